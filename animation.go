@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// findFilterEffect returns the effect of the first filter among filters with
+// the given effectid, or nil.
+func findFilterEffect(filters []Filter, effectID string) *Effect {
+	for i := range filters {
+		if effect := filters[i].Effect; effect != nil && strings.EqualFold(effect.EffectID, effectID) {
+			return effect
+		}
+	}
+	return nil
+}
+
+// filterEffect returns the effect of the first filter among filters with the
+// effectid of effect, appending an enabled filter with effect if there is
+// none.
+func filterEffect(filters []Filter, effect *Effect) ([]Filter, *Effect) {
+	if existing := findFilterEffect(filters, effect.EffectID); existing != nil {
+		return filters, existing
+	}
+	filters = append(filters, Filter{Enabled: newFCPBool(true), Effect: effect})
+	return filters, filters[len(filters)-1].Effect
+}
+
+// animatedValue returns the value of a numeric parameter divided by scale:
+// a float64 if it is constant, or if it is keyframed a list of keyframes,
+// each with its frame as "when", its value and, if it has one, its
+// "interpolation". ok is false if the parameter has no numeric value.
+func animatedValue(p *Parameter, scale float64) (value any, ok bool) {
+	if len(p.Keyframe) == 0 {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p.Value), 64)
+		if err != nil {
+			return nil, false
+		}
+		return v / scale, true
+	}
+	keyframes := make([]gotio.AnyDictionary, 0, len(p.Keyframe))
+	for _, k := range p.Keyframe {
+		v, err := strconv.ParseFloat(strings.TrimSpace(k.Value), 64)
+		if err != nil {
+			continue
+		}
+		keyframe := gotio.AnyDictionary{
+			"when":  k.When,
+			"value": v / scale,
+		}
+		if k.Interpolation != "" {
+			keyframe["interpolation"] = k.Interpolation
+		}
+		keyframes = append(keyframes, keyframe)
+	}
+	return keyframes, true
+}
+
+// setAnimatedValue writes a value made by animatedValue back to p, a float64
+// as a constant value and a list of keyframes as keyframes, multiplied by
+// scale. Values and keyframes that are unchanged are left as they were, so an
+// unedited parameter is re-emitted verbatim. Other values are ignored.
+func setAnimatedValue(p *Parameter, value any, scale float64) {
+	if v, ok := metadataFloat(value); ok {
+		p.Keyframe = nil
+		setScaledValue(&p.Value, v, scale)
+	} else if v, ok := metadataDicts(value); ok {
+		keyframes := make([]Keyframe, 0, len(v))
+		for _, keyframe := range v {
+			when, ok := metadataInt(keyframe["when"])
+			value, ok2 := metadataFloat(keyframe["value"])
+			if !ok || !ok2 {
+				continue
+			}
+			k := Keyframe{When: when}
+			// Keep the keyframe as read if only its value is restored
+			for _, existing := range p.Keyframe {
+				if existing.When == when {
+					k = existing
+					break
+				}
+			}
+			if interpolation, ok := keyframe["interpolation"].(string); ok {
+				k.Interpolation = interpolation
+			}
+			setScaledValue(&k.Value, value, scale)
+			keyframes = append(keyframes, k)
+		}
+		p.Keyframe = keyframes
+	}
+}
+
+// setScaledValue sets a parameter or keyframe value to value multiplied by
+// scale, unless it already holds it.
+func setScaledValue(text *string, value, scale float64) {
+	if current, err := strconv.ParseFloat(strings.TrimSpace(*text), 64); err == nil && current/scale == value {
+		return
+	}
+	// Round away the error of scaling
+	*text = strconv.FormatFloat(math.Round(value*scale*1e6)/1e6, 'f', -1, 64)
+}
@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"encoding/xml"
+	"sort"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// setAttributesMetadata stores attributes that aren't otherwise modeled,
+// such as Premiere's MZ.TrackTargeted or explodedTracks, as
+// fcp7xml_attributes metadata mapping their names to their values, if
+// there are any. Namespace declarations are left out. metadata must not be
+// nil.
+func setAttributesMetadata(metadata gotio.AnyDictionary, attrs []xml.Attr) {
+	attributes := make(gotio.AnyDictionary)
+	for _, attr := range attrs {
+		if attr.Name.Space != "" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		attributes[attr.Name.Local] = attr.Value
+	}
+	if len(attributes) > 0 {
+		metadata["fcp7xml_attributes"] = attributes
+	}
+}
+
+// metadataToAttributes returns the attributes stored by the decoder, in name
+// order.
+func metadataToAttributes(metadata gotio.AnyDictionary) []xml.Attr {
+	attributes, _ := metadataDict(metadata["fcp7xml_attributes"])
+	names := make([]string, 0, len(attributes))
+	for name, value := range attributes {
+		if _, ok := value.(string); ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	attrs := make([]xml.Attr, len(names))
+	for i, name := range names {
+		attrs[i] = xml.Attr{Name: xml.Name{Local: name}, Value: attributes[name].(string)}
+	}
+	return attrs
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import "github.com/Avalanche-io/gotio"
+
+// audioFilter describes one of FCP7's standard audio filters, whose single
+// parameter is summarized in clip metadata.
+type audioFilter struct {
+	key         string // metadata key; keyframes add "_keyframes"
+	effectID    string
+	name        string
+	parameterID string
+	parameter   string // name of the parameter
+	min, max    float64
+}
+
+// audioFilters are the Audio Levels filter, whose level is a linear gain, 1
+// being 0 dB, up to 3.98109 (+12 dB), and the Audio Pan filter, from -1
+// (left) to 1 (right).
+var audioFilters = []audioFilter{
+	{"fcp7xml_audio_level", "audiolevels", "Audio Levels", "level", "Level", 0.00001, 3.98109},
+	{"fcp7xml_audio_pan", "audiopan", "Audio Pan", "pan", "Pan", -1, 1},
+}
+
+// audioFiltersToMetadata stores the level of the Audio Levels filter and the
+// pan of the Audio Pan filter among filters as metadata, as opacity is: a
+// constant value as fcp7xml_audio_level or fcp7xml_audio_pan, and a keyframed
+// one as fcp7xml_audio_level_keyframes or fcp7xml_audio_pan_keyframes. The
+// filters themselves are still kept in full under fcp7xml_filters.
+func audioFiltersToMetadata(filters []Filter, metadata gotio.AnyDictionary) {
+	for _, f := range audioFilters {
+		effect := findFilterEffect(filters, f.effectID)
+		if effect == nil {
+			continue
+		}
+		p := findParameter(effect, f.parameterID)
+		if p == nil {
+			continue
+		}
+		value, _ := animatedValue(p, 1)
+		switch value := value.(type) {
+		case float64:
+			metadata[f.key] = value
+		case []gotio.AnyDictionary:
+			metadata[f.key+"_keyframes"] = value
+		}
+	}
+}
+
+// applyAudioFilters writes audio level and pan metadata back to the Audio
+// Levels and Audio Pan filters in filters, adding them if there are none.
+// Unchanged values and keyframes are left as they were.
+func applyAudioFilters(filters []Filter, metadata gotio.AnyDictionary) []Filter {
+	for _, f := range audioFilters {
+		value, ok := metadataFloat(metadata[f.key])
+		var level any = value
+		if !ok {
+			keyframes, ok := metadataDicts(metadata[f.key+"_keyframes"])
+			if !ok {
+				continue
+			}
+			level = keyframes
+		}
+
+		valueMin, valueMax := f.min, f.max
+		var effect *Effect
+		filters, effect = filterEffect(filters, &Effect{
+			Name:           f.name,
+			EffectID:       f.effectID,
+			EffectCategory: f.effectID,
+			EffectType:     f.effectID,
+			MediaType:      "audio",
+			Parameter: []Parameter{{
+				ParameterID: f.parameterID,
+				Name:        f.parameter,
+				ValueMin:    &valueMin,
+				ValueMax:    &valueMax,
+			}},
+		})
+		setAnimatedValue(parameterFor(effect, f.parameterID), level, 1)
+	}
+	return filters
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// CharsetReader converts input declared in the given character set to UTF-8.
+// It is used for documents whose XML declaration names an encoding other than
+// UTF-8, and supports ISO-8859-1 (latin-1) and Mac OS Roman ("macintosh"),
+// the encodings written by FCP7 on localized systems. It can be called from a
+// DecodeOptions.CharsetReader to fall back to the built-in encodings.
+func CharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "iso-8859-1", "iso8859-1", "iso_8859-1", "latin1", "latin-1", "l1",
+		"cp819", "ibm819", "csisolatin1", "us-ascii", "ascii":
+		return &singleByteReader{r: input}, nil
+	case "macintosh", "mac", "macroman", "mac-roman", "x-mac-roman", "csmacintosh":
+		return &singleByteReader{r: input, high: &macRomanHigh}, nil
+	}
+	return nil, fmt.Errorf("unsupported character encoding %q (supported: ISO-8859-1, macintosh; "+
+		"set DecodeOptions.CharsetReader to decode other encodings)", charset)
+}
+
+// newXMLDecoder returns an xml.Decoder for r that converts non-UTF-8 input
+// with opts.CharsetReader, or the built-in CharsetReader if it is nil.
+func newXMLDecoder(r io.Reader, opts DecodeOptions) *xml.Decoder {
+	decoder := xml.NewDecoder(r)
+	// No entities are expanded beyond the five predefined ones; DTD entity
+	// declarations are never read, so entity tricks can't inflate the input.
+	decoder.Entity = nil
+	decoder.CharsetReader = CharsetReader
+	if opts.CharsetReader != nil {
+		decoder.CharsetReader = opts.CharsetReader
+	}
+	return decoder
+}
+
+// singleByteReader converts a single-byte encoding to UTF-8. Bytes below 0x80
+// are ASCII; the rest are looked up in high, or taken as latin-1 code points
+// if high is nil.
+type singleByteReader struct {
+	r    io.Reader
+	high *[128]rune
+
+	in  [4096]byte
+	out []byte
+	err error
+}
+
+func (s *singleByteReader) Read(p []byte) (int, error) {
+	for len(s.out) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		var n int
+		n, s.err = s.r.Read(s.in[:])
+		for _, b := range s.in[:n] {
+			switch {
+			case b < 0x80:
+				s.out = append(s.out, b)
+			case s.high != nil:
+				s.out = utf8.AppendRune(s.out, s.high[b-0x80])
+			default:
+				s.out = utf8.AppendRune(s.out, rune(b))
+			}
+		}
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+// macRomanHigh maps bytes 0x80-0xFF of Mac OS Roman to Unicode.
+var macRomanHigh = [128]rune{
+	'Ä', 'Å', 'Ç', 'É', 'Ñ', 'Ö', 'Ü', 'á', 'à', 'â', 'ä', 'ã', 'å', 'ç', 'é', 'è',
+	'ê', 'ë', 'í', 'ì', 'î', 'ï', 'ñ', 'ó', 'ò', 'ô', 'ö', 'õ', 'ú', 'ù', 'û', 'ü',
+	'†', '°', '¢', '£', '§', '•', '¶', 'ß', '®', '©', '™', '´', '¨', '≠', 'Æ', 'Ø',
+	'∞', '±', '≤', '≥', '¥', 'µ', '∂', '∑', '∏', 'π', '∫', 'ª', 'º', 'Ω', 'æ', 'ø',
+	'¿', '¡', '¬', '√', 'ƒ', '≈', '∆', '«', '»', '…', '\u00a0', 'À', 'Ã', 'Õ', 'Œ', 'œ',
+	'–', '—', '“', '”', '‘', '’', '÷', '◊', 'ÿ', 'Ÿ', '⁄', '€', '‹', '›', 'ﬁ', 'ﬂ',
+	'‡', '·', '‚', '„', '‰', 'Â', 'Ê', 'Á', 'Ë', 'È', 'Í', 'Î', 'Ï', 'Ì', 'Ó', 'Ô',
+	'\uf8ff', 'Ò', 'Ú', 'Û', 'Ù', 'ı', 'ˆ', '˜', '¯', '˘', '˙', '˚', '¸', '˝', '˛', 'ˇ',
+}
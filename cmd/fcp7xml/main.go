@@ -4,18 +4,26 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/Avalanche-io/gotio"
 	"github.com/Avalanche-io/otio-fcp7xml"
 )
 
 func main() {
 	var (
-		input  = flag.String("i", "", "Input FCP7 XML file")
-		output = flag.String("o", "", "Output file (optional, prints to stdout if not specified)")
+		input   = flag.String("i", "", "Input FCP7 XML or OTIO JSON file")
+		output  = flag.String("o", "", "Output file (optional, prints to stdout if not specified)")
+		asJSON  = flag.Bool("json", false, "Write the decoded timeline as OTIO JSON")
+		from    = flag.String("from", "", "Input format: fcp7xml or json (default: detected from extension)")
+		verbose = flag.Bool("v", false, "Print the decoder's warnings to stderr as they are found")
 	)
 
 	flag.Usage = func() {
@@ -26,8 +34,14 @@ func main() {
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  # Read and validate FCP7 XML\n")
 		fmt.Fprintf(os.Stderr, "  %s -i sequence.xml\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  # Show what the decoder skipped or assumed\n")
+		fmt.Fprintf(os.Stderr, "  %s -v -i sequence.xml\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  # Convert FCP7 XML to normalized format\n")
 		fmt.Fprintf(os.Stderr, "  %s -i input.xml -o output.xml\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  # Convert FCP7 XML to OTIO JSON\n")
+		fmt.Fprintf(os.Stderr, "  %s -i input.xml -json -o output.otio\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  # Convert OTIO JSON to FCP7 XML\n")
+		fmt.Fprintf(os.Stderr, "  %s -i input.otio -o output.xml\n\n", os.Args[0])
 	}
 
 	flag.Parse()
@@ -37,6 +51,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	format := *from
+	if format == "" {
+		format = detectFormat(*input)
+	}
+
 	// Open input file
 	inFile, err := os.Open(*input)
 	if err != nil {
@@ -44,11 +63,31 @@ func main() {
 	}
 	defer inFile.Close()
 
-	// Decode FCP7 XML
-	decoder := fcp7xml.NewDecoder(inFile)
-	timeline, err := decoder.Decode()
-	if err != nil {
-		log.Fatalf("Failed to decode FCP7 XML: %v", err)
+	var timeline *gotio.Timeline
+	switch format {
+	case "json":
+		timeline, err = readJSON(inFile)
+		if err != nil {
+			log.Fatalf("Failed to read OTIO JSON: %v", err)
+		}
+
+	case "fcp7xml", "xml":
+		// Decode FCP7 XML
+		var opts fcp7xml.DecodeOptions
+		if *verbose {
+			opts.Diagnostics = os.Stderr
+		}
+		decoder := fcp7xml.NewDecoderWithOptions(inFile, opts)
+		timeline, err = decoder.Decode()
+		if errors.Is(err, fcp7xml.ErrFCPXMLNotSupported) {
+			log.Fatalf("%s: %v", *input, err)
+		}
+		if err != nil {
+			log.Fatalf("Failed to decode FCP7 XML: %v", err)
+		}
+
+	default:
+		log.Fatalf("Unknown input format %q (expected fcp7xml or json)", format)
 	}
 
 	// Print timeline info
@@ -61,6 +100,37 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Duration: %s\n", duration.String())
 	}
 
+	// Dump OTIO JSON to the output file, or stdout if none is specified
+	if *asJSON {
+		var w io.Writer = os.Stdout
+		if *output != "" {
+			outFile, err := os.Create(*output)
+			if err != nil {
+				log.Fatalf("Failed to create output file: %v", err)
+			}
+			defer outFile.Close()
+			w = outFile
+		}
+
+		if err := writeJSON(w, timeline); err != nil {
+			log.Fatalf("Failed to write OTIO JSON: %v", err)
+		}
+
+		if *output != "" {
+			fmt.Fprintf(os.Stderr, "Successfully wrote: %s\n", *output)
+		}
+		return
+	}
+
+	// OTIO JSON input is always converted, to stdout if no output is specified
+	if *output == "" && format == "json" {
+		encoder := fcp7xml.NewEncoder(os.Stdout)
+		if err := encoder.Encode(timeline); err != nil {
+			log.Fatalf("Failed to encode FCP7 XML: %v", err)
+		}
+		return
+	}
+
 	// If output is specified, encode back to FCP7 XML
 	if *output != "" {
 		outFile, err := os.Create(*output)
@@ -77,3 +147,41 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Successfully wrote: %s\n", *output)
 	}
 }
+
+// writeJSON serializes a timeline as indented OTIO JSON.
+func writeJSON(w io.Writer, timeline *gotio.Timeline) error {
+	data, err := gotio.ToJSONString(timeline, "  ")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, data+"\n")
+	return err
+}
+
+// detectFormat guesses the input format from a file's extension.
+func detectFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".otio", ".json":
+		return "json"
+	}
+	return "fcp7xml"
+}
+
+// readJSON deserializes an OTIO JSON document holding a timeline.
+func readJSON(r io.Reader) (*gotio.Timeline, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := gotio.FromJSONString(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	timeline, ok := obj.(*gotio.Timeline)
+	if !ok {
+		return nil, fmt.Errorf("expected a Timeline, got %s", obj.SchemaName())
+	}
+	return timeline, nil
+}
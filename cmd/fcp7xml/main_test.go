@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/Avalanche-io/otio-fcp7xml"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, name := range []string{"features_test.xml", "premiere_example.xml", "multiclip.xml", "audio_outputs.xml"} {
+		data, err := os.ReadFile("../../testdata/" + name)
+		if err != nil {
+			t.Fatalf("Failed to read test file: %v", err)
+		}
+		timeline, err := fcp7xml.NewDecoder(bytes.NewReader(data)).Decode()
+		if err != nil {
+			t.Fatalf("%s: Decode failed: %v", name, err)
+		}
+		var expected bytes.Buffer
+		if err := fcp7xml.NewEncoder(&expected).Encode(timeline); err != nil {
+			t.Fatalf("%s: Encode failed: %v", name, err)
+		}
+
+		// XML to JSON to XML, as with -json and then -i output.otio
+		var otio bytes.Buffer
+		if err := writeJSON(&otio, timeline); err != nil {
+			t.Fatalf("%s: writeJSON failed: %v", name, err)
+		}
+		read, err := readJSON(&otio)
+		if err != nil {
+			t.Fatalf("%s: readJSON failed: %v", name, err)
+		}
+		var encoded bytes.Buffer
+		if err := fcp7xml.NewEncoder(&encoded).Encode(read); err != nil {
+			t.Fatalf("%s: Encode failed: %v", name, err)
+		}
+
+		if encoded.String() != expected.String() {
+			t.Errorf("%s: Expected the XML written from JSON to match, got\n%s\nwant\n%s", name, encoded.String(), expected.String())
+		}
+	}
+}
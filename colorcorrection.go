@@ -0,0 +1,204 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"encoding/xml"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// colorCorrector3WayID is the effectid of FCP7's three-way color corrector.
+const colorCorrector3WayID = "Color Corrector 3-way"
+
+// colorCorrectionRanges maps the lift/gamma/gain entries of
+// fcp7xml_color_correction to the corrector's balance and level parameters.
+var colorCorrectionRanges = []struct {
+	key, balance, level string
+}{
+	{"lift", "blackbalance", "blacklevel"},
+	{"gamma", "midbalance", "midlevel"},
+	{"gain", "whitebalance", "whitelevel"},
+}
+
+// balanceComponentOrder is the order in which known components of a
+// structured value are written; others follow in name order.
+var balanceComponentOrder = []string{"horiz", "vert", "alpha", "red", "green", "blue"}
+
+// findColorCorrector returns the first three-way color corrector among
+// filters, or nil.
+func findColorCorrector(filters []Filter) *Effect {
+	return findFilterEffect(filters, colorCorrector3WayID)
+}
+
+// findParameter returns the parameter of effect with the given id, or nil.
+func findParameter(effect *Effect, id string) *Parameter {
+	for i := range effect.Parameter {
+		if effect.Parameter[i].ParameterID == id {
+			return &effect.Parameter[i]
+		}
+	}
+	return nil
+}
+
+// colorCorrectionToMetadata summarizes a three-way color corrector as
+// lift/gamma/gain and saturation. It returns nil if filters has none. The
+// filter itself is still kept in full under fcp7xml_filters.
+func colorCorrectionToMetadata(filters []Filter) gotio.AnyDictionary {
+	effect := findColorCorrector(filters)
+	if effect == nil {
+		return nil
+	}
+
+	metadata := make(gotio.AnyDictionary)
+	for _, r := range colorCorrectionRanges {
+		entry := make(gotio.AnyDictionary)
+		if p := findParameter(effect, r.balance); p != nil {
+			if components := parseValueComponents(p.ValueXML); len(components) > 0 {
+				balance := make(gotio.AnyDictionary, len(components))
+				for name, value := range components {
+					balance[name] = value
+				}
+				entry["balance"] = balance
+			}
+		}
+		if p := findParameter(effect, r.level); p != nil {
+			if level, err := strconv.ParseFloat(strings.TrimSpace(p.Value), 64); err == nil {
+				entry["level"] = level
+			}
+		}
+		if len(entry) > 0 {
+			metadata[r.key] = entry
+		}
+	}
+	if p := findParameter(effect, "saturation"); p != nil {
+		if saturation, err := strconv.ParseFloat(strings.TrimSpace(p.Value), 64); err == nil {
+			metadata["saturation"] = saturation
+		}
+	}
+	return metadata
+}
+
+// applyColorCorrection writes the lift/gamma/gain and saturation values of
+// fcp7xml_color_correction metadata back to the three-way color corrector in
+// filters, adding one if there is none. Parameters whose value is unchanged
+// are left as they were, so an unedited filter is re-emitted verbatim.
+func applyColorCorrection(filters []Filter, metadata gotio.AnyDictionary) []Filter {
+	effect := findColorCorrector(filters)
+	if effect == nil {
+		filters = append(filters, Filter{
+			Enabled: newFCPBool(true),
+			Effect: &Effect{
+				Name:           colorCorrector3WayID,
+				EffectID:       colorCorrector3WayID,
+				EffectCategory: "Color Correction",
+				EffectType:     "filter",
+				MediaType:      "video",
+			},
+		})
+		effect = filters[len(filters)-1].Effect
+	}
+
+	for _, r := range colorCorrectionRanges {
+		entry, ok := metadataDict(metadata[r.key])
+		if !ok {
+			continue
+		}
+		if balance, ok := metadataDict(entry["balance"]); ok {
+			components := make(map[string]float64, len(balance))
+			for name, value := range balance {
+				if v, ok := metadataFloat(value); ok {
+					components[name] = v
+				}
+			}
+			p := parameterFor(effect, r.balance)
+			if !maps.Equal(parseValueComponents(p.ValueXML), components) {
+				p.Value = ""
+				p.ValueXML = formatValueComponents(components)
+			}
+		}
+		if level, ok := metadataFloat(entry["level"]); ok {
+			setFloatParameter(parameterFor(effect, r.level), level)
+		}
+	}
+	if saturation, ok := metadataFloat(metadata["saturation"]); ok {
+		setFloatParameter(parameterFor(effect, "saturation"), saturation)
+	}
+	return filters
+}
+
+// parameterFor returns the parameter of effect with the given id, adding it
+// if it doesn't exist.
+func parameterFor(effect *Effect, id string) *Parameter {
+	if p := findParameter(effect, id); p != nil {
+		return p
+	}
+	effect.Parameter = append(effect.Parameter, Parameter{ParameterID: id, Name: id})
+	return &effect.Parameter[len(effect.Parameter)-1]
+}
+
+// setFloatParameter sets a scalar parameter unless it already holds value.
+func setFloatParameter(p *Parameter, value float64) {
+	if current, err := strconv.ParseFloat(strings.TrimSpace(p.Value), 64); err == nil && current == value {
+		return
+	}
+	p.Value = strconv.FormatFloat(value, 'f', -1, 64)
+	p.ValueXML = ""
+}
+
+// parseValueComponents reads the numeric child elements of a structured
+// parameter value, e.g. <horiz>0.1</horiz><vert>-0.2</vert>.
+func parseValueComponents(valueXML string) map[string]float64 {
+	if valueXML == "" {
+		return nil
+	}
+	var value struct {
+		Components []struct {
+			XMLName xml.Name
+			Text    string `xml:",chardata"`
+		} `xml:",any"`
+	}
+	if err := xml.Unmarshal([]byte("<value>"+valueXML+"</value>"), &value); err != nil {
+		return nil
+	}
+	components := make(map[string]float64, len(value.Components))
+	for _, c := range value.Components {
+		if v, err := strconv.ParseFloat(strings.TrimSpace(c.Text), 64); err == nil {
+			components[c.XMLName.Local] = v
+		}
+	}
+	return components
+}
+
+// formatValueComponents writes components as the content of a structured
+// parameter value.
+func formatValueComponents(components map[string]float64) string {
+	var names []string
+	for _, name := range balanceComponentOrder {
+		if _, ok := components[name]; ok {
+			names = append(names, name)
+		}
+	}
+	var others []string
+	for name := range components {
+		if !slices.Contains(balanceComponentOrder, name) {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	names = append(names, others...)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString("<" + name + ">")
+		b.WriteString(strconv.FormatFloat(components[name], 'f', -1, 64))
+		b.WriteString("</" + name + ">")
+	}
+	return b.String()
+}
@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"fmt"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// TimelineFromXMEML converts the first sequence of an already parsed
+// document to an OTIO Timeline, as Decode does. References to files defined
+// elsewhere in the document are resolved in x itself.
+func TimelineFromXMEML(x *XMEML) (*gotio.Timeline, error) {
+	if x == nil {
+		return nil, fmt.Errorf("xmeml cannot be nil")
+	}
+	version, err := parseVersion(x.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Decoder{}
+	sequences, err := d.loadSequences(x, version)
+	if err != nil {
+		return nil, err
+	}
+	return d.convertSequence(sequences[0].sequence, sequences[0].binPath)
+}
+
+// XMEMLFromTimeline converts an OTIO Timeline to the FCP7 document Encode
+// would write, without writing it.
+func XMEMLFromTimeline(t *gotio.Timeline) (*XMEML, error) {
+	if t == nil {
+		return nil, fmt.Errorf("timeline cannot be nil")
+	}
+	e := &Encoder{}
+	xmeml, err := e.convertTimeline(t)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert timeline: %w", err)
+	}
+	return xmeml, nil
+}
@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTimelineFromXMEML(t *testing.T) {
+	data, err := os.ReadFile("testdata/sample.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	var x XMEML
+	if err := xml.Unmarshal(data, &x); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+
+	timeline, err := TimelineFromXMEML(&x)
+	if err != nil {
+		t.Fatalf("TimelineFromXMEML failed: %v", err)
+	}
+	decoded, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	// Both timelines encode the same
+	var got, expected bytes.Buffer
+	if err := NewEncoder(&got).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if err := NewEncoder(&expected).Encode(decoded); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if got.String() != expected.String() {
+		t.Errorf("Expected the timeline Decode returns, got:\n%s\nexpected:\n%s", got.String(), expected.String())
+	}
+
+	if _, err := TimelineFromXMEML(&XMEML{Version: "5"}); err == nil || !strings.Contains(err.Error(), "no sequence") {
+		t.Errorf("Expected an error for a document without sequences, got %v", err)
+	}
+	if _, err := TimelineFromXMEML(nil); err == nil {
+		t.Error("Expected an error for a nil document")
+	}
+}
+
+func TestXMEMLFromTimeline(t *testing.T) {
+	data, err := os.ReadFile("testdata/sample.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	x, err := XMEMLFromTimeline(timeline)
+	if err != nil {
+		t.Fatalf("XMEMLFromTimeline failed: %v", err)
+	}
+	if len(x.Sequence) != 1 || x.Sequence[0].Name != timeline.Name() {
+		t.Fatalf("Expected one sequence named '%s', got %+v", timeline.Name(), x.Sequence)
+	}
+
+	// The document is the one Encode writes
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	marshaled, err := xml.MarshalIndent(x, "", "  ")
+	if err != nil {
+		t.Fatalf("Failed to marshal XMEML: %v", err)
+	}
+	if !strings.Contains(buf.String(), string(marshaled)) {
+		t.Errorf("Expected the document Encode writes, got:\n%s", marshaled)
+	}
+
+	if _, err := XMEMLFromTimeline(nil); err == nil {
+		t.Error("Expected an error for a nil timeline")
+	}
+}
+
+func TestTimelineFromXMEMLLeavesDocument(t *testing.T) {
+	var x XMEML
+	if err := xml.Unmarshal([]byte(joinedTransitionsXML), &x); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+	original := x.Sequence[0].Media.Video.Track[0].ClipItem[1]
+
+	// Converting the same document twice gives the same timeline
+	var encoded [2]bytes.Buffer
+	for i := range encoded {
+		timeline, err := TimelineFromXMEML(&x)
+		if err != nil {
+			t.Fatalf("TimelineFromXMEML failed: %v", err)
+		}
+		if err := NewEncoder(&encoded[i]).Encode(timeline); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+	}
+	if encoded[0].String() != encoded[1].String() {
+		t.Errorf("Expected the same timeline from both conversions, got:\n%s\nand:\n%s", encoded[0].String(), encoded[1].String())
+	}
+
+	item := x.Sequence[0].Media.Video.Track[0].ClipItem[1]
+	if item.Start != original.Start || item.End != original.End || item.In != original.In || item.Out != original.Out {
+		t.Errorf("Expected %s to keep start/end %d-%d and in/out %d-%d, got %d-%d and %d-%d", item.Name,
+			original.Start, original.End, original.In, original.Out, item.Start, item.End, item.In, item.Out)
+	}
+}
+
+func TestTimelineFromXMEMLLeavesRate(t *testing.T) {
+	const doc = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>No Rate</name>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>Shot</name>
+            <rate><timebase>25</timebase><ntsc>FALSE</ntsc></rate>
+            <start>0</start>
+            <end>50</end>
+            <in>10</in>
+            <out>60</out>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+	var x XMEML
+	if err := xml.Unmarshal([]byte(doc), &x); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+
+	timeline, err := TimelineFromXMEML(&x)
+	if err != nil {
+		t.Fatalf("TimelineFromXMEML failed: %v", err)
+	}
+	duration, err := timeline.Duration()
+	if err != nil || duration.Rate() != 25 {
+		t.Errorf("Expected the timeline at the assumed rate of 25 fps, got %v (%v)", duration, err)
+	}
+
+	// The assumed rate isn't written into the document
+	if rate := x.Sequence[0].Rate; rate.Timebase != 0 {
+		t.Errorf("Expected the sequence to be left without a rate, got %s", formatRate(&rate))
+	}
+}
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import "github.com/Avalanche-io/gotio"
+
+// cropID is the effectid of FCP7's crop filter.
+const cropID = "crop"
+
+// cropParameters are the parameters of the crop filter, each a percentage
+// from 0 to 100, in the order FCP7 writes them, with their names.
+var cropParameters = []struct {
+	id, name string
+}{
+	{"left", "left"},
+	{"right", "right"},
+	{"top", "top"},
+	{"bottom", "bottom"},
+	{"edgefeather", "edge feather"},
+}
+
+// cropToMetadata summarizes the crop filter among filters as a dictionary
+// holding each of its parameters, by parameterid, as animatedValue returns
+// it. It returns nil if filters has none. The filter itself is still kept
+// in full under fcp7xml_filters.
+func cropToMetadata(filters []Filter) gotio.AnyDictionary {
+	effect := findFilterEffect(filters, cropID)
+	if effect == nil {
+		return nil
+	}
+	metadata := make(gotio.AnyDictionary)
+	for _, c := range cropParameters {
+		if p := findParameter(effect, c.id); p != nil {
+			if value, ok := animatedValue(p, 1); ok {
+				metadata[c.id] = value
+			}
+		}
+	}
+	return metadata
+}
+
+// applyCrop writes the values of fcp7xml_crop metadata back to the crop
+// filter in filters, adding one if there is none. Unchanged values are left
+// as they were, so an unedited filter is re-emitted verbatim.
+func applyCrop(filters []Filter, metadata gotio.AnyDictionary) []Filter {
+	filters, effect := filterEffect(filters, &Effect{
+		Name:           "Crop",
+		EffectID:       cropID,
+		EffectCategory: "motion",
+		EffectType:     "motion",
+		MediaType:      "video",
+	})
+	for _, c := range cropParameters {
+		value, ok := metadata[c.id]
+		if !ok {
+			continue
+		}
+		p := findParameter(effect, c.id)
+		if p == nil {
+			valueMin, valueMax := 0.0, 100.0
+			effect.Parameter = append(effect.Parameter, Parameter{
+				ParameterID: c.id,
+				Name:        c.name,
+				ValueMin:    &valueMin,
+				ValueMax:    &valueMax,
+			})
+			p = &effect.Parameter[len(effect.Parameter)-1]
+		}
+		setAnimatedValue(p, value, 1)
+	}
+	return filters
+}
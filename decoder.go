@@ -4,17 +4,198 @@
 package fcp7xml
 
 import (
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/Avalanche-io/gotio/opentime"
 	"github.com/Avalanche-io/gotio"
 )
 
+// ErrFCPXMLNotSupported is returned when the input is an FCPXML document
+// (Final Cut Pro X, root element <fcpxml>) rather than FCP7 XML (<xmeml>).
+var ErrFCPXMLNotSupported = errors.New("input is FCPXML (Final Cut Pro X), not FCP7 XML (xmeml): " +
+	"export the project as \"Final Cut Pro 7 XML\" instead, or convert the .fcpxml with a tool " +
+	"such as Xto7 or the OpenTimelineIO fcpx_xml adapter")
+
+// DecodeOptions configures optional Decoder behavior. The zero value decodes
+// exactly like NewDecoder.
+type DecodeOptions struct {
+	// Strict makes the decoder return an error for input it would otherwise
+	// tolerate, such as clipitems without a frame rate or with out before in.
+	// Timing inconsistencies (see TimingError) are joined into a single error
+	// listing every finding; without Strict they are reported as warnings.
+	Strict bool
+
+	// ExpandNestedSequences converts nested sequences into OTIO Stacks holding
+	// the nested tracks, instead of placeholder clips with a MissingReference.
+	ExpandNestedSequences bool
+
+	// RepairRateMismatch recomputes the in/out points of a clipitem whose rate
+	// differs from its file's rate in the file's rate, when the result fits
+	// within the file's duration. Mismatches are reported as warnings either way.
+	RepairRateMismatch bool
+
+	// PadToSequenceDuration appends a trailing Gap to every track that ends
+	// before the sequence's declared <duration>, so that the timeline keeps
+	// intentional blank space at its end. Without it the timeline is only as
+	// long as its content.
+	PadToSequenceDuration bool
+
+	// CharsetReader, if non-nil, converts documents whose XML declaration
+	// names an encoding other than UTF-8. It replaces the package's
+	// CharsetReader, which handles ISO-8859-1 and macintosh (Mac OS Roman).
+	CharsetReader func(charset string, input io.Reader) (io.Reader, error)
+
+	// Sidecar, if non-nil, receives the parsed document as a JSON Sidecar
+	// when Decode or DecodeAll reads it. Passing the sidecar to the encoder
+	// in EncodeOptions.Sidecar restores the details OTIO can't hold.
+	Sidecar io.Writer
+
+	// Diagnostics, if non-nil, receives every warning as a line of text as
+	// soon as it is found, in addition to Warnings().
+	Diagnostics io.Writer
+
+	// MaxElements, MaxClipItems and MaxSequences limit the number of XML
+	// elements, <clipitem> elements and <sequence> elements in the
+	// document, MaxFileSizeBytes its size, and MaxNestingDepth how deeply
+	// sequences may be nested inside clipitems, so that hostile input can't
+	// exhaust memory or the stack. Zero selects the corresponding Default
+	// constant, and a negative value removes the limit. Exceeding any of
+	// them fails with a *LimitError, which matches ErrLimitExceeded.
+	MaxElements      int
+	MaxNestingDepth  int
+	MaxClipItems     int
+	MaxSequences     int
+	MaxFileSizeBytes int64
+
+	// Progress, if non-nil, is called as the document is converted: with
+	// ProgressSequences after each sequence, ProgressTracks after each track
+	// of a sequence, and ProgressItems every progressInterval items of a
+	// track and after its last. done counts up to total within each
+	// sequence or track; total is 0 where it isn't known, as for the tracks
+	// of a streamed sequence. Nested sequences aren't reported separately.
+	Progress func(stage string, done, total int)
+
+	// MediaReferenceKey is the key under which each clip's media reference
+	// is stored, and made active; gotio.DefaultMediaKey if empty. Decoding
+	// proxy and online versions of a sequence under different keys lets
+	// their references be combined into the clips of one timeline.
+	MediaReferenceKey string
+
+	// FilelessClipsAsGaps decodes clipitems with neither a <file> nor a
+	// nested <sequence>, which some tools write as placeholders for empty
+	// space, as Gaps of the same length rather than Clips with a
+	// MissingReference. Everything else about such a clipitem, including its
+	// name and id, is dropped.
+	FilelessClipsAsGaps bool
+
+	// TargetRate, if positive, is the frame rate every time in the decoded
+	// timeline is converted to, so that material of mixed rates is all
+	// expressed in one. Times keep what they come to in seconds: a clip 48
+	// frames long at 24 fps lasts 50 frames at 25. Frame numbers kept in
+	// metadata, such as those of keyframes, are left as read.
+	TargetRate float64
+
+	// Namespace selects the metadata layout written for details OTIO has no
+	// field for. The fcp7xml_* keys are always written.
+	Namespace MetadataNamespace
+
+	// BaseDir, if set, is the directory relative <pathurl> values are
+	// resolved against, making them absolute file:// URLs, such as the
+	// directory of the document when it was moved together with its media.
+	// Absolute URLs and paths are left as they are.
+	BaseDir string
+}
+
+// Progress stages; see DecodeOptions.Progress.
+const (
+	ProgressSequences = "sequences"
+	ProgressTracks    = "tracks"
+	ProgressItems     = "items"
+)
+
+// progressInterval is the number of items converted between calls to
+// DecodeOptions.Progress.
+const progressInterval = 100
+
+// Warning categories.
+const (
+	WarningRateMismatch        = "rate_mismatch"
+	WarningTimingInconsistency = "timing_inconsistency"
+	WarningMissingMedia        = "missing_media"
+	WarningNestedSequence      = "nested_sequence"
+	WarningUnknownStart        = "unknown_start"
+	WarningClampedMarker       = "clamped_marker"
+	WarningTrackReclassified   = "track_reclassified"
+	WarningMissingRate         = "missing_rate"
+	WarningMalformedPathURL    = "malformed_pathurl"
+)
+
+// Warning describes a non-fatal problem found while decoding.
+type Warning struct {
+	Category string
+	Message  string
+
+	// Path locates the offending element by the names of the sequence,
+	// track and item containing it, joined with "/", e.g.
+	// "My Sequence/Video 1/Clip A". Nested sequences add further levels.
+	Path string
+}
+
+// String returns the warning as "category: message", prefixed with the
+// path when there is one.
+func (w Warning) String() string {
+	if w.Path != "" {
+		return w.Path + ": " + w.Category + ": " + w.Message
+	}
+	return w.Category + ": " + w.Message
+}
+
 // Decoder decodes Final Cut Pro 7 XML into OTIO Timeline.
 type Decoder struct {
-	r io.Reader
+	r    io.Reader
+	opts DecodeOptions
+
+	// ctx is the context of the decode in progress, and converted counts the
+	// clipitems converted so far, for checking it
+	ctx       context.Context
+	converted int
+
+	// sequences maps sequence ids to their full definitions
+	sequences map[string]*Sequence
+	// expanding holds the nested sequences currently being expanded
+	expanding map[*Sequence]bool
+	// files maps file ids to the first full definition of each file
+	files map[string]*File
+	// linkGroups maps the ids of linked clipitems to their link group, and
+	// stereoItems and mergedItems hold the two halves of stereo pairs; see
+	// findStereoPairs
+	linkGroups  map[string]string
+	stereoItems map[*ClipItem]bool
+	mergedItems map[*ClipItem]bool
+	// linkedClips, when streaming, maps clipitem ids to the clips converted
+	// from them before the link groups of the sequence are known
+	linkedClips map[string][]*gotio.Clip
+
+	// version is the xmeml version of the document, or 0 if unknown
+	version int
+	// sequenceAnamorphic is the anamorphic setting of the sequence being
+	// converted's format, or "" if it has none
+	sequenceAnamorphic string
+
+	warnings []Warning
+	// path holds the names of the elements being converted, for warnings
+	path []string
+	// scope locates the sequence and track being converted, for errors
+	scope decodeScope
 }
 
 // NewDecoder creates a new FCP7 XML decoder.
@@ -22,59 +203,658 @@ func NewDecoder(r io.Reader) *Decoder {
 	return &Decoder{r: r}
 }
 
-// Decode parses FCP7 XML and returns an OTIO Timeline.
+// NewDecoderWithOptions creates a new FCP7 XML decoder configured by opts.
+func NewDecoderWithOptions(r io.Reader, opts DecodeOptions) *Decoder {
+	return &Decoder{r: r, opts: opts}
+}
+
+// Decode parses FCP7 XML and returns an OTIO Timeline for the first sequence
+// in it. Use DecodeAll to convert every sequence.
+//
+// The sequence is read one track at a time, and each track converted as
+// soon as it has been read, so that memory use stays bounded for very large
+// sequences. A track is held back until the sequence has been read only
+// when it needs something further on: a file or nested sequence defined
+// later, or the other channel of a stereo pair.
 func (d *Decoder) Decode() (*gotio.Timeline, error) {
+	return d.DecodeContext(context.Background())
+}
+
+// DecodeContext is like Decode, but gives up and returns ctx.Err() once ctx
+// is done. The context is checked as the document is read, between tracks,
+// and every contextCheckInterval clipitems.
+func (d *Decoder) DecodeContext(ctx context.Context) (*gotio.Timeline, error) {
+	d.ctx = ctx
+	timeline, err := d.decodeStreaming()
+	if err != nil {
+		return nil, d.contextError(err)
+	}
+	d.progress(ProgressSequences, 1, 1)
+	return timeline, nil
+}
+
+// progress reports progress to DecodeOptions.Progress, if it is set, unless
+// a nested sequence is being converted.
+func (d *Decoder) progress(stage string, done, total int) {
+	if d.opts.Progress != nil && len(d.expanding) == 0 {
+		d.opts.Progress(stage, done, total)
+	}
+}
+
+// contextCheckInterval is the number of clipitems converted between checks
+// of the decode's context.
+const contextCheckInterval = 256
+
+// checkContext returns the error of the decode's context, if it is done.
+func (d *Decoder) checkContext() error {
+	if d.ctx == nil {
+		return nil
+	}
+	return d.ctx.Err()
+}
+
+// contextError returns the context's error in place of err, which it may
+// have caused, if the decode was cancelled.
+func (d *Decoder) contextError(err error) error {
+	if ctxErr := d.checkContext(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// reader returns the decoder's input, which fails once the decode's context
+// is done.
+func (d *Decoder) reader() io.Reader {
+	if d.ctx == nil {
+		return d.r
+	}
+	return &contextReader{ctx: d.ctx, r: d.r}
+}
+
+// contextReader is an io.Reader that fails with the context's error once the
+// context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// readSequences parses the document and prepares the decoder to convert
+// the sequences in it, which are returned in the order of collectSequences.
+func (d *Decoder) readSequences() ([]binSequence, error) {
 	var xmeml XMEML
-	decoder := xml.NewDecoder(d.r)
-	if err := decoder.Decode(&xmeml); err != nil {
+	decoder := d.xmlDecoder()
+	root, err := readRootElement(decoder)
+	if err != nil {
+		return nil, err
+	}
+	version, err := xmemlVersion(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.DecodeElement(&xmeml, &root); err != nil {
 		return nil, fmt.Errorf("failed to decode XML: %w", err)
 	}
+	if d.opts.Sidecar != nil {
+		if err := writeSidecar(d.opts.Sidecar, &xmeml); err != nil {
+			return nil, err
+		}
+	}
+	return d.loadSequences(&xmeml, version)
+}
 
-	if len(xmeml.Sequence) == 0 {
+// loadSequences prepares the decoder to convert the sequences in xmeml, a
+// document of the given version, and returns them in the order of
+// collectSequences.
+func (d *Decoder) loadSequences(xmeml *XMEML, version int) ([]binSequence, error) {
+	sequences := collectSequences(xmeml)
+	if len(sequences) == 0 {
 		return nil, fmt.Errorf("no sequence found in FCP7 XML")
 	}
+	for _, s := range sequences {
+		if err := checkNesting(s.sequence, 0, d.maxNestingDepth()); err != nil {
+			return nil, err
+		}
+	}
 
-	// For now, convert the first sequence
-	// In the future, we might want to handle multiple sequences
-	return d.convertSequence(&xmeml.Sequence[0])
+	all := make([]*Sequence, len(sequences))
+	for i, s := range sequences {
+		all[i] = s.sequence
+	}
+	d.prepare(all, version)
+	return sequences, nil
 }
 
-// convertSequence converts an FCP7 Sequence to an OTIO Timeline.
-func (d *Decoder) convertSequence(seq *Sequence) (*gotio.Timeline, error) {
-	timeline := gotio.NewTimeline(seq.Name, nil, nil)
+// Warnings returns the non-fatal problems found by the last decode.
+func (d *Decoder) Warnings() []Warning {
+	return d.warnings
+}
 
-	// Convert video tracks
-	if seq.Media.Video != nil {
-		for i, fcpTrack := range seq.Media.Video.Track {
-			track, err := d.convertTrack(&fcpTrack, &seq.Rate, gotio.TrackKindVideo, i)
-			if err != nil {
-				return nil, fmt.Errorf("failed to convert video track %d: %w", i, err)
-			}
-			if err := timeline.Tracks().AppendChild(track); err != nil {
-				return nil, fmt.Errorf("failed to append video track: %w", err)
-			}
+// warn records a non-fatal problem found in the element being converted.
+func (d *Decoder) warn(w Warning) {
+	if w.Path == "" {
+		w.Path = d.currentPath()
+	}
+	d.warnings = append(d.warnings, w)
+	if d.opts.Diagnostics != nil {
+		fmt.Fprintln(d.opts.Diagnostics, w)
+	}
+}
+
+// enter records that the named element is being converted, until leave.
+func (d *Decoder) enter(name string) {
+	d.path = append(d.path, name)
+}
+
+// leave undoes the last enter.
+func (d *Decoder) leave() {
+	d.path = d.path[:len(d.path)-1]
+}
+
+// currentPath returns the path of the element being converted.
+func (d *Decoder) currentPath() string {
+	return strings.Join(d.path, "/")
+}
+
+// prepare resets the decoder's per-document state for the given sequences
+// of an xmeml document of the given version.
+func (d *Decoder) prepare(sequences []*Sequence, version int) {
+	d.version = version
+	d.warnings = nil
+	d.path = nil
+
+	d.linkGroups = make(map[string]string)
+	d.stereoItems = make(map[*ClipItem]bool)
+	d.mergedItems = make(map[*ClipItem]bool)
+	d.linkedClips = nil
+
+	d.files = make(map[string]*File)
+	for _, seq := range sequences {
+		forEachClipItem(seq, d.indexFile)
+	}
+	for _, seq := range sequences {
+		forEachClipItem(seq, d.resolveFile)
+	}
+
+	if d.opts.ExpandNestedSequences {
+		d.sequences = make(map[string]*Sequence)
+		d.expanding = make(map[*Sequence]bool)
+		for _, seq := range sequences {
+			d.indexSequences(seq)
 		}
 	}
+}
 
-	// Convert audio tracks
-	if seq.Media.Audio != nil {
-		for i, fcpTrack := range seq.Media.Audio.Track {
-			track, err := d.convertTrack(&fcpTrack, &seq.Rate, gotio.TrackKindAudio, i)
-			if err != nil {
-				return nil, fmt.Errorf("failed to convert audio track %d: %w", i, err)
+// Sniff reads the start of r and reports whether it looks like an FCP7 XML
+// document. It returns nil for an <xmeml> root, ErrFCPXMLNotSupported for
+// FCPXML input, and a descriptive error for anything else.
+func Sniff(r io.Reader) error {
+	root, err := readRootElement(newXMLDecoder(r, DecodeOptions{}))
+	if err != nil {
+		return err
+	}
+	if root.Name.Local != "xmeml" {
+		return fmt.Errorf("unexpected root element <%s>, expected <xmeml>", root.Name.Local)
+	}
+	return nil
+}
+
+// latestVersion is the newest xmeml version, written by FCP7.
+const latestVersion = 5
+
+// fileRateVersion is the first xmeml version in which a <file>'s <rate> and
+// <duration> describe the media itself. In earlier versions the duration is
+// counted in the rate of the clipitem referencing the file.
+const fileRateVersion = 4
+
+// rootVersion returns the version attribute of the <xmeml> element root.
+func rootVersion(root xml.StartElement) string {
+	for _, attr := range root.Attr {
+		if attr.Name.Local == "version" {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// xmemlVersion returns the version attribute of an <xmeml> root element, or 0
+// if it has none. Versions newer than latestVersion are rejected, since their
+// fields can't be assumed to mean what they do in the versions we know.
+func xmemlVersion(root xml.StartElement) (int, error) {
+	return parseVersion(rootVersion(root))
+}
+
+// parseVersion parses an xmeml version attribute; see xmemlVersion.
+func parseVersion(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(s)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid xmeml version %q", s)
+	}
+	if version > latestVersion {
+		return 0, fmt.Errorf("xmeml version %d is not supported: versions 1 through %d are understood, "+
+			"and later versions may change the meaning of fields; export as version %d instead",
+			version, latestVersion, latestVersion)
+	}
+	return version, nil
+}
+
+// readRootElement advances the decoder to the document's root element,
+// rejecting FCPXML documents before any further parsing happens.
+func readRootElement(decoder *xml.Decoder) (xml.StartElement, error) {
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return xml.StartElement{}, fmt.Errorf("failed to decode XML: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "fcpxml", "resources", "library":
+			return start, ErrFCPXMLNotSupported
+		}
+		return start, nil
+	}
+}
+
+// convertSequence converts an FCP7 Sequence to an OTIO Timeline. binPath
+// locates the sequence in its project, if it is in a bin.
+func (d *Decoder) convertSequence(seq *Sequence, binPath string) (*gotio.Timeline, error) {
+	timeline := d.newSequenceTimeline(seq, binPath)
+	seq, err := d.appendSequenceTracks(seq, timeline.Tracks())
+	if err != nil {
+		return nil, err
+	}
+	d.checkSequenceDuration(seq, timeline)
+	d.conformToTargetRate(timeline)
+
+	return timeline, nil
+}
+
+// newSequenceTimeline returns an empty timeline for seq, with the sequence's
+// metadata.
+func (d *Decoder) newSequenceTimeline(seq *Sequence, binPath string) *gotio.Timeline {
+	d.sequenceAnamorphic = sequenceAnamorphicMode(seq)
+
+	metadata := make(gotio.AnyDictionary)
+	if d.version != 0 {
+		metadata["fcp7xml_version"] = int64(d.version)
+	}
+	if binPath != "" {
+		metadata["fcp7xml_bin_path"] = binPath
+	}
+	if seq.Duration > 0 {
+		metadata["fcp7xml_duration"] = seq.Duration
+	}
+	if d.sequenceAnamorphic != "" {
+		metadata["fcp7xml_anamorphic"] = d.sequenceAnamorphic
+	}
+	if format := sequenceFormat(seq); format != nil && format.FieldDominance != "" {
+		metadata["fcp7xml_fielddominance"] = format.FieldDominance
+	}
+	if seq.Timecode.DisplayFormat != "" {
+		metadata["fcp7xml_timecode_displayformat"] = seq.Timecode.DisplayFormat
+	}
+	if workArea := workAreaToMetadata(seq); workArea != nil {
+		metadata["fcp7xml_work_area"] = workArea
+	}
+	if audio := seq.Media.Audio; audio != nil {
+		if audio.NumOutputChannels > 0 {
+			metadata["fcp7xml_audio_output_channels"] = int64(audio.NumOutputChannels)
+		}
+		if audio.Outputs != nil {
+			metadata["fcp7xml_audio_outputs"] = outputsToMetadata(audio.Outputs)
+		}
+	}
+	setUnknownMetadata(metadata, seq.Unknown)
+	setAttributesMetadata(metadata, seq.Attrs)
+	adapterSeq := *seq
+	adapterSeq.Media, adapterSeq.Marker = Media{}, nil
+	d.setAdapterMetadata(metadata, "sequence", &adapterSeq)
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+	return gotio.NewTimeline(seq.Name, sequenceStartTime(seq), metadata)
+}
+
+// appendSequenceTracks converts the tracks of an FCP7 Sequence and appends
+// them to stack. It returns the sequence converted: seq, or, if seq has no
+// rate, a copy of it with the rate assumed for it, so that the parsed
+// document is left without one.
+func (d *Decoder) appendSequenceTracks(seq *Sequence, stack *gotio.Stack) (*Sequence, error) {
+	outer := d.scope
+	d.scope = decodeScope{sequence: seq.Name, sequenceLine: seq.line}
+	defer func() { d.scope = outer }()
+
+	if d.opts.Strict && seq.Rate.Timebase == 0 {
+		return nil, d.decodeError(0, "", fmt.Errorf("sequence %q has no frame rate", seq.Name))
+	}
+
+	d.enter(seq.Name)
+	defer d.leave()
+	d.warnAssumedNTSC("sequence", &seq.Rate, &seq.Timecode.Rate)
+
+	if seq.Rate.Timebase == 0 {
+		assumed := *seq
+		assumed.Rate = d.assumeSequenceRate(seq)
+		seq = &assumed
+	}
+
+	if err := d.checkSequenceTiming(seq); err != nil {
+		return nil, d.decodeError(0, "", err)
+	}
+
+	tracks := classifyTracks(seq)
+	groups := linkGroups(trackClipItems(tracks))
+	maps.Copy(d.linkGroups, groups)
+	var audioTracks []*Track
+	for _, t := range tracks {
+		if t.kind == gotio.TrackKindAudio {
+			audioTracks = append(audioTracks, t.track)
+		}
+	}
+	stereo, merged := findStereoPairs(audioTracks, groups)
+	maps.Copy(d.stereoItems, stereo)
+	maps.Copy(d.mergedItems, merged)
+
+	// Tracks holding only the second channels of stereo pairs are dropped,
+	// and the tracks after them renumbered
+	dropped := make(map[string]int)
+	for i, t := range tracks {
+		if hasOnlyMergedItems(t.track, merged) {
+			dropped[t.kind]++
+			d.progress(ProgressTracks, i+1, len(tracks))
+			continue
+		}
+		track, err := d.convertSequenceTrack(t, t.index-dropped[t.kind], seq)
+		if err != nil {
+			return nil, err
+		}
+		if err := stack.AppendChild(track); err != nil {
+			return nil, d.decodeError(0, "", fmt.Errorf("failed to append %s track: %w", strings.ToLower(t.kind), err))
+		}
+		d.progress(ProgressTracks, i+1, len(tracks))
+	}
+
+	return seq, nil
+}
+
+// convertSequenceTrack converts a track of seq, numbered index among the
+// tracks of its kind that are kept, and pads it to the sequence's duration.
+func (d *Decoder) convertSequenceTrack(t sequenceTrack, index int, seq *Sequence) (*gotio.Track, error) {
+	if err := d.checkContext(); err != nil {
+		return nil, err
+	}
+	name := strings.ToLower(t.kind)
+	if w := t.warning(); w != nil {
+		w.Path = d.currentPath() + "/" + trackName(t.kind, index)
+		d.warn(*w)
+	}
+	outer := d.scope
+	d.scope.trackKind, d.scope.trackIndex, d.scope.trackLine = t.kind, index, t.track.line
+	defer func() { d.scope = outer }()
+
+	track, err := d.convertTrack(t.track, &seq.Rate, t.kind, index)
+	if err != nil {
+		return nil, d.decodeError(0, "", fmt.Errorf("failed to convert %s track %d: %w", name, index, err))
+	}
+	if err := d.padTrack(track, seq); err != nil {
+		return nil, d.decodeError(0, "", fmt.Errorf("failed to pad %s track %d: %w", name, index, err))
+	}
+	return track, nil
+}
+
+// defaultTimebase is the timebase assumed for a sequence without a rate
+// when none of its items has one either.
+const defaultTimebase = 24
+
+// assumeSequenceRate returns the rate assumed for a sequence without one:
+// that of its first clipitem or generator that has one, or 24 fps. It
+// reports the assumption.
+func (d *Decoder) assumeSequenceRate(seq *Sequence) Rate {
+	for _, t := range classifyTracks(seq) {
+		for _, item := range t.track.ClipItem {
+			if item.Rate.Timebase > 0 {
+				d.warn(Warning{
+					Category: WarningMissingRate,
+					Message:  fmt.Sprintf("sequence has no frame rate; assuming a rate of %s from clipitem %q", formatRate(&item.Rate), item.Name),
+				})
+				return item.Rate
 			}
-			if err := timeline.Tracks().AppendChild(track); err != nil {
-				return nil, fmt.Errorf("failed to append audio track: %w", err)
+		}
+		for _, item := range t.track.GeneratorItem {
+			if item.Rate.Timebase > 0 {
+				d.warn(Warning{
+					Category: WarningMissingRate,
+					Message:  fmt.Sprintf("sequence has no frame rate; assuming a rate of %s from generator %q", formatRate(&item.Rate), item.Name),
+				})
+				return item.Rate
 			}
 		}
 	}
+	rate := Rate{Timebase: defaultTimebase}
+	d.warn(Warning{
+		Category: WarningMissingRate,
+		Message:  fmt.Sprintf("sequence and its items have no frame rate; assuming a rate of %s", formatRate(&rate)),
+	})
+	return rate
+}
 
-	return timeline, nil
+// warnAssumedNTSC warns if any of rates, those of the named element, had no
+// <ntsc> and was taken as NTSC; see Rate.UnmarshalXML.
+func (d *Decoder) warnAssumedNTSC(element string, rates ...*Rate) {
+	for _, rate := range rates {
+		if rate != nil && rate.ntscAssumed {
+			d.warn(Warning{
+				Category: WarningMissingRate,
+				Message:  fmt.Sprintf("%s has a timebase of %d without <ntsc>; assuming a rate of %s", element, rate.Timebase, formatRate(rate)),
+			})
+			return
+		}
+	}
+}
+
+// placedDuration returns how long a clipitem lasts in the sequence, from its
+// start and end in sequence frames, when its frame rate differs from the
+// sequence's. It reports false for clipitems at the sequence's rate, next to
+// transitions, or with a time remap.
+func placedDuration(item *ClipItem, sequenceRate *Rate) (opentime.RationalTime, bool) {
+	if sequenceRate == nil || sequenceRate.Timebase == 0 || sameRate(itemRate(&item.Rate, sequenceRate), sequenceRate) {
+		return opentime.RationalTime{}, false
+	}
+	if item.Start < 0 || item.End < item.Start || isRetimed(item) {
+		return opentime.RationalTime{}, false
+	}
+	return opentime.NewRationalTime(float64(item.End-item.Start), rateToFrameRate(sequenceRate)), true
+}
+
+// itemRate returns the rate of an item, or the sequence's if the item has
+// none.
+func itemRate(rate, sequenceRate *Rate) *Rate {
+	if rate.Timebase == 0 && sequenceRate != nil {
+		return sequenceRate
+	}
+	return rate
+}
+
+// padTrack appends a Gap to track so that it lasts as long as the sequence's
+// declared duration, when DecodeOptions.PadToSequenceDuration is set.
+func (d *Decoder) padTrack(track *gotio.Track, seq *Sequence) error {
+	if !d.opts.PadToSequenceDuration || seq.Duration <= 0 || seq.Rate.Timebase == 0 {
+		return nil
+	}
+
+	frameRate := rateToFrameRate(&seq.Rate)
+	duration, err := track.Duration()
+	if err != nil {
+		return fmt.Errorf("failed to get track duration: %w", err)
+	}
+	var frames int64
+	if duration.Rate() > 0 {
+		frames = int64(math.Round(duration.ValueRescaledTo(frameRate)))
+	}
+
+	if frames >= seq.Duration {
+		return nil
+	}
+	gap := gotio.NewGapWithDuration(opentime.NewRationalTime(float64(seq.Duration-frames), frameRate))
+	if err := track.AppendChild(gap); err != nil {
+		return fmt.Errorf("failed to append gap: %w", err)
+	}
+	return nil
 }
 
-// trackItem represents any item in a track with its start time.
+// checkSequenceDuration warns if the content of timeline, converted from
+// seq, lasts longer than the <duration> seq declares. A declared duration
+// longer than the content is trailing empty space, kept as fcp7xml_duration.
+func (d *Decoder) checkSequenceDuration(seq *Sequence, timeline *gotio.Timeline) {
+	if seq.Duration <= 0 || seq.Rate.Timebase == 0 {
+		return
+	}
+	duration, err := timeline.Duration()
+	if err != nil || duration.Rate() <= 0 {
+		return
+	}
+	frames := int64(math.Round(duration.ValueRescaledTo(rateToFrameRate(&seq.Rate))))
+	if frames > seq.Duration {
+		d.warn(Warning{
+			Category: WarningTimingInconsistency,
+			Message:  fmt.Sprintf("sequence %q has a duration of %d frames, but its content lasts %d", seq.Name, seq.Duration, frames),
+			Path:     seq.Name,
+		})
+	}
+}
+
+// checkSequenceTiming cross-checks the timing of every track in seq. In strict
+// mode all findings are returned as one joined error, otherwise they are
+// recorded as warnings.
+func (d *Decoder) checkSequenceTiming(seq *Sequence) error {
+	return d.reportTiming(seq, sequenceTiming(seq))
+}
+
+// reportTiming records timing findings in seq as warnings, or returns them
+// as one joined error in strict mode.
+func (d *Decoder) reportTiming(seq *Sequence, findings []*TimingError) error {
+	if !d.opts.Strict {
+		for _, f := range findings {
+			w := f.warning()
+			w.Path = d.currentPath() + "/" + f.path()
+			d.warn(w)
+		}
+		return nil
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+
+	errs := make([]error, len(findings))
+	for i, f := range findings {
+		errs[i] = f
+	}
+	return fmt.Errorf("sequence %q has inconsistent timing: %w", seq.Name, errors.Join(errs...))
+}
+
+// forEachClipItem calls f for every clipitem in seq, including those in
+// nested sequences, in document order.
+func forEachClipItem(seq *Sequence, f func(*ClipItem)) {
+	for _, t := range classifyTracks(seq) {
+		forEachTrackClipItem(t.track, f)
+	}
+}
+
+// forEachTrackClipItem calls f for every clipitem on track, including those
+// in nested sequences, in document order.
+func forEachTrackClipItem(track *Track, f func(*ClipItem)) {
+	for i := range track.ClipItem {
+		item := &track.ClipItem[i]
+		f(item)
+		if item.Sequence != nil {
+			forEachClipItem(item.Sequence, f)
+		}
+	}
+}
+
+// itemFiles returns the files of item: its own, and those of the angles of
+// its multiclip.
+func itemFiles(item *ClipItem) []**File {
+	files := []**File{&item.File}
+	if item.Multiclip != nil {
+		for i := range item.Multiclip.MCSource {
+			files = append(files, &item.Multiclip.MCSource[i].File)
+		}
+	}
+	return files
+}
+
+// indexFile records the files of item by id, if they are full definitions.
+func (d *Decoder) indexFile(item *ClipItem) {
+	for _, file := range itemFiles(item) {
+		if *file == nil || (*file).ID == "" || (*file).isReference() {
+			continue
+		}
+		if _, ok := d.files[(*file).ID]; !ok {
+			d.files[(*file).ID] = *file
+		}
+	}
+}
+
+// resolveFile replaces <file id="..."/> references on item with the file's
+// full definition from elsewhere in the document. FCP7 writes each file in
+// full only once. A multiclip without a file of its own takes that of its
+// active angle.
+func (d *Decoder) resolveFile(item *ClipItem) {
+	for _, file := range itemFiles(item) {
+		if *file == nil || !(*file).isReference() {
+			continue
+		}
+		if definition, ok := d.files[(*file).ID]; ok {
+			*file = definition
+		}
+	}
+	if item.File == nil && item.Multiclip != nil {
+		if source := item.Multiclip.activeSource(); source != nil {
+			item.File = source.File
+		}
+	}
+}
+
+// indexSequences records seq and every sequence nested inside it by id, so
+// that empty <sequence id="..."/> references can be resolved.
+func (d *Decoder) indexSequences(seq *Sequence) {
+	if seq.ID != "" && (seq.Media.Video != nil || seq.Media.Audio != nil) {
+		if _, ok := d.sequences[seq.ID]; !ok {
+			d.sequences[seq.ID] = seq
+		}
+	}
+
+	for _, t := range classifyTracks(seq) {
+		for _, item := range t.track.ClipItem {
+			if item.Sequence != nil {
+				d.indexSequences(item.Sequence)
+			}
+		}
+	}
+}
+
+// trackItem represents any item in a track with its start time. The
+// bounds of clipitems and generators are copies, which joinTransitions may
+// change.
 type trackItem struct {
 	start      int64
+	end        int64
+	in         int64
+	out        int64
 	itemType   string // "clip", "transition", "generator"
 	clipItem   *ClipItem
 	transition *TransitionItem
@@ -83,8 +863,30 @@ type trackItem struct {
 
 // convertTrack converts an FCP7 Track to an OTIO Track.
 func (d *Decoder) convertTrack(fcpTrack *Track, rate *Rate, kind string, index int) (*gotio.Track, error) {
-	trackName := fmt.Sprintf("%s %d", kind, index+1)
-	track := gotio.NewTrack(trackName, nil, kind, nil, nil)
+	trackName := trackName(kind, index)
+	metadata := make(gotio.AnyDictionary)
+	if fcpTrack.Locked != nil {
+		metadata["fcp7xml_locked"] = bool(*fcpTrack.Locked)
+	}
+	if fcpTrack.OutputChannelIndex != nil {
+		metadata["fcp7xml_output_channel_index"] = int64(*fcpTrack.OutputChannelIndex)
+	}
+	setUnknownMetadata(metadata, fcpTrack.Unknown)
+	setAttributesMetadata(metadata, fcpTrack.Attrs)
+	adapterTrack := *fcpTrack
+	adapterTrack.ClipItem, adapterTrack.TransitionItem, adapterTrack.GeneratorItem = nil, nil, nil
+	d.setAdapterMetadata(metadata, "track", &adapterTrack)
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+	name := trackName
+	if fcpTrack.Name != "" {
+		name = fcpTrack.Name
+	}
+	track := gotio.NewTrack(name, nil, kind, metadata, nil)
+
+	d.enter(trackName)
+	defer d.leave()
 
 	// Set enabled state if specified
 	if fcpTrack.Enabled != nil && !*fcpTrack.Enabled {
@@ -95,8 +897,14 @@ func (d *Decoder) convertTrack(fcpTrack *Track, rate *Rate, kind string, index i
 	var items []trackItem
 
 	for i := range fcpTrack.ClipItem {
+		if d.mergedItems[&fcpTrack.ClipItem[i]] {
+			continue
+		}
 		items = append(items, trackItem{
 			start:    fcpTrack.ClipItem[i].Start,
+			end:      fcpTrack.ClipItem[i].End,
+			in:       fcpTrack.ClipItem[i].In,
+			out:      fcpTrack.ClipItem[i].Out,
 			itemType: "clip",
 			clipItem: &fcpTrack.ClipItem[i],
 		})
@@ -105,6 +913,7 @@ func (d *Decoder) convertTrack(fcpTrack *Track, rate *Rate, kind string, index i
 	for i := range fcpTrack.TransitionItem {
 		items = append(items, trackItem{
 			start:      fcpTrack.TransitionItem[i].Start,
+			end:        fcpTrack.TransitionItem[i].End,
 			itemType:   "transition",
 			transition: &fcpTrack.TransitionItem[i],
 		})
@@ -113,70 +922,193 @@ func (d *Decoder) convertTrack(fcpTrack *Track, rate *Rate, kind string, index i
 	for i := range fcpTrack.GeneratorItem {
 		items = append(items, trackItem{
 			start:     fcpTrack.GeneratorItem[i].Start,
+			end:       fcpTrack.GeneratorItem[i].End,
+			in:        fcpTrack.GeneratorItem[i].In,
+			out:       fcpTrack.GeneratorItem[i].Out,
 			itemType:  "generator",
 			generator: &fcpTrack.GeneratorItem[i],
 		})
 	}
 
-	// Sort by start time
-	for i := 0; i < len(items)-1; i++ {
-		for j := i + 1; j < len(items); j++ {
-			if items[j].start < items[i].start {
-				items[i], items[j] = items[j], items[i]
-			}
+	joinTransitions(items)
+	for _, item := range items {
+		if item.start < 0 && item.itemType != "transition" {
+			d.warn(Warning{
+				Category: WarningUnknownStart,
+				Message:  fmt.Sprintf("%s %q has no start frame; its position on the track is approximate", item.itemType, item.name()),
+				Path:     d.currentPath() + "/" + item.name(),
+			})
 		}
 	}
 
-	// Convert items in order
+	// Sort by start time, putting each transition between the items that
+	// meet at its cut
+	sort.SliceStable(items, func(i, j int) bool {
+		ki, kj := items[i].sortKey(), items[j].sortKey()
+		if ki != kj {
+			return ki < kj
+		}
+		return items[i].itemType == "transition" && items[j].itemType != "transition"
+	})
+
+	// Convert items in order, filling the space before each clipitem or
+	// generator with a gap. Positions on the track are in sequence frames.
+	sequenceFrameRate := rateToFrameRate(rate)
+	var position int64
 	for i, item := range items {
+		if i > 0 && i%progressInterval == 0 {
+			d.progress(ProgressItems, i, len(items))
+		}
 		switch item.itemType {
 		case "clip":
-			composable, err := d.convertClipItem(item.clipItem, rate)
+			composable, err := d.convertClipItem(d.joinedClipItem(&item), rate)
 			if err != nil {
-				return nil, fmt.Errorf("failed to convert clip %d: %w", i, err)
+				return nil, d.decodeError(item.clipItem.line, item.clipItem.Name, fmt.Errorf("failed to convert clip %d: %w", i, err))
+			}
+			if err := appendGap(track, item.start-position, sequenceFrameRate); err != nil {
+				return nil, d.decodeError(item.clipItem.line, item.clipItem.Name, err)
 			}
 			if err := track.AppendChild(composable); err != nil {
-				return nil, fmt.Errorf("failed to append clip: %w", err)
+				return nil, d.decodeError(item.clipItem.line, item.clipItem.Name, fmt.Errorf("failed to append clip: %w", err))
 			}
+			position = item.placedEnd(position, composable, sequenceFrameRate)
 
 		case "transition":
 			trans, err := d.convertTransition(item.transition, rate)
 			if err != nil {
-				return nil, fmt.Errorf("failed to convert transition %d: %w", i, err)
+				return nil, d.decodeError(item.transition.line, item.transition.Name, fmt.Errorf("failed to convert transition %d: %w", i, err))
 			}
 			if err := track.AppendChild(trans); err != nil {
-				return nil, fmt.Errorf("failed to append transition: %w", err)
+				return nil, d.decodeError(item.transition.line, item.transition.Name, fmt.Errorf("failed to append transition: %w", err))
+			}
+			// The frames under a transition belong to the items it joins
+			if item.end > position {
+				position = item.end
 			}
 
 		case "generator":
-			gen, err := d.convertGenerator(item.generator, rate)
+			gen, err := d.convertGenerator(joinedGenerator(&item), rate)
 			if err != nil {
-				return nil, fmt.Errorf("failed to convert generator %d: %w", i, err)
+				return nil, d.decodeError(item.generator.line, item.generator.Name, fmt.Errorf("failed to convert generator %d: %w", i, err))
+			}
+			if err := appendGap(track, item.start-position, sequenceFrameRate); err != nil {
+				return nil, d.decodeError(item.generator.line, item.generator.Name, err)
 			}
 			if err := track.AppendChild(gen); err != nil {
-				return nil, fmt.Errorf("failed to append generator: %w", err)
+				return nil, d.decodeError(item.generator.line, item.generator.Name, fmt.Errorf("failed to append generator: %w", err))
 			}
+			position = item.placedEnd(position, gen, sequenceFrameRate)
 		}
 	}
+	d.progress(ProgressItems, len(items), len(items))
 
 	return track, nil
 }
 
+// appendGap appends a gap of the given number of sequence frames to track,
+// if there are any.
+func appendGap(track *gotio.Track, frames int64, sequenceFrameRate float64) error {
+	if frames <= 0 {
+		return nil
+	}
+	gap := gotio.NewGapWithDuration(opentime.NewRationalTime(float64(frames), sequenceFrameRate))
+	if err := track.AppendChild(gap); err != nil {
+		return fmt.Errorf("failed to append gap: %w", err)
+	}
+	return nil
+}
+
+// placedEnd returns the sequence frame at which an item placed at position
+// ends: its <end>, or, next to a transition where that is -1, position plus
+// the length of the converted child.
+func (item *trackItem) placedEnd(position int64, child gotio.Composable, sequenceFrameRate float64) int64 {
+	if item.end >= 0 {
+		return item.end
+	}
+	if item.start > position {
+		position = item.start
+	}
+	dur, err := child.Duration()
+	if err != nil {
+		return position
+	}
+	return position + int64(math.Round(dur.ValueRescaledTo(sequenceFrameRate)))
+}
+
+// name returns the name of the item.
+func (item *trackItem) name() string {
+	switch item.itemType {
+	case "clip":
+		return item.clipItem.Name
+	case "transition":
+		return item.transition.Name
+	default:
+		return item.generator.Name
+	}
+}
+
+// trackName returns the name given to the index-th decoded track of a kind.
+func trackName(kind string, index int) string {
+	return fmt.Sprintf("%s %d", kind, index+1)
+}
+
 // convertClipItem converts an FCP7 ClipItem to an OTIO Clip.
 func (d *Decoder) convertClipItem(item *ClipItem, sequenceRate *Rate) (gotio.Composable, error) {
+	d.converted++
+	if d.converted%contextCheckInterval == 0 {
+		if err := d.checkContext(); err != nil {
+			return nil, err
+		}
+	}
+
+	d.enter(item.Name)
+	defer d.leave()
+	d.warnAssumedNTSC(fmt.Sprintf("clipitem %q", item.Name), &item.Rate)
+	if file := item.File; file != nil {
+		rates := []*Rate{&file.Rate}
+		if file.Timecode != nil {
+			rates = append(rates, &file.Timecode.Rate)
+		}
+		d.warnAssumedNTSC(fmt.Sprintf("file %q", file.Name), rates...)
+	}
+
+	inPoint, outPoint := mediaInOut(item)
+	// A reversed clip may give its in and out points in playback order
+	scalar, swapped, retimed := retiming(item, inPoint, outPoint)
+	if swapped {
+		inPoint, outPoint = outPoint, inPoint
+	}
+	if d.opts.Strict {
+		if item.Rate.Timebase == 0 {
+			return nil, fmt.Errorf("clipitem %q has no frame rate", item.Name)
+		}
+		if outPoint < inPoint {
+			return nil, fmt.Errorf("clipitem %q has out point %d before in point %d", item.Name, outPoint, inPoint)
+		}
+	}
+
 	// Calculate the frame rate
-	rate := item.Rate
+	rate := *itemRate(&item.Rate, sequenceRate)
 	frameRate := float64(rate.Timebase)
 	if rate.NTSC {
 		// NTSC uses a drop frame rate (e.g., 29.97 instead of 30)
 		frameRate = frameRate * 1000.0 / 1001.0
 	}
 
+	// A clipitem without media is a placeholder for empty space
+	if d.opts.FilelessClipsAsGaps && item.File == nil && item.Sequence == nil && item.Multiclip == nil {
+		duration := opentime.NewRationalTime(float64(outPoint-inPoint), frameRate)
+		if placed, ok := placedDuration(item, sequenceRate); ok {
+			duration = placed
+		}
+		return gotio.NewGapWithDuration(duration), nil
+	}
+
 	// Check for nested sequence
 	if item.Sequence != nil {
 		// Calculate source range for nested sequence
-		sourceStart := opentime.NewRationalTime(float64(item.In), frameRate)
-		sourceDuration := opentime.NewRationalTime(float64(item.Out-item.In), frameRate)
+		sourceStart := opentime.NewRationalTime(float64(inPoint), frameRate)
+		sourceDuration := opentime.NewRationalTime(float64(outPoint-inPoint), frameRate)
 		sourceRange := opentime.NewTimeRange(sourceStart, sourceDuration)
 
 		// Create a clip referencing the nested timeline
@@ -184,12 +1116,21 @@ func (d *Decoder) convertClipItem(item *ClipItem, sequenceRate *Rate) (gotio.Com
 		metadata["fcp7xml_nested_sequence"] = true
 		metadata["fcp7xml_sequence_name"] = item.Sequence.Name
 
+		if d.opts.ExpandNestedSequences {
+			return d.convertNestedSequence(item, &sourceRange, metadata)
+		}
+		d.warn(Warning{
+			Category: WarningNestedSequence,
+			Message: fmt.Sprintf("nested sequence %q was decoded as a placeholder clip without its tracks; "+
+				"set DecodeOptions.ExpandNestedSequences to convert them", item.Sequence.Name),
+		})
+
 		clip := gotio.NewClip(
 			item.Name,
 			gotio.NewMissingReference("", nil, nil),
 			&sourceRange,
 			metadata,
-			nil, nil, "", nil,
+			nil, nil, d.opts.MediaReferenceKey, nil,
 		)
 		return clip, nil
 	}
@@ -197,22 +1138,62 @@ func (d *Decoder) convertClipItem(item *ClipItem, sequenceRate *Rate) (gotio.Com
 	// Convert frame numbers to rational times
 	// In FCP7 XML:
 	// - start/end: position in the timeline
-	// - in/out: range in the source media
-	// - duration: length of the clip
+	// - in/out: range in the source media (the used length)
+	// - duration: length of the source media, as is <file><duration>
+	// The clip's source range comes from in/out; the media reference's
+	// available range comes from the file's duration.
+
+	if mismatch := findRateMismatch(item, d.version); mismatch != nil {
+		d.warn(mismatch.warning(item))
+		if d.opts.RepairRateMismatch && mismatch.repairable {
+			// Trust the file: express the in/out points in the media's own rate
+			inPoint, outPoint = mismatch.in, mismatch.out
+			frameRate = rateToFrameRate(&item.File.Rate)
+		}
+	}
 
-	// Source range is from in to out point
-	sourceStart := opentime.NewRationalTime(float64(item.In), frameRate)
-	sourceDuration := opentime.NewRationalTime(float64(item.Out-item.In), frameRate)
+	// Source range is from in to out point, in the clip's rate. A clip whose
+	// rate differs from the sequence's lasts from start to end in sequence
+	// frames, which FCP7 rounds separately from in/out, so its length is
+	// that many sequence frames counted in the clip's rate.
+	sourceStart := opentime.NewRationalTime(float64(inPoint), frameRate)
+	if start, ok := pproTicksStart(item, inPoint, frameRate); ok {
+		sourceStart = start
+	}
+	sourceDuration := opentime.NewRationalTime(float64(outPoint-inPoint), frameRate)
+	if placed, ok := placedDuration(item, sequenceRate); ok {
+		sourceDuration = placed.RescaledTo(frameRate)
+	}
 	sourceRange := opentime.NewTimeRange(sourceStart, sourceDuration)
 
 	// Create media reference
 	var mediaRef gotio.MediaReference
 	if item.File != nil && item.File.PathURL != "" {
 		// Check for image sequence
-		mediaRef = d.createMediaReference(item.File, frameRate)
+		mediaRef = d.createMediaReference(item.File, item.SubclipInfo, frameRate)
 	} else {
-		// No file reference - create missing reference
-		mediaRef = gotio.NewMissingReference("", nil, nil)
+		// No file path - create missing reference, keeping what is known
+		// about the offline file
+		var name string
+		var availableRange *opentime.TimeRange
+		var metadata gotio.AnyDictionary
+		if item.File != nil {
+			name = item.File.Name
+			if item.File.Duration > 0 {
+				mediaRate := d.mediaFrameRate(item.File, frameRate)
+				ar := opentime.NewTimeRange(
+					opentime.NewRationalTime(0, mediaRate),
+					opentime.NewRationalTime(float64(item.File.Duration), mediaRate),
+				)
+				availableRange = &ar
+			}
+			metadata = d.fileMetadata(item.File)
+		}
+		mediaRef = gotio.NewMissingReference(name, availableRange, metadata)
+		d.warn(Warning{
+			Category: WarningMissingMedia,
+			Message:  fmt.Sprintf("clipitem %q has no file path; it was decoded with a MissingReference", item.Name),
+		})
 	}
 
 	// Create metadata
@@ -220,6 +1201,73 @@ func (d *Decoder) convertClipItem(item *ClipItem, sequenceRate *Rate) (gotio.Com
 	if item.ID != "" {
 		metadata["fcp7xml_id"] = item.ID
 	}
+	if item.MasterClipID != "" {
+		metadata["fcp7xml_masterclipid"] = item.MasterClipID
+	}
+	if item.Rate.Timebase == 0 {
+		metadata["fcp7xml_rate_inherited"] = true
+	}
+	if item.In == -1 {
+		metadata["fcp7xml_implicit_in"] = true
+	}
+	if item.Out == -1 {
+		metadata["fcp7xml_implicit_out"] = true
+	}
+	pproTicksToMetadata(item, metadata)
+	setUnknownMetadata(metadata, item.Unknown)
+	setAttributesMetadata(metadata, item.Attrs)
+	if group, ok := d.linkGroups[item.ID]; ok && item.ID != "" {
+		metadata["fcp7xml_link_group"] = group
+	}
+	if d.stereoItems[item] {
+		metadata["fcp7xml_audio_channels"] = int64(2)
+	}
+	if item.SourceTrack != nil && item.SourceTrack.TrackIndex > 0 && strings.EqualFold(item.SourceTrack.MediaType, "audio") {
+		metadata["fcp7xml_source_track"] = int64(item.SourceTrack.TrackIndex)
+	}
+	if item.Labels != nil {
+		if item.Labels.Label != "" {
+			metadata["fcp7xml_label"] = item.Labels.Label
+		}
+		if item.Labels.Label2 != "" {
+			metadata["fcp7xml_label2"] = item.Labels.Label2
+		}
+	}
+	if item.Multiclip != nil {
+		metadata["fcp7xml_multiclip"] = multiclipToMetadata(item.Multiclip)
+	}
+	if comments := commentsToMetadata(item.Comments); comments != nil {
+		metadata["fcp7xml_comments"] = comments
+	}
+	if loggingInfo := loggingInfoToMetadata(item.LoggingInfo); loggingInfo != nil {
+		metadata["fcp7xml_logginginfo"] = loggingInfo
+	}
+	if reelName := fileReelName(item.File); reelName != "" {
+		metadata["fcp7xml_reel_name"] = reelName
+	}
+	imageFlagsToMetadata(item.Anamorphic, item.AlphaType, metadata)
+	if mode := fileAnamorphicMode(item.File); mode != "" {
+		metadata["fcp7xml_file_anamorphic"] = mode
+	}
+	if item.SubclipInfo != nil {
+		metadata["fcp7xml_subclipinfo"] = gotio.AnyDictionary{
+			"startoffset": item.SubclipInfo.StartOffset,
+			"endoffset":   item.SubclipInfo.EndOffset,
+		}
+	}
+	if item.Stereo3D != nil {
+		metadata["fcp7xml_stereo3d"] = item.Stereo3D.Inner
+		if eye := item.Stereo3D.Eye(); eye != "" {
+			metadata["fcp7xml_eye"] = eye
+		}
+	}
+	if aspect, ok := displayAspect(item, d.sequenceAnamorphic); ok {
+		metadata["fcp7xml_display_aspect"] = aspect
+	}
+	pixelAspectToMetadata(item, metadata)
+	adapterItem := *item
+	adapterItem.File, adapterItem.Sequence, adapterItem.Marker = nil, nil, nil
+	d.setAdapterMetadata(metadata, "clipitem", &adapterItem)
 
 	// Store effects and filters as metadata
 	if len(item.Effect) > 0 {
@@ -227,6 +1275,29 @@ func (d *Decoder) convertClipItem(item *ClipItem, sequenceRate *Rate) (gotio.Com
 	}
 	if len(item.Filter) > 0 {
 		metadata["fcp7xml_filters"] = d.filtersToMetadata(item.Filter)
+		if colorCorrection := colorCorrectionToMetadata(item.Filter); colorCorrection != nil {
+			metadata["fcp7xml_color_correction"] = colorCorrection
+		}
+		opacityToMetadata(item.Filter, metadata)
+		if crop := cropToMetadata(item.Filter); crop != nil {
+			metadata["fcp7xml_crop"] = crop
+		}
+		audioFiltersToMetadata(item.Filter, metadata)
+	}
+
+	// A constant speed change, which may be reversed, becomes a
+	// LinearTimeWarp; the time remap itself stays in fcp7xml_filters
+	var effects []gotio.Effect
+	if retimed {
+		effects = append(effects, gotio.NewLinearTimeWarp("Time Remap", "LinearTimeWarp", scalar, nil))
+		if swapped {
+			metadata["fcp7xml_reversed_inout"] = true
+		}
+	}
+
+	// A freeze frame holds one frame for the clip's length
+	if held, ok := stillFrame(item, inPoint); ok {
+		effects = append(effects, freezeFrame(item, held, frameRate, &sourceRange, metadata))
 	}
 
 	// Convert markers
@@ -242,10 +1313,10 @@ func (d *Decoder) convertClipItem(item *ClipItem, sequenceRate *Rate) (gotio.Com
 		mediaRef,
 		&sourceRange,
 		metadata,
-		nil,     // effects
-		markers, // markers
-		"",      // active media reference key
-		nil,     // color
+		effects,                  // effects
+		markers,                  // markers
+		d.opts.MediaReferenceKey, // active media reference key
+		nil,                      // color
 	)
 
 	// Set enabled state if specified
@@ -253,27 +1324,69 @@ func (d *Decoder) convertClipItem(item *ClipItem, sequenceRate *Rate) (gotio.Com
 		clip.SetEnabled(false)
 	}
 
+	if d.linkedClips != nil && len(d.expanding) == 0 && item.ID != "" {
+		d.linkedClips[item.ID] = append(d.linkedClips[item.ID], clip)
+	}
+
 	return clip, nil
 }
 
+// convertNestedSequence converts a clipitem wrapping a nested sequence into
+// an OTIO Stack holding the nested sequence's tracks.
+func (d *Decoder) convertNestedSequence(item *ClipItem, sourceRange *opentime.TimeRange, metadata gotio.AnyDictionary) (*gotio.Stack, error) {
+	seq := item.Sequence
+	if def, ok := d.sequences[seq.ID]; ok {
+		seq = def
+		metadata["fcp7xml_sequence_name"] = seq.Name
+	}
+
+	if d.expanding[seq] {
+		return nil, fmt.Errorf("nested sequence %q contains itself", seq.Name)
+	}
+	if maxDepth := d.maxNestingDepth(); maxDepth > 0 && len(d.expanding) >= maxDepth {
+		return nil, &LimitError{Limit: "MaxNestingDepth", Max: int64(maxDepth)}
+	}
+	d.expanding[seq] = true
+	defer delete(d.expanding, seq)
+
+	stack := gotio.NewStack(item.Name, sourceRange, metadata, nil, nil, nil)
+	if _, err := d.appendSequenceTracks(seq, stack); err != nil {
+		return nil, fmt.Errorf("failed to convert nested sequence %q: %w", seq.Name, err)
+	}
+
+	if item.Enabled != nil && !*item.Enabled {
+		stack.SetEnabled(false)
+	}
+
+	return stack, nil
+}
+
 // convertTransition converts an FCP7 TransitionItem to an OTIO Transition.
 func (d *Decoder) convertTransition(item *TransitionItem, sequenceRate *Rate) (*gotio.Transition, error) {
-	frameRate := rateToFrameRate(&item.Rate)
+	d.enter(item.Name)
+	defer d.leave()
+	d.warnAssumedNTSC(fmt.Sprintf("transitionitem %q", item.Name), &item.Rate)
+
+	frameRate := rateToFrameRate(itemRate(&item.Rate, sequenceRate))
 
 	metadata := make(gotio.AnyDictionary)
 	metadata["fcp7xml_alignment"] = item.Alignment
+	if item.Rate.Timebase == 0 {
+		metadata["fcp7xml_rate_inherited"] = true
+	}
 	if item.Effect != nil {
 		metadata["fcp7xml_effect"] = d.effectToMetadata(item.Effect)
 	}
+	d.setAdapterMetadata(metadata, "transitionitem", item)
 
-	// Split duration between in and out offset (typically 50/50 for center alignment)
-	halfDuration := opentime.NewRationalTime(float64(item.End-item.Start)/2.0, frameRate)
-
+	// The offsets reach from the cut the alignment puts the transition on
+	// back to its start and on to its end
+	cut := transitionCut(item)
 	transition := gotio.NewTransition(
 		item.Name,
 		gotio.TransitionTypeCustom,
-		halfDuration,
-		halfDuration,
+		opentime.NewRationalTime(float64(cut-item.Start), frameRate),
+		opentime.NewRationalTime(float64(item.End-cut), frameRate),
 		metadata,
 	)
 
@@ -282,7 +1395,11 @@ func (d *Decoder) convertTransition(item *TransitionItem, sequenceRate *Rate) (*
 
 // convertGenerator converts an FCP7 GeneratorItem to an OTIO Clip.
 func (d *Decoder) convertGenerator(item *GeneratorItem, sequenceRate *Rate) (*gotio.Clip, error) {
-	frameRate := rateToFrameRate(&item.Rate)
+	d.enter(item.Name)
+	defer d.leave()
+	d.warnAssumedNTSC(fmt.Sprintf("generatoritem %q", item.Name), &item.Rate)
+
+	frameRate := rateToFrameRate(itemRate(&item.Rate, sequenceRate))
 
 	// Calculate source range
 	sourceStart := opentime.NewRationalTime(float64(item.In), frameRate)
@@ -293,12 +1410,23 @@ func (d *Decoder) convertGenerator(item *GeneratorItem, sequenceRate *Rate) (*go
 	metadata := make(gotio.AnyDictionary)
 	metadata["fcp7xml_generator"] = true
 	metadata["fcp7xml_generator_name"] = item.Name
+	if item.Rate.Timebase == 0 {
+		metadata["fcp7xml_rate_inherited"] = true
+	}
+	imageFlagsToMetadata(item.Anamorphic, item.AlphaType, metadata)
 
 	if item.Effect != nil {
 		metadata["fcp7xml_effect"] = d.effectToMetadata(item.Effect)
 	}
 	if len(item.Filter) > 0 {
 		metadata["fcp7xml_filters"] = d.filtersToMetadata(item.Filter)
+		if colorCorrection := colorCorrectionToMetadata(item.Filter); colorCorrection != nil {
+			metadata["fcp7xml_color_correction"] = colorCorrection
+		}
+		opacityToMetadata(item.Filter, metadata)
+		if crop := cropToMetadata(item.Filter); crop != nil {
+			metadata["fcp7xml_crop"] = crop
+		}
 	}
 
 	// Convert markers
@@ -312,7 +1440,7 @@ func (d *Decoder) convertGenerator(item *GeneratorItem, sequenceRate *Rate) (*go
 	mediaRef := gotio.NewGeneratorReference(
 		item.Name,
 		item.Name, // generator kind
-		nil,       // parameters
+		generatorParameters(item.Effect),
 		nil,       // available range
 		nil,       // metadata
 	)
@@ -324,7 +1452,7 @@ func (d *Decoder) convertGenerator(item *GeneratorItem, sequenceRate *Rate) (*go
 		metadata,
 		nil,
 		markers,
-		"",
+		d.opts.MediaReferenceKey,
 		nil,
 	)
 
@@ -337,9 +1465,21 @@ func (d *Decoder) convertGenerator(item *GeneratorItem, sequenceRate *Rate) (*go
 
 // convertMarker converts an FCP7 Marker to an OTIO Marker.
 func (d *Decoder) convertMarker(m *Marker, frameRate float64) *gotio.Marker {
+	// An out point of -1 marks a single frame
+	duration := m.Out - m.In
+	if m.Out == -1 {
+		duration = 0
+	} else if duration < 0 {
+		d.warn(Warning{
+			Category: WarningClampedMarker,
+			Message:  fmt.Sprintf("marker %q has out point %d before in point %d; its duration was clamped to 0", m.Name, m.Out, m.In),
+		})
+		duration = 0
+	}
+
 	markedRange := opentime.NewTimeRange(
 		opentime.NewRationalTime(float64(m.In), frameRate),
-		opentime.NewRationalTime(float64(m.Out-m.In), frameRate),
+		opentime.NewRationalTime(float64(duration), frameRate),
 	)
 
 	metadata := make(gotio.AnyDictionary)
@@ -357,23 +1497,32 @@ func (d *Decoder) convertMarker(m *Marker, frameRate float64) *gotio.Marker {
 		}
 	}
 
-	// Use default marker color
-	markerColor := gotio.MarkerColorGreen
+	d.setAdapterMetadata(metadata, "marker", m)
+
 	comment := m.Comment
 
-	return gotio.NewMarker(m.Name, markedRange, markerColor, comment, metadata)
+	return gotio.NewMarker(m.Name, markedRange, markerColor(m.Color), comment, metadata)
 }
 
 // createMediaReference creates the appropriate MediaReference, detecting image sequences.
-func (d *Decoder) createMediaReference(file *File, frameRate float64) gotio.MediaReference {
+func (d *Decoder) createMediaReference(file *File, subclip *SubclipInfo, frameRate float64) gotio.MediaReference {
+	frameRate = d.mediaFrameRate(file, frameRate)
+
+	// The available range is the full media length, independent of how much
+	// of it the clipitem uses, or the part of it a subclip is limited to
+	start, end := int64(0), file.Duration
+	if subclip != nil && subclip.StartOffset >= 0 && subclip.EndOffset >= 0 &&
+		subclip.StartOffset+subclip.EndOffset < file.Duration {
+		start, end = subclip.StartOffset, file.Duration-subclip.EndOffset
+	}
 	availableRange := opentime.NewTimeRange(
-		opentime.NewRationalTime(0, frameRate),
-		opentime.NewRationalTime(float64(file.Duration), frameRate),
+		opentime.NewRationalTime(float64(start), frameRate),
+		opentime.NewRationalTime(float64(end-start), frameRate),
 	)
 
 	// Detect image sequence patterns (e.g., file.####.ext or file.%04d.ext)
 	name := file.Name
-	pathURL := file.PathURL
+	pathURL := d.resolvePathURL(d.repairPathURL(file))
 
 	// Common image sequence patterns
 	isImageSequence := false
@@ -399,7 +1548,10 @@ func (d *Decoder) createMediaReference(file *File, frameRate float64) gotio.Medi
 	}
 
 	if isImageSequence {
-		metadata := make(gotio.AnyDictionary)
+		metadata := d.fileMetadata(file)
+		if metadata == nil {
+			metadata = make(gotio.AnyDictionary)
+		}
 		metadata["fcp7xml_file_id"] = file.ID
 
 		// Parse image sequence pattern - basic implementation
@@ -424,15 +1576,277 @@ func (d *Decoder) createMediaReference(file *File, frameRate float64) gotio.Medi
 		)
 	}
 
+	// A still image has no duration of its own: the clipitem's in and out
+	// points alone decide how long it is shown, so it gets no available range
+	if file.Duration <= 0 {
+		metadata := d.fileMetadata(file)
+		if metadata == nil {
+			metadata = make(gotio.AnyDictionary)
+		}
+		metadata["fcp7xml_still"] = true
+		return gotio.NewExternalReference(
+			name,
+			pathURL,
+			nil,
+			metadata,
+		)
+	}
+
 	// Regular external reference
 	return gotio.NewExternalReference(
 		name,
 		pathURL,
 		&availableRange,
-		nil,
+		d.fileMetadata(file),
 	)
 }
 
+// mediaFrameRate returns the frame rate in which file's duration is counted:
+// its own rate, or clipRate if it has none or the document is older than
+// fileRateVersion.
+func (d *Decoder) mediaFrameRate(file *File, clipRate float64) float64 {
+	if file.Rate.Timebase == 0 || (d.version != 0 && d.version < fileRateVersion) {
+		return clipRate
+	}
+	return rateToFrameRate(&file.Rate)
+}
+
+// fileMetadata returns the media reference metadata for the details of file
+// that OTIO has no field for, or nil if there are none.
+func (d *Decoder) fileMetadata(file *File) gotio.AnyDictionary {
+	metadata := make(gotio.AnyDictionary)
+	if file.Rate.Timebase != 0 {
+		metadata["fcp7xml_file_rate"] = gotio.AnyDictionary{
+			"timebase": int64(file.Rate.Timebase),
+			"ntsc":     bool(file.Rate.NTSC),
+		}
+	}
+	if characteristics := fileVideoCharacteristics(file); characteristics != nil && characteristics.FieldDominance != "" {
+		metadata["fcp7xml_fielddominance"] = characteristics.FieldDominance
+	}
+	setUnknownMetadata(metadata, file.Unknown)
+	if loggingInfo := loggingInfoToMetadata(file.LoggingInfo); loggingInfo != nil {
+		metadata["fcp7xml_logginginfo"] = loggingInfo
+	}
+	if channels := fileChannelCount(file); channels > 0 {
+		metadata["fcp7xml_channelcount"] = int64(channels)
+	}
+	d.setAdapterMetadata(metadata, "file", file)
+	if len(metadata) == 0 {
+		return nil
+	}
+	return metadata
+}
+
+// fileChannelCount returns the number of audio channels in file, or 0 if it
+// doesn't say.
+func fileChannelCount(file *File) int {
+	if file.Media == nil || file.Media.Audio == nil {
+		return 0
+	}
+	audio := file.Media.Audio
+	if audio.ChannelCount == 0 && audio.SampleCharacteristics != nil {
+		return audio.SampleCharacteristics.Channels
+	}
+	return audio.ChannelCount
+}
+
+// commentsToMetadata stores a clipitem's numbered master comments and its
+// other comments, or returns nil if it has none.
+func commentsToMetadata(comments *Comments) gotio.AnyDictionary {
+	if comments == nil {
+		return nil
+	}
+	metadata := make(gotio.AnyDictionary)
+	for i, text := range []string{comments.MasterComment1, comments.MasterComment2, comments.MasterComment3, comments.MasterComment4} {
+		if text != "" {
+			metadata[fmt.Sprintf("mastercomment%d", i+1)] = text
+		}
+	}
+	if len(comments.Comment) > 0 {
+		texts := make([]string, len(comments.Comment))
+		for i, c := range comments.Comment {
+			texts[i] = c.Text
+		}
+		metadata["comment"] = texts
+	}
+	if len(metadata) == 0 {
+		return nil
+	}
+	return metadata
+}
+
+// loggingInfoToMetadata stores the logging fields present in info, even if
+// empty, or returns nil if there is no info.
+func loggingInfoToMetadata(info *LoggingInfo) gotio.AnyDictionary {
+	if info == nil {
+		return nil
+	}
+	metadata := make(gotio.AnyDictionary)
+	for key, field := range map[string]*string{
+		"description": info.Description,
+		"scene":       info.Scene,
+		"shottake":    info.ShotTake,
+		"lognote":     info.LogNote,
+	} {
+		if field != nil {
+			metadata[key] = *field
+		}
+	}
+	if info.Good != nil {
+		metadata["good"] = bool(*info.Good)
+	}
+	setUnknownMetadata(metadata, info.Unknown)
+	return metadata
+}
+
+// fileReelName returns the reel/tape name of a file, if it has one.
+func fileReelName(file *File) string {
+	if file == nil {
+		return ""
+	}
+	if file.Timecode != nil && file.Timecode.Reel != nil {
+		return file.Timecode.Reel.Name
+	}
+	if file.Reel != nil {
+		return file.Reel.Name
+	}
+	return ""
+}
+
+// imageFlagsToMetadata stores a clipitem's or generatoritem's anamorphic and
+// alpha type flags in metadata.
+func imageFlagsToMetadata(anamorphic *fcpBool, alphaType string, metadata gotio.AnyDictionary) {
+	if anamorphic != nil {
+		metadata["fcp7xml_anamorphic"] = bool(*anamorphic)
+	}
+	if alphaType != "" {
+		metadata["fcp7xml_alphatype"] = alphaType
+	}
+}
+
+// fileVideoCharacteristics returns a file's video sample characteristics, or
+// nil if it has none.
+func fileVideoCharacteristics(file *File) *SampleCharacteristics {
+	if file == nil || file.Media == nil || file.Media.Video == nil {
+		return nil
+	}
+	return file.Media.Video.SampleCharacteristics
+}
+
+// fileAnamorphicMode returns the anamorphic setting of a file's video sample
+// characteristics, if it has one.
+func fileAnamorphicMode(file *File) string {
+	if characteristics := fileVideoCharacteristics(file); characteristics != nil {
+		return characteristics.AnamorphicMode
+	}
+	return ""
+}
+
+// sequenceFormat returns the sample characteristics of a sequence's video
+// format, or nil if it has none.
+func sequenceFormat(seq *Sequence) *SampleCharacteristics {
+	if seq.Media.Video == nil || seq.Media.Video.Format == nil {
+		return nil
+	}
+	return seq.Media.Video.Format.SampleCharacteristics
+}
+
+// sequenceAnamorphicMode returns the anamorphic setting of a sequence's
+// video format, if it has one.
+func sequenceAnamorphicMode(seq *Sequence) string {
+	if format := sequenceFormat(seq); format != nil {
+		return format.AnamorphicMode
+	}
+	return ""
+}
+
+// Display aspect ratios of standard and anamorphic (widescreen) video.
+const (
+	standardDisplayAspect   = 4.0 / 3.0
+	anamorphicDisplayAspect = 16.0 / 9.0
+)
+
+// displayAspect returns the display aspect ratio of a clipitem in a sequence
+// whose format has the anamorphic setting sequenceMode. The clipitem's own
+// flag takes precedence over its file's. Anamorphic media is stretched to
+// 16:9 once, whether the clip, the sequence or both are anamorphic: an
+// anamorphic clip in an anamorphic sequence is not stretched again. ok is
+// false if neither the clipitem, its file nor the sequence has a setting.
+func displayAspect(item *ClipItem, sequenceMode string) (aspect float64, ok bool) {
+	clipAnamorphic, clipOK := false, false
+	if item.Anamorphic != nil {
+		clipAnamorphic, clipOK = bool(*item.Anamorphic), true
+	} else if mode := fileAnamorphicMode(item.File); mode != "" {
+		clipAnamorphic, clipOK = parseAnamorphicMode(mode)
+	}
+	sequenceAnamorphic, sequenceOK := parseAnamorphicMode(sequenceMode)
+	if !clipOK && !sequenceOK {
+		return 0, false
+	}
+	if clipAnamorphic || sequenceAnamorphic {
+		return anamorphicDisplayAspect, true
+	}
+	return standardDisplayAspect, true
+}
+
+// parseAnamorphicMode parses an <anamorphic> setting such as "TRUE".
+func parseAnamorphicMode(mode string) (anamorphic, ok bool) {
+	anamorphic, err := strconv.ParseBool(strings.TrimSpace(mode))
+	return anamorphic, err == nil
+}
+
+// pixelAspectToMetadata stores the pixel aspect ratio of a clipitem: the
+// file's own value, and the value in effect for the clip, which is the
+// clipitem's override if it has one.
+func pixelAspectToMetadata(item *ClipItem, metadata gotio.AnyDictionary) {
+	pixelAspectRatio := item.PixelAspectRatio
+	if characteristics := fileVideoCharacteristics(item.File); characteristics != nil && characteristics.PixelAspectRatio != "" {
+		metadata["fcp7xml_file_pixelaspectratio"] = characteristics.PixelAspectRatio
+		if pixelAspectRatio == "" {
+			pixelAspectRatio = characteristics.PixelAspectRatio
+		}
+	}
+	if pixelAspectRatio != "" {
+		metadata["fcp7xml_pixelaspectratio"] = pixelAspectRatio
+		if ratio, ok := PixelAspectRatioValue(pixelAspectRatio); ok {
+			metadata["fcp7xml_pixel_aspect"] = ratio
+		}
+	}
+}
+
+// pixelAspectRatios maps the named <pixelaspectratio> values written by FCP7,
+// in lower case, to the width of a pixel relative to its height.
+var pixelAspectRatios = map[string]float64{
+	"square":         1,
+	"ntsc-601":       10.0 / 11.0,
+	"ntsc-ccir-601":  10.0 / 11.0,
+	"pal-601":        59.0 / 54.0,
+	"pal-ccir-601":   59.0 / 54.0,
+	"hd-(960x720)":   4.0 / 3.0,
+	"hd-(1280x1080)": 3.0 / 2.0,
+	"hd-(1440x1080)": 4.0 / 3.0,
+}
+
+// PixelAspectRatioValue returns the numeric pixel aspect ratio (pixel width
+// over height) of an FCP7 <pixelaspectratio> value, such as "NTSC-601" or
+// "HD-(1440x1080)". Names are matched case-insensitively. Plain numbers such
+// as "1.5", and descriptions ending in the ratio in parentheses, such as
+// "NTSC CCIR 601/DV (0.9091)", are also accepted.
+func PixelAspectRatioValue(name string) (float64, bool) {
+	name = strings.TrimSpace(name)
+	if ratio, ok := pixelAspectRatios[strings.ToLower(name)]; ok {
+		return ratio, true
+	}
+	if open := strings.LastIndex(name, "("); open >= 0 && strings.HasSuffix(name, ")") {
+		name = name[open+1 : len(name)-1]
+	}
+	if ratio, err := strconv.ParseFloat(name, 64); err == nil && ratio > 0 {
+		return ratio, true
+	}
+	return 0, false
+}
+
 // effectToMetadata converts an Effect to metadata dictionary.
 func (d *Decoder) effectToMetadata(effect *Effect) gotio.AnyDictionary {
 	metadata := make(gotio.AnyDictionary)
@@ -447,6 +1861,12 @@ func (d *Decoder) effectToMetadata(effect *Effect) gotio.AnyDictionary {
 	if effect.Duration > 0 {
 		metadata["duration"] = effect.Duration
 	}
+	if effect.WipeCode != nil {
+		metadata["wipecode"] = *effect.WipeCode
+	}
+	if effect.WipeAccuracy != nil {
+		metadata["wipeaccuracy"] = *effect.WipeAccuracy
+	}
 	if effect.StartRatio != nil {
 		metadata["startratio"] = *effect.StartRatio
 	}
@@ -454,7 +1874,7 @@ func (d *Decoder) effectToMetadata(effect *Effect) gotio.AnyDictionary {
 		metadata["endratio"] = *effect.EndRatio
 	}
 	if effect.Reverse != nil {
-		metadata["reverse"] = *effect.Reverse
+		metadata["reverse"] = bool(*effect.Reverse)
 	}
 
 	if len(effect.Parameter) > 0 {
@@ -483,7 +1903,7 @@ func (d *Decoder) filtersToMetadata(filters []Filter) []gotio.AnyDictionary {
 	for i, f := range filters {
 		filterMeta := make(gotio.AnyDictionary)
 		if f.Enabled != nil {
-			filterMeta["enabled"] = *f.Enabled
+			filterMeta["enabled"] = bool(*f.Enabled)
 		}
 		if f.Start > 0 {
 			filterMeta["start"] = f.Start
@@ -512,6 +1932,9 @@ func (d *Decoder) parameterToMetadata(p *Parameter) gotio.AnyDictionary {
 	if p.Value != "" {
 		metadata["value"] = p.Value
 	}
+	if p.ValueXML != "" {
+		metadata["valuexml"] = p.ValueXML
+	}
 	if p.ValueID != "" {
 		metadata["valueid"] = p.ValueID
 	}
@@ -524,6 +1947,19 @@ func (d *Decoder) parameterToMetadata(p *Parameter) gotio.AnyDictionary {
 	if p.ValueList != "" {
 		metadata["valuelist"] = p.ValueList
 	}
+	if len(p.Keyframe) > 0 {
+		keyframes := make([]gotio.AnyDictionary, len(p.Keyframe))
+		for i, k := range p.Keyframe {
+			keyframes[i] = gotio.AnyDictionary{"when": k.When, "value": k.Value}
+			if k.ValueXML != "" {
+				keyframes[i]["valuexml"] = k.ValueXML
+			}
+			if k.Interpolation != "" {
+				keyframes[i]["interpolation"] = k.Interpolation
+			}
+		}
+		metadata["keyframes"] = keyframes
+	}
 
 	return metadata
 }
@@ -537,3 +1973,63 @@ func rateToFrameRate(rate *Rate) float64 {
 	}
 	return frameRate
 }
+
+// rateMismatch describes a clipitem whose rate differs from its file's rate.
+type rateMismatch struct {
+	// in and out are the clipitem's in/out points expressed in the file's rate
+	in, out int64
+	// repairable is set when the converted range fits within the file
+	repairable bool
+}
+
+// findRateMismatch compares a clipitem's rate with its file's rate and
+// returns nil when they agree or either is unknown. Documents older than
+// fileRateVersion don't give files a rate of their own, so they have no
+// mismatches.
+func findRateMismatch(item *ClipItem, version int) *rateMismatch {
+	if item.File == nil || item.File.Rate.Timebase == 0 || item.Rate.Timebase == 0 {
+		return nil
+	}
+	if version != 0 && version < fileRateVersion {
+		return nil
+	}
+	if sameRate(&item.Rate, &item.File.Rate) {
+		return nil
+	}
+
+	scale := rateToFrameRate(&item.File.Rate) / rateToFrameRate(&item.Rate)
+	in, out := mediaInOut(item)
+	mismatch := &rateMismatch{
+		in:  int64(math.Round(float64(in) * scale)),
+		out: int64(math.Round(float64(out) * scale)),
+	}
+	mismatch.repairable = item.File.Duration > 0 && mismatch.in >= 0 &&
+		mismatch.out >= mismatch.in && mismatch.out <= item.File.Duration
+	return mismatch
+}
+
+// warning describes the mismatch for the given clipitem.
+func (m *rateMismatch) warning(item *ClipItem) Warning {
+	message := fmt.Sprintf("clipitem %q has rate %s but its file %q has rate %s",
+		item.Name, formatRate(&item.Rate), item.File.Name, formatRate(&item.File.Rate))
+	if m.repairable {
+		in, out := mediaInOut(item)
+		message += fmt.Sprintf("; in/out %d-%d correspond to %d-%d in the file's rate", in, out, m.in, m.out)
+	} else {
+		message += "; the rates are ambiguous because the converted range does not fit the file's duration"
+	}
+	return Warning{Category: WarningRateMismatch, Message: message}
+}
+
+// sameRate reports whether two FCP7 Rates describe the same frame rate.
+func sameRate(a, b *Rate) bool {
+	return a.Timebase == b.Timebase && a.NTSC == b.NTSC
+}
+
+// formatRate formats an FCP7 Rate for messages, e.g. "24" or "29.97 (NTSC)".
+func formatRate(rate *Rate) string {
+	if rate.NTSC {
+		return fmt.Sprintf("%.2f (NTSC)", rateToFrameRate(rate))
+	}
+	return fmt.Sprintf("%d", rate.Timebase)
+}
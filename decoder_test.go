@@ -4,10 +4,21 @@
 package fcp7xml
 
 import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/Avalanche-io/gotio"
+	"github.com/Avalanche-io/gotio/opentime"
 )
 
 func TestDecoder_Decode(t *testing.T) {
@@ -333,3 +344,2463 @@ func TestDecoder_DecodeMultipleTracks(t *testing.T) {
 		}
 	}
 }
+
+func TestDecoder_MediaLengthVersusUsedLength(t *testing.T) {
+	// The clip uses frames 100-160 of a 300 frame file. The clipitem's
+	// <duration> repeats the media length, not the 60 frames on the timeline.
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Partial Use</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>false</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem>
+            <name>Excerpt</name>
+            <duration>300</duration>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>false</ntsc>
+            </rate>
+            <start>0</start>
+            <end>60</end>
+            <in>100</in>
+            <out>160</out>
+            <file id="file-1">
+              <name>long.mov</name>
+              <pathurl>file:///media/long.mov</pathurl>
+              <rate>
+                <timebase>24</timebase>
+                <ntsc>false</ntsc>
+              </rate>
+              <duration>300</duration>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	decoder := NewDecoder(strings.NewReader(xmlData))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if warnings := decoder.Warnings(); len(warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", warnings)
+	}
+
+	clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+
+	available := clip.MediaReference().AvailableRange()
+	if available == nil {
+		t.Fatal("Expected media reference to have an available range")
+	}
+	if available.StartTime().Value() != 0 || available.Duration().Value() != 300 {
+		t.Errorf("Expected available range 0+300, got %v+%v",
+			available.StartTime().Value(), available.Duration().Value())
+	}
+
+	sr := clip.SourceRange()
+	if sr == nil {
+		t.Fatal("Expected clip to have a source range")
+	}
+	if sr.StartTime().Value() != 100 || sr.Duration().Value() != 60 {
+		t.Errorf("Expected source range 100+60, got %v+%v",
+			sr.StartTime().Value(), sr.Duration().Value())
+	}
+}
+
+func TestDecoder_DecodeFCPXML(t *testing.T) {
+	tests := []struct {
+		name    string
+		xmlData string
+	}{
+		{
+			name: "fcpxml root",
+			xmlData: `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE fcpxml>
+<fcpxml version="1.9">
+  <resources>
+    <format id="r1" name="FFVideoFormat1080p24" frameDuration="100/2400s" width="1920" height="1080"/>
+  </resources>
+  <library>
+    <event name="Event">
+      <project name="Project">
+        <sequence format="r1" duration="240/24s">
+          <spine/>
+        </sequence>
+      </project>
+    </event>
+  </library>
+</fcpxml>`,
+		},
+		{
+			name: "bare library root",
+			xmlData: `<?xml version="1.0" encoding="UTF-8"?>
+<library location="file:///Users/editor/Movies/Library.fcpbundle/">
+  <event name="Event"/>
+</library>`,
+		},
+	}
+
+	for _, tt := range tests {
+		decoder := NewDecoder(strings.NewReader(tt.xmlData))
+		timeline, err := decoder.Decode()
+		if !errors.Is(err, ErrFCPXMLNotSupported) {
+			t.Errorf("%s: expected ErrFCPXMLNotSupported, got %v", tt.name, err)
+		}
+		if timeline != nil {
+			t.Errorf("%s: expected nil timeline", tt.name)
+		}
+
+		if err := Sniff(strings.NewReader(tt.xmlData)); !errors.Is(err, ErrFCPXMLNotSupported) {
+			t.Errorf("%s: Sniff() expected ErrFCPXMLNotSupported, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestDecoder_DecodeXMEMLMentioningFCPXML(t *testing.T) {
+	// Valid xmeml that mentions fcpxml in names and paths must not be rejected
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>fcpxml conversion test</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>false</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip1">
+            <name>library resources fcpxml</name>
+            <duration>10</duration>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>false</ntsc>
+            </rate>
+            <start>0</start>
+            <end>10</end>
+            <in>0</in>
+            <out>10</out>
+            <file id="file-1">
+              <name>project.fcpxml.mov</name>
+              <pathurl>file:///exports/fcpxml/project.fcpxml.mov</pathurl>
+              <duration>10</duration>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	if err := Sniff(strings.NewReader(xmlData)); err != nil {
+		t.Errorf("Sniff() failed on valid xmeml: %v", err)
+	}
+
+	decoder := NewDecoder(strings.NewReader(xmlData))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+
+	if timeline.Name() != "fcpxml conversion test" {
+		t.Errorf("Expected timeline name 'fcpxml conversion test', got '%s'", timeline.Name())
+	}
+}
+
+func TestSniff_NotXMEML(t *testing.T) {
+	xmlData := `<?xml version="1.0"?>
+<invalid>
+  This is not valid FCP XML
+</invalid>`
+
+	err := Sniff(strings.NewReader(xmlData))
+	if err == nil {
+		t.Error("Expected error for non-xmeml root, got nil")
+	}
+	if errors.Is(err, ErrFCPXMLNotSupported) {
+		t.Error("Did not expect ErrFCPXMLNotSupported for non-FCPXML input")
+	}
+}
+
+func TestDecoder_ZeroOptionsMatchDefault(t *testing.T) {
+	data, err := os.ReadFile("testdata/premiere_example.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	expected, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	actual, err := NewDecoderWithOptions(bytes.NewReader(data), DecodeOptions{}).Decode()
+	if err != nil {
+		t.Fatalf("Decode() with zero options failed: %v", err)
+	}
+
+	if actual.Name() != expected.Name() {
+		t.Errorf("Expected name '%s', got '%s'", expected.Name(), actual.Name())
+	}
+
+	expectedTracks := expected.Tracks().Children()
+	actualTracks := actual.Tracks().Children()
+	if len(actualTracks) != len(expectedTracks) {
+		t.Fatalf("Expected %d tracks, got %d", len(expectedTracks), len(actualTracks))
+	}
+	for i := range expectedTracks {
+		expectedChildren := expectedTracks[i].(*gotio.Track).Children()
+		actualChildren := actualTracks[i].(*gotio.Track).Children()
+		if len(actualChildren) != len(expectedChildren) {
+			t.Errorf("Track %d: expected %d children, got %d", i, len(expectedChildren), len(actualChildren))
+			continue
+		}
+		for j := range expectedChildren {
+			if actualChildren[j].Name() != expectedChildren[j].Name() {
+				t.Errorf("Track %d item %d: expected '%s', got '%s'", i, j, expectedChildren[j].Name(), actualChildren[j].Name())
+			}
+		}
+	}
+}
+
+func TestDecoder_StrictRejectsRatelessClip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Rateless</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>false</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem>
+            <name>No Rate</name>
+            <duration>10</duration>
+            <start>0</start>
+            <end>10</end>
+            <in>0</in>
+            <out>10</out>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	if _, err := NewDecoder(strings.NewReader(xmlData)).Decode(); err != nil {
+		t.Fatalf("Decode() without options failed: %v", err)
+	}
+
+	_, err := NewDecoderWithOptions(strings.NewReader(xmlData), DecodeOptions{Strict: true}).Decode()
+	if err == nil {
+		t.Fatal("Expected strict decode to fail for clipitem without a rate")
+	}
+	if !strings.Contains(err.Error(), "No Rate") {
+		t.Errorf("Expected error to name the clip, got: %v", err)
+	}
+}
+
+func TestDecoder_TimingInconsistencies(t *testing.T) {
+	data, err := os.ReadFile("testdata/timing_inconsistent.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	expected := []string{
+		`video track 0: clipitem "Short Source": end - start (50) does not match out - in (40)`,
+		`video track 0: clipitem "Overlapping": overlaps clipitem "Short Source" by 10 frames`,
+		`audio track 0: transitionitem "Empty Dissolve": end 20 is not after start 20`,
+	}
+
+	decoder := NewDecoder(bytes.NewReader(data))
+	if _, err := decoder.Decode(); err != nil {
+		t.Fatalf("Decode() without options failed: %v", err)
+	}
+	var warnings []Warning
+	for _, w := range decoder.Warnings() {
+		if w.Category == WarningTimingInconsistency {
+			warnings = append(warnings, w)
+		}
+	}
+	if len(warnings) != len(expected) {
+		t.Fatalf("Expected %d timing warnings, got %d: %v", len(expected), len(warnings), warnings)
+	}
+	for i, w := range warnings {
+		if w.Message != expected[i] {
+			t.Errorf("Expected warning %q, got %q", expected[i], w.Message)
+		}
+	}
+
+	_, err = NewDecoderWithOptions(bytes.NewReader(data), DecodeOptions{Strict: true}).Decode()
+	if err == nil {
+		t.Fatal("Expected strict decode to fail for inconsistent timing")
+	}
+	for _, msg := range expected {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("Expected error to contain %q, got: %v", msg, err)
+		}
+	}
+	var timingErr *TimingError
+	if !errors.As(err, &timingErr) {
+		t.Fatalf("Expected a *TimingError in %v", err)
+	}
+	if timingErr.TrackIndex != 0 || timingErr.Name != "Short Source" {
+		t.Errorf("Expected first finding on track 0 for \"Short Source\", got track %d %q", timingErr.TrackIndex, timingErr.Name)
+	}
+}
+
+func TestDecoder_TimingAcrossRates(t *testing.T) {
+	// A 15fps clip in a 30fps sequence spans twice as many sequence frames
+	// as it uses source frames.
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Mixed Rates</name>
+    <rate>
+      <timebase>30</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem>
+            <name>Half Rate</name>
+            <duration>50</duration>
+            <rate>
+              <timebase>15</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>100</end>
+            <in>0</in>
+            <out>50</out>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	_, err := NewDecoderWithOptions(strings.NewReader(xmlData), DecodeOptions{Strict: true}).Decode()
+	if err != nil {
+		t.Errorf("Expected consistent mixed-rate timing to decode, got: %v", err)
+	}
+}
+
+func TestDecoder_WarningsWithPaths(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Edit</name>
+    <rate>
+      <timebase>24</timebase>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem>
+            <name>Offline</name>
+            <rate>
+              <timebase>24</timebase>
+            </rate>
+            <start>0</start>
+            <end>24</end>
+            <in>0</in>
+            <out>24</out>
+            <marker>
+              <name>Point</name>
+              <in>5</in>
+              <out>-1</out>
+            </marker>
+            <marker>
+              <name>Rateless</name>
+              <in>10</in>
+              <out>8</out>
+            </marker>
+          </clipitem>
+        </track>
+        <track>
+          <clipitem>
+            <name>Compound</name>
+            <rate>
+              <timebase>24</timebase>
+            </rate>
+            <start>-1</start>
+            <end>24</end>
+            <in>0</in>
+            <out>24</out>
+            <sequence id="nested-1">
+              <name>Inner</name>
+            </sequence>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	decoder := NewDecoder(strings.NewReader(xmlData))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+
+	expected := []struct {
+		category string
+		path     string
+	}{
+		{WarningMissingMedia, "Edit/Video 1/Offline"},
+		{WarningClampedMarker, "Edit/Video 1/Offline"},
+		{WarningUnknownStart, "Edit/Video 2/Compound"},
+		{WarningNestedSequence, "Edit/Video 2/Compound"},
+	}
+	warnings := decoder.Warnings()
+	if len(warnings) != len(expected) {
+		t.Fatalf("Expected %d warnings, got %d: %v", len(expected), len(warnings), warnings)
+	}
+	for i, w := range warnings {
+		if w.Category != expected[i].category || w.Path != expected[i].path {
+			t.Errorf("Expected warning %d to be %s at %q, got %s at %q",
+				i, expected[i].category, expected[i].path, w.Category, w.Path)
+		}
+		if w.Message == "" {
+			t.Errorf("Expected warning %d to have a message", i)
+		}
+	}
+	if !strings.HasPrefix(warnings[0].String(), "Edit/Video 1/Offline: missing_media: ") {
+		t.Errorf("Expected String() to lead with the path, got %q", warnings[0].String())
+	}
+
+	markers := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip).Markers()
+	for _, m := range markers {
+		if d := m.MarkedRange().Duration().Value(); d != 0 {
+			t.Errorf("Expected marker %q to have zero duration, got %v", m.Name(), d)
+		}
+	}
+}
+
+func TestDecoder_PadToSequenceDuration(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Trailing Blank</name>
+    <duration>500</duration>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>false</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem>
+            <name>First</name>
+            <rate>
+              <timebase>24</timebase>
+            </rate>
+            <start>0</start>
+            <end>150</end>
+            <in>0</in>
+            <out>150</out>
+          </clipitem>
+          <clipitem>
+            <name>Second</name>
+            <rate>
+              <timebase>24</timebase>
+            </rate>
+            <start>150</start>
+            <end>300</end>
+            <in>0</in>
+            <out>150</out>
+          </clipitem>
+        </track>
+      </video>
+      <audio>
+        <track>
+          <clipitem>
+            <name>Music</name>
+            <rate>
+              <timebase>24</timebase>
+            </rate>
+            <start>0</start>
+            <end>200</end>
+            <in>0</in>
+            <out>200</out>
+          </clipitem>
+        </track>
+      </audio>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if d, _ := timeline.Duration(); d.Value() != 300 {
+		t.Errorf("Expected content-only duration 300, got %v", d.Value())
+	}
+
+	opts := DecodeOptions{PadToSequenceDuration: true}
+	timeline, err = NewDecoderWithOptions(strings.NewReader(xmlData), opts).Decode()
+	if err != nil {
+		t.Fatalf("Decode() with padding failed: %v", err)
+	}
+	if d, _ := timeline.Duration(); d.Value() != 500 {
+		t.Errorf("Expected declared duration 500, got %v", d.Value())
+	}
+
+	tests := []struct {
+		track *gotio.Track
+		gap   float64
+	}{
+		{timeline.VideoTracks()[0], 200},
+		{timeline.AudioTracks()[0], 300},
+	}
+	for _, tt := range tests {
+		children := tt.track.Children()
+		gap, ok := children[len(children)-1].(*gotio.Gap)
+		if !ok {
+			t.Errorf("%s: Expected trailing Gap, got %T", tt.track.Name(), children[len(children)-1])
+			continue
+		}
+		if d, _ := gap.Duration(); d.Value() != tt.gap {
+			t.Errorf("%s: Expected gap of %v frames, got %v", tt.track.Name(), tt.gap, d.Value())
+		}
+	}
+}
+
+func TestDecoder_ExpandNestedSequences(t *testing.T) {
+	data, err := os.ReadFile("testdata/premiere_example.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	countStacks := func(timeline *gotio.Timeline) (stacks int, emptyStacks int) {
+		for _, child := range timeline.Tracks().Children() {
+			for _, item := range child.(*gotio.Track).Children() {
+				if stack, ok := item.(*gotio.Stack); ok {
+					stacks++
+					if len(stack.Children()) == 0 {
+						emptyStacks++
+					}
+				}
+			}
+		}
+		return stacks, emptyStacks
+	}
+
+	flat, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if stacks, _ := countStacks(flat); stacks != 0 {
+		t.Errorf("Expected no stacks without ExpandNestedSequences, got %d", stacks)
+	}
+
+	expanded, err := NewDecoderWithOptions(bytes.NewReader(data), DecodeOptions{ExpandNestedSequences: true}).Decode()
+	if err != nil {
+		t.Fatalf("Decode() with ExpandNestedSequences failed: %v", err)
+	}
+	stacks, emptyStacks := countStacks(expanded)
+	if stacks < 2 {
+		t.Fatalf("Expected nested sequences to decode as stacks, got %d", stacks)
+	}
+	if emptyStacks != 0 {
+		t.Errorf("Expected id-only nested sequence references to resolve, got %d empty stacks", emptyStacks)
+	}
+}
+
+func TestDecoder_RateMismatch(t *testing.T) {
+	data, err := os.ReadFile("testdata/rate_mismatch.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	sourceRanges := func(opts DecodeOptions) (*Decoder, []*gotio.Clip) {
+		decoder := NewDecoderWithOptions(bytes.NewReader(data), opts)
+		timeline, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Decode() failed: %v", err)
+		}
+		var clips []*gotio.Clip
+		for _, child := range timeline.VideoTracks()[0].Children() {
+			clips = append(clips, child.(*gotio.Clip))
+		}
+		return decoder, clips
+	}
+
+	// Without repair the clipitem is trusted, but the mismatch is reported
+	decoder, clips := sourceRanges(DecodeOptions{})
+	if len(decoder.Warnings()) != 2 {
+		t.Errorf("Expected 2 rate mismatch warnings, got %v", decoder.Warnings())
+	}
+	sr := clips[0].SourceRange()
+	if sr.StartTime().Value() != 25 || sr.Duration().Value() != 50 || sr.Duration().Rate() != 25 {
+		t.Errorf("Expected unrepaired range 25+50 @25, got %v+%v @%v",
+			sr.StartTime().Value(), sr.Duration().Value(), sr.Duration().Rate())
+	}
+
+	// With repair the repairable clip is expressed in the file's rate
+	_, clips = sourceRanges(DecodeOptions{RepairRateMismatch: true})
+	sr = clips[0].SourceRange()
+	if sr.StartTime().Value() != 24 || sr.Duration().Value() != 48 || sr.Duration().Rate() != 24 {
+		t.Errorf("Expected repaired range 24+48 @24, got %v+%v @%v",
+			sr.StartTime().Value(), sr.Duration().Value(), sr.Duration().Rate())
+	}
+
+	// The ambiguous clip is left alone
+	sr = clips[1].SourceRange()
+	if sr.StartTime().Value() != 0 || sr.Duration().Value() != 100 || sr.Duration().Rate() != 25 {
+		t.Errorf("Expected ambiguous clip to keep 0+100 @25, got %v+%v @%v",
+			sr.StartTime().Value(), sr.Duration().Value(), sr.Duration().Rate())
+	}
+}
+
+func TestDecoder_NonUTF8Encodings(t *testing.T) {
+	for _, fixture := range []string{"testdata/charset_latin1.xml", "testdata/charset_macroman.xml"} {
+		t.Run(fixture, func(t *testing.T) {
+			data, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatalf("Failed to read test file: %v", err)
+			}
+			timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+			if err != nil {
+				t.Fatalf("Decode() failed: %v", err)
+			}
+
+			if timeline.Name() != "Montage d'été" {
+				t.Errorf("Expected timeline name \"Montage d'été\", got %q", timeline.Name())
+			}
+			children := timeline.VideoTracks()[0].Children()
+			if len(children) != 2 {
+				t.Fatalf("Expected 2 clips, got %d", len(children))
+			}
+			if children[0].Name() != "Café Crème" {
+				t.Errorf("Expected clip name 'Café Crème', got %q", children[0].Name())
+			}
+			if children[1].Name() != "Señor Niño" {
+				t.Errorf("Expected clip name 'Señor Niño', got %q", children[1].Name())
+			}
+		})
+	}
+}
+
+func TestDecoder_UnknownCharset(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="x-klingon"?>
+<xmeml version="5"><sequence><name>Qapla</name></sequence></xmeml>`
+
+	_, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err == nil {
+		t.Fatal("Expected an error for an unknown charset")
+	}
+	if !strings.Contains(err.Error(), `unsupported character encoding "x-klingon"`) {
+		t.Errorf("Expected error naming the charset, got: %v", err)
+	}
+
+	// A custom CharsetReader can handle it
+	opts := DecodeOptions{
+		CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+			if charset == "x-klingon" {
+				return input, nil
+			}
+			return CharsetReader(charset, input)
+		},
+	}
+	timeline, err := NewDecoderWithOptions(strings.NewReader(xmlData), opts).Decode()
+	if err != nil {
+		t.Fatalf("Decode() with custom CharsetReader failed: %v", err)
+	}
+	if timeline.Name() != "Qapla" {
+		t.Errorf("Expected timeline name 'Qapla', got %q", timeline.Name())
+	}
+}
+
+func TestDecoder_XMEMLVersions(t *testing.T) {
+	decode := func(path string) (*Decoder, *gotio.Timeline) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read test file: %v", err)
+		}
+		decoder := NewDecoderWithOptions(bytes.NewReader(data), DecodeOptions{RepairRateMismatch: true})
+		timeline, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Decode() of %s failed: %v", path, err)
+		}
+		return decoder, timeline
+	}
+
+	// Version 5: the file's rate is its own, so the clipitem is repaired
+	decoder, timeline := decode("testdata/xmeml_v5.xml")
+	if version, _ := timeline.Metadata()["fcp7xml_version"].(int64); version != 5 {
+		t.Errorf("Expected fcp7xml_version 5, got %v", timeline.Metadata()["fcp7xml_version"])
+	}
+	if len(decoder.Warnings()) != 1 || decoder.Warnings()[0].Category != WarningRateMismatch {
+		t.Errorf("Expected 1 rate mismatch warning, got %v", decoder.Warnings())
+	}
+	clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	if sr := clip.SourceRange(); sr.StartTime().Value() != 24 || sr.Duration().Rate() != 24 {
+		t.Errorf("Expected repaired range starting at 24 @24, got %v @%v", sr.StartTime().Value(), sr.Duration().Rate())
+	}
+
+	// Version 3: the file's duration is counted in the clipitem's rate
+	decoder, timeline = decode("testdata/xmeml_v3.xml")
+	if version, _ := timeline.Metadata()["fcp7xml_version"].(int64); version != 3 {
+		t.Errorf("Expected fcp7xml_version 3, got %v", timeline.Metadata()["fcp7xml_version"])
+	}
+	if len(decoder.Warnings()) != 0 {
+		t.Errorf("Expected no warnings, got %v", decoder.Warnings())
+	}
+	clip = timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	if sr := clip.SourceRange(); sr.StartTime().Value() != 25 || sr.Duration().Rate() != 25 {
+		t.Errorf("Expected range starting at 25 @25, got %v @%v", sr.StartTime().Value(), sr.Duration().Rate())
+	}
+	if ar := clip.MediaReference().AvailableRange(); ar.Duration().Value() != 240 || ar.Duration().Rate() != 25 {
+		t.Errorf("Expected available range 240 @25, got %v @%v", ar.Duration().Value(), ar.Duration().Rate())
+	}
+}
+
+func TestDecoder_UnsupportedXMEMLVersion(t *testing.T) {
+	for _, version := range []string{"6", "five"} {
+		xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<xmeml version="` + version + `"><sequence><name>Future</name></sequence></xmeml>`
+
+		_, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+		if err == nil {
+			t.Errorf("Expected an error for xmeml version %q", version)
+			continue
+		}
+		if !strings.Contains(err.Error(), "xmeml version") {
+			t.Errorf("Expected error to explain the version, got: %v", err)
+		}
+	}
+}
+
+func TestDecoder_ProjectExport(t *testing.T) {
+	data, err := os.ReadFile("testdata/project_export.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	// Decode returns the first sequence, wherever it is
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if timeline.Name() != "Rough Cut" {
+		t.Errorf("Expected timeline 'Rough Cut', got '%s'", timeline.Name())
+	}
+
+	timelines, err := NewDecoder(bytes.NewReader(data)).DecodeAll()
+	if err != nil {
+		t.Fatalf("DecodeAll() failed: %v", err)
+	}
+	if len(timelines) != 2 {
+		t.Fatalf("Expected 2 timelines, got %d", len(timelines))
+	}
+
+	expected := []struct {
+		name, binPath string
+		duration      float64
+	}{
+		{"Rough Cut", "Documentary/Edits", 100},
+		{"Assembly", "Documentary/Edits/Old Versions", 250},
+	}
+	for i, want := range expected {
+		tl := timelines[i]
+		if tl.Name() != want.name {
+			t.Errorf("Timeline %d: expected name '%s', got '%s'", i, want.name, tl.Name())
+		}
+		if binPath, _ := tl.Metadata()["fcp7xml_bin_path"].(string); binPath != want.binPath {
+			t.Errorf("Timeline %d: expected bin path '%s', got '%s'", i, want.binPath, binPath)
+		}
+		duration, err := tl.Duration()
+		if err != nil {
+			t.Fatalf("Duration() failed: %v", err)
+		}
+		if duration.Value() != want.duration {
+			t.Errorf("Timeline %d: expected duration %v, got %v", i, want.duration, duration.Value())
+		}
+	}
+}
+
+func TestDecoder_MislabeledTrack(t *testing.T) {
+	data, err := os.ReadFile("testdata/mislabeled_tracks.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	decoder := NewDecoder(bytes.NewReader(data))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+
+	videoTracks := timeline.VideoTracks()
+	if len(videoTracks) != 1 {
+		t.Fatalf("Expected 1 video track, got %d", len(videoTracks))
+	}
+	if name := videoTracks[0].Children()[0].Name(); name != "picture" {
+		t.Errorf("Expected video clip 'picture', got '%s'", name)
+	}
+
+	audioTracks := timeline.AudioTracks()
+	if len(audioTracks) != 2 {
+		t.Fatalf("Expected 2 audio tracks, got %d", len(audioTracks))
+	}
+	if name := audioTracks[0].Children()[0].Name(); name != "dialogue" {
+		t.Errorf("Expected reclassified track first with clip 'dialogue', got '%s'", name)
+	}
+	if audioTracks[0].Name() != "Audio 1" || audioTracks[1].Name() != "Audio 2" {
+		t.Errorf("Expected tracks 'Audio 1' and 'Audio 2', got '%s' and '%s'", audioTracks[0].Name(), audioTracks[1].Name())
+	}
+
+	var reclassified []Warning
+	for _, w := range decoder.Warnings() {
+		if w.Category == WarningTrackReclassified {
+			reclassified = append(reclassified, w)
+		}
+	}
+	if len(reclassified) != 1 {
+		t.Fatalf("Expected 1 track_reclassified warning, got %v", decoder.Warnings())
+	}
+	if reclassified[0].Path != "Mislabeled/Audio 1" {
+		t.Errorf("Expected warning path 'Mislabeled/Audio 1', got '%s'", reclassified[0].Path)
+	}
+}
+
+func TestDecoder_StillImage(t *testing.T) {
+	data, err := os.ReadFile("testdata/still_image.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+
+	clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	ref, ok := clip.MediaReference().(*gotio.ExternalReference)
+	if !ok {
+		t.Fatalf("Expected an ExternalReference, got %T", clip.MediaReference())
+	}
+	if ref.AvailableRange() != nil {
+		t.Errorf("Expected no available range for a still, got %v", ref.AvailableRange())
+	}
+	if still, _ := ref.Metadata()["fcp7xml_still"].(bool); !still {
+		t.Error("Expected fcp7xml_still metadata on the reference")
+	}
+	dur, err := clip.Duration()
+	if err != nil {
+		t.Fatalf("Duration() failed: %v", err)
+	}
+	if dur.Value() != 125 {
+		t.Errorf("Expected clip duration 125 from in/out, got %v", dur.Value())
+	}
+
+	// The encoder doesn't invent a duration for the still
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	item := xmeml.Sequence[0].Media.Video.Track[0].ClipItem[0]
+	if item.File.Duration != 0 {
+		t.Errorf("Expected no file duration for the still, got %d", item.File.Duration)
+	}
+	if item.In != 0 || item.Out != 125 {
+		t.Errorf("Expected in/out 0/125, got %d/%d", item.In, item.Out)
+	}
+}
+
+func TestDecoder_AnamorphicDisplayAspect(t *testing.T) {
+	const doc = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Aspect</name>
+    <rate><timebase>30</timebase><ntsc>TRUE</ntsc></rate>
+    <media>
+      <video>
+        <format>
+          <samplecharacteristics>
+            <width>720</width>
+            <height>480</height>
+            <anamorphic>SEQUENCE</anamorphic>
+          </samplecharacteristics>
+        </format>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>Shot</name>
+            <duration>60</duration>
+            <rate><timebase>30</timebase><ntsc>TRUE</ntsc></rate>
+            <start>0</start>
+            <end>60</end>
+            <in>0</in>
+            <out>60</out>
+            <anamorphic>CLIP</anamorphic>
+            <file id="file-1">
+              <name>shot.mov</name>
+              <pathurl>file:///media/shot.mov</pathurl>
+              <duration>300</duration>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	tests := []struct {
+		clip, sequence string
+		expected       float64
+	}{
+		{"FALSE", "FALSE", 4.0 / 3.0},
+		{"TRUE", "FALSE", 16.0 / 9.0},
+		{"FALSE", "TRUE", 16.0 / 9.0},
+		// The sequence already stretches the clip; it isn't stretched twice
+		{"TRUE", "TRUE", 16.0 / 9.0},
+	}
+
+	for _, tt := range tests {
+		input := strings.NewReplacer("CLIP", tt.clip, "SEQUENCE", tt.sequence).Replace(doc)
+		timeline, err := NewDecoder(strings.NewReader(input)).Decode()
+		if err != nil {
+			t.Fatalf("clip %s, sequence %s: Decode() failed: %v", tt.clip, tt.sequence, err)
+		}
+
+		clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+		aspect, ok := clip.Metadata()["fcp7xml_display_aspect"].(float64)
+		if !ok || aspect != tt.expected {
+			t.Errorf("clip %s, sequence %s: expected display aspect %.4f, got %v", tt.clip, tt.sequence, tt.expected, clip.Metadata()["fcp7xml_display_aspect"])
+		}
+		if mode := timeline.Metadata()["fcp7xml_anamorphic"]; mode != tt.sequence {
+			t.Errorf("clip %s, sequence %s: expected sequence anamorphic '%s', got %v", tt.clip, tt.sequence, tt.sequence, mode)
+		}
+
+		// Both raw flags survive a round trip
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(timeline); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		var xmeml XMEML
+		if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+			t.Fatalf("Failed to parse encoded XML: %v", err)
+		}
+		video := xmeml.Sequence[0].Media.Video
+		if video.Format == nil || video.Format.SampleCharacteristics.AnamorphicMode != tt.sequence {
+			t.Errorf("clip %s, sequence %s: expected sequence format anamorphic '%s', got %+v", tt.clip, tt.sequence, tt.sequence, video.Format)
+		}
+		item := video.Track[0].ClipItem[0]
+		if item.Anamorphic == nil || *item.Anamorphic != (tt.clip == "TRUE") {
+			t.Errorf("clip %s, sequence %s: expected clipitem anamorphic %s, got %v", tt.clip, tt.sequence, tt.clip, item.Anamorphic)
+		}
+	}
+}
+
+func TestDecoder_FileReferences(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Shared Media</name>
+    <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>Take 1</name>
+            <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+            <start>0</start>
+            <end>24</end>
+            <in>0</in>
+            <out>24</out>
+            <file id="file-1">
+              <name>take.mov</name>
+              <pathurl>file:///media/take.mov</pathurl>
+              <duration>240</duration>
+            </file>
+          </clipitem>
+          <clipitem id="clipitem-2">
+            <name>Take 1 again</name>
+            <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+            <start>24</start>
+            <end>48</end>
+            <in>100</in>
+            <out>124</out>
+            <file id="file-1"/>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	decoder := NewDecoder(strings.NewReader(xmlData))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+
+	for i, child := range timeline.VideoTracks()[0].Children() {
+		clip := child.(*gotio.Clip)
+		ref, ok := clip.MediaReference().(*gotio.ExternalReference)
+		if !ok {
+			t.Errorf("Clip %d: expected an ExternalReference, got %T", i, clip.MediaReference())
+			continue
+		}
+		if ref.TargetURL() != "file:///media/take.mov" {
+			t.Errorf("Clip %d: expected target URL 'file:///media/take.mov', got '%s'", i, ref.TargetURL())
+		}
+		if ar := ref.AvailableRange(); ar == nil || ar.Duration().Value() != 240 {
+			t.Errorf("Clip %d: expected available range of 240 frames, got %v", i, ar)
+		}
+	}
+	for _, w := range decoder.Warnings() {
+		if w.Category == WarningMissingMedia {
+			t.Errorf("Unexpected missing media warning: %s", w.Message)
+		}
+	}
+}
+
+func TestPixelAspectRatioValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected float64
+		ok       bool
+	}{
+		{"Square", 1, true},
+		{"square", 1, true},
+		{"NTSC-601", 10.0 / 11.0, true},
+		{"NTSC-CCIR-601", 10.0 / 11.0, true},
+		{"PAL-601", 59.0 / 54.0, true},
+		{"PAL-CCIR-601", 59.0 / 54.0, true},
+		{"HD-(960x720)", 4.0 / 3.0, true},
+		{"HD-(1280x1080)", 3.0 / 2.0, true},
+		{"HD-(1440x1080)", 4.0 / 3.0, true},
+		{" 1.5 ", 1.5, true},
+		{"NTSC CCIR 601/DV (0.9091)", 0.9091, true},
+		{"Cinemascope", 0, false},
+		{"", 0, false},
+		{"-1", 0, false},
+	}
+
+	for _, tt := range tests {
+		ratio, ok := PixelAspectRatioValue(tt.name)
+		if ok != tt.ok || ratio != tt.expected {
+			t.Errorf("PixelAspectRatioValue(%q): expected %v, %v, got %v, %v", tt.name, tt.expected, tt.ok, ratio, ok)
+		}
+	}
+}
+
+func TestDecoder_FieldDominance(t *testing.T) {
+	data, err := os.ReadFile("testdata/interlaced_lower.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if fd := timeline.Metadata()["fcp7xml_fielddominance"]; fd != "lower" {
+		t.Errorf("Expected sequence field dominance 'lower', got %v", fd)
+	}
+
+	expected := []string{"lower", "none", ""}
+	children := timeline.VideoTracks()[0].Children()
+	for i, want := range expected {
+		ref := children[i].(*gotio.Clip).MediaReference()
+		got, _ := ref.Metadata()["fcp7xml_fielddominance"].(string)
+		if got != want {
+			t.Errorf("Clip %d: expected field dominance '%s', got '%s'", i, want, got)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var original, encoded XMEML
+	if err := xml.Unmarshal(data, &original); err != nil {
+		t.Fatalf("Failed to parse test file: %v", err)
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+
+	format := encoded.Sequence[0].Media.Video.Format
+	if format == nil || format.SampleCharacteristics.FieldDominance != "lower" {
+		t.Errorf("Expected sequence format field dominance 'lower', got %+v", format)
+	}
+	originalItems := original.Sequence[0].Media.Video.Track[0].ClipItem
+	for i, item := range encoded.Sequence[0].Media.Video.Track[0].ClipItem {
+		want := fileVideoCharacteristics(originalItems[i].File)
+		got := fileVideoCharacteristics(item.File)
+		if want == nil {
+			// Material with no field setting doesn't gain one
+			if got != nil {
+				t.Errorf("Clip %d: expected no sample characteristics, got %+v", i, *got)
+			}
+			continue
+		}
+		if got == nil || got.FieldDominance != want.FieldDominance {
+			t.Errorf("Clip %d: expected field dominance '%s', got %+v", i, want.FieldDominance, got)
+		}
+	}
+}
+
+func TestDecoder_SequenceWithoutRate(t *testing.T) {
+	const doc = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>No Rate</name>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>Shot</name>
+            CLIPRATE
+            <start>0</start>
+            <end>50</end>
+            <in>10</in>
+            <out>60</out>
+            <file id="file-1">
+              <name>shot.mov</name>
+              <pathurl>file:///media/shot.mov</pathurl>
+              <duration>100</duration>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	tests := []struct {
+		name     string
+		clipRate string
+		expected float64
+	}{
+		{"rate from clipitem", "<rate><timebase>25</timebase><ntsc>FALSE</ntsc></rate>", 25},
+		{"default rate", "", 24},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := NewDecoder(strings.NewReader(strings.Replace(doc, "CLIPRATE", tt.clipRate, 1)))
+			timeline, err := decoder.Decode()
+			if err != nil {
+				t.Fatalf("Decode() failed: %v", err)
+			}
+
+			clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+			sr := clip.SourceRange()
+			if sr.StartTime().Rate() != tt.expected || sr.Duration().Rate() != tt.expected {
+				t.Errorf("Expected source range at %v fps, got %v", tt.expected, sr)
+			}
+			if sr.StartTime().Value() != 10 || sr.Duration().Value() != 50 {
+				t.Errorf("Expected source range 10+50, got %v+%v", sr.StartTime().Value(), sr.Duration().Value())
+			}
+			if ar := clip.MediaReference().AvailableRange(); ar == nil || ar.Duration().Rate() != tt.expected {
+				t.Errorf("Expected available range at %v fps, got %v", tt.expected, ar)
+			}
+
+			found := false
+			for _, w := range decoder.Warnings() {
+				if w.Category == WarningMissingRate {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Expected a %s warning, got %v", WarningMissingRate, decoder.Warnings())
+			}
+		})
+	}
+
+	// Strict mode still rejects the sequence
+	_, err := NewDecoderWithOptions(strings.NewReader(strings.Replace(doc, "CLIPRATE", "", 1)), DecodeOptions{Strict: true}).Decode()
+	if err == nil {
+		t.Error("Expected an error for a sequence without a rate in strict mode")
+	}
+}
+
+func TestDecoder_RatelessItems(t *testing.T) {
+	data, err := os.ReadFile("testdata/rateless_items.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+
+	const sequenceRate = 30 * 1000.0 / 1001.0
+	children := timeline.VideoTracks()[0].Children()
+	if len(children) != 4 {
+		t.Fatalf("Expected 4 items, got %d", len(children))
+	}
+
+	expectedDurations := map[int]float64{0: 30, 2: 20, 3: 30}
+	for i, expected := range expectedDurations {
+		clip := children[i].(*gotio.Clip)
+		dur, err := clip.Duration()
+		if err != nil {
+			t.Fatalf("Duration() failed: %v", err)
+		}
+		if dur.Value() != expected || dur.Rate() != sequenceRate {
+			t.Errorf("Expected %s to last %v frames at %v fps, got %v at %v", clip.Name(), expected, sequenceRate, dur.Value(), dur.Rate())
+		}
+		if inherited, _ := clip.Metadata()["fcp7xml_rate_inherited"].(bool); !inherited {
+			t.Errorf("Expected %s to be flagged as inheriting the sequence rate", clip.Name())
+		}
+	}
+
+	transition := children[1].(*gotio.Transition)
+	if transition.InOffset().Rate() != sequenceRate || transition.InOffset().Value() != 10 {
+		t.Errorf("Expected transition in offset of 10 frames at %v fps, got %v", sequenceRate, transition.InOffset())
+	}
+	if inherited, _ := transition.Metadata()["fcp7xml_rate_inherited"].(bool); !inherited {
+		t.Error("Expected the transition to be flagged as inheriting the sequence rate")
+	}
+}
+
+func TestDecoder_MixedRatePlacement(t *testing.T) {
+	data, err := os.ReadFile("testdata/mixed_rate.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+
+	const sequenceRate = 30 * 1000.0 / 1001.0
+	const clipRate = 24 * 1000.0 / 1001.0
+	track := timeline.VideoTracks()[0]
+	children := track.Children()
+	if len(children) != 4 {
+		t.Fatalf("Expected interview, gap and two film clips, got %d items", len(children))
+	}
+	if _, ok := children[1].(*gotio.Gap); !ok {
+		t.Errorf("Expected a gap before the first film clip, got %T", children[1])
+	}
+
+	tests := []struct {
+		index      int
+		start, end float64
+		in         float64
+	}{
+		{0, 0, 60, 0},
+		{2, 90, 150, 0},
+		{3, 150, 213, 100},
+	}
+	for _, tt := range tests {
+		clip := children[tt.index].(*gotio.Clip)
+		r, err := track.RangeOfChildAtIndex(tt.index)
+		if err != nil {
+			t.Fatalf("RangeOfChildAtIndex(%d) failed: %v", tt.index, err)
+		}
+		start := math.Round(r.StartTime().ValueRescaledTo(sequenceRate)*1000) / 1000
+		end := math.Round(r.EndTimeExclusive().ValueRescaledTo(sequenceRate)*1000) / 1000
+		if start != tt.start || end != tt.end {
+			t.Errorf("Expected %s at %v-%v in the sequence, got %v-%v", clip.Name(), tt.start, tt.end, start, end)
+		}
+
+		// The source range starts in the clip's own rate
+		sr := clip.SourceRange()
+		if tt.index > 0 && (sr.StartTime().Rate() != clipRate || sr.StartTime().Value() != tt.in) {
+			t.Errorf("Expected %s to start at %v in its media at %v fps, got %v", clip.Name(), tt.in, clipRate, sr.StartTime())
+		}
+	}
+}
+
+func TestDecoder_FullMediaInOut(t *testing.T) {
+	const doc = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Full Media</name>
+    <rate><timebase>25</timebase><ntsc>FALSE</ntsc></rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>Interview</name>
+            <rate><timebase>25</timebase><ntsc>FALSE</ntsc></rate>
+            <start>0</start>
+            <end>250</end>
+            <in>-1</in>
+            <out>-1</out>
+            <file id="file-1">
+              <name>interview.mov</name>
+              <pathurl>file:///media/interview.mov</pathurl>
+              <rate><timebase>25</timebase><ntsc>FALSE</ntsc></rate>
+              <duration>250</duration>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	decoder := NewDecoder(strings.NewReader(doc))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+
+	clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	sr := clip.SourceRange()
+	if sr.StartTime().Value() != 0 || sr.Duration().Value() != 250 {
+		t.Errorf("Expected source range 0+250, got %v+%v", sr.StartTime().Value(), sr.Duration().Value())
+	}
+	if ar := clip.MediaReference().AvailableRange(); ar == nil || *ar != *sr {
+		t.Errorf("Expected source range to span the whole file %v, got %v", ar, sr)
+	}
+	for _, w := range decoder.Warnings() {
+		if w.Category == WarningTimingInconsistency {
+			t.Errorf("Expected no timing warnings, got %v", w)
+		}
+	}
+}
+
+func TestDecoder_FullMediaInOutMixedRate(t *testing.T) {
+	// A 48 fps file used to its end by a 24 fps clipitem
+	doc := func(clipDuration string) string {
+		return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Full Media</name>
+    <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>Slow Motion</name>
+            ` + clipDuration + `
+            <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+            <start>0</start>
+            <end>240</end>
+            <in>-1</in>
+            <out>-1</out>
+            <file id="file-1">
+              <name>slowmo.mov</name>
+              <pathurl>file:///media/slowmo.mov</pathurl>
+              <rate><timebase>48</timebase><ntsc>FALSE</ntsc></rate>
+              <duration>480</duration>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+	}
+
+	for _, clipDuration := range []string{"", "<duration>240</duration>"} {
+		decoder := NewDecoder(strings.NewReader(doc(clipDuration)))
+		timeline, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Decode() failed: %v", err)
+		}
+
+		clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+		sr := clip.SourceRange()
+		if sr.StartTime().Value() != 0 || sr.Duration().Value() != 240 || sr.Duration().Rate() != 24 {
+			t.Errorf("%q: Expected source range 0+240 at 24 fps, got %v+%v at %v",
+				clipDuration, sr.StartTime().Value(), sr.Duration().Value(), sr.Duration().Rate())
+		}
+		for _, w := range decoder.Warnings() {
+			if w.Category == WarningTimingInconsistency {
+				t.Errorf("%q: Expected no timing warnings, got %v", clipDuration, w)
+			}
+		}
+	}
+}
+
+func TestDecoder_Diagnostics(t *testing.T) {
+	const doc = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Diagnostics</name>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>Offline</name>
+            <start>0</start>
+            <end>50</end>
+            <in>0</in>
+            <out>50</out>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	var diagnostics bytes.Buffer
+	decoder := NewDecoderWithOptions(strings.NewReader(doc), DecodeOptions{Diagnostics: &diagnostics})
+	if _, err := decoder.Decode(); err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+
+	warnings := decoder.Warnings()
+	if len(warnings) == 0 {
+		t.Fatal("Expected warnings for a sequence without a rate and a clip without media")
+	}
+	lines := strings.Split(strings.TrimSuffix(diagnostics.String(), "\n"), "\n")
+	if len(lines) != len(warnings) {
+		t.Fatalf("Expected %d diagnostic lines, got %d: %q", len(warnings), len(lines), diagnostics.String())
+	}
+	for i, w := range warnings {
+		if lines[i] != w.String() {
+			t.Errorf("Expected line %d to be %q, got %q", i, w.String(), lines[i])
+		}
+	}
+}
+
+// decodeWhole is Decode without streaming: it parses the whole document
+// first, as DecodeAll does, and converts the first sequence.
+func decodeWhole(d *Decoder) (*gotio.Timeline, error) {
+	sequences, err := d.readSequences()
+	if err != nil {
+		return nil, err
+	}
+	return d.convertSequence(sequences[0].sequence, sequences[0].binPath)
+}
+
+func TestDecoder_StreamingMatchesWholeDocument(t *testing.T) {
+	files, err := os.ReadDir("testdata")
+	if err != nil {
+		t.Fatalf("Failed to list testdata: %v", err)
+	}
+	optionSets := []DecodeOptions{
+		{},
+		{Strict: true},
+		{PadToSequenceDuration: true, RepairRateMismatch: true},
+		{ExpandNestedSequences: true},
+	}
+	for _, file := range files {
+		data, err := os.ReadFile("testdata/" + file.Name())
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file.Name(), err)
+		}
+		for _, opts := range optionSets {
+			var expectedSidecar, sidecar bytes.Buffer
+			opts.Sidecar = &expectedSidecar
+			decoder := NewDecoderWithOptions(bytes.NewReader(data), opts)
+			expected, expectedErr := decodeWhole(decoder)
+			expectedWarnings := decoder.Warnings()
+
+			opts.Sidecar = &sidecar
+			streamer := NewDecoderWithOptions(bytes.NewReader(data), opts)
+			timeline, err := streamer.Decode()
+			opts.Sidecar = nil
+
+			if (err != nil) != (expectedErr != nil) {
+				t.Errorf("%s %+v: Expected error %v, got %v", file.Name(), opts, expectedErr, err)
+				continue
+			}
+			if err != nil {
+				continue
+			}
+			if sidecar.String() != expectedSidecar.String() {
+				t.Errorf("%s %+v: Expected the sidecar to match the whole document's, got\n%s\nwant\n%s",
+					file.Name(), opts, sidecar.String(), expectedSidecar.String())
+			}
+
+			// The timelines match if they encode to the same document
+			var expectedXML, streamedXML bytes.Buffer
+			if err := NewEncoder(&expectedXML).Encode(expected); err != nil {
+				t.Fatalf("%s: Encode failed: %v", file.Name(), err)
+			}
+			if err := NewEncoder(&streamedXML).Encode(timeline); err != nil {
+				t.Fatalf("%s: Encode failed: %v", file.Name(), err)
+			}
+			if streamedXML.String() != expectedXML.String() {
+				t.Errorf("%s %+v: Expected the streamed timeline to match the whole document's, got\n%s\nwant\n%s",
+					file.Name(), opts, streamedXML.String(), expectedXML.String())
+			}
+
+			// Warnings may be found in a different order
+			warnings := streamer.Warnings()
+			if len(warnings) != len(expectedWarnings) {
+				t.Errorf("%s %+v: Expected %d warnings, got %d", file.Name(), opts, len(expectedWarnings), len(warnings))
+				continue
+			}
+			found := make(map[Warning]int)
+			for _, w := range expectedWarnings {
+				found[w]++
+			}
+			for _, w := range warnings {
+				if found[w] == 0 {
+					t.Errorf("%s %+v: Unexpected warning %v", file.Name(), opts, w)
+				}
+				found[w]--
+			}
+		}
+	}
+}
+
+func TestDecoder_StreamingExpandsLaterSequence(t *testing.T) {
+	const document = `<?xml version="1.0" encoding="UTF-8"?>
+<xmeml version="5">
+  <sequence id="main">
+    <name>Main</name>
+    <rate><timebase>24</timebase></rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>Shot A</name>
+            <start>0</start>
+            <end>24</end>
+            <in>0</in>
+            <out>24</out>
+          </clipitem>
+        </track>
+        <track>
+          <clipitem id="clipitem-2">
+            <name>Nest</name>
+            <start>0</start>
+            <end>24</end>
+            <in>0</in>
+            <out>24</out>
+            <sequence id="nested"/>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+  <bin>
+    <name>Nests</name>
+    <children>
+      <sequence id="nested">
+        <name>Nested</name>
+        <rate><timebase>24</timebase></rate>
+        <media>
+          <video>
+            <track>
+              <clipitem id="clipitem-3">
+                <name>Shot B</name>
+                <start>0</start>
+                <end>24</end>
+                <in>0</in>
+                <out>24</out>
+              </clipitem>
+            </track>
+          </video>
+        </media>
+      </sequence>
+    </children>
+  </bin>
+</xmeml>`
+
+	opts := DecodeOptions{ExpandNestedSequences: true}
+	timeline, err := NewDecoderWithOptions(strings.NewReader(document), opts).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	tracks := timeline.Tracks().Children()
+	if len(tracks) != 2 {
+		t.Fatalf("Expected 2 tracks, got %d", len(tracks))
+	}
+	stack, ok := tracks[1].(*gotio.Track).Children()[0].(*gotio.Stack)
+	if !ok {
+		t.Fatalf("Expected the nested sequence to be expanded, got %T", tracks[1].(*gotio.Track).Children()[0])
+	}
+	nested := stack.Children()
+	if len(nested) != 1 || len(nested[0].(*gotio.Track).Children()) != 1 {
+		t.Fatalf("Expected the nested sequence's track and clip, got %d tracks", len(nested))
+	}
+	if name := nested[0].(*gotio.Track).Children()[0].Name(); name != "Shot B" {
+		t.Errorf("Expected nested clip 'Shot B', got '%s'", name)
+	}
+
+	// A sequence can't be expanded within itself
+	selfNested := strings.Replace(document, `<sequence id="nested"/>`, `<sequence id="main"/>`, 1)
+	if _, err := NewDecoderWithOptions(strings.NewReader(selfNested), opts).Decode(); err == nil || !strings.Contains(err.Error(), "contains itself") {
+		t.Errorf("Expected a self-nested sequence to fail, got %v", err)
+	}
+}
+
+func TestDecoder_UppercaseNTSC(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<xmeml version="5">
+  <sequence>
+    <name>NTSC</name>
+    <rate>
+      <timebase>30</timebase>
+      <ntsc>TRUE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip1">
+            <name>Clip</name>
+            <rate>
+              <timebase>30</timebase>
+              <ntsc>TRUE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>60</end>
+            <in>0</in>
+            <out>60</out>
+            <file id="file-1">
+              <name>clip.mov</name>
+              <pathurl>file:///media/clip.mov</pathurl>
+              <rate>
+                <timebase>30</timebase>
+                <ntsc>FALSE</ntsc>
+              </rate>
+              <duration>300</duration>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	if rate := clip.SourceRange().Duration().Rate(); math.Abs(rate-29.97) > 0.01 {
+		t.Errorf("Expected a clip rate of 29.97 from <ntsc>TRUE</ntsc>, got %v", rate)
+	}
+	ref := clip.MediaReference().(*gotio.ExternalReference)
+	if available := ref.AvailableRange(); available == nil || available.Duration().Rate() != 30 {
+		t.Errorf("Expected the file's available range at 30 fps from <ntsc>FALSE</ntsc>, got %v", available)
+	}
+}
+
+// nestedSequenceXML returns a document whose sequence holds a clipitem
+// wrapping a sequence, depth levels deep.
+func nestedSequenceXML(depth int) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?><xmeml version="5">`)
+	for i := 0; i <= depth; i++ {
+		b.WriteString(`<sequence><name>Level ` + strconv.Itoa(i) + `</name><rate><timebase>24</timebase></rate><media><video><track>`)
+		if i < depth {
+			b.WriteString(`<clipitem><name>Nest</name><start>0</start><end>24</end><in>0</in><out>24</out>`)
+		}
+	}
+	for i := depth; i >= 0; i-- {
+		if i < depth {
+			b.WriteString(`</clipitem>`)
+		}
+		b.WriteString(`</track></video></media></sequence>`)
+	}
+	b.WriteString(`</xmeml>`)
+	return b.String()
+}
+
+// repeatReader reads prefix, then s over and over without end.
+type repeatReader struct {
+	prefix string
+	s      string
+	off    int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if r.prefix != "" {
+			c := copy(p[n:], r.prefix)
+			r.prefix = r.prefix[c:]
+			n += c
+			continue
+		}
+		c := copy(p[n:], r.s[r.off:])
+		r.off = (r.off + c) % len(r.s)
+		n += c
+	}
+	return n, nil
+}
+
+func TestDecoder_Limits(t *testing.T) {
+	data, err := os.ReadFile("testdata/features_test.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	const sequenceHeader = `<?xml version="1.0" encoding="UTF-8"?><xmeml version="5"><sequence><name>Hostile</name><rate><timebase>24</timebase></rate>`
+	tests := []struct {
+		name     string
+		document io.Reader
+		opts     DecodeOptions
+		// limit is the LimitError.Limit expected, or "" for none
+		limit string
+	}{
+		{"elements within the default", bytes.NewReader(data), DecodeOptions{}, ""},
+		{"too many elements", bytes.NewReader(data), DecodeOptions{MaxElements: 20}, "MaxElements"},
+		{"too many clipitems", bytes.NewReader(data), DecodeOptions{MaxClipItems: 2}, "MaxClipItems"},
+		{"too many sequences", strings.NewReader(nestedSequenceXML(3)), DecodeOptions{MaxSequences: 3}, "MaxSequences"},
+		{"file too large", bytes.NewReader(data), DecodeOptions{MaxFileSizeBytes: 1024}, "MaxFileSizeBytes"},
+		{"no file size limit", bytes.NewReader(data), DecodeOptions{MaxFileSizeBytes: -1}, ""},
+		{"nesting within the limit", strings.NewReader(nestedSequenceXML(3)), DecodeOptions{MaxNestingDepth: 3}, ""},
+		{"nesting too deep", strings.NewReader(nestedSequenceXML(3)), DecodeOptions{MaxNestingDepth: 2}, "MaxNestingDepth"},
+		{"nesting too deep, expanded", strings.NewReader(nestedSequenceXML(3)), DecodeOptions{MaxNestingDepth: 2, ExpandNestedSequences: true}, "MaxNestingDepth"},
+		{"no nesting limit", strings.NewReader(nestedSequenceXML(100)), DecodeOptions{MaxNestingDepth: -1}, ""},
+		// Endless documents must stop at a limit rather than grow without
+		// bound.
+		{"endless markers", &repeatReader{prefix: sequenceHeader, s: `<marker><name>M</name><in>0</in><out>-1</out></marker>`}, DecodeOptions{MaxElements: 100_000}, "MaxElements"},
+		{"endless clipitems", &repeatReader{prefix: sequenceHeader + `<media><video><track>`, s: `<clipitem><name>C</name><start>0</start><end>1</end><in>0</in><out>1</out></clipitem>`}, DecodeOptions{MaxClipItems: 10_000}, "MaxClipItems"},
+		{"endless sequences", &repeatReader{prefix: `<?xml version="1.0" encoding="UTF-8"?><xmeml version="5">`, s: `<sequence id="s"/>`}, DecodeOptions{}, "MaxSequences"},
+		{"endless text", &repeatReader{prefix: sequenceHeader + `<name>`, s: `Hostile `}, DecodeOptions{MaxFileSizeBytes: 1 << 20}, "MaxFileSizeBytes"},
+	}
+	for _, tt := range tests {
+		_, err := NewDecoderWithOptions(tt.document, tt.opts).Decode()
+		if tt.limit == "" {
+			if err != nil {
+				t.Errorf("%s: Decode() failed: %v", tt.name, err)
+			}
+			continue
+		}
+		var limitErr *LimitError
+		if !errors.Is(err, ErrLimitExceeded) || !errors.As(err, &limitErr) {
+			t.Errorf("%s: Expected ErrLimitExceeded, got %v", tt.name, err)
+		} else if limitErr.Limit != tt.limit {
+			t.Errorf("%s: Expected limit %s, got %s", tt.name, tt.limit, limitErr.Limit)
+		}
+	}
+}
+
+func TestDecoder_EntityExpansion(t *testing.T) {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?><!DOCTYPE xmeml [<!ENTITY lol0 "lol">`)
+	for i := 1; i <= 9; i++ {
+		fmt.Fprintf(&b, `<!ENTITY lol%d "%s">`, i, strings.Repeat("&lol"+strconv.Itoa(i-1)+";", 10))
+	}
+	b.WriteString(`]><xmeml version="5"><sequence><name>&lol9;</name><rate><timebase>24</timebase></rate></sequence></xmeml>`)
+
+	for _, decode := range []func(*Decoder) (*gotio.Timeline, error){(*Decoder).Decode, decodeWhole} {
+		timeline, err := decode(NewDecoder(strings.NewReader(b.String())))
+		if err == nil && len(timeline.Name()) > len("&lol9;") {
+			t.Errorf("Expected entities not to be expanded, got a name of %d bytes", len(timeline.Name()))
+		}
+	}
+}
+
+func TestMarkerColor(t *testing.T) {
+	tests := []struct {
+		name     string
+		color    *Color
+		expected gotio.MarkerColor
+	}{
+		{"no color", nil, gotio.MarkerColorGreen},
+		{"red", &Color{Red: 255}, gotio.MarkerColorRed},
+		{"dark red", &Color{Red: 160, Green: 20, Blue: 10}, gotio.MarkerColorRed},
+		{"orange", &Color{Red: 255, Green: 140, Blue: 0}, gotio.MarkerColorOrange},
+		{"yellow", &Color{Red: 240, Green: 230, Blue: 40}, gotio.MarkerColorYellow},
+		{"green", &Color{Green: 255}, gotio.MarkerColorGreen},
+		{"cyan", &Color{Green: 200, Blue: 220}, gotio.MarkerColorCyan},
+		{"blue", &Color{Blue: 255}, gotio.MarkerColorBlue},
+		{"purple", &Color{Red: 120, Green: 20, Blue: 230}, gotio.MarkerColorPurple},
+		{"magenta", &Color{Red: 230, Green: 10, Blue: 240}, gotio.MarkerColorMagenta},
+		{"pink", &Color{Red: 255, Green: 150, Blue: 200}, gotio.MarkerColorPink},
+		{"black", &Color{Red: 10, Green: 10, Blue: 10}, gotio.MarkerColorBlack},
+		{"white", &Color{Red: 250, Green: 250, Blue: 250}, gotio.MarkerColorWhite},
+	}
+	for _, tt := range tests {
+		if got := markerColor(tt.color); got != tt.expected {
+			t.Errorf("%s: Expected %s, got %s", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestDecoder_MediaReferenceKey(t *testing.T) {
+	f, err := os.Open("testdata/sample.xml")
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer f.Close()
+
+	timeline, err := NewDecoderWithOptions(f, DecodeOptions{MediaReferenceKey: "proxy"}).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	clips := 0
+	for _, track := range timeline.Tracks().Children() {
+		for _, child := range track.(*gotio.Track).Children() {
+			clip, ok := child.(*gotio.Clip)
+			if !ok {
+				continue
+			}
+			clips++
+			if clip.ActiveMediaReferenceKey() != "proxy" {
+				t.Errorf("%s: Expected active media reference key 'proxy', got '%s'", clip.Name(), clip.ActiveMediaReferenceKey())
+			}
+			if _, ok := clip.MediaReferences()["proxy"]; !ok {
+				t.Errorf("%s: Expected a media reference under 'proxy'", clip.Name())
+			}
+		}
+	}
+	if clips == 0 {
+		t.Fatal("Expected clips in the timeline")
+	}
+}
+
+func TestDecoder_DecodeError(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		f, err := os.Open("testdata/broken_clip.xml")
+		if err != nil {
+			t.Fatalf("Failed to open test file: %v", err)
+		}
+		decoder := NewDecoderWithOptions(f, DecodeOptions{Strict: true})
+		if streaming {
+			_, err = decoder.Decode()
+		} else {
+			_, err = decodeWhole(decoder)
+		}
+		f.Close()
+
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Fatalf("streaming=%v: Expected a DecodeError, got %v", streaming, err)
+		}
+		if decodeErr.Line != 41 {
+			t.Errorf("streaming=%v: Expected line 41, got %d", streaming, decodeErr.Line)
+		}
+		if decodeErr.Sequence != "Broken Clip" {
+			t.Errorf("streaming=%v: Expected sequence 'Broken Clip', got '%s'", streaming, decodeErr.Sequence)
+		}
+		if decodeErr.TrackKind != gotio.TrackKindAudio || decodeErr.TrackIndex != 1 {
+			t.Errorf("streaming=%v: Expected audio track 1, got %s track %d", streaming, decodeErr.TrackKind, decodeErr.TrackIndex)
+		}
+		if decodeErr.ItemName != "Rateless" {
+			t.Errorf("streaming=%v: Expected item 'Rateless', got '%s'", streaming, decodeErr.ItemName)
+		}
+		if cause := errors.Unwrap(decodeErr); cause == nil || !strings.Contains(cause.Error(), "has no frame rate") {
+			t.Errorf("streaming=%v: Expected the missing rate cause, got %v", streaming, cause)
+		}
+		if !strings.HasPrefix(decodeErr.Error(), `line 41, sequence "Broken Clip", Audio 2, item "Rateless"`) {
+			t.Errorf("streaming=%v: Expected the context in the message, got %q", streaming, decodeErr.Error())
+		}
+	}
+}
+
+func TestDecoder_DecodeSequence(t *testing.T) {
+	data, err := os.ReadFile("testdata/three_sequences.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	all, err := NewDecoder(bytes.NewReader(data)).DecodeAll()
+	if err != nil {
+		t.Fatalf("DecodeAll() failed: %v", err)
+	}
+
+	// Sequences are numbered as DecodeAll returns them
+	expected := []struct {
+		name    string
+		binPath string
+	}{
+		{"Reel 1", "Feature"},
+		{"Reel 2", "Feature"},
+		{"Reel 1 Alt", "Feature/Alternates"},
+	}
+	if len(all) != len(expected) {
+		t.Fatalf("Expected %d timelines, got %d", len(expected), len(all))
+	}
+	for i, want := range expected {
+		timeline, err := NewDecoder(bytes.NewReader(data)).DecodeSequence(SequenceIndex(i))
+		if err != nil {
+			t.Fatalf("DecodeSequence(%d) failed: %v", i, err)
+		}
+		if timeline.Name() != want.name || all[i].Name() != want.name {
+			t.Errorf("Sequence %d: Expected '%s', got '%s' (DecodeAll '%s')", i, want.name, timeline.Name(), all[i].Name())
+		}
+		if binPath, _ := timeline.Metadata()["fcp7xml_bin_path"].(string); binPath != want.binPath {
+			t.Errorf("Sequence %d: Expected bin path '%s', got '%s'", i, want.binPath, binPath)
+		}
+	}
+
+	// Reel 2 fails in strict mode, so it must not be converted, and the
+	// file of the alternate is defined in Reel 1
+	timeline, err := NewDecoderWithOptions(bytes.NewReader(data), DecodeOptions{Strict: true}).DecodeSequence(SequenceName("Reel 1 Alt"))
+	if err != nil {
+		t.Fatalf("DecodeSequence(\"Reel 1 Alt\") failed: %v", err)
+	}
+	clip := timeline.Tracks().Children()[0].(*gotio.Track).Children()[0].(*gotio.Clip)
+	ref, ok := clip.MediaReference().(*gotio.ExternalReference)
+	if !ok || ref.TargetURL() != "file:///media/opening.mov" {
+		t.Errorf("Expected the file defined in Reel 1, got %v", clip.MediaReference())
+	}
+
+	_, err = NewDecoder(bytes.NewReader(data)).DecodeSequence(SequenceName("Reel 3"))
+	if err == nil || !strings.Contains(err.Error(), `available sequences: "Reel 1", "Reel 2", "Reel 1 Alt"`) {
+		t.Errorf("Expected an error listing the sequences, got %v", err)
+	}
+	if _, err := NewDecoder(bytes.NewReader(data)).DecodeSequence(SequenceIndex(3)); err == nil {
+		t.Error("Expected an error for an index out of range")
+	}
+	if _, err := NewDecoderWithOptions(bytes.NewReader(data), DecodeOptions{ExpandNestedSequences: true}).DecodeSequence(SequenceName("Reel 1 Alt")); err != nil {
+		t.Errorf("DecodeSequence with ExpandNestedSequences failed: %v", err)
+	}
+}
+
+func TestDecoder_DecodeSequenceOutOfOrder(t *testing.T) {
+	seq := func(name string) string {
+		return `<sequence><name>` + name + `</name><rate><timebase>24</timebase></rate><media><video><track>` +
+			`<clipitem><name>` + name + ` Shot</name><start>0</start><end>24</end><in>0</in><out>24</out></clipitem>` +
+			`</track></video></media></sequence>`
+	}
+	// Sequences in projects and bins are numbered after top-level ones,
+	// and those directly in a bin before those of its bins
+	document := `<?xml version="1.0" encoding="UTF-8"?><xmeml version="5">` +
+		`<bin><name>Bin</name><children>` + seq("A") + `<bin><name>Sub</name><children>` + seq("B") + `</children></bin>` + seq("C") + `</children></bin>` +
+		seq("D") +
+		`<project><name>Project</name><children>` + seq("E") + `</children></project>` +
+		`</xmeml>`
+	order := []string{"D", "E", "A", "C", "B"}
+
+	decoder := xml.NewDecoder(strings.NewReader(document))
+	if _, err := readRootElement(decoder); err != nil {
+		t.Fatalf("readRootElement failed: %v", err)
+	}
+	minIndex := make(map[int]int)
+	entries, err := walkSequences(decoder, func(ordinal, least int, start xml.StartElement) (string, error) {
+		minIndex[ordinal] = least
+		return "", decoder.Skip()
+	})
+	if err != nil {
+		t.Fatalf("walkSequences failed: %v", err)
+	}
+	for i, entry := range entries {
+		if minIndex[entry.ordinal] > i {
+			t.Errorf("Sequence %d: Expected a minIndex of at most %d, got %d", i, i, minIndex[entry.ordinal])
+		}
+	}
+
+	all, err := NewDecoder(strings.NewReader(document)).DecodeAll()
+	if err != nil {
+		t.Fatalf("DecodeAll() failed: %v", err)
+	}
+	for i, name := range order {
+		timeline, err := NewDecoder(strings.NewReader(document)).DecodeSequence(SequenceIndex(i))
+		if err != nil {
+			t.Fatalf("DecodeSequence(%d) failed: %v", i, err)
+		}
+		if timeline.Name() != name || all[i].Name() != name {
+			t.Errorf("Sequence %d: Expected '%s', got '%s' (DecodeAll '%s')", i, name, timeline.Name(), all[i].Name())
+		}
+	}
+}
+
+func TestDecoder_BaseDir(t *testing.T) {
+	pathURLs := []string{
+		"media/clip%201.mov",
+		"../shared/music.wav",
+		"file:///Volumes/Media/absolute.mov",
+		"/Volumes/Media/path.mov",
+		"https://example.com/stream.mov",
+	}
+	var items strings.Builder
+	for i, pathURL := range pathURLs {
+		fmt.Fprintf(&items, `<clipitem id="clip-%d"><name>Clip %d</name><start>%d</start><end>%d</end><in>0</in><out>24</out>`+
+			`<file id="file-%d"><name>clip-%d.mov</name><pathurl>%s</pathurl><duration>240</duration></file></clipitem>`,
+			i, i, i*24, (i+1)*24, i, i, pathURL)
+	}
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?><xmeml version="5"><sequence><name>Relative</name>` +
+		`<rate><timebase>24</timebase></rate><media><video><track>` + items.String() + `</track></video></media></sequence></xmeml>`
+
+	targetURLs := func(opts DecodeOptions) []string {
+		timeline, err := NewDecoderWithOptions(strings.NewReader(xmlData), opts).Decode()
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		var urls []string
+		for _, child := range timeline.VideoTracks()[0].Children() {
+			ref, ok := child.(*gotio.Clip).MediaReference().(*gotio.ExternalReference)
+			if !ok {
+				t.Fatalf("Expected an ExternalReference, got %T", child.(*gotio.Clip).MediaReference())
+			}
+			urls = append(urls, ref.TargetURL())
+		}
+		return urls
+	}
+
+	// Without BaseDir, pathurls are passed through
+	for i, got := range targetURLs(DecodeOptions{}) {
+		if got != pathURLs[i] {
+			t.Errorf("Expected %s unchanged, got %s", pathURLs[i], got)
+		}
+	}
+
+	tests := []struct {
+		baseDir  string
+		expected []string
+	}{
+		{`C:\Projects\Show`, []string{
+			"file:///C:/Projects/Show/media/clip%201.mov",
+			"file:///C:/Projects/shared/music.wav",
+		}},
+		{`\\server\projects\Show\`, []string{
+			"file://server/projects/Show/media/clip%201.mov",
+			"file://server/projects/shared/music.wav",
+		}},
+	}
+	if runtime.GOOS != "windows" {
+		tests = append(tests, struct {
+			baseDir  string
+			expected []string
+		}{"/projects/show", []string{
+			"file:///projects/show/media/clip%201.mov",
+			"file:///projects/shared/music.wav",
+		}})
+	}
+	for _, test := range tests {
+		urls := targetURLs(DecodeOptions{BaseDir: test.baseDir})
+		for i, want := range test.expected {
+			if urls[i] != want {
+				t.Errorf("%s: Expected %s, got %s", test.baseDir, want, urls[i])
+			}
+		}
+		// Absolute URLs and paths are kept
+		for i := len(test.expected); i < len(pathURLs); i++ {
+			if urls[i] != pathURLs[i] {
+				t.Errorf("%s: Expected %s unchanged, got %s", test.baseDir, pathURLs[i], urls[i])
+			}
+		}
+	}
+}
+
+func TestDecoder_ResolveQuirks(t *testing.T) {
+	f, err := os.Open("testdata/resolve_example.xml")
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer f.Close()
+	decoder := NewDecoder(f)
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	// The rates leave out <ntsc>; a timebase of 30 is taken as 29.97
+	clips := timeline.VideoTracks()[0].Children()
+	if len(clips) != 2 {
+		t.Fatalf("Expected 2 clips, got %d", len(clips))
+	}
+	first := clips[0].(*gotio.Clip)
+	sourceRange := first.SourceRange()
+	if rate := sourceRange.Duration().Rate(); math.Abs(rate-30000.0/1001.0) > 1e-9 {
+		t.Errorf("Expected a rate of 29.97, got %v", rate)
+	}
+	if duration := sourceRange.Duration().Value(); duration != 300 {
+		t.Errorf("Expected a duration of 300 frames, got %v", duration)
+	}
+
+	// The second file's duration is counted in its own rate, 24
+	second := clips[1].(*gotio.Clip)
+	ref, ok := second.MediaReference().(*gotio.ExternalReference)
+	if !ok {
+		t.Fatalf("Expected an ExternalReference, got %T", second.MediaReference())
+	}
+	if available := ref.AvailableRange(); available == nil || available.Duration().Value() != 240 || available.Duration().Rate() != 24 {
+		t.Errorf("Expected an available range of 240 frames at 24, got %v", available)
+	}
+
+	// The pathurls have unescaped spaces
+	expected := []string{
+		"file://localhost/C:/Users/Editor/Videos/Day%201/A001%20Take%202.mov",
+		"file://localhost/D:/Footage/B%20Roll/B002.mov",
+	}
+	for i, want := range expected {
+		ref := clips[i].(*gotio.Clip).MediaReference().(*gotio.ExternalReference)
+		if ref.TargetURL() != want {
+			t.Errorf("Expected %s, got %s", want, ref.TargetURL())
+		}
+	}
+	if path, err := PathFromFileURL(expected[0]); err != nil || path != `C:\Users\Editor\Videos\Day 1\A001 Take 2.mov` {
+		t.Errorf("Expected the repaired URL to give the Windows path, got %q (%v)", path, err)
+	}
+	repaired := 0
+	for _, w := range decoder.Warnings() {
+		if w.Category == WarningMalformedPathURL {
+			repaired++
+		}
+	}
+	if repaired != 2 {
+		t.Errorf("Expected 2 malformed_pathurl warnings, got %d", repaired)
+	}
+
+	// Each element whose rate was taken as NTSC is reported
+	var assumed []string
+	for _, w := range decoder.Warnings() {
+		if w.Category == WarningMissingRate {
+			assumed = append(assumed, w.Message)
+		}
+	}
+	expectedAssumed := []string{
+		`sequence has a timebase of 30 without <ntsc>; assuming a rate of 29.97 (NTSC)`,
+		`clipitem "A001 Take 2.mov" has a timebase of 30 without <ntsc>; assuming a rate of 29.97 (NTSC)`,
+		`file "A001 Take 2.mov" has a timebase of 30 without <ntsc>; assuming a rate of 29.97 (NTSC)`,
+		`clipitem "B002.mov" has a timebase of 30 without <ntsc>; assuming a rate of 29.97 (NTSC)`,
+	}
+	if !reflect.DeepEqual(assumed, expectedAssumed) {
+		t.Errorf("Expected missing_rate warnings %q, got %q", expectedAssumed, assumed)
+	}
+}
+
+func TestRate_MissingNTSC(t *testing.T) {
+	tests := []struct {
+		xml      string
+		expected bool
+	}{
+		{"<rate><timebase>30</timebase></rate>", true},
+		{"<rate><timebase>60</timebase></rate>", true},
+		{"<rate><timebase>24</timebase></rate>", false},
+		{"<rate><timebase>25</timebase></rate>", false},
+		{"<rate><timebase>30</timebase><ntsc>FALSE</ntsc></rate>", false},
+		{"<rate><timebase>24</timebase><ntsc>TRUE</ntsc></rate>", true},
+	}
+	for _, test := range tests {
+		var rate Rate
+		if err := xml.Unmarshal([]byte(test.xml), &rate); err != nil {
+			t.Errorf("%s: %v", test.xml, err)
+			continue
+		}
+		if bool(rate.NTSC) != test.expected {
+			t.Errorf("%s: Expected NTSC %v, got %v", test.xml, test.expected, rate.NTSC)
+		}
+	}
+}
+
+func TestDecoder_TargetRate(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence id="sequence-1">
+    <name>Conform</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>Shot</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>24</start>
+            <end>72</end>
+            <in>24</in>
+            <out>72</out>
+            <file id="file-1">
+              <name>shot.mov</name>
+              <pathurl>file:///media/shot.mov</pathurl>
+              <rate>
+                <timebase>24</timebase>
+                <ntsc>FALSE</ntsc>
+              </rate>
+              <duration>240</duration>
+            </file>
+            <marker>
+              <name>Beat</name>
+              <in>36</in>
+              <out>-1</out>
+            </marker>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoderWithOptions(strings.NewReader(xmlData), DecodeOptions{TargetRate: 25}).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	expectTime := func(what string, got opentime.RationalTime, frames float64) {
+		t.Helper()
+		if got.Rate() != 25 || math.Abs(got.Value()-frames) > 1e-9 {
+			t.Errorf("Expected %s of %v frames at 25, got %v at %v", what, frames, got.Value(), got.Rate())
+		}
+	}
+
+	children := timeline.VideoTracks()[0].Children()
+	if len(children) != 2 {
+		t.Fatalf("Expected a gap and a clip, got %d items", len(children))
+	}
+	gap, err := children[0].Duration()
+	if err != nil {
+		t.Fatalf("Failed to get gap duration: %v", err)
+	}
+	expectTime("a gap duration", gap, 25)
+
+	clip := children[1].(*gotio.Clip)
+	expectTime("a source start", clip.SourceRange().StartTime(), 25)
+	expectTime("a source duration", clip.SourceRange().Duration(), 50)
+	available := clip.MediaReference().AvailableRange()
+	if available == nil {
+		t.Fatal("Expected an available range")
+	}
+	expectTime("an available duration", available.Duration(), 250)
+	expectTime("a marker start", clip.Markers()[0].MarkedRange().StartTime(), 37.5)
+
+	duration, err := timeline.Duration()
+	if err != nil {
+		t.Fatalf("Failed to get timeline duration: %v", err)
+	}
+	if seconds := duration.ToSeconds(); math.Abs(seconds-3) > 1e-9 {
+		t.Errorf("Expected the timeline to last 3 seconds, got %v", seconds)
+	}
+}
+
+func TestDecoder_FilelessClipsAsGaps(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence id="sequence-1">
+    <name>Placeholders</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>Shot A</name>
+            <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+            <start>0</start>
+            <end>24</end>
+            <in>0</in>
+            <out>24</out>
+            <file id="file-1">
+              <name>a.mov</name>
+              <pathurl>file:///media/a.mov</pathurl>
+              <duration>240</duration>
+            </file>
+          </clipitem>
+          <clipitem id="clipitem-2">
+            <name>Black</name>
+            <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+            <start>24</start>
+            <end>72</end>
+            <in>0</in>
+            <out>48</out>
+          </clipitem>
+          <clipitem id="clipitem-3">
+            <name>Shot B</name>
+            <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+            <start>72</start>
+            <end>96</end>
+            <in>0</in>
+            <out>24</out>
+            <file id="file-2">
+              <name>b.mov</name>
+              <pathurl>file:///media/b.mov</pathurl>
+              <duration>240</duration>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	decode := func(opts DecodeOptions) (*gotio.Track, []Warning) {
+		decoder := NewDecoderWithOptions(strings.NewReader(xmlData), opts)
+		timeline, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		return timeline.VideoTracks()[0], decoder.Warnings()
+	}
+	missingMedia := func(warnings []Warning) int {
+		count := 0
+		for _, w := range warnings {
+			if w.Category == WarningMissingMedia {
+				count++
+			}
+		}
+		return count
+	}
+
+	// By default the placeholder is a clip with a MissingReference
+	track, warnings := decode(DecodeOptions{})
+	children := track.Children()
+	if len(children) != 3 {
+		t.Fatalf("Expected 3 items, got %d", len(children))
+	}
+	placeholder, ok := children[1].(*gotio.Clip)
+	if !ok {
+		t.Fatalf("Expected a Clip, got %T", children[1])
+	}
+	if _, ok := placeholder.MediaReference().(*gotio.MissingReference); !ok {
+		t.Errorf("Expected a MissingReference, got %T", placeholder.MediaReference())
+	}
+	if count := missingMedia(warnings); count != 1 {
+		t.Errorf("Expected 1 missing_media warning, got %d", count)
+	}
+
+	// With the option it is a gap of the same length
+	track, warnings = decode(DecodeOptions{FilelessClipsAsGaps: true})
+	children = track.Children()
+	if len(children) != 3 {
+		t.Fatalf("Expected 3 items, got %d", len(children))
+	}
+	gap, ok := children[1].(*gotio.Gap)
+	if !ok {
+		t.Fatalf("Expected a Gap, got %T", children[1])
+	}
+	if duration, err := gap.Duration(); err != nil || duration.Value() != 48 || duration.Rate() != 24 {
+		t.Errorf("Expected a gap of 48 frames at 24, got %v (%v)", duration, err)
+	}
+	if shotB, err := track.RangeOfChildAtIndex(2); err != nil || shotB.StartTime().Value() != 72 {
+		t.Errorf("Expected Shot B to start at 72, got %v (%v)", shotB, err)
+	}
+	if count := missingMedia(warnings); count != 0 {
+		t.Errorf("Expected no missing_media warnings, got %d", count)
+	}
+}
+
+// joinedTransitionsXML is a track of three clips joined by two transitions.
+// Shot B runs under both, so FCP7 gives it neither a start nor an end; its in
+// and out take in all the media under them.
+const joinedTransitionsXML = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence id="sequence-1">
+    <name>Joined</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>Shot A</name>
+            <start>0</start>
+            <end>-1</end>
+            <in>0</in>
+            <out>60</out>
+          </clipitem>
+          <transitionitem>
+            <name>Dissolve</name>
+            <start>40</start>
+            <end>60</end>
+            <alignment>center</alignment>
+          </transitionitem>
+          <clipitem id="clipitem-2">
+            <name>Shot B</name>
+            <start>-1</start>
+            <end>-1</end>
+            <in>10</in>
+            <out>90</out>
+          </clipitem>
+          <transitionitem>
+            <name>Dip</name>
+            <start>100</start>
+            <end>120</end>
+            <alignment>end</alignment>
+          </transitionitem>
+          <clipitem id="clipitem-3">
+            <name>Shot C</name>
+            <start>-1</start>
+            <end>170</end>
+            <in>0</in>
+            <out>70</out>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+func TestDecoder_TransitionsJoinClips(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader(joinedTransitionsXML))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	for _, w := range decoder.Warnings() {
+		if w.Category == WarningUnknownStart {
+			t.Errorf("Expected no unknown start warnings, got %q", w.Message)
+		}
+	}
+
+	track := timeline.VideoTracks()[0]
+	children := track.Children()
+	if len(children) != 5 {
+		t.Fatalf("Expected clip, transition, clip, transition, clip, got %d items", len(children))
+	}
+
+	clips := []struct {
+		index     int
+		name      string
+		start, in float64
+		duration  float64
+	}{
+		{0, "Shot A", 0, 0, 50},
+		{2, "Shot B", 50, 20, 70},
+		{4, "Shot C", 120, 20, 50},
+	}
+	for _, tt := range clips {
+		clip, ok := children[tt.index].(*gotio.Clip)
+		if !ok || clip.Name() != tt.name {
+			t.Fatalf("Expected %s at index %d, got %T", tt.name, tt.index, children[tt.index])
+		}
+		if sr := clip.SourceRange(); sr.StartTime().Value() != tt.in || sr.Duration().Value() != tt.duration {
+			t.Errorf("%s: Expected source range of %v frames from %v, got %v from %v", tt.name, tt.duration, tt.in, sr.Duration().Value(), sr.StartTime().Value())
+		}
+		r, err := track.RangeOfChildAtIndex(tt.index)
+		if err != nil {
+			t.Fatalf("RangeOfChildAtIndex(%d) failed: %v", tt.index, err)
+		}
+		if r.StartTime().Value() != tt.start {
+			t.Errorf("%s: Expected to start at frame %v, got %v", tt.name, tt.start, r.StartTime().Value())
+		}
+	}
+
+	transitions := []struct {
+		index   int
+		in, out float64
+	}{
+		{1, 10, 10},
+		{3, 20, 0},
+	}
+	for _, tt := range transitions {
+		transition, ok := children[tt.index].(*gotio.Transition)
+		if !ok {
+			t.Fatalf("Expected a transition at index %d, got %T", tt.index, children[tt.index])
+		}
+		if transition.InOffset().Value() != tt.in || transition.OutOffset().Value() != tt.out {
+			t.Errorf("%s: Expected offsets %v/%v, got %v/%v", transition.Name(), tt.in, tt.out, transition.InOffset().Value(), transition.OutOffset().Value())
+		}
+	}
+}
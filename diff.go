@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/Avalanche-io/gotio"
+	"github.com/Avalanche-io/gotio/opentime"
+)
+
+// Kinds of differences; see Difference.What.
+const (
+	DiffTracks   = "tracks"   // number of tracks of a kind
+	DiffItems    = "items"    // number of items on a track
+	DiffKind     = "kind"     // schema of an item, such as Clip or Gap
+	DiffName     = "name"     // name of the timeline or an item
+	DiffDuration = "duration" // duration of an item
+	DiffPosition = "position" // start of an item on its track
+	DiffMetadata = "metadata" // metadata keys of the timeline, a track or an item
+)
+
+// diffTolerance is the largest difference between two times, in seconds,
+// that Diff considers equal, so that times conformed to another rate and
+// back compare equal.
+const diffTolerance = 1e-6
+
+// Difference is a structural difference between two timelines found by Diff.
+type Difference struct {
+	What string
+
+	// Path locates the difference by the names of the timeline, track and
+	// item, joined with "/", as Warning.Path does. Tracks are named by kind
+	// and number, e.g. "Video 1", and items by their name in the first
+	// timeline.
+	Path string
+
+	// A and B are the values in the first and second timeline: counts for
+	// DiffTracks and DiffItems, strings for DiffKind and DiffName, and
+	// opentime.RationalTime values for DiffDuration and DiffPosition. For
+	// DiffMetadata they are the keys only the first and only the second
+	// timeline has, as sorted []string.
+	A, B any
+}
+
+// String returns the difference as "path: what: a != b".
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: %s: %v != %v", d.Path, d.What, d.A, d.B)
+}
+
+// Diff reports the structural differences between timelines a and b, such
+// as an original and the same timeline encoded and decoded again: the
+// number of tracks of each kind and of items on each track, and the kind,
+// name, duration, position and metadata keys of each item, compared by
+// index. Metadata values aren't compared. It returns nil if there are none.
+func Diff(a, b *gotio.Timeline) []Difference {
+	var diffs []Difference
+	path := a.Name()
+	if a.Name() != b.Name() {
+		diffs = append(diffs, Difference{What: DiffName, Path: path, A: a.Name(), B: b.Name()})
+	}
+	diffs = appendMetadataDiff(diffs, path, a.Metadata(), b.Metadata())
+	diffs = appendTracksDiff(diffs, path, gotio.TrackKindVideo, a.VideoTracks(), b.VideoTracks())
+	diffs = appendTracksDiff(diffs, path, gotio.TrackKindAudio, a.AudioTracks(), b.AudioTracks())
+	return diffs
+}
+
+// appendTracksDiff appends the differences between the tracks of one kind of
+// two timelines to diffs.
+func appendTracksDiff(diffs []Difference, path, kind string, a, b []*gotio.Track) []Difference {
+	if len(a) != len(b) {
+		diffs = append(diffs, Difference{What: DiffTracks, Path: path + "/" + kind, A: len(a), B: len(b)})
+	}
+	for i := range min(len(a), len(b)) {
+		trackPath := path + "/" + trackName(kind, i)
+		diffs = appendMetadataDiff(diffs, trackPath, a[i].Metadata(), b[i].Metadata())
+		childrenA, childrenB := a[i].Children(), b[i].Children()
+		if len(childrenA) != len(childrenB) {
+			diffs = append(diffs, Difference{What: DiffItems, Path: trackPath, A: len(childrenA), B: len(childrenB)})
+		}
+		for j := range min(len(childrenA), len(childrenB)) {
+			diffs = appendItemDiff(diffs, trackPath, a[i], b[i], j)
+		}
+	}
+	return diffs
+}
+
+// appendItemDiff appends the differences between the items at index of
+// tracks a and b to diffs.
+func appendItemDiff(diffs []Difference, path string, a, b *gotio.Track, index int) []Difference {
+	itemA, itemB := a.Children()[index], b.Children()[index]
+	path += "/" + itemA.Name()
+	if kindA, kindB := itemA.SchemaName(), itemB.SchemaName(); kindA != kindB {
+		// Items of different kinds have nothing else in common to compare
+		return append(diffs, Difference{What: DiffKind, Path: path, A: kindA, B: kindB})
+	}
+	if itemA.Name() != itemB.Name() {
+		diffs = append(diffs, Difference{What: DiffName, Path: path, A: itemA.Name(), B: itemB.Name()})
+	}
+	durationA, errA := itemA.Duration()
+	durationB, errB := itemB.Duration()
+	if errA == nil && errB == nil && !sameTime(durationA, durationB) {
+		diffs = append(diffs, Difference{What: DiffDuration, Path: path, A: durationA, B: durationB})
+	}
+	rangeA, errA := a.RangeOfChildAtIndex(index)
+	rangeB, errB := b.RangeOfChildAtIndex(index)
+	if errA == nil && errB == nil && !sameTime(rangeA.StartTime(), rangeB.StartTime()) {
+		diffs = append(diffs, Difference{What: DiffPosition, Path: path, A: rangeA.StartTime(), B: rangeB.StartTime()})
+	}
+	return appendMetadataDiff(diffs, path, itemA.Metadata(), itemB.Metadata())
+}
+
+// appendMetadataDiff appends a DiffMetadata difference to diffs if a and b
+// don't have the same keys.
+func appendMetadataDiff(diffs []Difference, path string, a, b gotio.AnyDictionary) []Difference {
+	var onlyA, onlyB []string
+	for key := range a {
+		if _, ok := b[key]; !ok {
+			onlyA = append(onlyA, key)
+		}
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			onlyB = append(onlyB, key)
+		}
+	}
+	if len(onlyA) == 0 && len(onlyB) == 0 {
+		return diffs
+	}
+	sort.Strings(onlyA)
+	sort.Strings(onlyB)
+	return append(diffs, Difference{What: DiffMetadata, Path: path, A: slices.Clip(onlyA), B: slices.Clip(onlyB)})
+}
+
+// sameTime reports whether a and b are within diffTolerance of each other.
+func sameTime(a, b opentime.RationalTime) bool {
+	return math.Abs(a.ToSeconds()-b.ToSeconds()) <= diffTolerance
+}
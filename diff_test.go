@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/Avalanche-io/gotio"
+	"github.com/Avalanche-io/gotio/opentime"
+)
+
+// decodeFile decodes the first sequence of a test file.
+func decodeFile(t *testing.T, name string) *gotio.Timeline {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	return timeline
+}
+
+func TestDiff(t *testing.T) {
+	a := decodeFile(t, "testdata/sample.xml")
+	b := decodeFile(t, "testdata/sample.xml")
+	if diffs := Diff(a, b); diffs != nil {
+		t.Fatalf("Expected no differences, got %v", diffs)
+	}
+
+	clip := b.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	clip.SetName("Renamed")
+	trimmed := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(12, 24))
+	clip.SetSourceRange(&trimmed)
+	b.Metadata()["note"] = "added"
+	b.Tracks().AppendChild(gotio.NewTrack("Audio 2", nil, gotio.TrackKindAudio, nil, nil))
+
+	var got []string
+	for _, d := range Diff(a, b) {
+		got = append(got, d.Path+" "+d.What)
+	}
+	expected := []string{
+		"Sample Sequence metadata",
+		"Sample Sequence/Video 1/Intro Clip name",
+		"Sample Sequence/Video 1/Intro Clip duration",
+		"Sample Sequence/Video 1/Main Clip position",
+		"Sample Sequence/Audio tracks",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected differences %v, got %v", expected, got)
+	}
+
+	for _, d := range Diff(a, b) {
+		if d.What == DiffMetadata && !reflect.DeepEqual(d.B, []string{"note"}) {
+			t.Errorf("Expected the added key 'note', got %v", d.B)
+		}
+	}
+}
+
+func TestDiff_RoundTrip(t *testing.T) {
+	for _, name := range []string{"testdata/sample.xml", "testdata/features_test.xml"} {
+		original := decodeFile(t, name)
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(original); err != nil {
+			t.Fatalf("%s: Encode failed: %v", name, err)
+		}
+		decoded, err := NewDecoder(&buf).Decode()
+		if err != nil {
+			t.Fatalf("%s: Decode failed: %v", name, err)
+		}
+		// The encoder adds ids and defaults, which show up as new metadata
+		// keys; the structure is unchanged
+		for _, d := range Diff(original, decoded) {
+			if d.What != DiffMetadata || len(d.A.([]string)) > 0 {
+				t.Errorf("%s: %v", name, d)
+			}
+		}
+	}
+}
@@ -7,16 +7,88 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"math"
 	"net/url"
-	"path/filepath"
 
 	"github.com/Avalanche-io/gotio/opentime"
 	"github.com/Avalanche-io/gotio"
 )
 
+// TransitionStrategy selects how OTIO Transitions that FCP7 can't represent
+// exactly are encoded.
+//
+// An OTIO Transition has independent in and out offsets around the cut,
+// while an FCP7 transitionitem only has a start, an end and an alignment
+// ("start", "center" or "end") saying where the cut falls. Transitions whose
+// offsets are equal, or where one of them is zero, map exactly under either
+// strategy.
+type TransitionStrategy int
+
+const (
+	// TransitionPreserveTiming keeps the transition's start and end exactly
+	// and picks the alignment closest to where the cut falls. For an
+	// asymmetric transition the alignment, and any effect restored from
+	// metadata, describe a slightly different transition than the one timed.
+	TransitionPreserveTiming TransitionStrategy = iota
+
+	// TransitionPreserveEffect keeps the alignment and effect restored from
+	// metadata (a centered transition if there is none) and moves the
+	// transition so that it is aligned that way around the cut, keeping its
+	// total duration. The in and out offsets are approximated.
+	TransitionPreserveEffect
+)
+
+// EncodeOptions configures optional Encoder behavior. The zero value encodes
+// exactly like NewEncoder.
+type EncodeOptions struct {
+	// Transitions selects how inexact transitions are encoded.
+	Transitions TransitionStrategy
+
+	// Sidecar, if non-nil, is merged into the output: elements and values
+	// the encoder leaves out are taken from the sidecar's sequence with the
+	// timeline's name. See ReadSidecar.
+	Sidecar *Sidecar
+
+	// ForcedRate, if non-nil, is the rate of the sequence instead of the
+	// rate of the first clip. Times in other rates are conformed to it,
+	// rounding to the nearest frame.
+	ForcedRate *Rate
+
+	// MediaReferenceKey, if set, selects the media reference written for
+	// each clip that has one under this key, such as "proxy" or "online",
+	// instead of its active reference. FCP7 clipitems hold a single file,
+	// so a clip's other references are not written.
+	MediaReferenceKey string
+
+	// Namespace selects the metadata layout read for details OTIO has no
+	// field for, in addition to the fcp7xml_* keys.
+	Namespace MetadataNamespace
+}
+
 // Encoder encodes OTIO Timeline into Final Cut Pro 7 XML.
 type Encoder struct {
-	w io.Writer
+	w    io.Writer
+	opts EncodeOptions
+
+	// masterClipIDs maps a media key to the master clip id generated for it
+	masterClipIDs map[string]string
+	// offlineFiles counts the offline file stubs written, for their ids
+	offlineFiles int
+	// fileIDs maps the pathurl of each file written to its id, and
+	// usedFileIDs holds those ids
+	fileIDs     map[string]string
+	usedFileIDs map[string]bool
+	// clipItemIDs holds the clipitem ids written, and generatedIDs counts
+	// those generated for linked clipitems
+	clipItemIDs  map[string]bool
+	generatedIDs int
+	// linkGroups maps clipitem ids to their link group, and stereoItems holds
+	// the ids of stereo clipitems to split; see splitStereo
+	linkGroups  map[string]string
+	stereoItems map[string]bool
+
+	// frameRate is the frame rate of the sequence being written
+	frameRate float64
 }
 
 // NewEncoder creates a new FCP7 XML encoder.
@@ -24,6 +96,11 @@ func NewEncoder(w io.Writer) *Encoder {
 	return &Encoder{w: w}
 }
 
+// NewEncoderWithOptions creates a new FCP7 XML encoder configured by opts.
+func NewEncoderWithOptions(w io.Writer, opts EncodeOptions) *Encoder {
+	return &Encoder{w: w, opts: opts}
+}
+
 // Encode converts an OTIO Timeline to FCP7 XML and writes it.
 func (e *Encoder) Encode(timeline *gotio.Timeline) error {
 	if timeline == nil {
@@ -61,16 +138,32 @@ func (e *Encoder) Encode(timeline *gotio.Timeline) error {
 
 // convertTimeline converts an OTIO Timeline to FCP7 XMEML.
 func (e *Encoder) convertTimeline(timeline *gotio.Timeline) (*XMEML, error) {
-	// Determine the frame rate from the first track
+	e.masterClipIDs = make(map[string]string)
+	e.offlineFiles = 0
+	e.fileIDs = make(map[string]string)
+	e.usedFileIDs = make(map[string]bool)
+	e.clipItemIDs = make(map[string]bool)
+	e.generatedIDs = 0
+	e.linkGroups = make(map[string]string)
+	e.stereoItems = make(map[string]bool)
+
+	// Determine the frame rate from the first item of a track, a clip or a
+	// gap, which the decoder makes at the sequence's rate
 	frameRate := 24.0 // default
 	isNTSC := false
 
-	if timeline.Tracks() != nil && len(timeline.Tracks().Children()) > 0 {
+	if e.opts.ForcedRate != nil {
+		frameRate = rateToFrameRate(e.opts.ForcedRate)
+		isNTSC = bool(e.opts.ForcedRate.NTSC)
+	} else if timeline.Tracks() != nil && len(timeline.Tracks().Children()) > 0 {
 		for _, child := range timeline.Tracks().Children() {
 			if track, ok := child.(*gotio.Track); ok {
 				if len(track.Children()) > 0 {
-					if clip, ok := track.Children()[0].(*gotio.Clip); ok {
-						dur, err := clip.Duration()
+					first := track.Children()[0]
+					_, isClip := first.(*gotio.Clip)
+					_, isGap := first.(*gotio.Gap)
+					if isClip || isGap {
+						dur, err := first.Duration()
 						if err == nil && dur.Rate() > 0 {
 							frameRate = dur.Rate()
 							// Check if this is an NTSC rate
@@ -83,11 +176,16 @@ func (e *Encoder) convertTimeline(timeline *gotio.Timeline) (*XMEML, error) {
 		}
 	}
 
+	e.frameRate = frameRate
+
 	// Create the sequence
 	sequence, err := e.convertTracks(timeline, frameRate, isNTSC)
 	if err != nil {
 		return nil, err
 	}
+	if e.opts.Sidecar != nil {
+		mergeSidecar(sequence, e.opts.Sidecar)
+	}
 
 	return &XMEML{
 		Version:  "5",
@@ -97,35 +195,24 @@ func (e *Encoder) convertTimeline(timeline *gotio.Timeline) (*XMEML, error) {
 
 // convertTracks converts OTIO tracks to an FCP7 Sequence.
 func (e *Encoder) convertTracks(timeline *gotio.Timeline, frameRate float64, isNTSC bool) (*Sequence, error) {
-	timebase := int(frameRate)
-	if isNTSC {
-		// Round up for NTSC rates (e.g., 29.97 -> 30)
-		timebase = int(frameRate*1001.0/1000.0 + 0.5)
-	}
-
-	rate := Rate{
-		Timebase: timebase,
-		NTSC:     isNTSC,
-	}
-
-	// Calculate duration
-	duration, err := timeline.Duration()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get timeline duration: %w", err)
-	}
-	durationFrames := int64(duration.Value())
+	rate := frameRateToRate(frameRate, isNTSC)
 
 	sequence := &Sequence{
 		Name:     timeline.Name(),
-		Duration: durationFrames,
+		Duration: e.sequenceDuration(timeline),
 		Rate:     rate,
+		Timecode: sequenceTimecode(timeline, rate),
 		Media:    Media{},
+		Unknown:  metadataToUnknown(timeline.Metadata()),
+		Attrs:    metadataToAttributes(timeline.Metadata()),
 	}
+	setWorkArea(sequence, timeline.Metadata())
+	sequence.Unknown = e.adapterToUnknown(timeline.Metadata(), sequence, sequence.Unknown)
 
 	// Convert video tracks
 	var videoTracks []Track
-	for _, track := range timeline.VideoTracks() {
-		fcpTrack, err := e.convertTrack(track, &rate)
+	for i, track := range timeline.VideoTracks() {
+		fcpTrack, err := e.convertTrack(track, &rate, i)
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert video track: %w", err)
 		}
@@ -133,35 +220,71 @@ func (e *Encoder) convertTracks(timeline *gotio.Timeline, frameRate float64, isN
 	}
 	if len(videoTracks) > 0 {
 		sequence.Media.Video = &Video{Track: videoTracks}
+		sequence.Media.Video.Format = metadataToFormat(timeline.Metadata())
 	}
 
 	// Convert audio tracks
 	var audioTracks []Track
-	for _, track := range timeline.AudioTracks() {
-		fcpTrack, err := e.convertTrack(track, &rate)
+	for i, track := range timeline.AudioTracks() {
+		fcpTrack, err := e.convertTrack(track, &rate, i)
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert audio track: %w", err)
 		}
 		audioTracks = append(audioTracks, *fcpTrack)
+		if channel2 := e.splitStereo(fcpTrack); channel2 != nil {
+			audioTracks = append(audioTracks, *channel2)
+		}
 	}
 	if len(audioTracks) > 0 {
 		sequence.Media.Audio = &Audio{Track: audioTracks}
+		setAudioOutputs(sequence.Media.Audio, timeline.Metadata())
 	}
+	e.linkClipItems(sequence)
 
 	return sequence, nil
 }
 
-// convertTrack converts an OTIO Track to an FCP7 Track.
-func (e *Encoder) convertTrack(track *gotio.Track, rate *Rate) (*Track, error) {
+// sequenceDuration returns the duration of the sequence for timeline, in
+// frames: that of its content, or the <duration> kept as fcp7xml_duration if
+// that is longer, as a sequence may run past its last item. A timeline whose
+// duration can't be found, such as one without tracks, has the kept
+// duration.
+func (e *Encoder) sequenceDuration(timeline *gotio.Timeline) int64 {
+	declared, _ := metadataInt(timeline.Metadata()["fcp7xml_duration"])
+	duration, err := timeline.Duration()
+	if err != nil {
+		return declared
+	}
+	return max(e.frames(duration), declared)
+}
+
+// convertTrack converts an OTIO Track, the index-th of its kind, to an FCP7
+// Track.
+func (e *Encoder) convertTrack(track *gotio.Track, rate *Rate, index int) (*Track, error) {
 	fcpTrack := &Track{
 		ClipItem:       make([]ClipItem, 0),
 		TransitionItem: make([]TransitionItem, 0),
 		GeneratorItem:  make([]GeneratorItem, 0),
 	}
 
+	// Names other than the one the decoder would give the track are kept
+	if name := track.Name(); name != trackName(track.Kind(), index) {
+		fcpTrack.Name = name
+	}
+
 	// Set enabled state
-	enabled := track.Enabled()
-	fcpTrack.Enabled = &enabled
+	fcpTrack.Enabled = newFCPBool(track.Enabled())
+
+	// Restore locked state from metadata
+	if locked, ok := track.Metadata()["fcp7xml_locked"].(bool); ok {
+		fcpTrack.Locked = newFCPBool(locked)
+	}
+	if index, ok := metadataInt(track.Metadata()["fcp7xml_output_channel_index"]); ok {
+		outputChannelIndex := int(index)
+		fcpTrack.OutputChannelIndex = &outputChannelIndex
+	}
+	fcpTrack.Unknown = e.adapterToUnknown(track.Metadata(), fcpTrack, metadataToUnknown(track.Metadata()))
+	fcpTrack.Attrs = metadataToAttributes(track.Metadata())
 
 	// Track position in frames for start time
 	var currentPosition int64 = 0
@@ -172,12 +295,18 @@ func (e *Encoder) convertTrack(track *gotio.Track, rate *Rate) (*Track, error) {
 		case *gotio.Clip:
 			// Check if it's a generator
 			if isGenerator, genItem := e.convertToGenerator(item, rate, currentPosition); isGenerator {
+				if err := clampHead(genItem.Name, &genItem.Start, &genItem.End, &genItem.In, &genItem.Duration); err != nil {
+					return nil, err
+				}
 				fcpTrack.GeneratorItem = append(fcpTrack.GeneratorItem, *genItem)
 			} else {
 				clipItem, err := e.convertClip(item, rate, currentPosition)
 				if err != nil {
 					return nil, fmt.Errorf("failed to convert clip: %w", err)
 				}
+				if err := clampHead(clipItem.Name, &clipItem.Start, &clipItem.End, &clipItem.In, &clipItem.Duration); err != nil {
+					return nil, err
+				}
 				fcpTrack.ClipItem = append(fcpTrack.ClipItem, *clipItem)
 			}
 
@@ -186,18 +315,21 @@ func (e *Encoder) convertTrack(track *gotio.Track, rate *Rate) (*Track, error) {
 			if err != nil {
 				return nil, fmt.Errorf("failed to get clip duration: %w", err)
 			}
-			currentPosition += int64(dur.Value())
+			currentPosition += e.sequenceFrames(dur)
 
 		case *gotio.Transition:
 			transItem, err := e.convertTransitionToItem(item, rate, currentPosition)
 			if err != nil {
 				return nil, fmt.Errorf("failed to convert transition: %w", err)
 			}
+			if err := clampHead(transItem.Name, &transItem.Start, &transItem.End, nil, nil); err != nil {
+				return nil, err
+			}
 			fcpTrack.TransitionItem = append(fcpTrack.TransitionItem, *transItem)
 
-			// Update position
-			dur := item.InOffset().Add(item.OutOffset())
-			currentPosition += int64(dur.Value())
+			// A transition overlaps the items on either side of the cut
+			// rather than taking up time of its own, so the next item
+			// starts right at the cut
 
 		case *gotio.Gap:
 			// Gaps represent empty space in the timeline
@@ -206,7 +338,7 @@ func (e *Encoder) convertTrack(track *gotio.Track, rate *Rate) (*Track, error) {
 			if err != nil {
 				return nil, fmt.Errorf("failed to get gap duration: %w", err)
 			}
-			currentPosition += int64(dur.Value())
+			currentPosition += e.sequenceFrames(dur)
 
 		default:
 			// Skip unsupported types
@@ -232,40 +364,76 @@ func (e *Encoder) convertClip(clip *gotio.Clip, rate *Rate, startPosition int64)
 		sourceRange = ar
 	}
 
-	// Convert to frames
-	inPoint := int64(sourceRange.StartTime().Value())
-	outPoint := inPoint + int64(sourceRange.Duration().Value())
-	duration := int64(sourceRange.Duration().Value())
+	// Convert to frames. A clip at another rate than the sequence keeps it:
+	// its in and out count its own frames, its start and end the sequence's.
+	clipRate := *rate
+	inPoint := e.frames(sourceRange.StartTime())
+	duration := e.frames(sourceRange.Duration())
+	if own, ok := e.ownRate(sourceRange.StartTime()); ok {
+		clipRate = own
+		inPoint = int64(math.Round(sourceRange.StartTime().Value()))
+		duration = int64(math.Round(sourceRange.Duration().ValueRescaledTo(sourceRange.StartTime().Rate())))
+	}
 
 	clipItem := &ClipItem{
 		Name:     clip.Name(),
 		Duration: duration,
-		Rate:     *rate,
+		Rate:     clipRate,
 		Start:    startPosition,
-		End:      startPosition + duration,
+		End:      startPosition + e.sequenceFrames(sourceRange.Duration()),
 		In:       inPoint,
-		Out:      outPoint,
+		Out:      inPoint + duration,
 	}
 
 	// Set enabled state
-	enabled := clip.Enabled()
-	clipItem.Enabled = &enabled
+	clipItem.Enabled = newFCPBool(clip.Enabled())
 
 	// Get ID from metadata if available
 	if metadata := clip.Metadata(); metadata != nil {
 		if id, ok := metadata["fcp7xml_id"].(string); ok {
 			clipItem.ID = id
+			e.clipItemIDs[id] = true
+		}
+		if masterClipID, ok := metadata["fcp7xml_masterclipid"].(string); ok {
+			clipItem.MasterClipID = masterClipID
+		}
+		label, _ := metadata["fcp7xml_label"].(string)
+		label2, _ := metadata["fcp7xml_label2"].(string)
+		if label != "" || label2 != "" {
+			clipItem.Labels = &Labels{Label: label, Label2: label2}
+		}
+		clipItem.Anamorphic, clipItem.AlphaType = metadataToImageFlags(metadata)
+		clipItem.Stereo3D = metadataToStereo3D(metadata)
+		if comments, ok := metadataDict(metadata["fcp7xml_comments"]); ok {
+			clipItem.Comments = metadataToComments(comments)
+		}
+		if loggingInfo, ok := metadataDict(metadata["fcp7xml_logginginfo"]); ok {
+			clipItem.LoggingInfo = metadataToLoggingInfo(loggingInfo)
 		}
 
 		// Restore effects from metadata
-		if effects, ok := metadata["fcp7xml_effects"].([]gotio.AnyDictionary); ok {
+		if effects, ok := metadataDicts(metadata["fcp7xml_effects"]); ok {
 			clipItem.Effect = e.metadataToEffects(effects)
 		}
 
 		// Restore filters from metadata
-		if filters, ok := metadata["fcp7xml_filters"].([]gotio.AnyDictionary); ok {
+		if filters, ok := metadataDicts(metadata["fcp7xml_filters"]); ok {
 			clipItem.Filter = e.metadataToFilters(filters)
 		}
+		if colorCorrection, ok := metadataDict(metadata["fcp7xml_color_correction"]); ok {
+			clipItem.Filter = applyColorCorrection(clipItem.Filter, colorCorrection)
+		}
+		clipItem.Filter = applyOpacity(clipItem.Filter, metadata)
+		if crop, ok := metadataDict(metadata["fcp7xml_crop"]); ok {
+			clipItem.Filter = applyCrop(clipItem.Filter, crop)
+		}
+		clipItem.Filter = applyAudioFilters(clipItem.Filter, metadata)
+		if sourceTrack, ok := metadataInt(metadata["fcp7xml_source_track"]); ok && sourceTrack > 0 {
+			clipItem.SourceTrack = &SourceTrack{MediaType: "audio", TrackIndex: int(sourceTrack)}
+		}
+		clipItem.Unknown = e.adapterToUnknown(metadata, clipItem, metadataToUnknown(metadata))
+		clipItem.Attrs = metadataToAttributes(metadata)
+		e.registerLinks(metadata, clipItem)
 	}
 
 	// Convert markers
@@ -275,18 +443,130 @@ func (e *Encoder) convertClip(clip *gotio.Clip, rate *Rate, startPosition int64)
 	}
 
 	// Convert media reference
-	mediaRef := clip.MediaReference()
+	mediaRef := e.mediaReference(clip)
 	if mediaRef != nil {
-		file, err := e.convertMediaReference(mediaRef, rate)
+		file, err := e.convertMediaReference(mediaRef, &clipRate)
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert media reference: %w", err)
 		}
 		clipItem.File = file
+		if _, ok := mediaRef.(*gotio.MissingReference); ok {
+			e.completeOfflineFile(file, clipItem)
+		}
+
+		// Reel names live in the file's timecode block
+		if reelName, ok := clip.Metadata()["fcp7xml_reel_name"].(string); ok && reelName != "" {
+			if file.Timecode == nil {
+				file.Timecode = &Timecode{Rate: file.Rate}
+			}
+			file.Timecode.Reel = &Reel{Name: reelName}
+		}
+
+		if mode, ok := clip.Metadata()["fcp7xml_file_anamorphic"].(string); ok && mode != "" {
+			setFileAnamorphicMode(file, mode)
+		}
+
+		if subclip, ok := metadataDict(clip.Metadata()["fcp7xml_subclipinfo"]); ok {
+			e.restoreSubclipInfo(subclip, mediaRef, clipItem)
+		}
+
+		if clipItem.MasterClipID == "" {
+			clipItem.MasterClipID = e.masterClipID(mediaRef)
+		}
+	}
+	metadataToPixelAspect(clip.Metadata(), clipItem)
+	restoreTimeRemap(clip, clipItem)
+	restoreStillFrame(clip, clipItem)
+	restorePProTicks(clip.Metadata(), clipItem)
+	restoreImplicitInOut(clip.Metadata(), clipItem)
+	if multiclip, ok := metadataDict(clip.Metadata()["fcp7xml_multiclip"]); ok {
+		e.restoreMulticlip(multiclip, clipItem)
+	}
+	if clipItem.File != nil {
+		clipItem.File = e.shareFile(clipItem.File)
 	}
 
 	return clipItem, nil
 }
 
+// restoreSubclipInfo writes the <subclipinfo> stored in metadata. The
+// decoder limits a subclip's available range to the subclip, so the file's
+// full duration is the end of that range, in the file's frames, plus the end
+// offset.
+func (e *Encoder) restoreSubclipInfo(metadata gotio.AnyDictionary, ref gotio.MediaReference, clipItem *ClipItem) {
+	subclip := &SubclipInfo{}
+	subclip.StartOffset, _ = metadataInt(metadata["startoffset"])
+	subclip.EndOffset, _ = metadataInt(metadata["endoffset"])
+	clipItem.SubclipInfo = subclip
+
+	if _, ok := ref.(*gotio.MissingReference); ok {
+		return
+	}
+	if ar := ref.AvailableRange(); ar != nil && clipItem.File != nil {
+		_, ownRate := metadataToRate(ref.Metadata()["fcp7xml_file_rate"])
+		clipItem.File.Duration = e.mediaFrames(ar.EndTimeExclusive(), clipItem.File, ownRate) + subclip.EndOffset
+	}
+}
+
+// restoreImplicitInOut writes back the in and out points of -1 that the
+// decoder replaced with the start and end of the media, as long as the clip
+// still uses the media from its start or to its end.
+func restoreImplicitInOut(metadata gotio.AnyDictionary, clipItem *ClipItem) {
+	if implicit, _ := metadata["fcp7xml_implicit_out"].(bool); implicit {
+		mediaEnd := clipItem.Duration
+		if clipItem.File != nil && clipItem.File.Duration > 0 {
+			mediaEnd = clipItem.File.Duration
+		}
+		if clipItem.Out == mediaEnd {
+			clipItem.Out = -1
+		}
+	}
+	if implicit, _ := metadata["fcp7xml_implicit_in"].(bool); implicit && clipItem.In == 0 {
+		clipItem.In = -1
+	}
+}
+
+// shareFile returns the file to write for a clipitem: the full file the
+// first time its media is used, and afterwards a reference to it by id, as
+// FCP7 writes shared media. Media is identified by pathurl; different media
+// with the same name are given distinct ids.
+func (e *Encoder) shareFile(file *File) *File {
+	if file.PathURL == "" {
+		return file
+	}
+	if id, ok := e.fileIDs[file.PathURL]; ok {
+		return &File{ID: id}
+	}
+
+	id := file.ID
+	for n := 2; e.usedFileIDs[id]; n++ {
+		id = fmt.Sprintf("%s-%d", file.ID, n)
+	}
+	file.ID = id
+	e.fileIDs[file.PathURL] = id
+	e.usedFileIDs[id] = true
+	return file
+}
+
+// masterClipID returns a master clip id shared by every clip that uses the
+// same media, or an empty string if the reference doesn't identify any media.
+func (e *Encoder) masterClipID(ref gotio.MediaReference) string {
+	key := ref.Name()
+	if extRef, ok := ref.(*gotio.ExternalReference); ok && extRef.TargetURL() != "" {
+		key = extRef.TargetURL()
+	}
+	if key == "" {
+		return ""
+	}
+
+	if id, ok := e.masterClipIDs[key]; ok {
+		return id
+	}
+	id := fmt.Sprintf("masterclip-%d", len(e.masterClipIDs)+1)
+	e.masterClipIDs[key] = id
+	return id
+}
+
 // convertMediaReference converts an OTIO MediaReference to an FCP7 File.
 func (e *Encoder) convertMediaReference(ref gotio.MediaReference, rate *Rate) (*File, error) {
 	// Generate a file ID based on the reference name
@@ -298,6 +578,24 @@ func (e *Encoder) convertMediaReference(ref gotio.MediaReference, rate *Rate) (*
 		Rate: *rate,
 	}
 
+	if fieldDominance, ok := ref.Metadata()["fcp7xml_fielddominance"].(string); ok && fieldDominance != "" {
+		videoCharacteristics(file).FieldDominance = fieldDominance
+	}
+	if channels, ok := metadataInt(ref.Metadata()["fcp7xml_channelcount"]); ok && channels > 0 {
+		if file.Media == nil {
+			file.Media = &FileMedia{}
+		}
+		file.Media.Audio = &FileAudio{ChannelCount: int(channels)}
+	}
+	file.Unknown = e.adapterToUnknown(ref.Metadata(), file, metadataToUnknown(ref.Metadata()))
+	if loggingInfo, ok := metadataDict(ref.Metadata()["fcp7xml_logginginfo"]); ok {
+		file.LoggingInfo = metadataToLoggingInfo(loggingInfo)
+	}
+	fileRate, ownRate := metadataToRate(ref.Metadata()["fcp7xml_file_rate"])
+	if ownRate {
+		file.Rate = fileRate
+	}
+
 	// Handle different types of references
 	switch r := ref.(type) {
 	case *gotio.ExternalReference:
@@ -306,27 +604,22 @@ func (e *Encoder) convertMediaReference(ref gotio.MediaReference, rate *Rate) (*
 		if targetURL != "" {
 			// Ensure it's a proper file:// URL
 			if !isFileURL(targetURL) {
-				// Convert file path to file:// URL
-				absPath, err := filepath.Abs(targetURL)
-				if err == nil {
-					fileURL := url.URL{
-						Scheme: "file",
-						Path:   absPath,
-					}
-					targetURL = fileURL.String()
-				}
+				targetURL = FileURLFromPath(targetURL)
 			}
 			file.PathURL = targetURL
 		}
 
 		// Get available range
 		if ar := r.AvailableRange(); ar != nil {
-			file.Duration = int64(ar.Duration().Value())
+			file.Duration = e.mediaFrames(ar.Duration(), file, ownRate)
 		}
 
 	case *gotio.MissingReference:
-		// Missing reference - no path URL
+		// Missing reference - no path URL; see completeOfflineFile
 		file.PathURL = ""
+		if ar := r.AvailableRange(); ar != nil {
+			file.Duration = e.mediaFrames(ar.Duration(), file, ownRate)
+		}
 
 	default:
 		// For other reference types, just use the name
@@ -336,13 +629,99 @@ func (e *Encoder) convertMediaReference(ref gotio.MediaReference, rate *Rate) (*
 	return file, nil
 }
 
+// metadataToRate reads a rate stored by the decoder as timebase and ntsc.
+func metadataToRate(value any) (Rate, bool) {
+	md, ok := metadataDict(value)
+	if !ok {
+		return Rate{}, false
+	}
+	timebase, _ := metadataInt(md["timebase"])
+	ntsc, _ := md["ntsc"].(bool)
+	return Rate{Timebase: int(timebase), NTSC: fcpBool(ntsc)}, timebase > 0
+}
+
+// mediaFrames converts a length of media to frames of file: in the file's own
+// rate if it has one, and otherwise like frames.
+func (e *Encoder) mediaFrames(t opentime.RationalTime, file *File, ownRate bool) int64 {
+	if !ownRate {
+		return e.frames(t)
+	}
+	return int64(math.Round(t.ValueRescaledTo(rateToFrameRate(&file.Rate))))
+}
+
+// completeOfflineFile turns the file written for a MissingReference into a
+// well-formed offline file, which FCP7 imports as offline media: it gets an
+// id of its own, since the reference's name may be empty or shared, a name
+// (the clip's, if the reference has none), and a duration covering at least
+// the clipitem's out point. The decoder reads such a file back as a
+// MissingReference with the same name and duration.
+func (e *Encoder) completeOfflineFile(file *File, clipItem *ClipItem) {
+	e.offlineFiles++
+	file.ID = fmt.Sprintf("file-offline-%d", e.offlineFiles)
+	if file.Name == "" {
+		file.Name = clipItem.Name
+	}
+	if file.Duration < clipItem.Out {
+		file.Duration = clipItem.Out
+	}
+}
+
+// frames returns t as a number of frames. With EncodeOptions.ForcedRate, t
+// is first conformed to the sequence's rate.
+func (e *Encoder) frames(t opentime.RationalTime) int64 {
+	if e.opts.ForcedRate != nil && t.Rate() > 0 && t.Rate() != e.frameRate {
+		return int64(math.Round(t.ValueRescaledTo(e.frameRate)))
+	}
+	return int64(t.Value())
+}
+
+// sequenceFrames returns t as a number of sequence frames, conforming it to
+// the sequence's rate if it is in another.
+func (e *Encoder) sequenceFrames(t opentime.RationalTime) int64 {
+	if t.Rate() > 0 && !sameFrameRate(t.Rate(), e.frameRate) {
+		return int64(math.Round(t.ValueRescaledTo(e.frameRate)))
+	}
+	return int64(t.Value())
+}
+
+// ownRate returns the rate a clip whose source range starts at t is written
+// at, when that isn't the sequence's. With EncodeOptions.ForcedRate every
+// clip is conformed to the sequence instead.
+func (e *Encoder) ownRate(t opentime.RationalTime) (Rate, bool) {
+	if e.opts.ForcedRate != nil || t.Rate() <= 0 || sameFrameRate(t.Rate(), e.frameRate) {
+		return Rate{}, false
+	}
+	return frameRateToRate(t.Rate(), isNTSCRate(t.Rate())), true
+}
+
+// sameFrameRate reports whether two frame rates are the same, allowing for
+// rounding in NTSC rates.
+func sameFrameRate(a, b float64) bool {
+	return abs(a-b) < 0.001
+}
+
+// frameRateToRate returns the FCP7 rate for a frame rate.
+func frameRateToRate(frameRate float64, isNTSC bool) Rate {
+	timebase := int(math.Round(frameRate))
+	if isNTSC {
+		// Recover the nominal timebase for NTSC rates (e.g., 29.97 -> 30, 59.94 -> 60)
+		timebase = int(math.Round(frameRate * 1001.0 / 1000.0))
+	}
+	return Rate{
+		Timebase: timebase,
+		NTSC:     fcpBool(isNTSC),
+	}
+}
+
 // isNTSCRate checks if a frame rate is an NTSC rate.
 func isNTSCRate(rate float64) bool {
-	// Common NTSC rates: 23.976, 29.97, 59.94
+	// Common NTSC rates: 23.976, 29.97, 47.952, 59.94, 119.88
 	ntscRates := []float64{
 		23.976023976023978, // 24000/1001
 		29.97002997002997,  // 30000/1001
+		47.952047952047955, // 48000/1001
 		59.94005994005994,  // 60000/1001
+		119.88011988011988, // 120000/1001
 	}
 
 	for _, ntsc := range ntscRates {
@@ -387,16 +766,41 @@ func isFileURL(s string) bool {
 	return u.Scheme == "file"
 }
 
+// setAudioOutputs restores the audio routing stored by the decoder, or
+// routes audio to a stereo pair if there is none.
+func setAudioOutputs(audio *Audio, metadata gotio.AnyDictionary) {
+	audio.Outputs = metadataToOutputs(metadata)
+	if channels, ok := metadataInt(metadata["fcp7xml_audio_output_channels"]); ok {
+		audio.NumOutputChannels = int(channels)
+	}
+	if audio.Outputs == nil {
+		audio.Outputs = defaultOutputs()
+		if audio.NumOutputChannels == 0 {
+			audio.NumOutputChannels = 2
+		}
+	}
+}
+
+// mediaReference returns the media reference to write for clip: the one
+// under EncodeOptions.MediaReferenceKey if it has one, and its active
+// reference otherwise.
+func (e *Encoder) mediaReference(clip *gotio.Clip) gotio.MediaReference {
+	if e.opts.MediaReferenceKey != "" {
+		if ref, ok := clip.MediaReferences()[e.opts.MediaReferenceKey]; ok && ref != nil {
+			return ref
+		}
+	}
+	return clip.MediaReference()
+}
+
 // convertToGenerator checks if a clip is a generator and converts it.
 func (e *Encoder) convertToGenerator(clip *gotio.Clip, rate *Rate, startPosition int64) (bool, *GeneratorItem) {
 	metadata := clip.Metadata()
-	if metadata == nil {
-		return false, nil
-	}
 
-	// Check if this is marked as a generator
-	isGen, ok := metadata["fcp7xml_generator"].(bool)
-	if !ok || !isGen {
+	// Clips are generators if they are marked as such or reference a generator
+	genRef, isGenRef := e.mediaReference(clip).(*gotio.GeneratorReference)
+	isGen, _ := metadata["fcp7xml_generator"].(bool)
+	if !isGen && !isGenRef {
 		return false, nil
 	}
 
@@ -405,13 +809,13 @@ func (e *Encoder) convertToGenerator(clip *gotio.Clip, rate *Rate, startPosition
 	if err != nil {
 		return false, nil
 	}
-	duration := int64(dur.Value())
+	duration := e.frames(dur)
 
 	// Get source range for in/out points
 	inPoint := int64(0)
 	outPoint := duration
 	if clip.SourceRange() != nil {
-		inPoint = int64(clip.SourceRange().StartTime().Value())
+		inPoint = e.frames(clip.SourceRange().StartTime())
 		outPoint = inPoint + duration
 	}
 
@@ -426,18 +830,32 @@ func (e *Encoder) convertToGenerator(clip *gotio.Clip, rate *Rate, startPosition
 	}
 
 	// Set enabled state
-	enabled := clip.Enabled()
-	genItem.Enabled = &enabled
+	genItem.Enabled = newFCPBool(clip.Enabled())
+
+	genItem.Anamorphic, genItem.AlphaType = metadataToImageFlags(metadata)
 
 	// Restore effect from metadata
-	if effectMeta, ok := metadata["fcp7xml_effect"].(gotio.AnyDictionary); ok {
+	if effectMeta, ok := metadataDict(metadata["fcp7xml_effect"]); ok {
 		genItem.Effect = e.metadataToEffect(effectMeta)
+	} else if isGenRef {
+		// Generators created in OTIO describe themselves through the reference
+		genItem.Effect = generatorEffect(genRef)
+	}
+	if isGenRef && genItem.Effect != nil {
+		applyGeneratorParameters(genItem.Effect, genRef.Parameters())
 	}
 
 	// Restore filters from metadata
-	if filters, ok := metadata["fcp7xml_filters"].([]gotio.AnyDictionary); ok {
+	if filters, ok := metadataDicts(metadata["fcp7xml_filters"]); ok {
 		genItem.Filter = e.metadataToFilters(filters)
 	}
+	if colorCorrection, ok := metadataDict(metadata["fcp7xml_color_correction"]); ok {
+		genItem.Filter = applyColorCorrection(genItem.Filter, colorCorrection)
+	}
+	genItem.Filter = applyOpacity(genItem.Filter, metadata)
+	if crop, ok := metadataDict(metadata["fcp7xml_crop"]); ok {
+		genItem.Filter = applyCrop(genItem.Filter, crop)
+	}
 
 	// Convert markers
 	for _, marker := range clip.Markers() {
@@ -448,39 +866,233 @@ func (e *Encoder) convertToGenerator(clip *gotio.Clip, rate *Rate, startPosition
 	return true, genItem
 }
 
+// metadataToImageFlags restores the anamorphic and alpha type flags stored by
+// the decoder.
+func metadataToImageFlags(metadata gotio.AnyDictionary) (*fcpBool, string) {
+	var anamorphic *fcpBool
+	if value, ok := metadata["fcp7xml_anamorphic"].(bool); ok {
+		anamorphic = newFCPBool(value)
+	}
+	alphaType, _ := metadata["fcp7xml_alphatype"].(string)
+	return anamorphic, alphaType
+}
+
+// setFileAnamorphicMode sets the anamorphic setting of a file's video sample
+// characteristics, creating them as needed.
+func setFileAnamorphicMode(file *File, mode string) {
+	videoCharacteristics(file).AnamorphicMode = mode
+}
+
+// videoCharacteristics returns a file's video sample characteristics,
+// creating them as needed.
+func videoCharacteristics(file *File) *SampleCharacteristics {
+	if file.Media == nil {
+		file.Media = &FileMedia{}
+	}
+	if file.Media.Video == nil {
+		file.Media.Video = &FileVideo{}
+	}
+	if file.Media.Video.SampleCharacteristics == nil {
+		file.Media.Video.SampleCharacteristics = &SampleCharacteristics{}
+	}
+	return file.Media.Video.SampleCharacteristics
+}
+
+// metadataToComments restores a clipitem's <comments> from metadata.
+func metadataToComments(metadata gotio.AnyDictionary) *Comments {
+	comments := &Comments{}
+	comments.MasterComment1, _ = metadata["mastercomment1"].(string)
+	comments.MasterComment2, _ = metadata["mastercomment2"].(string)
+	comments.MasterComment3, _ = metadata["mastercomment3"].(string)
+	comments.MasterComment4, _ = metadata["mastercomment4"].(string)
+	texts, _ := metadataStrings(metadata["comment"])
+	for _, text := range texts {
+		comments.Comment = append(comments.Comment, Comment{Text: text})
+	}
+	return comments
+}
+
+// metadataToLoggingInfo restores the logging fields stored by the decoder.
+func metadataToLoggingInfo(metadata gotio.AnyDictionary) *LoggingInfo {
+	field := func(key string) *string {
+		if text, ok := metadata[key].(string); ok {
+			return &text
+		}
+		return nil
+	}
+	info := &LoggingInfo{
+		Description: field("description"),
+		Scene:       field("scene"),
+		ShotTake:    field("shottake"),
+		LogNote:     field("lognote"),
+		Unknown:     metadataToUnknown(metadata),
+	}
+	if good, ok := metadata["good"].(bool); ok {
+		info.Good = newFCPBool(good)
+	}
+	return info
+}
+
+// metadataToStereo3D restores a clipitem's <stereo3d> from the raw settings
+// the decoder kept, or from just its eye if that was set on its own.
+func metadataToStereo3D(metadata gotio.AnyDictionary) *Stereo3D {
+	if inner, ok := metadata["fcp7xml_stereo3d"].(string); ok {
+		return &Stereo3D{Inner: inner}
+	}
+	if eye, _ := metadata["fcp7xml_eye"].(string); eye == "left" || eye == "right" {
+		return &Stereo3D{Inner: "<eye>" + eye + "</eye>"}
+	}
+	return nil
+}
+
+// metadataToFormat restores the sequence format settings stored by the
+// decoder, or returns nil if there are none.
+func metadataToFormat(metadata gotio.AnyDictionary) *Format {
+	mode, _ := metadata["fcp7xml_anamorphic"].(string)
+	fieldDominance, _ := metadata["fcp7xml_fielddominance"].(string)
+	if mode == "" && fieldDominance == "" {
+		return nil
+	}
+	return &Format{
+		SampleCharacteristics: &SampleCharacteristics{
+			AnamorphicMode: mode,
+			FieldDominance: fieldDominance,
+		},
+	}
+}
+
+// metadataToPixelAspect restores the pixel aspect ratios stored by the
+// decoder. The clip's value is written on the clipitem only when it differs
+// from the file's.
+func metadataToPixelAspect(metadata gotio.AnyDictionary, clipItem *ClipItem) {
+	filePixelAspect, _ := metadata["fcp7xml_file_pixelaspectratio"].(string)
+	if filePixelAspect != "" && clipItem.File != nil {
+		videoCharacteristics(clipItem.File).PixelAspectRatio = filePixelAspect
+	}
+	if pixelAspect, _ := metadata["fcp7xml_pixelaspectratio"].(string); pixelAspect != filePixelAspect {
+		clipItem.PixelAspectRatio = pixelAspect
+	}
+}
+
+// generatorEffect builds the generator effect for a GeneratorReference.
+func generatorEffect(ref *gotio.GeneratorReference) *Effect {
+	name := ref.Name()
+	if name == "" {
+		name = ref.GeneratorKind()
+	}
+	return &Effect{
+		Name:       name,
+		EffectID:   ref.GeneratorKind(),
+		EffectType: "generator",
+		MediaType:  "video",
+	}
+}
+
 // convertTransitionToItem converts an OTIO Transition to FCP7 TransitionItem.
-func (e *Encoder) convertTransitionToItem(trans *gotio.Transition, rate *Rate, startPosition int64) (*TransitionItem, error) {
-	duration := trans.InOffset().Add(trans.OutOffset())
-	durationFrames := int64(duration.Value())
+// cut is the sequence frame between the items the transition joins; it
+// reaches back from there by its in offset and on by its out offset.
+func (e *Encoder) convertTransitionToItem(trans *gotio.Transition, rate *Rate, cut int64) (*TransitionItem, error) {
+	inFrames := e.frames(trans.InOffset())
+	outFrames := e.frames(trans.OutOffset())
+	durationFrames := inFrames + outFrames
 
 	transItem := &TransitionItem{
 		Name:      trans.Name(),
 		Rate:      *rate,
-		Start:     startPosition,
-		End:       startPosition + durationFrames,
+		Start:     cut - inFrames,
+		End:       cut + outFrames,
 		Alignment: "center", // default
 	}
 
-	// Get alignment from metadata
-	if metadata := trans.Metadata(); metadata != nil {
-		if alignment, ok := metadata["fcp7xml_alignment"].(string); ok {
+	metadata := trans.Metadata()
+	alignment, hasAlignment := metadata["fcp7xml_alignment"].(string)
+
+	switch e.opts.Transitions {
+	case TransitionPreserveEffect:
+		if hasAlignment {
 			transItem.Alignment = alignment
 		}
+		// Keep the cut where it is and align the transition to it
+		switch transItem.Alignment {
+		case "start", "start-black":
+			transItem.Start = cut
+		case "end", "end-black":
+			transItem.Start = cut - durationFrames
+		default:
+			transItem.Start = cut - durationFrames/2
+		}
+		transItem.End = transItem.Start + durationFrames
 
-		// Restore effect from metadata
-		if effectMeta, ok := metadata["fcp7xml_effect"].(gotio.AnyDictionary); ok {
-			transItem.Effect = e.metadataToEffect(effectMeta)
+	default:
+		// A stored alignment is kept as long as the offsets still put the
+		// cut where it says
+		if hasAlignment && alignmentCut(alignment, 0, durationFrames) == inFrames {
+			transItem.Alignment = alignment
+		} else {
+			transItem.Alignment = alignmentForOffsets(inFrames, outFrames)
 		}
 	}
 
+	// Restore effect from metadata
+	if effectMeta, ok := metadataDict(metadata["fcp7xml_effect"]); ok {
+		transItem.Effect = e.metadataToEffect(effectMeta)
+	}
+
 	return transItem, nil
 }
 
+// clampHead trims the part of an item that would start before the head of
+// the track, where FCP7 can't place it, moving its in point and shortening
+// its duration (if given) to match. Transitions at the head of a track can
+// reach back that far. It fails if nothing of the item is left.
+func clampHead(name string, start, end, in, duration *int64) error {
+	if *start >= 0 {
+		return nil
+	}
+	if *end <= 0 {
+		return fmt.Errorf("%q ends at frame %d, before the start of the track", name, *end)
+	}
+	trim := -*start
+	*start = 0
+	if in != nil {
+		*in += trim
+	}
+	if duration != nil {
+		*duration -= trim
+	}
+	return nil
+}
+
+// alignmentForOffsets returns the FCP7 alignment closest to where the cut
+// falls within a transition with the given in and out offsets.
+func alignmentForOffsets(inFrames, outFrames int64) string {
+	duration := inFrames + outFrames
+	switch {
+	case duration <= 0 || inFrames == outFrames:
+		return "center"
+	case inFrames*4 < duration:
+		return "start"
+	case outFrames*4 < duration:
+		return "end"
+	default:
+		return "center"
+	}
+}
+
 // convertMarkerToFCP converts an OTIO Marker to FCP7 Marker.
 func (e *Encoder) convertMarkerToFCP(marker *gotio.Marker) Marker {
 	markedRange := marker.MarkedRange()
-	inPoint := int64(markedRange.StartTime().Value())
-	outPoint := inPoint + int64(markedRange.Duration().Value())
+	inPoint := e.frames(markedRange.StartTime())
+	outPoint := inPoint + e.frames(markedRange.Duration())
+	if outPoint == inPoint {
+		if markedRange.Duration().Value() > 0 {
+			// A ranged marker shorter than a frame stays ranged
+			outPoint = inPoint + 1
+		} else {
+			// FCP7 writes -1 as the out point of point markers
+			outPoint = -1
+		}
+	}
 
 	fcpMarker := Marker{
 		Name:    marker.Name(),
@@ -489,9 +1101,11 @@ func (e *Encoder) convertMarkerToFCP(marker *gotio.Marker) Marker {
 		Out:     outPoint,
 	}
 
-	// Restore FCP7 color from metadata if available
+	// Restore FCP7 color from metadata if available, and use the marker
+	// color's palette value otherwise
+	fcpMarker.Color = markerRGB(marker.Color())
 	if metadata := marker.Metadata(); metadata != nil {
-		if colorMap, ok := metadata["fcp7xml_color"].(map[string]int); ok {
+		if colorMap, ok := metadataIntMap(metadata["fcp7xml_color"]); ok {
 			fcpMarker.Color = &Color{
 				Red:   colorMap["red"],
 				Green: colorMap["green"],
@@ -523,21 +1137,27 @@ func (e *Encoder) metadataToEffect(metadata gotio.AnyDictionary) *Effect {
 	if effectCat, ok := metadata["effectcategory"].(string); ok {
 		effect.EffectCategory = effectCat
 	}
-	if duration, ok := metadata["duration"].(int64); ok {
+	if duration, ok := metadataInt(metadata["duration"]); ok {
 		effect.Duration = duration
 	}
-	if startRatio, ok := metadata["startratio"].(float64); ok {
+	if wipeCode, ok := metadataInt(metadata["wipecode"]); ok {
+		effect.WipeCode = &wipeCode
+	}
+	if wipeAccuracy, ok := metadataInt(metadata["wipeaccuracy"]); ok {
+		effect.WipeAccuracy = &wipeAccuracy
+	}
+	if startRatio, ok := metadataFloat(metadata["startratio"]); ok {
 		effect.StartRatio = &startRatio
 	}
-	if endRatio, ok := metadata["endratio"].(float64); ok {
+	if endRatio, ok := metadataFloat(metadata["endratio"]); ok {
 		effect.EndRatio = &endRatio
 	}
 	if reverse, ok := metadata["reverse"].(bool); ok {
-		effect.Reverse = &reverse
+		effect.Reverse = newFCPBool(reverse)
 	}
 
 	// Convert parameters
-	if params, ok := metadata["parameters"].([]gotio.AnyDictionary); ok {
+	if params, ok := metadataDicts(metadata["parameters"]); ok {
 		for _, paramMeta := range params {
 			param := e.metadataToParameter(paramMeta)
 			effect.Parameter = append(effect.Parameter, param)
@@ -563,15 +1183,15 @@ func (e *Encoder) metadataToFilters(metadataArray []gotio.AnyDictionary) []Filte
 		filter := Filter{}
 
 		if enabled, ok := meta["enabled"].(bool); ok {
-			filter.Enabled = &enabled
+			filter.Enabled = newFCPBool(enabled)
 		}
-		if start, ok := meta["start"].(int64); ok {
+		if start, ok := metadataInt(meta["start"]); ok {
 			filter.Start = start
 		}
-		if end, ok := meta["end"].(int64); ok {
+		if end, ok := metadataInt(meta["end"]); ok {
 			filter.End = end
 		}
-		if effectMeta, ok := meta["effect"].(gotio.AnyDictionary); ok {
+		if effectMeta, ok := metadataDict(meta["effect"]); ok {
 			filter.Effect = e.metadataToEffect(effectMeta)
 		}
 
@@ -593,18 +1213,39 @@ func (e *Encoder) metadataToParameter(metadata gotio.AnyDictionary) Parameter {
 	if value, ok := metadata["value"].(string); ok {
 		param.Value = value
 	}
+	if valueXML, ok := metadata["valuexml"].(string); ok {
+		param.ValueXML = valueXML
+	}
 	if valueID, ok := metadata["valueid"].(string); ok {
 		param.ValueID = valueID
 	}
-	if valueMin, ok := metadata["valuemin"].(float64); ok {
+	if valueMin, ok := metadataFloat(metadata["valuemin"]); ok {
 		param.ValueMin = &valueMin
 	}
-	if valueMax, ok := metadata["valuemax"].(float64); ok {
+	if valueMax, ok := metadataFloat(metadata["valuemax"]); ok {
 		param.ValueMax = &valueMax
 	}
 	if valueList, ok := metadata["valuelist"].(string); ok {
 		param.ValueList = valueList
 	}
+	if keyframes, ok := metadataDicts(metadata["keyframes"]); ok {
+		for _, k := range keyframes {
+			keyframe := Keyframe{}
+			if when, ok := metadataInt(k["when"]); ok {
+				keyframe.When = when
+			}
+			if value, ok := k["value"].(string); ok {
+				keyframe.Value = value
+			}
+			if valueXML, ok := k["valuexml"].(string); ok {
+				keyframe.ValueXML = valueXML
+			}
+			if interpolation, ok := k["interpolation"].(string); ok {
+				keyframe.Interpolation = interpolation
+			}
+			param.Keyframe = append(param.Keyframe, keyframe)
+		}
+	}
 
 	return param
 }
@@ -6,6 +6,7 @@ package fcp7xml
 import (
 	"bytes"
 	"encoding/xml"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -398,10 +399,12 @@ func TestIsNTSCRate(t *testing.T) {
 		{23.976, true},
 		{29.97, true},
 		{59.94, true},
+		{119.88, true},
 		{24.0, false},
 		{25.0, false},
 		{30.0, false},
 		{60.0, false},
+		{120.0, false},
 	}
 
 	for _, tt := range tests {
@@ -411,3 +414,706 @@ func TestIsNTSCRate(t *testing.T) {
 		}
 	}
 }
+
+func TestEncoder_EncodeMasterClipID(t *testing.T) {
+	timeline := gotio.NewTimeline("Master Clips", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+
+	newClip := func(name, url string, metadata gotio.AnyDictionary) *gotio.Clip {
+		sourceRange := opentime.NewTimeRange(
+			opentime.NewRationalTime(0, 24),
+			opentime.NewRationalTime(24, 24),
+		)
+		return gotio.NewClip(
+			name,
+			gotio.NewExternalReference("", url, nil, nil),
+			&sourceRange,
+			metadata,
+			nil,
+			nil,
+			"",
+			nil,
+		)
+	}
+
+	videoTrack.AppendChild(newClip("Shot A take 1", "file:///media/shot_a.mov", nil))
+	videoTrack.AppendChild(newClip("Shot B", "file:///media/shot_b.mov", nil))
+	videoTrack.AppendChild(newClip("Shot A take 2", "file:///media/shot_a.mov", nil))
+	videoTrack.AppendChild(newClip("Stored", "file:///media/shot_c.mov", gotio.AnyDictionary{
+		"fcp7xml_masterclipid": "master-clip-5",
+	}))
+	timeline.Tracks().AppendChild(videoTrack)
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+
+	clipItems := xmeml.Sequence[0].Media.Video.Track[0].ClipItem
+	if len(clipItems) != 4 {
+		t.Fatalf("Expected 4 clip items, got %d", len(clipItems))
+	}
+
+	if clipItems[0].MasterClipID == "" {
+		t.Error("Expected a generated masterclipid")
+	}
+	if clipItems[0].MasterClipID != clipItems[2].MasterClipID {
+		t.Errorf("Clips of the same file should share a masterclipid, got '%s' and '%s'",
+			clipItems[0].MasterClipID, clipItems[2].MasterClipID)
+	}
+	if clipItems[0].MasterClipID == clipItems[1].MasterClipID {
+		t.Errorf("Clips of different files should not share masterclipid '%s'", clipItems[0].MasterClipID)
+	}
+	if clipItems[3].MasterClipID != "master-clip-5" {
+		t.Errorf("Expected stored masterclipid 'master-clip-5', got '%s'", clipItems[3].MasterClipID)
+	}
+
+	// Decoding should surface the masterclipid in clip metadata
+	decoded, err := NewDecoder(&buf).Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	clip := decoded.VideoTracks()[0].Children()[3].(*gotio.Clip)
+	if id, _ := clip.Metadata()["fcp7xml_masterclipid"].(string); id != "master-clip-5" {
+		t.Errorf("Expected decoded masterclipid 'master-clip-5', got '%s'", id)
+	}
+}
+
+func TestEncoder_EncodeHighFrameRates(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     float64
+		timebase int
+		ntsc     bool
+	}{
+		{"50", 50.0, 50, false},
+		{"59.94", 60000.0 / 1001.0, 60, true},
+		{"60", 60.0, 60, false},
+		{"119.88", 120000.0 / 1001.0, 120, true},
+	}
+
+	for _, tt := range tests {
+		timeline := gotio.NewTimeline("HFR "+tt.name, nil, nil)
+		videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+
+		sourceRange := opentime.NewTimeRange(
+			opentime.NewRationalTime(10, tt.rate),
+			opentime.NewRationalTime(125, tt.rate),
+		)
+		clip := gotio.NewClip(
+			"HFR Clip",
+			gotio.NewMissingReference("", nil, nil),
+			&sourceRange,
+			nil,
+			nil,
+			nil,
+			"",
+			nil,
+		)
+		videoTrack.AppendChild(clip)
+		timeline.Tracks().AppendChild(videoTrack)
+
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(timeline); err != nil {
+			t.Fatalf("%s: Encode() failed: %v", tt.name, err)
+		}
+
+		var xmeml XMEML
+		if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+			t.Fatalf("%s: Failed to parse XML: %v", tt.name, err)
+		}
+		seqRate := xmeml.Sequence[0].Rate
+		if seqRate.Timebase != tt.timebase || bool(seqRate.NTSC) != tt.ntsc {
+			t.Errorf("%s: Expected timebase %d ntsc %v, got timebase %d ntsc %v",
+				tt.name, tt.timebase, tt.ntsc, seqRate.Timebase, seqRate.NTSC)
+		}
+
+		decoded, err := NewDecoder(&buf).Decode()
+		if err != nil {
+			t.Fatalf("%s: Decode() failed: %v", tt.name, err)
+		}
+		decodedClip := decoded.VideoTracks()[0].Children()[0].(*gotio.Clip)
+		decodedRange := decodedClip.SourceRange()
+		if decodedRange.Duration().Value() != 125 || decodedRange.StartTime().Value() != 10 {
+			t.Errorf("%s: Expected source range 10+125 frames, got %v+%v", tt.name,
+				decodedRange.StartTime().Value(), decodedRange.Duration().Value())
+		}
+		if abs(decodedRange.Duration().Rate()-tt.rate) > 1e-9 {
+			t.Errorf("%s: Expected rate %f, got %f", tt.name, tt.rate, decodedRange.Duration().Rate())
+		}
+	}
+}
+
+func TestEncoder_EncodeNativeGeneratorReference(t *testing.T) {
+	timeline := gotio.NewTimeline("Generators", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+
+	sourceRange := opentime.NewTimeRange(
+		opentime.NewRationalTime(0, 24),
+		opentime.NewRationalTime(48, 24),
+	)
+	clip := gotio.NewClip(
+		"Bars",
+		gotio.NewGeneratorReference("Bars and Tone", "SMPTEBars", nil, nil, nil),
+		&sourceRange,
+		nil,
+		nil,
+		nil,
+		"",
+		nil,
+	)
+	videoTrack.AppendChild(clip)
+	timeline.Tracks().AppendChild(videoTrack)
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+
+	track := xmeml.Sequence[0].Media.Video.Track[0]
+	if len(track.ClipItem) != 0 {
+		t.Errorf("Expected no clip items, got %d", len(track.ClipItem))
+	}
+	if len(track.GeneratorItem) != 1 {
+		t.Fatalf("Expected 1 generator item, got %d", len(track.GeneratorItem))
+	}
+
+	genItem := track.GeneratorItem[0]
+	if genItem.Duration != 48 {
+		t.Errorf("Expected duration 48, got %d", genItem.Duration)
+	}
+	if genItem.Effect == nil {
+		t.Fatal("Expected generator effect")
+	}
+	if genItem.Effect.EffectID != "SMPTEBars" || genItem.Effect.EffectType != "generator" {
+		t.Errorf("Expected generator effect 'SMPTEBars', got id '%s' type '%s'",
+			genItem.Effect.EffectID, genItem.Effect.EffectType)
+	}
+}
+
+func TestEncoder_AsymmetricTransitionStrategies(t *testing.T) {
+	newTimeline := func() *gotio.Timeline {
+		timeline := gotio.NewTimeline("Transitions", nil, nil)
+		videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+
+		sourceRange := opentime.NewTimeRange(
+			opentime.NewRationalTime(0, 24),
+			opentime.NewRationalTime(48, 24),
+		)
+		clip := gotio.NewClip("Clip A", nil, &sourceRange, nil, nil, nil, "", nil)
+		videoTrack.AppendChild(clip)
+
+		// The cut falls 4 frames into a 24 frame dissolve
+		metadata := gotio.AnyDictionary{
+			"fcp7xml_effect": gotio.AnyDictionary{
+				"name":       "Cross Dissolve",
+				"effectid":   "Cross Dissolve",
+				"effecttype": "transition",
+				"mediatype":  "video",
+			},
+		}
+		transition := gotio.NewTransition(
+			"Dissolve",
+			gotio.TransitionTypeSMPTEDissolve,
+			opentime.NewRationalTime(4, 24),
+			opentime.NewRationalTime(20, 24),
+			metadata,
+		)
+		videoTrack.AppendChild(transition)
+
+		timeline.Tracks().AppendChild(videoTrack)
+		return timeline
+	}
+
+	tests := []struct {
+		name      string
+		strategy  TransitionStrategy
+		start     int64
+		end       int64
+		alignment string
+	}{
+		{"preserve timing", TransitionPreserveTiming, 44, 68, "start"},
+		{"preserve effect", TransitionPreserveEffect, 36, 60, "center"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		encoder := NewEncoderWithOptions(&buf, EncodeOptions{Transitions: tt.strategy})
+		if err := encoder.Encode(newTimeline()); err != nil {
+			t.Fatalf("%s: Encode() failed: %v", tt.name, err)
+		}
+
+		var xmeml XMEML
+		if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+			t.Fatalf("%s: Failed to parse XML: %v", tt.name, err)
+		}
+
+		track := xmeml.Sequence[0].Media.Video.Track[0]
+		if len(track.TransitionItem) != 1 {
+			t.Fatalf("%s: Expected 1 transition item, got %d", tt.name, len(track.TransitionItem))
+		}
+		item := track.TransitionItem[0]
+		if item.Start != tt.start || item.End != tt.end {
+			t.Errorf("%s: Expected start/end %d-%d, got %d-%d", tt.name, tt.start, tt.end, item.Start, item.End)
+		}
+		if item.Alignment != tt.alignment {
+			t.Errorf("%s: Expected alignment '%s', got '%s'", tt.name, tt.alignment, item.Alignment)
+		}
+		if item.Effect == nil || item.Effect.EffectID != "Cross Dissolve" {
+			t.Errorf("%s: Expected Cross Dissolve effect, got %+v", tt.name, item.Effect)
+		}
+	}
+}
+
+func TestEncoder_HeadTransition(t *testing.T) {
+	// A fade up from the head of the track, centered on the first frame
+	timeline := gotio.NewTimeline("Head Transition", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	videoTrack.AppendChild(gotio.NewTransition(
+		"Fade Up",
+		gotio.TransitionTypeSMPTEDissolve,
+		opentime.NewRationalTime(0, 24),
+		opentime.NewRationalTime(12, 24),
+		nil,
+	))
+	sourceRange := opentime.NewTimeRange(
+		opentime.NewRationalTime(0, 24),
+		opentime.NewRationalTime(48, 24),
+	)
+	videoTrack.AppendChild(gotio.NewClip("Clip A", nil, &sourceRange, nil, nil, nil, "", nil))
+	timeline.Tracks().AppendChild(videoTrack)
+
+	tests := []struct {
+		name     string
+		strategy TransitionStrategy
+		start    int64
+		end      int64
+	}{
+		{"preserve timing", TransitionPreserveTiming, 0, 12},
+		{"preserve effect", TransitionPreserveEffect, 0, 6},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		encoder := NewEncoderWithOptions(&buf, EncodeOptions{Transitions: tt.strategy})
+		if err := encoder.Encode(timeline); err != nil {
+			t.Fatalf("%s: Encode() failed: %v", tt.name, err)
+		}
+
+		var xmeml XMEML
+		if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+			t.Fatalf("%s: Failed to parse XML: %v", tt.name, err)
+		}
+		track := xmeml.Sequence[0].Media.Video.Track[0]
+		if len(track.TransitionItem) != 1 {
+			t.Fatalf("%s: Expected 1 transition item, got %d", tt.name, len(track.TransitionItem))
+		}
+		item := track.TransitionItem[0]
+		if item.Start != tt.start || item.End != tt.end {
+			t.Errorf("%s: Expected start/end %d-%d, got %d-%d", tt.name, tt.start, tt.end, item.Start, item.End)
+		}
+	}
+}
+
+func TestEncoder_TransitionBetweenClips(t *testing.T) {
+	timeline := gotio.NewTimeline("Clip Transition Clip", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	sourceRange := opentime.NewTimeRange(
+		opentime.NewRationalTime(0, 24),
+		opentime.NewRationalTime(48, 24),
+	)
+	videoTrack.AppendChild(gotio.NewClip("Clip A", nil, &sourceRange, nil, nil, nil, "", nil))
+	videoTrack.AppendChild(gotio.NewTransition(
+		"Dissolve",
+		gotio.TransitionTypeSMPTEDissolve,
+		opentime.NewRationalTime(12, 24),
+		opentime.NewRationalTime(12, 24),
+		nil,
+	))
+	videoTrack.AppendChild(gotio.NewClip("Clip B", nil, &sourceRange, nil, nil, nil, "", nil))
+	videoTrack.AppendChild(gotio.NewClip("Clip C", nil, &sourceRange, nil, nil, nil, "", nil))
+	timeline.Tracks().AppendChild(videoTrack)
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+	track := xmeml.Sequence[0].Media.Video.Track[0]
+	if len(track.ClipItem) != 3 || len(track.TransitionItem) != 1 {
+		t.Fatalf("Expected 3 clip items and 1 transition item, got %d and %d", len(track.ClipItem), len(track.TransitionItem))
+	}
+
+	// The transition straddles the cut at frame 48 without pushing the
+	// clips after it further down the track
+	transition := track.TransitionItem[0]
+	if transition.Start != 36 || transition.End != 60 {
+		t.Errorf("Expected transition start/end 36-60, got %d-%d", transition.Start, transition.End)
+	}
+	expected := []struct{ start, end int64 }{{0, 48}, {48, 96}, {96, 144}}
+	for i, want := range expected {
+		item := track.ClipItem[i]
+		if item.Start != want.start || item.End != want.end {
+			t.Errorf("%s: Expected start/end %d-%d, got %d-%d", item.Name, want.start, want.end, item.Start, item.End)
+		}
+	}
+	if xmeml.Sequence[0].Duration != 144 {
+		t.Errorf("Expected sequence duration 144, got %d", xmeml.Sequence[0].Duration)
+	}
+
+	decoded, err := NewDecoder(bytes.NewReader(buf.Bytes())).Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	children := decoded.Tracks().Children()[0].(*gotio.Track).Children()
+	if len(children) != 4 {
+		t.Fatalf("Expected clip, transition, clip, clip, got %d children", len(children))
+	}
+	if _, ok := children[1].(*gotio.Transition); !ok {
+		t.Errorf("Expected second child to be a Transition, got %T", children[1])
+	}
+}
+
+func TestClampHead(t *testing.T) {
+	start, end, in, duration := int64(-4), int64(20), int64(10), int64(24)
+	if err := clampHead("Clip A", &start, &end, &in, &duration); err != nil {
+		t.Fatalf("clampHead failed: %v", err)
+	}
+	if start != 0 || end != 20 || in != 14 || duration != 20 {
+		t.Errorf("Expected start 0, end 20, in 14, duration 20, got %d, %d, %d, %d", start, end, in, duration)
+	}
+
+	start, end = -10, 0
+	if err := clampHead("Clip B", &start, &end, nil, nil); err == nil {
+		t.Error("Expected an error for an item entirely before the track")
+	}
+}
+
+func TestEncoder_EncodeMissingReference(t *testing.T) {
+	timeline := gotio.NewTimeline("Offline", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	for _, name := range []string{"Lost Shot", "Also Lost"} {
+		sourceRange := opentime.NewTimeRange(
+			opentime.NewRationalTime(10, 24),
+			opentime.NewRationalTime(48, 24),
+		)
+		videoTrack.AppendChild(gotio.NewClip(
+			name,
+			gotio.NewMissingReference("", nil, nil),
+			&sourceRange,
+			nil,
+			nil,
+			nil,
+			"",
+			nil,
+		))
+	}
+	timeline.Tracks().AppendChild(videoTrack)
+
+	encode := func(timeline *gotio.Timeline) []byte {
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(timeline); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		return buf.Bytes()
+	}
+	data := encode(timeline)
+
+	var xmeml XMEML
+	if err := xml.Unmarshal(data, &xmeml); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	clipItems := xmeml.Sequence[0].Media.Video.Track[0].ClipItem
+	for i, id := range []string{"file-offline-1", "file-offline-2"} {
+		file := clipItems[i].File
+		if file == nil {
+			t.Fatalf("Clip %d: expected an offline file stub", i)
+		}
+		if file.ID != id {
+			t.Errorf("Clip %d: expected file id '%s', got '%s'", i, id, file.ID)
+		}
+		if file.Name != clipItems[i].Name {
+			t.Errorf("Clip %d: expected file named after the clip, got '%s'", i, file.Name)
+		}
+		if file.PathURL != "" {
+			t.Errorf("Clip %d: expected no pathurl, got '%s'", i, file.PathURL)
+		}
+		if file.Duration != 58 {
+			t.Errorf("Clip %d: expected file duration 58, got %d", i, file.Duration)
+		}
+	}
+
+	// Decoding and re-encoding gives the same offline files
+	decoded, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	clip := decoded.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	if _, ok := clip.MediaReference().(*gotio.MissingReference); !ok {
+		t.Errorf("Expected a MissingReference, got %T", clip.MediaReference())
+	}
+
+	var again XMEML
+	if err := xml.Unmarshal(encode(decoded), &again); err != nil {
+		t.Fatalf("Failed to parse re-encoded XML: %v", err)
+	}
+	for i, item := range again.Sequence[0].Media.Video.Track[0].ClipItem {
+		if !reflect.DeepEqual(*item.File, *clipItems[i].File) {
+			t.Errorf("Clip %d: offline file changed:\n  got      %+v\n  expected %+v", i, *item.File, *clipItems[i].File)
+		}
+	}
+}
+
+func TestEncoder_SharedFiles(t *testing.T) {
+	timeline := gotio.NewTimeline("Shared", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	for _, url := range []string{"file:///media/a/clip.mov", "file:///media/a/clip.mov", "file:///media/b/clip.mov"} {
+		sourceRange := opentime.NewTimeRange(
+			opentime.NewRationalTime(0, 24),
+			opentime.NewRationalTime(24, 24),
+		)
+		videoTrack.AppendChild(gotio.NewClip(
+			"Shot",
+			gotio.NewExternalReference("clip.mov", url, nil, nil),
+			&sourceRange,
+			nil,
+			nil,
+			nil,
+			"",
+			nil,
+		))
+	}
+	timeline.Tracks().AppendChild(videoTrack)
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	clipItems := xmeml.Sequence[0].Media.Video.Track[0].ClipItem
+	if len(clipItems) != 3 {
+		t.Fatalf("Expected 3 clipitems, got %d", len(clipItems))
+	}
+
+	first, second, third := clipItems[0].File, clipItems[1].File, clipItems[2].File
+	if first.isReference() || first.PathURL != "file:///media/a/clip.mov" {
+		t.Errorf("Expected the first clip to define the file in full, got %+v", *first)
+	}
+	if !second.isReference() || second.ID != first.ID {
+		t.Errorf("Expected the second clip to reference file '%s', got %+v", first.ID, *second)
+	}
+	if third.isReference() || third.ID == first.ID {
+		t.Errorf("Expected the third clip to define a different file, got %+v", *third)
+	}
+	if third.ID != "file-clipmov-2" {
+		t.Errorf("Expected file id 'file-clipmov-2', got '%s'", third.ID)
+	}
+
+	// Decoding resolves the reference to the full definition
+	decoded, err := NewDecoder(bytes.NewReader(buf.Bytes())).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	for i, expected := range []string{"file:///media/a/clip.mov", "file:///media/a/clip.mov", "file:///media/b/clip.mov"} {
+		clip := decoded.VideoTracks()[0].Children()[i].(*gotio.Clip)
+		ref, ok := clip.MediaReference().(*gotio.ExternalReference)
+		if !ok {
+			t.Errorf("Clip %d: expected an ExternalReference, got %T", i, clip.MediaReference())
+			continue
+		}
+		if ref.TargetURL() != expected {
+			t.Errorf("Clip %d: expected target URL '%s', got '%s'", i, expected, ref.TargetURL())
+		}
+	}
+}
+
+func TestEncoder_ForcedRate(t *testing.T) {
+	timeline := gotio.NewTimeline("Forced", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	for _, name := range []string{"First", "Second"} {
+		sourceRange := opentime.NewTimeRange(
+			opentime.NewRationalTime(24, 24),
+			opentime.NewRationalTime(48, 24),
+		)
+		videoTrack.AppendChild(gotio.NewClip(
+			name,
+			gotio.NewExternalReference(name+".mov", "file:///media/"+name+".mov", nil, nil),
+			&sourceRange,
+			nil,
+			nil,
+			nil,
+			"",
+			nil,
+		))
+	}
+	timeline.Tracks().AppendChild(videoTrack)
+
+	var buf bytes.Buffer
+	opts := EncodeOptions{ForcedRate: &Rate{Timebase: 30}}
+	if err := NewEncoderWithOptions(&buf, opts).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	seq := xmeml.Sequence[0]
+	if seq.Rate.Timebase != 30 || seq.Rate.NTSC {
+		t.Errorf("Expected sequence rate 30 non-NTSC, got %+v", seq.Rate)
+	}
+	if seq.Duration != 120 {
+		t.Errorf("Expected sequence duration 120, got %d", seq.Duration)
+	}
+
+	// 1s in and 2s long at 24 fps is 30 frames in and 60 long at 30 fps
+	expected := []struct{ start, end, in, out int64 }{
+		{0, 60, 30, 90},
+		{60, 120, 30, 90},
+	}
+	for i, want := range expected {
+		item := seq.Media.Video.Track[0].ClipItem[i]
+		if item.Rate.Timebase != 30 {
+			t.Errorf("Clip %d: expected rate 30, got %d", i, item.Rate.Timebase)
+		}
+		if item.Start != want.start || item.End != want.end || item.In != want.in || item.Out != want.out {
+			t.Errorf("Clip %d: expected start/end/in/out %d/%d/%d/%d, got %d/%d/%d/%d",
+				i, want.start, want.end, want.in, want.out, item.Start, item.End, item.In, item.Out)
+		}
+	}
+}
+
+func TestEncoder_MarkerColor(t *testing.T) {
+	markedRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(0, 24))
+	markers := []*gotio.Marker{
+		gotio.NewMarker("Palette", markedRange, gotio.MarkerColorCyan, "", nil),
+		gotio.NewMarker("Default", markedRange, gotio.MarkerColorGreen, "", nil),
+		gotio.NewMarker("Exact", markedRange, gotio.MarkerColorCyan, "", gotio.AnyDictionary{
+			"fcp7xml_color": map[string]int{"red": 10, "green": 200, "blue": 220},
+		}),
+	}
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(24, 24))
+	clip := gotio.NewClip("Marked", gotio.NewExternalReference("marked.mov", "file:///media/marked.mov", nil, nil), &sourceRange, nil, nil, markers, "", nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	videoTrack.AppendChild(clip)
+	timeline := gotio.NewTimeline("Markers", nil, nil)
+	timeline.Tracks().AppendChild(videoTrack)
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	encoded := xmeml.Sequence[0].Media.Video.Track[0].ClipItem[0].Marker
+	if len(encoded) != 3 {
+		t.Fatalf("Expected 3 markers, got %d", len(encoded))
+	}
+
+	expected := []*Color{
+		{Red: 0, Green: 255, Blue: 255},
+		nil,
+		{Red: 10, Green: 200, Blue: 220},
+	}
+	for i, want := range expected {
+		got := encoded[i].Color
+		if (got == nil) != (want == nil) || got != nil && (got.Red != want.Red || got.Green != want.Green || got.Blue != want.Blue) {
+			t.Errorf("%s: Expected color %+v, got %+v", encoded[i].Name, want, got)
+		}
+	}
+}
+
+func TestEncoder_MarkerDuration(t *testing.T) {
+	at := opentime.NewRationalTime(12, 24)
+	markers := []*gotio.Marker{
+		gotio.NewMarker("Point", opentime.NewTimeRange(at, opentime.NewRationalTime(0, 24)), gotio.MarkerColorGreen, "", nil),
+		gotio.NewMarker("Short", opentime.NewTimeRange(at, opentime.NewRationalTime(0.4, 24)), gotio.MarkerColorGreen, "", nil),
+		gotio.NewMarker("Range", opentime.NewTimeRange(at, opentime.NewRationalTime(6, 24)), gotio.MarkerColorGreen, "", nil),
+	}
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(24, 24))
+	clip := gotio.NewClip("Marked", gotio.NewExternalReference("marked.mov", "file:///media/marked.mov", nil, nil), &sourceRange, nil, nil, markers, "", nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	videoTrack.AppendChild(clip)
+	timeline := gotio.NewTimeline("Markers", nil, nil)
+	timeline.Tracks().AppendChild(videoTrack)
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	encoded := xmeml.Sequence[0].Media.Video.Track[0].ClipItem[0].Marker
+	if len(encoded) != 3 {
+		t.Fatalf("Expected 3 markers, got %d", len(encoded))
+	}
+
+	// A ranged marker shorter than a frame is written as a one-frame range,
+	// not as a point marker
+	expected := []struct{ in, out int64 }{{12, -1}, {12, 13}, {12, 18}}
+	for i, want := range expected {
+		if got := encoded[i]; got.In != want.in || got.Out != want.out {
+			t.Errorf("%s: Expected in=%d out=%d, got in=%d out=%d", got.Name, want.in, want.out, got.In, got.Out)
+		}
+	}
+}
+
+func TestEncoder_MediaReferenceKey(t *testing.T) {
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(24, 24))
+	clip := gotio.NewClip("Shot", nil, &sourceRange, nil, nil, nil, "", nil)
+	if err := clip.SetMediaReferences(map[string]gotio.MediaReference{
+		"online": gotio.NewExternalReference("shot.mov", "file:///online/shot.mov", nil, nil),
+		"proxy":  gotio.NewExternalReference("shot_proxy.mov", "file:///proxy/shot_proxy.mov", nil, nil),
+	}, "online"); err != nil {
+		t.Fatalf("SetMediaReferences failed: %v", err)
+	}
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	videoTrack.AppendChild(clip)
+	timeline := gotio.NewTimeline("Conform", nil, nil)
+	timeline.Tracks().AppendChild(videoTrack)
+
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{"", "file:///online/shot.mov"},
+		{"proxy", "file:///proxy/shot_proxy.mov"},
+		{"missing", "file:///online/shot.mov"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := NewEncoderWithOptions(&buf, EncodeOptions{MediaReferenceKey: tt.key}).Encode(timeline); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		var xmeml XMEML
+		if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+			t.Fatalf("Failed to parse encoded XML: %v", err)
+		}
+		file := xmeml.Sequence[0].Media.Video.Track[0].ClipItem[0].File
+		if file == nil || file.PathURL != tt.expected {
+			t.Errorf("Key %q: expected pathurl %s, got %+v", tt.key, tt.expected, file)
+		}
+	}
+}
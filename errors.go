@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DecodeError locates an error that stopped a sequence from being
+// converted. Decode returns it wrapped, so use errors.As to get it.
+type DecodeError struct {
+	// Line is the line of the document the element being converted starts
+	// on, or 0 if it isn't known.
+	Line int
+	// Sequence is the name of the sequence being converted.
+	Sequence string
+	// TrackKind is gotio.TrackKindVideo or gotio.TrackKindAudio, and
+	// TrackIndex the 0-based index of the track among those of its kind,
+	// if the error concerns a track.
+	TrackKind  string
+	TrackIndex int
+	// ItemName is the name of the clipitem, transitionitem or
+	// generatoritem, if the error concerns one.
+	ItemName string
+	Cause    error
+}
+
+// Error implements the error interface.
+func (e *DecodeError) Error() string {
+	var context []string
+	if e.Line > 0 {
+		context = append(context, fmt.Sprintf("line %d", e.Line))
+	}
+	if e.Sequence != "" {
+		context = append(context, fmt.Sprintf("sequence %q", e.Sequence))
+	}
+	if e.TrackKind != "" {
+		context = append(context, trackName(e.TrackKind, e.TrackIndex))
+	}
+	if e.ItemName != "" {
+		context = append(context, fmt.Sprintf("item %q", e.ItemName))
+	}
+	if len(context) == 0 {
+		return e.Cause.Error()
+	}
+	return strings.Join(context, ", ") + ": " + e.Cause.Error()
+}
+
+// Unwrap returns the cause of the error.
+func (e *DecodeError) Unwrap() error {
+	return e.Cause
+}
+
+// decodeScope is the sequence and track being converted.
+type decodeScope struct {
+	sequence     string
+	sequenceLine int
+	trackKind    string
+	trackIndex   int
+	trackLine    int
+}
+
+// decodeError wraps err in a DecodeError for the item with the given name
+// and line in the current scope. Without an item, the error is located at
+// the current track, or sequence. An err that already holds a DecodeError
+// is located by it, and returned as is.
+func (d *Decoder) decodeError(line int, itemName string, err error) error {
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		return err
+	}
+	scope := d.scope
+	if line == 0 {
+		line = scope.trackLine
+	}
+	if line == 0 {
+		line = scope.sequenceLine
+	}
+	return &DecodeError{
+		Line:       line,
+		Sequence:   scope.sequence,
+		TrackKind:  scope.trackKind,
+		TrackIndex: scope.trackIndex,
+		ItemName:   itemName,
+		Cause:      err,
+	}
+}
+
+// The sequences, tracks and items of a document remember the line they start
+// on, for DecodeError.
+
+// decodeAt decodes the element start into v, and sets line to the line the
+// element starts on.
+func decodeAt(d *xml.Decoder, start xml.StartElement, v any, line *int) error {
+	startLine, _ := d.InputPos()
+	if err := d.DecodeElement(v, &start); err != nil {
+		return err
+	}
+	*line = startLine
+	return nil
+}
+
+// UnmarshalXML decodes a sequence, remembering its line.
+func (s *Sequence) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plain Sequence
+	return decodeAt(d, start, (*plain)(s), &s.line)
+}
+
+// UnmarshalXML decodes a track, remembering its line.
+func (t *Track) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plain Track
+	return decodeAt(d, start, (*plain)(t), &t.line)
+}
+
+// UnmarshalXML decodes a clipitem, remembering its line.
+func (c *ClipItem) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plain ClipItem
+	return decodeAt(d, start, (*plain)(c), &c.line)
+}
+
+// UnmarshalXML decodes a transitionitem, remembering its line.
+func (t *TransitionItem) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plain TransitionItem
+	return decodeAt(d, start, (*plain)(t), &t.line)
+}
+
+// UnmarshalXML decodes a generatoritem, remembering its line.
+func (g *GeneratorItem) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plain GeneratorItem
+	return decodeAt(d, start, (*plain)(g), &g.line)
+}
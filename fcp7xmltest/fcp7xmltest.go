@@ -0,0 +1,217 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+// Package fcp7xmltest generates synthetic timelines and FCP7 XML documents
+// for testing code that uses the fcp7xml package.
+//
+// Generated content is deterministic: the same Spec, including its Seed,
+// always produces the same output, so a failing case can be reproduced from
+// the Spec alone. The package does not import testing and can be used from
+// benchmarks, fuzz seeds and standalone tools alike.
+package fcp7xmltest
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+
+	"github.com/Avalanche-io/gotio"
+	"github.com/Avalanche-io/gotio/opentime"
+	"github.com/Avalanche-io/otio-fcp7xml"
+)
+
+// Spec describes the content to generate. The zero value generates a single
+// video track of 24fps clips.
+type Spec struct {
+	// Seed selects the pseudo-random clip lengths, source ranges and
+	// placement of optional content.
+	Seed int64
+
+	// VideoTracks and AudioTracks are the number of tracks of each kind.
+	// If both are zero, one video track is generated.
+	VideoTracks int
+	AudioTracks int
+
+	// ClipsPerTrack is the number of clips on every track (default 4).
+	ClipsPerTrack int
+
+	// Timebase is the nominal frame rate (default 24). With NTSC set the
+	// actual rate is Timebase * 1000/1001, e.g. 29.97 for a timebase of 30.
+	Timebase int
+	NTSC     bool
+
+	// Transitions inserts a centered dissolve between some adjacent clips.
+	Transitions bool
+
+	// Markers adds markers to some clips.
+	Markers bool
+
+	// Retimes gives some clips a constant speed change, carried as an OTIO
+	// LinearTimeWarp and an FCP7 timeremap filter.
+	Retimes bool
+}
+
+// Rate returns the frame rate described by the spec.
+func (s Spec) Rate() float64 {
+	timebase := s.Timebase
+	if timebase == 0 {
+		timebase = 24
+	}
+	if s.NTSC {
+		return float64(timebase) * 1000.0 / 1001.0
+	}
+	return float64(timebase)
+}
+
+// GenerateTimeline builds a timeline described by spec.
+func GenerateTimeline(spec Spec) *gotio.Timeline {
+	g := &generator{
+		spec: spec,
+		rng:  rand.New(rand.NewSource(spec.Seed)),
+		rate: spec.Rate(),
+	}
+
+	videoTracks, audioTracks := spec.VideoTracks, spec.AudioTracks
+	if videoTracks == 0 && audioTracks == 0 {
+		videoTracks = 1
+	}
+
+	timeline := gotio.NewTimeline(fmt.Sprintf("Generated %d", spec.Seed), nil, nil)
+	for i := 0; i < videoTracks; i++ {
+		timeline.Tracks().AppendChild(g.track(gotio.TrackKindVideo, i))
+	}
+	for i := 0; i < audioTracks; i++ {
+		timeline.Tracks().AppendChild(g.track(gotio.TrackKindAudio, i))
+	}
+	return timeline
+}
+
+// GenerateXMEML returns the FCP7 XML encoding of GenerateTimeline(spec). It
+// panics if the generated timeline cannot be encoded, which would be a bug in
+// either package.
+func GenerateXMEML(spec Spec) []byte {
+	var buf bytes.Buffer
+	if err := fcp7xml.NewEncoder(&buf).Encode(GenerateTimeline(spec)); err != nil {
+		panic(fmt.Sprintf("fcp7xmltest: failed to encode generated timeline: %v", err))
+	}
+	return buf.Bytes()
+}
+
+// generator holds the state of a single GenerateTimeline call.
+type generator struct {
+	spec  Spec
+	rng   *rand.Rand
+	rate  float64
+	clips int
+}
+
+// track generates one track of clips and, optionally, transitions.
+func (g *generator) track(kind string, index int) *gotio.Track {
+	track := gotio.NewTrack(fmt.Sprintf("%s %d", kind, index+1), nil, kind, nil, nil)
+
+	clips := g.spec.ClipsPerTrack
+	if clips == 0 {
+		clips = 4
+	}
+	for i := 0; i < clips; i++ {
+		if i > 0 && g.spec.Transitions && g.rng.Intn(2) == 0 {
+			track.AppendChild(g.transition())
+		}
+		track.AppendChild(g.clip(kind))
+	}
+	return track
+}
+
+// clip generates a clip with handles on both sides, so that transitions
+// always have media to overlap.
+func (g *generator) clip(kind string) *gotio.Clip {
+	g.clips++
+	name := fmt.Sprintf("clip_%03d", g.clips)
+
+	duration := 24 + g.rng.Intn(97)
+	in := 12 + g.rng.Intn(200)
+	mediaDuration := in + duration + 12
+
+	availableRange := opentime.NewTimeRange(
+		opentime.NewRationalTime(0, g.rate),
+		opentime.NewRationalTime(float64(mediaDuration), g.rate),
+	)
+	sourceRange := opentime.NewTimeRange(
+		opentime.NewRationalTime(float64(in), g.rate),
+		opentime.NewRationalTime(float64(duration), g.rate),
+	)
+
+	extension := ".mov"
+	if kind == gotio.TrackKindAudio {
+		extension = ".wav"
+	}
+	mediaRef := gotio.NewExternalReference(
+		name+extension,
+		"file:///media/"+name+extension,
+		&availableRange,
+		nil,
+	)
+
+	metadata := make(gotio.AnyDictionary)
+	var effects []gotio.Effect
+	if g.spec.Retimes && kind == gotio.TrackKindVideo && g.rng.Intn(3) == 0 {
+		speeds := []float64{25, 50, 200}
+		speed := speeds[g.rng.Intn(len(speeds))]
+		effects = append(effects, gotio.NewLinearTimeWarp("Time Remap", "LinearTimeWarp", speed/100, nil))
+		metadata["fcp7xml_filters"] = []gotio.AnyDictionary{timeRemapFilter(speed)}
+	}
+
+	var markers []*gotio.Marker
+	if g.spec.Markers && g.rng.Intn(2) == 0 {
+		offset := g.rng.Intn(duration)
+		markedRange := opentime.NewTimeRange(
+			opentime.NewRationalTime(float64(in+offset), g.rate),
+			opentime.NewRationalTime(0, g.rate),
+		)
+		markers = append(markers, gotio.NewMarker(
+			fmt.Sprintf("%s marker", name),
+			markedRange,
+			gotio.MarkerColorRed,
+			fmt.Sprintf("frame %d", in+offset),
+			nil,
+		))
+	}
+
+	return gotio.NewClip(name, mediaRef, &sourceRange, metadata, effects, markers, "", nil)
+}
+
+// transition generates a centered dissolve.
+func (g *generator) transition() *gotio.Transition {
+	half := opentime.NewRationalTime(float64(4+g.rng.Intn(9)), g.rate)
+	metadata := gotio.AnyDictionary{
+		"fcp7xml_alignment": "center",
+		"fcp7xml_effect": gotio.AnyDictionary{
+			"name":           "Cross Dissolve",
+			"effectid":       "Cross Dissolve",
+			"effecttype":     "transition",
+			"mediatype":      "video",
+			"effectcategory": "Dissolve",
+		},
+	}
+	return gotio.NewTransition("Cross Dissolve", gotio.TransitionTypeSMPTEDissolve, half, half, metadata)
+}
+
+// timeRemapFilter builds the filter metadata for a constant speed change,
+// in the form the fcp7xml decoder produces for a timeremap filter.
+func timeRemapFilter(speed float64) gotio.AnyDictionary {
+	return gotio.AnyDictionary{
+		"enabled": true,
+		"effect": gotio.AnyDictionary{
+			"name":           "Time Remap",
+			"effectid":       "timeremap",
+			"effecttype":     "motion",
+			"mediatype":      "video",
+			"effectcategory": "motion",
+			"parameters": []gotio.AnyDictionary{
+				{"parameterid": "variablespeed", "name": "variablespeed", "value": "0"},
+				{"parameterid": "speed", "name": "speed", "value": fmt.Sprintf("%g", speed)},
+				{"parameterid": "reverse", "name": "reverse", "value": "FALSE"},
+			},
+		},
+	}
+}
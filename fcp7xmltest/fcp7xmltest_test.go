@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xmltest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Avalanche-io/gotio"
+	"github.com/Avalanche-io/otio-fcp7xml"
+)
+
+func TestGenerateXMEML_Deterministic(t *testing.T) {
+	spec := Spec{Seed: 42, VideoTracks: 2, AudioTracks: 1, Transitions: true, Markers: true, Retimes: true}
+
+	first := GenerateXMEML(spec)
+	second := GenerateXMEML(spec)
+	if !bytes.Equal(first, second) {
+		t.Error("Expected identical output for the same spec")
+	}
+
+	spec.Seed = 43
+	if bytes.Equal(first, GenerateXMEML(spec)) {
+		t.Error("Expected different output for a different seed")
+	}
+}
+
+func TestGenerateTimeline_Spec(t *testing.T) {
+	spec := Spec{Seed: 7, VideoTracks: 2, AudioTracks: 3, ClipsPerTrack: 5, Timebase: 30, NTSC: true, Transitions: true}
+	timeline := GenerateTimeline(spec)
+
+	if len(timeline.VideoTracks()) != 2 {
+		t.Errorf("Expected 2 video tracks, got %d", len(timeline.VideoTracks()))
+	}
+	if len(timeline.AudioTracks()) != 3 {
+		t.Errorf("Expected 3 audio tracks, got %d", len(timeline.AudioTracks()))
+	}
+
+	clips, transitions := 0, 0
+	for _, track := range timeline.VideoTracks() {
+		for _, child := range track.Children() {
+			switch item := child.(type) {
+			case *gotio.Clip:
+				clips++
+				if rate := item.SourceRange().Duration().Rate(); rate != spec.Rate() {
+					t.Errorf("Expected rate %f, got %f", spec.Rate(), rate)
+				}
+			case *gotio.Transition:
+				transitions++
+			}
+		}
+	}
+	if clips != 10 {
+		t.Errorf("Expected 10 video clips, got %d", clips)
+	}
+	if transitions == 0 {
+		t.Error("Expected some transitions")
+	}
+}
+
+func TestGenerateXMEML_Decodes(t *testing.T) {
+	spec := Spec{Seed: 1, VideoTracks: 1, AudioTracks: 1, Timebase: 24, NTSC: true, Markers: true, Retimes: true}
+
+	timeline, err := fcp7xml.NewDecoder(bytes.NewReader(GenerateXMEML(spec))).Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if len(timeline.VideoTracks()) != 1 || len(timeline.AudioTracks()) != 1 {
+		t.Errorf("Expected 1 video and 1 audio track, got %d and %d",
+			len(timeline.VideoTracks()), len(timeline.AudioTracks()))
+	}
+	if n := len(timeline.VideoTracks()[0].Children()); n != 4 {
+		t.Errorf("Expected 4 clips by default, got %d", n)
+	}
+}
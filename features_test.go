@@ -4,10 +4,18 @@
 package fcp7xml
 
 import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"maps"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/Avalanche-io/gotio"
+	"github.com/Avalanche-io/gotio/opentime"
 )
 
 func TestDecoder_DecodeWithMarkers(t *testing.T) {
@@ -65,6 +73,10 @@ func TestDecoder_DecodeWithMarkers(t *testing.T) {
 	if _, ok := metadata["fcp7xml_color"]; !ok {
 		t.Error("Expected fcp7xml_color in marker metadata")
 	}
+
+	if markers[1].Color() != gotio.MarkerColorBlue {
+		t.Errorf("Expected second marker color BLUE, got %s", markers[1].Color())
+	}
 }
 
 func TestDecoder_DecodeWithEffectsAndFilters(t *testing.T) {
@@ -316,3 +328,3980 @@ func TestEncoder_EncodeWithNewFeatures(t *testing.T) {
 		t.Errorf("Marker name not preserved after round trip: got '%s'", markers[0].Name())
 	}
 }
+
+func TestReelNameRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Reel Test</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip-1">
+            <name>A001C003</name>
+            <duration>48</duration>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>48</end>
+            <in>0</in>
+            <out>48</out>
+            <file id="file-1">
+              <name>A001C003.mov</name>
+              <pathurl>file:///media/A001C003.mov</pathurl>
+              <rate>
+                <timebase>24</timebase>
+                <ntsc>FALSE</ntsc>
+              </rate>
+              <duration>96</duration>
+              <timecode>
+                <rate>
+                  <timebase>24</timebase>
+                  <ntsc>FALSE</ntsc>
+                </rate>
+                <string>01:00:00:00</string>
+                <frame>86400</frame>
+                <displayformat>NDF</displayformat>
+                <reel>
+                  <name>A001</name>
+                </reel>
+              </timecode>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	if reel, _ := clip.Metadata()["fcp7xml_reel_name"].(string); reel != "A001" {
+		t.Fatalf("Expected reel name 'A001' in metadata, got '%s'", reel)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	file := xmeml.Sequence[0].Media.Video.Track[0].ClipItem[0].File
+	if file == nil || file.Timecode == nil || file.Timecode.Reel == nil {
+		t.Fatal("Expected encoded file to carry a reel")
+	}
+	if file.Timecode.Reel.Name != "A001" {
+		t.Errorf("Expected encoded reel name 'A001', got '%s'", file.Timecode.Reel.Name)
+	}
+
+	decoded, err := NewDecoder(&buf).Decode()
+	if err != nil {
+		t.Fatalf("Decode of encoded XML failed: %v", err)
+	}
+	clip = decoded.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	if reel, _ := clip.Metadata()["fcp7xml_reel_name"].(string); reel != "A001" {
+		t.Errorf("Reel name not preserved after round trip: got '%s'", reel)
+	}
+}
+
+func TestImageFlagsRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Plates</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip-1">
+            <name>Plate</name>
+            <duration>48</duration>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>48</end>
+            <in>0</in>
+            <out>48</out>
+            <anamorphic>TRUE</anamorphic>
+            <alphatype>straight</alphatype>
+            <file id="file-1">
+              <name>plate.mov</name>
+              <pathurl>file:///media/plate.mov</pathurl>
+              <rate>
+                <timebase>24</timebase>
+                <ntsc>FALSE</ntsc>
+              </rate>
+              <duration>48</duration>
+              <media>
+                <video>
+                  <samplecharacteristics>
+                    <width>1920</width>
+                    <height>1080</height>
+                    <anamorphic>TRUE</anamorphic>
+                  </samplecharacteristics>
+                </video>
+              </media>
+            </file>
+          </clipitem>
+          <generatoritem>
+            <name>Matte</name>
+            <duration>24</duration>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>48</start>
+            <end>72</end>
+            <in>0</in>
+            <out>24</out>
+            <anamorphic>FALSE</anamorphic>
+            <alphatype>black</alphatype>
+          </generatoritem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	children := timeline.VideoTracks()[0].Children()
+	clipMeta := children[0].(*gotio.Clip).Metadata()
+	if anamorphic, _ := clipMeta["fcp7xml_anamorphic"].(bool); !anamorphic {
+		t.Error("Expected clip to be flagged anamorphic")
+	}
+	if alphaType, _ := clipMeta["fcp7xml_alphatype"].(string); alphaType != "straight" {
+		t.Errorf("Expected clip alpha type 'straight', got '%s'", alphaType)
+	}
+	if mode, _ := clipMeta["fcp7xml_file_anamorphic"].(string); mode != "TRUE" {
+		t.Errorf("Expected file anamorphic 'TRUE', got '%s'", mode)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	track := xmeml.Sequence[0].Media.Video.Track[0]
+
+	clipItem := track.ClipItem[0]
+	if clipItem.Anamorphic == nil || !*clipItem.Anamorphic {
+		t.Error("Expected encoded clipitem to be anamorphic")
+	}
+	if clipItem.AlphaType != "straight" {
+		t.Errorf("Expected encoded clipitem alpha type 'straight', got '%s'", clipItem.AlphaType)
+	}
+	if mode := fileAnamorphicMode(clipItem.File); mode != "TRUE" {
+		t.Errorf("Expected encoded file anamorphic 'TRUE', got '%s'", mode)
+	}
+
+	if len(track.GeneratorItem) != 1 {
+		t.Fatalf("Expected 1 generator item, got %d", len(track.GeneratorItem))
+	}
+	genItem := track.GeneratorItem[0]
+	if genItem.Anamorphic == nil || *genItem.Anamorphic {
+		t.Error("Expected encoded generator to keep anamorphic FALSE")
+	}
+	if genItem.AlphaType != "black" {
+		t.Errorf("Expected encoded generator alpha type 'black', got '%s'", genItem.AlphaType)
+	}
+}
+
+func TestAlphaTypeValuesRoundTrip(t *testing.T) {
+	const doc = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Alpha</name>
+    <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip-1">
+            <name>Title</name>
+            <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+            <start>0</start>
+            <end>24</end>
+            <in>0</in>
+            <out>24</out>
+            <alphatype>ALPHA</alphatype>
+            <file id="file-1">
+              <name>title.mov</name>
+              <pathurl>file:///media/title.mov</pathurl>
+              <duration>24</duration>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	for _, alphaType := range []string{"none", "straight", "premultiplied", "black", "white"} {
+		t.Run(alphaType, func(t *testing.T) {
+			timeline, err := NewDecoder(strings.NewReader(strings.Replace(doc, "ALPHA", alphaType, 1))).Decode()
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := NewEncoder(&buf).Encode(timeline); err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			var xmeml XMEML
+			if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+				t.Fatalf("Failed to parse encoded XML: %v", err)
+			}
+			if got := xmeml.Sequence[0].Media.Video.Track[0].ClipItem[0].AlphaType; got != alphaType {
+				t.Errorf("Expected alpha type '%s', got '%s'", alphaType, got)
+			}
+		})
+	}
+}
+
+func TestStereo3DRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Stereo Conform</name>
+    <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip-left">
+            <name>A001_L</name>
+            <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+            <start>0</start>
+            <end>24</end>
+            <in>0</in>
+            <out>24</out>
+            <file id="file-left">
+              <name>A001_L.mov</name>
+              <pathurl>file:///media/A001_L.mov</pathurl>
+              <duration>24</duration>
+            </file>
+            <stereo3d><eye>L</eye><convergence>0.5</convergence></stereo3d>
+          </clipitem>
+        </track>
+        <track>
+          <clipitem id="clip-right">
+            <name>A001_R</name>
+            <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+            <start>0</start>
+            <end>24</end>
+            <in>0</in>
+            <out>24</out>
+            <file id="file-right">
+              <name>A001_R.mov</name>
+              <pathurl>file:///media/A001_R.mov</pathurl>
+              <duration>24</duration>
+            </file>
+            <stereo3d><eye>right</eye></stereo3d>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	tracks := timeline.VideoTracks()
+	for i, expected := range []string{"left", "right"} {
+		clip := tracks[i].Children()[0].(*gotio.Clip)
+		if eye, _ := clip.Metadata()["fcp7xml_eye"].(string); eye != expected {
+			t.Errorf("Expected %s eye on track %d, got '%s'", expected, i+1, eye)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+
+	left := xmeml.Sequence[0].Media.Video.Track[0].ClipItem[0].Stereo3D
+	if left == nil || left.Inner != "<eye>L</eye><convergence>0.5</convergence>" {
+		t.Errorf("Expected left eye stereo3d to be kept as written, got %+v", left)
+	}
+	right := xmeml.Sequence[0].Media.Video.Track[1].ClipItem[0].Stereo3D
+	if right == nil || right.Eye() != "right" {
+		t.Errorf("Expected right eye stereo3d, got %+v", right)
+	}
+
+	// An eye set without the original settings is written on its own
+	clip := tracks[0].Children()[0].(*gotio.Clip)
+	delete(clip.Metadata(), "fcp7xml_stereo3d")
+	buf.Reset()
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "<stereo3d><eye>left</eye></stereo3d>") {
+		t.Errorf("Expected a stereo3d element with the left eye, got:\n%s", buf.String())
+	}
+}
+
+func TestImplicitInOutRoundTrip(t *testing.T) {
+	const doc = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Whole Media</name>
+    <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip-1">
+            <name>Shot</name>
+            <duration>100</duration>
+            <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+            <start>0</start>
+            <end>END</end>
+            <in>IN</in>
+            <out>OUT</out>
+            <file id="file-1">
+              <name>shot.mov</name>
+              <pathurl>file:///media/shot.mov</pathurl>
+              <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+              <duration>100</duration>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	tests := []struct {
+		name          string
+		in, out, end  string
+		expectedStart float64
+		expectedDur   float64
+	}{
+		{"in only", "-1", "40", "40", 0, 40},
+		{"out only", "60", "-1", "40", 60, 40},
+		{"both", "-1", "-1", "100", 0, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xmlData := strings.NewReplacer("IN", tt.in, "OUT", tt.out, "END", tt.end).Replace(doc)
+			timeline, err := NewDecoderWithOptions(strings.NewReader(xmlData), DecodeOptions{Strict: true}).Decode()
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+
+			clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+			sr := clip.SourceRange()
+			if sr.StartTime().Value() != tt.expectedStart || sr.Duration().Value() != tt.expectedDur {
+				t.Errorf("Expected source range %v+%v, got %v+%v",
+					tt.expectedStart, tt.expectedDur, sr.StartTime().Value(), sr.Duration().Value())
+			}
+
+			var buf bytes.Buffer
+			if err := NewEncoder(&buf).Encode(timeline); err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			var xmeml XMEML
+			if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+				t.Fatalf("Failed to parse encoded XML: %v", err)
+			}
+			clipItem := xmeml.Sequence[0].Media.Video.Track[0].ClipItem[0]
+			if in := strconv.FormatInt(clipItem.In, 10); in != tt.in {
+				t.Errorf("Expected in point %s, got %s", tt.in, in)
+			}
+			if out := strconv.FormatInt(clipItem.Out, 10); out != tt.out {
+				t.Errorf("Expected out point %s, got %s", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestFileRateRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>File Rate</name>
+    <rate><timebase>30</timebase><ntsc>FALSE</ntsc></rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip-1">
+            <name>Film</name>
+            <rate><timebase>30</timebase><ntsc>FALSE</ntsc></rate>
+            <start>0</start>
+            <end>60</end>
+            <in>30</in>
+            <out>90</out>
+            <file id="file-1">
+              <name>film.mov</name>
+              <pathurl>file:///media/film.mov</pathurl>
+              <rate><timebase>24</timebase><ntsc>TRUE</ntsc></rate>
+              <duration>240</duration>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	ref := clip.MediaReference()
+	ar := ref.AvailableRange()
+	if ar == nil || ar.Duration().Value() != 240 || ar.Duration().Rate() != 24*1000.0/1001.0 {
+		t.Errorf("Expected available range of 240 frames at 23.976 fps, got %v", ar)
+	}
+	if sr := clip.SourceRange(); sr.StartTime().Rate() != 30 {
+		t.Errorf("Expected source range in the clip's rate, got %v", sr)
+	}
+	fileRate, _ := ref.Metadata()["fcp7xml_file_rate"].(gotio.AnyDictionary)
+	if timebase, _ := fileRate["timebase"].(int64); timebase != 24 {
+		t.Errorf("Expected file rate timebase 24 in metadata, got %v", fileRate)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	file := xmeml.Sequence[0].Media.Video.Track[0].ClipItem[0].File
+	if file.Rate.Timebase != 24 || !file.Rate.NTSC {
+		t.Errorf("Expected file rate 24 NTSC, got %+v", file.Rate)
+	}
+	if file.Duration != 240 {
+		t.Errorf("Expected file duration 240, got %d", file.Duration)
+	}
+}
+
+func TestFCPBooleansRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("testdata/fcp_booleans.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	track := timeline.VideoTracks()[0]
+	if track.Enabled() {
+		t.Error("Expected track to be disabled")
+	}
+	if locked, _ := track.Metadata()["fcp7xml_locked"].(bool); !locked {
+		t.Error("Expected track to be locked")
+	}
+	clip := track.Children()[0].(*gotio.Clip)
+	if clip.Enabled() {
+		t.Error("Expected clip to be disabled")
+	}
+	dur, _ := clip.Duration()
+	if dur.Rate() != 30*1000.0/1001.0 {
+		t.Errorf("Expected NTSC rate, got %v", dur.Rate())
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	output := buf.String()
+	for _, expected := range []string{
+		"<ntsc>TRUE</ntsc>",
+		"<enabled>FALSE</enabled>",
+		"<locked>TRUE</locked>",
+		"<anamorphic>TRUE</anamorphic>",
+		"<anamorphic>FALSE</anamorphic>",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %s", expected)
+		}
+	}
+	if strings.Contains(output, ">true<") || strings.Contains(output, ">false<") {
+		t.Error("Expected booleans to be written as TRUE or FALSE only")
+	}
+
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	filter := xmeml.Sequence[0].Media.Video.Track[0].ClipItem[0].Filter[0]
+	if filter.Enabled == nil || *filter.Enabled {
+		t.Error("Expected filter to stay disabled")
+	}
+}
+
+func TestFCPBoolSpellings(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected bool
+	}{
+		{"TRUE", true},
+		{"true", true},
+		{"1", true},
+		{" TRUE\n", true},
+		{"FALSE", false},
+		{"false", false},
+		{"0", false},
+	}
+	for _, tt := range tests {
+		var rate Rate
+		if err := xml.Unmarshal([]byte("<rate><timebase>30</timebase><ntsc>"+tt.text+"</ntsc></rate>"), &rate); err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.text, err)
+			continue
+		}
+		if bool(rate.NTSC) != tt.expected {
+			t.Errorf("%q: Expected %v, got %v", tt.text, tt.expected, rate.NTSC)
+		}
+	}
+
+	var rate Rate
+	if err := xml.Unmarshal([]byte("<rate><ntsc>maybe</ntsc></rate>"), &rate); err == nil {
+		t.Error("Expected an error for an invalid boolean")
+	}
+}
+
+func TestMasterCommentsRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Logged</name>
+    <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip-1">
+            <name>Scene 12 Take 3</name>
+            <rate><timebase>24</timebase><ntsc>FALSE</ntsc></rate>
+            <start>0</start>
+            <end>48</end>
+            <in>0</in>
+            <out>48</out>
+            <file id="file-1">
+              <name>A012_C003.mov</name>
+              <pathurl>file:///media/A012_C003.mov</pathurl>
+              <duration>96</duration>
+            </file>
+            <comments>
+              <mastercomment1>Scene 12</mastercomment1>
+              <mastercomment2>Take 3</mastercomment2>
+              <mastercomment4>Circle take</mastercomment4>
+              <comment>Boom dips at the end</comment>
+            </comments>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	comments, ok := clip.Metadata()["fcp7xml_comments"].(gotio.AnyDictionary)
+	if !ok {
+		t.Fatal("Expected fcp7xml_comments metadata")
+	}
+	expected := gotio.AnyDictionary{
+		"mastercomment1": "Scene 12",
+		"mastercomment2": "Take 3",
+		"mastercomment4": "Circle take",
+		"comment":        []string{"Boom dips at the end"},
+	}
+	if !reflect.DeepEqual(comments, expected) {
+		t.Errorf("Expected comments %v, got %v", expected, comments)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	encoded := xmeml.Sequence[0].Media.Video.Track[0].ClipItem[0].Comments
+	if encoded == nil {
+		t.Fatal("Expected comments on the encoded clipitem")
+	}
+	if encoded.MasterComment1 != "Scene 12" || encoded.MasterComment2 != "Take 3" ||
+		encoded.MasterComment3 != "" || encoded.MasterComment4 != "Circle take" {
+		t.Errorf("Expected master comments to be restored, got %+v", encoded)
+	}
+	if len(encoded.Comment) != 1 || encoded.Comment[0].Text != "Boom dips at the end" {
+		t.Errorf("Expected the plain comment to be restored, got %+v", encoded.Comment)
+	}
+}
+
+func TestSequenceTimecodeRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("testdata/sidecar.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	start := timeline.GlobalStartTime()
+	if start == nil || start.Value() != 900000 || start.Rate() != 25 {
+		t.Fatalf("Expected a global start time of 900000 at 25 fps, got %v", start)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	tc := xmeml.Sequence[0].Timecode
+	if tc.String != "10:00:00:00" || tc.Frame != 900000 || tc.DisplayFormat != "NDF" || tc.Rate.Timebase != 25 {
+		t.Errorf("Expected timecode 10:00:00:00 (frame 900000, NDF, 25 fps), got %+v", tc)
+	}
+
+	// A timeline without a start time starts at zero
+	buf.Reset()
+	if err := NewEncoder(&buf).Encode(reelTimeline("Reel", 24, 1, false)); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "<string>00:00:00:00</string>") {
+		t.Errorf("Expected a timecode of 00:00:00:00, got:\n%s", buf.String())
+	}
+}
+
+func TestDropFrameTimecode(t *testing.T) {
+	rate := &Rate{Timebase: 30, NTSC: true}
+	tests := []struct {
+		frame    int64
+		timecode string
+	}{
+		{0, "00:00:00;00"},
+		{1799, "00:00:59;29"},
+		{1800, "00:01:00;02"},
+		{17982, "00:10:00;00"},
+		{107892, "01:00:00;00"},
+	}
+	for _, tt := range tests {
+		if got := formatTimecode(tt.frame, rate, true); got != tt.timecode {
+			t.Errorf("Expected frame %d to format as %s, got %s", tt.frame, tt.timecode, got)
+		}
+		if frame, ok := parseTimecode(tt.timecode, rate, true); !ok || frame != tt.frame {
+			t.Errorf("Expected %s to parse as frame %d, got %d", tt.timecode, tt.frame, frame)
+		}
+	}
+}
+
+func TestWipeTransitionRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Wipes</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <transitionitem>
+            <name>Clock Wipe</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>24</end>
+            <alignment>center</alignment>
+            <effect>
+              <name>Clock Wipe</name>
+              <effectid>Clock Wipe</effectid>
+              <effectcategory>Wipe</effectcategory>
+              <effecttype>transition</effecttype>
+              <mediatype>video</mediatype>
+              <wipecode>7</wipecode>
+              <wipeaccuracy>100</wipeaccuracy>
+              <startratio>0.25</startratio>
+              <endratio>0.75</endratio>
+              <reverse>TRUE</reverse>
+            </effect>
+          </transitionitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	var original XMEML
+	if err := xml.Unmarshal([]byte(xmlData), &original); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+	originalEffect := original.Sequence[0].Media.Video.Track[0].TransitionItem[0].Effect
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	transitions := encoded.Sequence[0].Media.Video.Track[0].TransitionItem
+	if len(transitions) != 1 || transitions[0].Effect == nil {
+		t.Fatal("Expected one transition with an effect")
+	}
+	if effect := transitions[0].Effect; !reflect.DeepEqual(effect, originalEffect) {
+		t.Errorf("Effect changed:\n  got      %+v\n  expected %+v", effect, originalEffect)
+	}
+}
+
+func TestDissolveRatioRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Dissolves</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <transitionitem>
+            <name>Cross Dissolve</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>24</end>
+            <alignment>center</alignment>
+            <effect>
+              <name>Cross Dissolve</name>
+              <effectid>Cross Dissolve</effectid>
+              <effectcategory>Dissolve</effectcategory>
+              <effecttype>transition</effecttype>
+              <mediatype>video</mediatype>
+              <startratio>0.0</startratio>
+              <endratio>1.0</endratio>
+            </effect>
+          </transitionitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	transition := timeline.Tracks().Children()[0].(*gotio.Track).Children()[0].(*gotio.Transition)
+	effect, _ := transition.Metadata()["fcp7xml_effect"].(gotio.AnyDictionary)
+	if effect["startratio"] != 0.0 || effect["endratio"] != 1.0 {
+		t.Errorf("Expected startratio 0 and endratio 1 in metadata, got %v and %v", effect["startratio"], effect["endratio"])
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	encodedEffect := encoded.Sequence[0].Media.Video.Track[0].TransitionItem[0].Effect
+	if encodedEffect == nil || encodedEffect.StartRatio == nil || encodedEffect.EndRatio == nil {
+		t.Fatalf("Expected the effect to keep its ratios, got %+v", encodedEffect)
+	}
+	if *encodedEffect.StartRatio != 0 || *encodedEffect.EndRatio != 1 {
+		t.Errorf("Expected startratio 0 and endratio 1, got %v and %v", *encodedEffect.StartRatio, *encodedEffect.EndRatio)
+	}
+}
+
+func TestStereoSourceChannelLayout(t *testing.T) {
+	data, err := os.ReadFile("testdata/stereo_source.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	// The two channels of the interview merge into one stereo clip; the
+	// room tone uses one channel of a four-channel file
+	audioTracks := timeline.AudioTracks()
+	if len(audioTracks) != 1 || len(audioTracks[0].Children()) != 2 {
+		t.Fatalf("Expected 1 audio track with 2 clips, got %d tracks", len(audioTracks))
+	}
+	video := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	stereo := audioTracks[0].Children()[0].(*gotio.Clip)
+	mono := audioTracks[0].Children()[1].(*gotio.Clip)
+
+	if channels, _ := stereo.Metadata()["fcp7xml_audio_channels"].(int64); channels != 2 {
+		t.Errorf("Expected a stereo clip, got %v channels", stereo.Metadata()["fcp7xml_audio_channels"])
+	}
+	if group := stereo.Metadata()["fcp7xml_link_group"]; group == nil || group != video.Metadata()["fcp7xml_link_group"] {
+		t.Errorf("Expected the stereo clip in the video's link group, got %v and %v", group, video.Metadata()["fcp7xml_link_group"])
+	}
+	if sourceTrack, _ := mono.Metadata()["fcp7xml_source_track"].(int64); sourceTrack != 3 {
+		t.Errorf("Expected source track 3, got %v", mono.Metadata()["fcp7xml_source_track"])
+	}
+	if _, ok := mono.Metadata()["fcp7xml_link_group"]; ok {
+		t.Error("Expected the unlinked clip to have no link group")
+	}
+	for _, tt := range []struct {
+		clip     *gotio.Clip
+		channels int64
+	}{{stereo, 2}, {mono, 4}} {
+		if channels, _ := tt.clip.MediaReference().Metadata()["fcp7xml_channelcount"].(int64); channels != tt.channels {
+			t.Errorf("%s: Expected channel count %d, got %v", tt.clip.Name(), tt.channels, tt.clip.MediaReference().Metadata()["fcp7xml_channelcount"])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	audio := encoded.Sequence[0].Media.Audio
+	if len(audio.Track) != 2 {
+		t.Fatalf("Expected the stereo clip split over 2 audio tracks, got %d", len(audio.Track))
+	}
+	roomTone := audio.Track[0].ClipItem[1]
+	if roomTone.SourceTrack == nil || roomTone.SourceTrack.TrackIndex != 3 {
+		t.Errorf("Expected source track 3, got %+v", roomTone.SourceTrack)
+	}
+	if roomTone.File == nil || roomTone.File.Media == nil || roomTone.File.Media.Audio == nil || roomTone.File.Media.Audio.ChannelCount != 4 {
+		t.Errorf("Expected the file's channel count 4 to be re-emitted, got %+v", roomTone.File)
+	}
+}
+
+func TestUnknownElementsRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("testdata/premiere_example.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	var original XMEML
+	if err := xml.Unmarshal(data, &original); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+
+	// Unknown elements are the same up to whitespace
+	normalize := func(elements []UnknownElement) []string {
+		var fragments []string
+		for _, fragment := range unknownToMetadata(elements) {
+			fragments = append(fragments, strings.Join(strings.Fields(fragment), " "))
+		}
+		return fragments
+	}
+	compare := func(what string, got, expected []UnknownElement) {
+		t.Helper()
+		if !reflect.DeepEqual(normalize(got), normalize(expected)) {
+			t.Errorf("%s: unknown elements changed:\n  got      %v\n  expected %v", what, normalize(got), normalize(expected))
+		}
+	}
+
+	seq, encodedSeq := &original.Sequence[0], &encoded.Sequence[0]
+	if len(seq.Unknown) == 0 {
+		t.Fatal("Expected the fixture's sequence to have unknown elements")
+	}
+	compare("sequence", encodedSeq.Unknown, seq.Unknown)
+	for i := range seq.Media.Video.Track {
+		compare("video track "+strconv.Itoa(i+1), encodedSeq.Media.Video.Track[i].Unknown, seq.Media.Video.Track[i].Unknown)
+	}
+
+	// Clipitems are matched by id and position, as generated ids may
+	// coincide with ids of the original
+	type clipItemKey struct {
+		id    string
+		start int64
+	}
+	clipItems := make(map[clipItemKey]*ClipItem)
+	files := make(map[string]*File)
+	for _, t := range classifyTracks(encodedSeq) {
+		for i := range t.track.ClipItem {
+			item := &t.track.ClipItem[i]
+			clipItems[clipItemKey{item.ID, item.Start}] = item
+			if item.File != nil && item.File.PathURL != "" {
+				files[item.File.PathURL] = item.File
+			}
+		}
+	}
+	compared := 0
+	for _, tr := range classifyTracks(seq) {
+		for i := range tr.track.ClipItem {
+			item := &tr.track.ClipItem[i]
+			if encodedItem, ok := clipItems[clipItemKey{item.ID, item.Start}]; ok {
+				compare("clipitem "+item.ID, encodedItem.Unknown, item.Unknown)
+				compared++
+			}
+			if item.File != nil && item.File.PathURL != "" {
+				if file, ok := files[item.File.PathURL]; ok {
+					compare("file "+item.File.ID, file.Unknown, item.File.Unknown)
+				}
+			}
+		}
+	}
+	if compared == 0 {
+		t.Error("Expected clipitems to keep their ids")
+	}
+}
+
+func TestAudioOutputsRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("testdata/premiere_example.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	var original XMEML
+	if err := xml.Unmarshal(data, &original); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+	originalAudio := original.Sequence[0].Media.Audio
+	if originalAudio.Outputs == nil || len(originalAudio.Outputs.Group) != 2 {
+		t.Fatalf("Expected the fixture to route audio to 2 outputs, got %+v", originalAudio.Outputs)
+	}
+
+	encode := func(timeline *gotio.Timeline) *Audio {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(timeline); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		var encoded XMEML
+		if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+			t.Fatalf("Failed to parse encoded XML: %v", err)
+		}
+		return encoded.Sequence[0].Media.Audio
+	}
+
+	for _, decode := range []func(*Decoder) (*gotio.Timeline, error){(*Decoder).Decode, decodeWhole} {
+		timeline, err := decode(NewDecoder(bytes.NewReader(data)))
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		audio := encode(timeline)
+		if audio.NumOutputChannels != originalAudio.NumOutputChannels {
+			t.Errorf("Expected %d output channels, got %d", originalAudio.NumOutputChannels, audio.NumOutputChannels)
+		}
+		if !reflect.DeepEqual(audio.Outputs, originalAudio.Outputs) {
+			t.Errorf("Outputs changed:\n  got      %+v\n  expected %+v", audio.Outputs, originalAudio.Outputs)
+		}
+	}
+
+	// Timelines without routing get a stereo pair
+	timeline := gotio.NewTimeline("No Routing", nil, nil)
+	audioTrack := gotio.NewTrack("Audio 1", nil, gotio.TrackKindAudio, nil, nil)
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(24, 24))
+	audioTrack.AppendChild(gotio.NewClip("Tone", gotio.NewExternalReference("tone.wav", "file:///media/tone.wav", nil, nil), &sourceRange, nil, nil, nil, "", nil))
+	timeline.Tracks().AppendChild(audioTrack)
+	audio := encode(timeline)
+	if audio.NumOutputChannels != 2 || audio.Outputs == nil || len(audio.Outputs.Group) != 2 {
+		t.Fatalf("Expected default stereo routing, got %d channels and %+v", audio.NumOutputChannels, audio.Outputs)
+	}
+	for i, group := range audio.Outputs.Group {
+		if group.Index != i+1 || group.NumChannels != 1 || len(group.Channel) != 1 || group.Channel[0].Index != i+1 {
+			t.Errorf("Output %d: expected mono output on channel %d, got %+v", i+1, i+1, group)
+		}
+	}
+}
+
+func TestTrackOutputChannelIndexRoundTrip(t *testing.T) {
+	// Two stereo pairs on four output channels, one track on each
+	data, err := os.ReadFile("testdata/audio_outputs.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	var original XMEML
+	if err := xml.Unmarshal(data, &original); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	groups, ok := timeline.Metadata()["fcp7xml_audio_outputs"].([]gotio.AnyDictionary)
+	if !ok || len(groups) != 2 || groups[1]["numchannels"] != int64(2) {
+		t.Errorf("Expected 2 stereo outputs, got %v", timeline.Metadata()["fcp7xml_audio_outputs"])
+	}
+	for i, track := range timeline.AudioTracks() {
+		if index := track.Metadata()["fcp7xml_output_channel_index"]; index != int64(i+1) {
+			t.Errorf("Audio %d: expected fcp7xml_output_channel_index %d, got %v", i+1, i+1, index)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	audio := encoded.Sequence[0].Media.Audio
+	if audio.NumOutputChannels != 4 || !reflect.DeepEqual(audio.Outputs, original.Sequence[0].Media.Audio.Outputs) {
+		t.Errorf("Expected the 4-channel routing to be written back, got %d channels and %+v", audio.NumOutputChannels, audio.Outputs)
+	}
+	if len(audio.Track) != 4 {
+		t.Fatalf("Expected 4 audio tracks, got %d", len(audio.Track))
+	}
+	for i, track := range audio.Track {
+		if track.OutputChannelIndex == nil || *track.OutputChannelIndex != i+1 {
+			t.Errorf("Audio %d: expected outputchannelindex %d, got %v", i+1, i+1, track.OutputChannelIndex)
+		}
+	}
+}
+
+func TestMixedRateRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("testdata/mixed_rate.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+
+	// Each clip keeps its own rate, with in/out in its frames and start/end
+	// in the sequence's
+	tests := []struct {
+		name       string
+		timebase   int
+		start, end int64
+		in, out    int64
+	}{
+		{"Interview", 30, 0, 60, 0, 60},
+		{"Film A", 24, 90, 150, 0, 48},
+		{"Film B", 24, 150, 213, 100, 150},
+	}
+	seq := encoded.Sequence[0]
+	if seq.Rate.Timebase != 30 || !seq.Rate.NTSC {
+		t.Errorf("Expected a 29.97 sequence, got %s", formatRate(&seq.Rate))
+	}
+	items := seq.Media.Video.Track[0].ClipItem
+	if len(items) != len(tests) {
+		t.Fatalf("Expected %d clipitems, got %d", len(tests), len(items))
+	}
+	for i, tt := range tests {
+		item := items[i]
+		if item.Name != tt.name || item.Rate.Timebase != tt.timebase || !item.Rate.NTSC {
+			t.Errorf("Expected %s at timebase %d, got %s at %s", tt.name, tt.timebase, item.Name, formatRate(&item.Rate))
+		}
+		if item.Start != tt.start || item.End != tt.end || item.In != tt.in || item.Out != tt.out {
+			t.Errorf("%s: Expected start/end %d-%d and in/out %d-%d, got %d-%d and %d-%d",
+				tt.name, tt.start, tt.end, tt.in, tt.out, item.Start, item.End, item.In, item.Out)
+		}
+		if item.File == nil || item.File.Rate.Timebase != tt.timebase {
+			t.Errorf("%s: Expected its file at timebase %d, got %+v", tt.name, tt.timebase, item.File)
+		}
+	}
+
+	redecoded, err := NewDecoder(bytes.NewReader(buf.Bytes())).Decode()
+	if err != nil {
+		t.Fatalf("Decode() of encoded XML failed: %v", err)
+	}
+	original := timeline.VideoTracks()[0].Children()
+	children := redecoded.VideoTracks()[0].Children()
+	if len(children) != len(original) {
+		t.Fatalf("Expected %d items after the round trip, got %d", len(original), len(children))
+	}
+	for i, child := range original {
+		clip, ok := child.(*gotio.Clip)
+		if !ok {
+			continue
+		}
+		want, got := clip.SourceRange(), children[i].(*gotio.Clip).SourceRange()
+		if *got != *want {
+			t.Errorf("%s: Expected source range %v, got %v", clip.Name(), *want, *got)
+		}
+		if got.Duration().Rate() != got.StartTime().Rate() {
+			t.Errorf("%s: Expected the source range in one rate, got %v", clip.Name(), *got)
+		}
+	}
+}
+
+// jsonMetadata replaces the metadata of every object in timeline with what
+// it reads back as from OTIO JSON: float64 numbers, []any lists and
+// map[string]any dictionaries.
+func jsonMetadata(t *testing.T, timeline *gotio.Timeline) {
+	t.Helper()
+	convert := func(md gotio.AnyDictionary) {
+		data, err := json.Marshal(md)
+		if err != nil {
+			t.Fatalf("Failed to marshal metadata: %v", err)
+		}
+		var decoded map[string]any
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Failed to unmarshal metadata: %v", err)
+		}
+		clear(md)
+		maps.Copy(md, decoded)
+	}
+	var walk func(item gotio.Composable)
+	walk = func(item gotio.Composable) {
+		convert(item.Metadata())
+		if item, ok := item.(interface{ Markers() []*gotio.Marker }); ok {
+			for _, marker := range item.Markers() {
+				convert(marker.Metadata())
+			}
+		}
+		if item, ok := item.(interface{ Effects() []gotio.Effect }); ok {
+			for _, effect := range item.Effects() {
+				convert(effect.Metadata())
+			}
+		}
+		switch item := item.(type) {
+		case *gotio.Clip:
+			for _, ref := range item.MediaReferences() {
+				convert(ref.Metadata())
+				if generator, ok := ref.(*gotio.GeneratorReference); ok {
+					convert(generator.Parameters())
+				}
+			}
+		case *gotio.Track:
+			for _, child := range item.Children() {
+				walk(child)
+			}
+		case *gotio.Stack:
+			for _, child := range item.Children() {
+				walk(child)
+			}
+		}
+	}
+	convert(timeline.Metadata())
+	walk(timeline.Tracks())
+}
+
+func TestJSONMetadataRoundTrip(t *testing.T) {
+	files, err := os.ReadDir("testdata")
+	if err != nil {
+		t.Fatalf("Failed to list testdata: %v", err)
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".xml") {
+			continue
+		}
+		data, err := os.ReadFile("testdata/" + file.Name())
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file.Name(), err)
+		}
+		expected, err := NewDecoder(bytes.NewReader(data)).Decode()
+		if err != nil {
+			continue
+		}
+		timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+		if err != nil {
+			t.Fatalf("%s: Decode failed: %v", file.Name(), err)
+		}
+		jsonMetadata(t, timeline)
+
+		var expectedXML, jsonXML bytes.Buffer
+		if err := NewEncoder(&expectedXML).Encode(expected); err != nil {
+			t.Fatalf("%s: Encode failed: %v", file.Name(), err)
+		}
+		if err := NewEncoder(&jsonXML).Encode(timeline); err != nil {
+			t.Fatalf("%s: Encode failed: %v", file.Name(), err)
+		}
+		if jsonXML.String() != expectedXML.String() {
+			t.Errorf("%s: Expected metadata read from JSON to encode the same, got\n%s\nwant\n%s",
+				file.Name(), jsonXML.String(), expectedXML.String())
+		}
+	}
+}
+
+func TestTrackNameRoundTrip(t *testing.T) {
+	timeline := gotio.NewTimeline("Named Tracks", nil, nil)
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(24, 24))
+	for _, tt := range []struct{ name, kind string }{
+		{"Video 1", gotio.TrackKindVideo},
+		{"Dialogue", gotio.TrackKindAudio},
+		{"Music", gotio.TrackKindAudio},
+	} {
+		track := gotio.NewTrack(tt.name, nil, tt.kind, nil, nil)
+		track.AppendChild(gotio.NewClip(tt.name, gotio.NewExternalReference("", "file:///media/"+tt.name+".mov", nil, nil), &sourceRange, nil, nil, nil, "", nil))
+		timeline.Tracks().AppendChild(track)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	media := encoded.Sequence[0].Media
+	if name := media.Video.Track[0].Name; name != "" {
+		t.Errorf("Expected no name for a track with the default name, got '%s'", name)
+	}
+	for i, expected := range []string{"Dialogue", "Music"} {
+		if name := media.Audio.Track[i].Name; name != expected {
+			t.Errorf("Audio track %d: expected name '%s', got '%s'", i+1, expected, name)
+		}
+	}
+
+	decoded, err := NewDecoder(bytes.NewReader(buf.Bytes())).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	var names []string
+	for _, track := range decoded.Tracks().Children() {
+		names = append(names, track.(*gotio.Track).Name())
+	}
+	if expected := []string{"Video 1", "Dialogue", "Music"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected track names %v, got %v", expected, names)
+	}
+}
+
+func TestLoggingInfoRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("testdata/logginginfo.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	var original XMEML
+	if err := xml.Unmarshal(data, &original); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	clip := timeline.Tracks().Children()[0].(*gotio.Track).Children()[0].(*gotio.Clip)
+	logging, ok := clip.Metadata()["fcp7xml_logginginfo"].(gotio.AnyDictionary)
+	if !ok {
+		t.Fatal("Expected fcp7xml_logginginfo metadata on the clip")
+	}
+	if logging["scene"] != "12A" || logging["shottake"] != "3" || logging["good"] != true {
+		t.Errorf("Expected scene 12A, take 3, good, got %v", logging)
+	}
+	if _, ok := clip.MediaReference().Metadata()["fcp7xml_logginginfo"].(gotio.AnyDictionary); !ok {
+		t.Error("Expected fcp7xml_logginginfo metadata on the media reference")
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	originalItems := original.Sequence[0].Media.Video.Track[0].ClipItem
+	encodedItems := encoded.Sequence[0].Media.Video.Track[0].ClipItem
+	for i := range originalItems {
+		if !reflect.DeepEqual(encodedItems[i].LoggingInfo, originalItems[i].LoggingInfo) {
+			t.Errorf("Clipitem %d: Expected logginginfo %+v, got %+v", i+1, originalItems[i].LoggingInfo, encodedItems[i].LoggingInfo)
+		}
+		if !reflect.DeepEqual(encodedItems[i].File.LoggingInfo, originalItems[i].File.LoggingInfo) {
+			t.Errorf("Clipitem %d: Expected file logginginfo %+v, got %+v", i+1, originalItems[i].File.LoggingInfo, encodedItems[i].File.LoggingInfo)
+		}
+	}
+	if strings.Count(buf.String(), "<logginginfo>") != 2 {
+		t.Errorf("Expected 2 logginginfo elements, got %d", strings.Count(buf.String(), "<logginginfo>"))
+	}
+	if !strings.Contains(buf.String(), "<lognote></lognote>") {
+		t.Error("Expected the empty lognote to be kept")
+	}
+}
+
+func TestMulticlipRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("testdata/multiclip.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	// The active angle is the clip's media; the cutaway refers to the file
+	// of the other angle
+	clips := timeline.Tracks().Children()[0].(*gotio.Track).Children()
+	if len(clips) != 2 {
+		t.Fatalf("Expected 2 clips, got %d", len(clips))
+	}
+	for i, expected := range []string{"file:///media/cam_b.mov", "file:///media/cam_a.mov"} {
+		ref, ok := clips[i].(*gotio.Clip).MediaReference().(*gotio.ExternalReference)
+		if !ok || ref.TargetURL() != expected {
+			t.Errorf("Clip %d: Expected media '%s', got %v", i+1, expected, clips[i].(*gotio.Clip).MediaReference())
+		}
+	}
+	multiclip, ok := clips[0].(*gotio.Clip).Metadata()["fcp7xml_multiclip"].(gotio.AnyDictionary)
+	if !ok {
+		t.Fatal("Expected fcp7xml_multiclip metadata")
+	}
+	if angles, _ := multiclip["angles"].([]gotio.AnyDictionary); len(angles) != 2 || angles[0]["name"] != "Cam A" || angles[1]["angle"] != int64(2) {
+		t.Errorf("Expected angles Cam A and Cam B, got %v", multiclip["angles"])
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	items := encoded.Sequence[0].Media.Video.Track[0].ClipItem
+	m := items[0].Multiclip
+	if m == nil {
+		t.Fatal("Expected the clipitem to be written as a multiclip")
+	}
+	if items[0].File != nil {
+		t.Errorf("Expected the multiclip's file only in its angles, got %+v", items[0].File)
+	}
+	if m.ID != "multiclip-1" || m.Name != "Interview Multicam" || m.ActiveAngle != 2 || len(m.MCSource) != 2 {
+		t.Fatalf("Expected multiclip-1 with 2 angles and angle 2 active, got %+v", m)
+	}
+
+	// Each file is written in full once, and referred to by id afterwards
+	files := make(map[string]*File)
+	for _, file := range []*File{m.MCSource[0].File, m.MCSource[1].File, items[1].File} {
+		if file != nil && !file.isReference() {
+			files[file.ID] = file
+		}
+	}
+	for i, expected := range []struct {
+		name, path string
+		angle      int
+		file       *File
+	}{
+		{"Cam A", "file:///media/cam_a.mov", 1, m.MCSource[0].File},
+		{"Cam B", "file:///media/cam_b.mov", 2, m.MCSource[1].File},
+		{"", "file:///media/cam_a.mov", 0, items[1].File},
+	} {
+		if i < 2 && (m.MCSource[i].Name != expected.name || m.MCSource[i].Angle != expected.angle) {
+			t.Errorf("Angle %d: Expected %s at %d, got %s at %d", i+1, expected.name, expected.angle, m.MCSource[i].Name, m.MCSource[i].Angle)
+		}
+		if expected.file == nil || files[expected.file.ID] == nil || files[expected.file.ID].PathURL != expected.path {
+			t.Errorf("File %d: Expected %s, got %+v", i+1, expected.path, expected.file)
+		}
+	}
+}
+
+func TestSequenceDurationRoundTrip(t *testing.T) {
+	// A slug followed by empty space up to the sequence's duration
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Slug Only</name>
+    <duration>120</duration>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <generatoritem>
+            <name>Slug</name>
+            <duration>96</duration>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>96</end>
+            <in>0</in>
+            <out>96</out>
+            <effect>
+              <name>Slug</name>
+              <effectid>slug</effectid>
+              <effecttype>generator</effecttype>
+              <mediatype>video</mediatype>
+            </effect>
+          </generatoritem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	decoder := NewDecoder(strings.NewReader(xmlData))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if duration, _ := timeline.Metadata()["fcp7xml_duration"].(int64); duration != 120 {
+		t.Errorf("Expected fcp7xml_duration 120, got %v", timeline.Metadata()["fcp7xml_duration"])
+	}
+	if warnings := decoder.Warnings(); len(warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", warnings)
+	}
+
+	encodeDuration := func(timeline *gotio.Timeline) int64 {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(timeline); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		var encoded XMEML
+		if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+			t.Fatalf("Failed to parse encoded XML: %v", err)
+		}
+		return encoded.Sequence[0].Duration
+	}
+	if duration := encodeDuration(timeline); duration != 120 {
+		t.Errorf("Expected the slug sequence to keep duration 120, got %d", duration)
+	}
+
+	// Only gaps, and no tracks at all
+	gaps := gotio.NewTimeline("Gaps", nil, nil)
+	track := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	track.AppendChild(gotio.NewGapWithDuration(opentime.NewRationalTime(48, 24)))
+	gaps.Tracks().AppendChild(track)
+	if duration := encodeDuration(gaps); duration != 48 {
+		t.Errorf("Expected a gap-only sequence to last 48 frames, got %d", duration)
+	}
+	empty := gotio.NewTimeline("Empty", nil, gotio.AnyDictionary{"fcp7xml_duration": int64(72)})
+	if duration := encodeDuration(empty); duration != 72 {
+		t.Errorf("Expected an empty sequence to keep duration 72, got %d", duration)
+	}
+
+	// Content running past the declared duration is reported
+	short := strings.Replace(xmlData, "<duration>120</duration>", "<duration>48</duration>", 1)
+	decoder = NewDecoder(strings.NewReader(short))
+	if _, err := decoder.Decode(); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if warnings := decoder.Warnings(); len(warnings) != 1 || warnings[0].Category != WarningTimingInconsistency {
+		t.Errorf("Expected a timing inconsistency warning, got %v", warnings)
+	}
+}
+
+func TestPythonAdapterNamespace(t *testing.T) {
+	data, err := os.ReadFile("testdata/python_adapter.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	otio, err := os.ReadFile("testdata/python_adapter.otio")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	var fixture map[string]any
+	if err := json.Unmarshal(otio, &fixture); err != nil {
+		t.Fatalf("Failed to parse OTIO JSON: %v", err)
+	}
+	// namespace returns the fcp_xml metadata of an object of the fixture
+	namespace := func(object any) map[string]any {
+		metadata, _ := object.(map[string]any)["metadata"].(map[string]any)
+		dict, _ := metadata["fcp_xml"].(map[string]any)
+		return dict
+	}
+	fixtureTrack := fixture["tracks"].(map[string]any)["children"].([]any)[0].(map[string]any)
+	fixtureClip := fixtureTrack["children"].([]any)[0].(map[string]any)
+	fixtureRef := fixtureClip["media_references"].(map[string]any)["DEFAULT_MEDIA"]
+	fixtureMarker := fixtureClip["markers"].([]any)[0]
+
+	timeline, err := NewDecoderWithOptions(bytes.NewReader(data), DecodeOptions{Namespace: NamespacePythonAdapter}).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	track := timeline.VideoTracks()[0]
+	clip := track.Children()[0].(*gotio.Clip)
+	for _, test := range []struct {
+		name     string
+		metadata gotio.AnyDictionary
+		expected map[string]any
+	}{
+		{"timeline", timeline.Metadata(), namespace(fixture)},
+		{"track", track.Metadata(), namespace(fixtureTrack)},
+		{"clip", clip.Metadata(), namespace(fixtureClip)},
+		{"media reference", clip.MediaReference().Metadata(), namespace(fixtureRef)},
+		{"marker", clip.Markers()[0].Metadata(), namespace(fixtureMarker)},
+	} {
+		// Compare through JSON, as the metadata would be serialized
+		encoded, err := json.Marshal(test.metadata["fcp_xml"])
+		if err != nil {
+			t.Fatalf("Failed to serialize %s metadata: %v", test.name, err)
+		}
+		var got map[string]any
+		if err := json.Unmarshal(encoded, &got); err != nil {
+			t.Fatalf("Failed to parse %s metadata: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Expected %s fcp_xml metadata %v, got %v", test.name, test.expected, got)
+		}
+	}
+	if _, ok := timeline.Metadata()["fcp7xml_unknown"]; !ok {
+		t.Error("Expected the fcp7xml_* keys to be written too")
+	}
+
+	// Both layouts hold the uuid; it is written once
+	var buf bytes.Buffer
+	if err := NewEncoderWithOptions(&buf, EncodeOptions{Namespace: NamespacePythonAdapter}).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if count := strings.Count(buf.String(), "<uuid>"); count != 1 {
+		t.Errorf("Expected 1 uuid, got %d", count)
+	}
+
+	// A timeline only carrying the Python adapter's metadata, as read from
+	// its OTIO JSON, keeps the elements it holds
+	adapterTimeline := gotio.NewTimeline("Adapter Cut", nil, gotio.AnyDictionary{"fcp_xml": namespace(fixture)})
+	adapterTrack := gotio.NewTrack("", nil, gotio.TrackKindVideo, gotio.AnyDictionary{"fcp_xml": namespace(fixtureTrack)}, nil)
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(24, 24), opentime.NewRationalTime(48, 24))
+	adapterTrack.AppendChild(gotio.NewClip(
+		"Interview",
+		gotio.NewExternalReference("interview.mov", "file:///media/interview.mov", nil, gotio.AnyDictionary{"fcp_xml": namespace(fixtureRef)}),
+		&sourceRange,
+		gotio.AnyDictionary{"fcp_xml": namespace(fixtureClip)},
+		nil, nil, "", nil,
+	))
+	adapterTimeline.Tracks().AppendChild(adapterTrack)
+	buf.Reset()
+	if err := NewEncoderWithOptions(&buf, EncodeOptions{Namespace: NamespacePythonAdapter}).Encode(adapterTimeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	sequence := encoded.Sequence[0]
+	if !strings.Contains(buf.String(), "<uuid>7A2C4E1F-0B3D-4C55-9E61-2F8A7D90B1C3</uuid>") {
+		t.Error("Expected the sequence uuid to be written")
+	}
+	item := sequence.Media.Video.Track[0].ClipItem[0]
+	if item.Labels == nil || item.Labels.Label2 != "Iris" {
+		t.Errorf("Expected label2 Iris, got %+v", item.Labels)
+	}
+	if locked := sequence.Media.Video.Track[0].Locked; locked == nil || bool(*locked) {
+		t.Errorf("Expected the track to be written unlocked, got %v", locked)
+	}
+
+	// Without the option the fcp_xml metadata is ignored
+	buf.Reset()
+	if err := NewEncoder(&buf).Encode(adapterTimeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "<uuid>") {
+		t.Error("Expected no uuid without NamespacePythonAdapter")
+	}
+}
+
+func TestOpacityRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Fades</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip-1">
+            <name>Fade Up</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>48</end>
+            <in>0</in>
+            <out>48</out>
+            <file id="file-1">
+              <name>fade.mov</name>
+              <pathurl>file:///media/fade.mov</pathurl>
+            </file>
+            <filter>
+              <effect>
+                <name>Opacity</name>
+                <effectid>opacity</effectid>
+                <effectcategory>motion</effectcategory>
+                <effecttype>motion</effecttype>
+                <mediatype>video</mediatype>
+                <parameter>
+                  <parameterid>opacity</parameterid>
+                  <name>Opacity</name>
+                  <valuemin>0</valuemin>
+                  <valuemax>100</valuemax>
+                  <keyframe>
+                    <when>0</when>
+                    <value>0</value>
+                  </keyframe>
+                  <keyframe>
+                    <when>24</when>
+                    <value>100</value>
+                  </keyframe>
+                </parameter>
+              </effect>
+            </filter>
+          </clipitem>
+          <clipitem id="clip-2">
+            <name>Half</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>48</start>
+            <end>96</end>
+            <in>0</in>
+            <out>48</out>
+            <file id="file-2">
+              <name>half.mov</name>
+              <pathurl>file:///media/half.mov</pathurl>
+            </file>
+            <filter>
+              <effect>
+                <name>Opacity</name>
+                <effectid>opacity</effectid>
+                <effectcategory>motion</effectcategory>
+                <effecttype>motion</effecttype>
+                <mediatype>video</mediatype>
+                <parameter>
+                  <parameterid>opacity</parameterid>
+                  <name>Opacity</name>
+                  <valuemin>0</valuemin>
+                  <valuemax>100</valuemax>
+                  <value>37</value>
+                </parameter>
+              </effect>
+            </filter>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	var original XMEML
+	if err := xml.Unmarshal([]byte(xmlData), &original); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+	originalItems := original.Sequence[0].Media.Video.Track[0].ClipItem
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	children := timeline.VideoTracks()[0].Children()
+	fade := children[0].(*gotio.Clip)
+	half := children[1].(*gotio.Clip)
+
+	keyframes, ok := fade.Metadata()["fcp7xml_opacity_keyframes"].([]gotio.AnyDictionary)
+	if !ok || len(keyframes) != 2 {
+		t.Fatalf("Expected 2 opacity keyframes, got %v", fade.Metadata()["fcp7xml_opacity_keyframes"])
+	}
+	if keyframes[0]["when"] != int64(0) || keyframes[0]["value"] != 0.0 ||
+		keyframes[1]["when"] != int64(24) || keyframes[1]["value"] != 1.0 {
+		t.Errorf("Expected a fade from 0 at frame 0 to 1 at frame 24, got %v", keyframes)
+	}
+	if _, ok := fade.Metadata()["fcp7xml_opacity"]; ok {
+		t.Error("Expected no constant opacity on a keyframed clip")
+	}
+	if opacity := half.Metadata()["fcp7xml_opacity"]; opacity != 0.37 {
+		t.Errorf("Expected opacity 0.37, got %v", opacity)
+	}
+
+	encodeItems := func(timeline *gotio.Timeline) []ClipItem {
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(timeline); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		var encoded XMEML
+		if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+			t.Fatalf("Failed to parse encoded XML: %v", err)
+		}
+		return encoded.Sequence[0].Media.Video.Track[0].ClipItem
+	}
+
+	// Unedited, the filters are re-emitted as they were read
+	items := encodeItems(timeline)
+	for i, item := range items {
+		if len(item.Filter) != 1 || !reflect.DeepEqual(item.Filter[0].Effect, originalItems[i].Filter[0].Effect) {
+			t.Errorf("%s: Expected the opacity filter unchanged, got %+v", item.Name, item.Filter)
+		}
+	}
+
+	// Edits to the metadata are written to the filter
+	keyframes[1]["value"] = 0.8
+	half.Metadata()["fcp7xml_opacity"] = 0.5
+	items = encodeItems(timeline)
+	if p := findParameter(items[0].Filter[0].Effect, "opacity"); p == nil || len(p.Keyframe) != 2 || p.Keyframe[1].Value != "80" {
+		t.Errorf("Expected the fade to end at 80, got %+v", p)
+	}
+	if p := findParameter(items[1].Filter[0].Effect, "opacity"); p == nil || p.Value != "50" {
+		t.Errorf("Expected opacity 50, got %+v", p)
+	}
+
+	// A clip without a filter gets one
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(24, 24))
+	clip := gotio.NewClip("Faded", gotio.NewExternalReference("faded.mov", "file:///media/faded.mov", nil, nil), &sourceRange,
+		gotio.AnyDictionary{"fcp7xml_opacity": 0.25}, nil, nil, "", nil)
+	track := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	track.AppendChild(clip)
+	fresh := gotio.NewTimeline("Fresh", nil, nil)
+	fresh.Tracks().AppendChild(track)
+	items = encodeItems(fresh)
+	if len(items[0].Filter) != 1 {
+		t.Fatalf("Expected one filter, got %d", len(items[0].Filter))
+	}
+	if effect := items[0].Filter[0].Effect; effect.EffectID != "opacity" || findParameter(effect, "opacity").Value != "25" {
+		t.Errorf("Expected an opacity filter at 25, got %+v", effect)
+	}
+}
+
+func TestCropRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Crops</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip-1">
+            <name>Letterboxed</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>48</end>
+            <in>0</in>
+            <out>48</out>
+            <file id="file-1">
+              <name>wide.mov</name>
+              <pathurl>file:///media/wide.mov</pathurl>
+            </file>
+            <filter>
+              <enabled>TRUE</enabled>
+              <effect>
+                <name>Crop</name>
+                <effectid>crop</effectid>
+                <effectcategory>motion</effectcategory>
+                <effecttype>motion</effecttype>
+                <mediatype>video</mediatype>
+                <parameter>
+                  <parameterid>left</parameterid>
+                  <name>left</name>
+                  <valuemin>0</valuemin>
+                  <valuemax>100</valuemax>
+                  <value>10</value>
+                </parameter>
+                <parameter>
+                  <parameterid>right</parameterid>
+                  <name>right</name>
+                  <valuemin>0</valuemin>
+                  <valuemax>100</valuemax>
+                  <value>0</value>
+                </parameter>
+                <parameter>
+                  <parameterid>top</parameterid>
+                  <name>top</name>
+                  <valuemin>0</valuemin>
+                  <valuemax>100</valuemax>
+                  <keyframe>
+                    <when>0</when>
+                    <value>0</value>
+                  </keyframe>
+                  <keyframe>
+                    <when>24</when>
+                    <value>12.5</value>
+                    <interpolation>
+                      <name>FCPCurve</name>
+                    </interpolation>
+                  </keyframe>
+                </parameter>
+                <parameter>
+                  <parameterid>bottom</parameterid>
+                  <name>bottom</name>
+                  <valuemin>0</valuemin>
+                  <valuemax>100</valuemax>
+                  <value>12.5</value>
+                </parameter>
+                <parameter>
+                  <parameterid>edgefeather</parameterid>
+                  <name>edge feather</name>
+                  <valuemin>0</valuemin>
+                  <valuemax>100</valuemax>
+                  <value>5</value>
+                </parameter>
+              </effect>
+            </filter>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	var original XMEML
+	if err := xml.Unmarshal([]byte(xmlData), &original); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+	originalEffect := original.Sequence[0].Media.Video.Track[0].ClipItem[0].Filter[0].Effect
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+
+	crop, ok := clip.Metadata()["fcp7xml_crop"].(gotio.AnyDictionary)
+	if !ok {
+		t.Fatal("Expected fcp7xml_crop metadata")
+	}
+	if crop["left"] != 10.0 || crop["right"] != 0.0 || crop["bottom"] != 12.5 || crop["edgefeather"] != 5.0 {
+		t.Errorf("Expected left 10, right 0, bottom 12.5 and edge feather 5, got %v", crop)
+	}
+	top, ok := crop["top"].([]gotio.AnyDictionary)
+	if !ok || len(top) != 2 {
+		t.Fatalf("Expected 2 top keyframes, got %v", crop["top"])
+	}
+	if top[1]["when"] != int64(24) || top[1]["value"] != 12.5 || top[1]["interpolation"] != "FCPCurve" {
+		t.Errorf("Expected a keyframe of 12.5 at frame 24 with FCPCurve interpolation, got %v", top[1])
+	}
+
+	encodeFilters := func(timeline *gotio.Timeline) []Filter {
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(timeline); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		var encoded XMEML
+		if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+			t.Fatalf("Failed to parse encoded XML: %v", err)
+		}
+		return encoded.Sequence[0].Media.Video.Track[0].ClipItem[0].Filter
+	}
+
+	// Unedited, the filter is re-emitted as it was read
+	filters := encodeFilters(timeline)
+	if len(filters) != 1 || !reflect.DeepEqual(filters[0].Effect, originalEffect) {
+		t.Errorf("Expected the crop filter unchanged, got %+v", filters)
+	}
+
+	// Edits to the metadata are written to the filter
+	crop["left"] = 15.0
+	top[1]["value"] = 20.0
+	effect := encodeFilters(timeline)[0].Effect
+	if p := findParameter(effect, "left"); p == nil || p.Value != "15" {
+		t.Errorf("Expected left 15, got %+v", p)
+	}
+	if p := findParameter(effect, "top"); p == nil || len(p.Keyframe) != 2 || p.Keyframe[1].Value != "20" || p.Keyframe[1].Interpolation != "FCPCurve" {
+		t.Errorf("Expected the top crop to end at 20 with FCPCurve interpolation, got %+v", p)
+	}
+
+	// A clip without a filter gets one
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(24, 24))
+	cropped := gotio.NewClip("Cropped", gotio.NewExternalReference("cropped.mov", "file:///media/cropped.mov", nil, nil), &sourceRange,
+		gotio.AnyDictionary{"fcp7xml_crop": gotio.AnyDictionary{"right": 25.0}}, nil, nil, "", nil)
+	track := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	track.AppendChild(cropped)
+	fresh := gotio.NewTimeline("Fresh", nil, nil)
+	fresh.Tracks().AppendChild(track)
+	filters = encodeFilters(fresh)
+	if len(filters) != 1 || filters[0].Effect.EffectID != "crop" {
+		t.Fatalf("Expected one crop filter, got %+v", filters)
+	}
+	if p := findParameter(filters[0].Effect, "right"); p == nil || p.Value != "25" {
+		t.Errorf("Expected right 25, got %+v", p)
+	}
+}
+
+func TestPProTicksRoundTrip(t *testing.T) {
+	// At 24 fps a frame is 10584000000 ticks; the clip starts half a frame
+	// after its in point
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="4">
+  <sequence id="sequence-1">
+    <name>Premiere Audio</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <audio>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>dialog.wav</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>48</end>
+            <in>10</in>
+            <out>58</out>
+            <pproTicksIn>111132000000</pproTicksIn>
+            <pproTicksOut>619164000000</pproTicksOut>
+            <file id="file-1">
+              <name>dialog.wav</name>
+              <pathurl>file:///media/dialog.wav</pathurl>
+              <duration>480</duration>
+              <media>
+                <audio>
+                  <channelcount>1</channelcount>
+                </audio>
+              </media>
+            </file>
+          </clipitem>
+        </track>
+      </audio>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	clip := timeline.AudioTracks()[0].Children()[0].(*gotio.Clip)
+	sourceRange := clip.SourceRange()
+	if start := sourceRange.StartTime().Value(); start != 10.5 {
+		t.Errorf("Expected a source start of 10.5 frames, got %v", start)
+	}
+	if duration := sourceRange.Duration().Value(); duration != 48 {
+		t.Errorf("Expected a duration of 48 frames, got %v", duration)
+	}
+	if ticks := clip.Metadata()["fcp7xml_ppro_ticks_in"]; ticks != int64(111132000000) {
+		t.Errorf("Expected fcp7xml_ppro_ticks_in 111132000000, got %v", ticks)
+	}
+
+	encodeItem := func() ClipItem {
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(timeline); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		var encoded XMEML
+		if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+			t.Fatalf("Failed to parse encoded XML: %v", err)
+		}
+		return encoded.Sequence[0].Media.Audio.Track[0].ClipItem[0]
+	}
+
+	item := encodeItem()
+	if item.In != 10 || item.Out != 58 {
+		t.Errorf("Expected in=10 out=58, got in=%d out=%d", item.In, item.Out)
+	}
+	if item.PProTicksIn == nil || *item.PProTicksIn != 111132000000 || item.PProTicksOut == nil || *item.PProTicksOut != 619164000000 {
+		t.Errorf("Expected the tick values to be written back, got %v and %v", item.PProTicksIn, item.PProTicksOut)
+	}
+
+	// A trimmed clip no longer matches its ticks
+	trimmed := opentime.NewTimeRange(opentime.NewRationalTime(20, 24), opentime.NewRationalTime(24, 24))
+	clip.SetSourceRange(&trimmed)
+	item = encodeItem()
+	if item.PProTicksIn != nil || item.PProTicksOut != nil {
+		t.Errorf("Expected no tick values for a trimmed clip, got %v and %v", item.PProTicksIn, item.PProTicksOut)
+	}
+}
+
+func TestPremiereAttributesRoundTrip(t *testing.T) {
+	f, err := os.Open("testdata/premiere_example.xml")
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer f.Close()
+	timeline, err := NewDecoder(f).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	attributes := func(metadata gotio.AnyDictionary) gotio.AnyDictionary {
+		attrs, _ := metadata["fcp7xml_attributes"].(gotio.AnyDictionary)
+		return attrs
+	}
+	if attrs := attributes(timeline.Metadata()); attrs["MZ.Sequence.PreviewFrameSizeWidth"] != "1280" || attrs["explodedTracks"] != "true" {
+		t.Errorf("Expected the sequence's Premiere attributes, got %v", attrs)
+	}
+	videoTrack := timeline.VideoTracks()[0]
+	if attrs := attributes(videoTrack.Metadata()); attrs["MZ.TrackTargeted"] != "1" {
+		t.Errorf("Expected MZ.TrackTargeted 1 on the first video track, got %v", attrs)
+	}
+	audioTrack := timeline.AudioTracks()[0]
+	if attrs := attributes(audioTrack.Metadata()); attrs["premiereTrackType"] != "Stereo" {
+		t.Errorf("Expected premiereTrackType Stereo on the first audio track, got %v", attrs)
+	}
+	var audioClip *gotio.Clip
+	for _, child := range audioTrack.Children() {
+		if clip, ok := child.(*gotio.Clip); ok {
+			audioClip = clip
+			break
+		}
+	}
+	if audioClip == nil {
+		t.Fatal("Expected a clip on the first audio track")
+	}
+	if attrs := attributes(audioClip.Metadata()); attrs["premiereChannelType"] != "stereo" {
+		t.Errorf("Expected premiereChannelType stereo on the audio clip, got %v", attrs)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	attr := func(attrs []xml.Attr, name string) string {
+		for _, a := range attrs {
+			if a.Name.Local == name {
+				return a.Value
+			}
+		}
+		return ""
+	}
+	seq := encoded.Sequence[0]
+	if got := attr(seq.Attrs, "MZ.Sequence.PreviewFrameSizeWidth"); got != "1280" {
+		t.Errorf("Expected MZ.Sequence.PreviewFrameSizeWidth 1280 to be written back, got %q", got)
+	}
+	if got := attr(seq.Media.Video.Track[0].Attrs, "MZ.TrackTargeted"); got != "1" {
+		t.Errorf("Expected MZ.TrackTargeted 1 to be written back, got %q", got)
+	}
+	track := seq.Media.Audio.Track[0]
+	if got := attr(track.Attrs, "premiereTrackType"); got != "Stereo" {
+		t.Errorf("Expected premiereTrackType Stereo to be written back, got %q", got)
+	}
+	if len(track.ClipItem) == 0 || attr(track.ClipItem[0].Attrs, "premiereChannelType") != "stereo" {
+		t.Error("Expected premiereChannelType stereo to be written back on the audio clipitem")
+	}
+}
+
+func TestStillFrameRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence id="sequence-1">
+    <name>Freeze</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>Hold</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>48</end>
+            <in>10</in>
+            <out>58</out>
+            <stillframe>TRUE</stillframe>
+            <stillframeoffset>5</stillframeoffset>
+            <file id="file-1">
+              <name>shot.mov</name>
+              <pathurl>file:///media/shot.mov</pathurl>
+              <duration>240</duration>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	sourceRange := clip.SourceRange()
+	if start := sourceRange.StartTime().Value(); start != 15 {
+		t.Errorf("Expected the held frame 15 as the source start, got %v", start)
+	}
+	if duration := sourceRange.Duration().Value(); duration != 48 {
+		t.Errorf("Expected a duration of 48 frames, got %v", duration)
+	}
+	effects := clip.Effects()
+	if len(effects) != 1 {
+		t.Fatalf("Expected 1 effect, got %d", len(effects))
+	}
+	if _, ok := effects[0].(*gotio.FreezeFrame); !ok {
+		t.Errorf("Expected a FreezeFrame effect, got %T", effects[0])
+	}
+
+	encodeItem := func(timeline *gotio.Timeline) ClipItem {
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(timeline); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		var encoded XMEML
+		if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+			t.Fatalf("Failed to parse encoded XML: %v", err)
+		}
+		return encoded.Sequence[0].Media.Video.Track[0].ClipItem[0]
+	}
+
+	item := encodeItem(timeline)
+	if item.In != 10 || item.Out != 58 {
+		t.Errorf("Expected in=10 out=58, got in=%d out=%d", item.In, item.Out)
+	}
+	if item.StillFrame == nil || !*item.StillFrame || item.StillFrameOffset == nil || *item.StillFrameOffset != 5 {
+		t.Errorf("Expected stillframe TRUE with offset 5, got %v and %v", item.StillFrame, item.StillFrameOffset)
+	}
+
+	// A freeze frame made in OTIO holds the frame its source range starts at
+	held := opentime.NewTimeRange(opentime.NewRationalTime(30, 24), opentime.NewRationalTime(24, 24))
+	frozen := gotio.NewClip("Frozen", gotio.NewExternalReference("", "file:///media/shot.mov", nil, nil), &held, nil,
+		[]gotio.Effect{gotio.NewFreezeFrame("", nil)}, nil, "", nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	videoTrack.AppendChild(frozen)
+	built := gotio.NewTimeline("Built", nil, nil)
+	built.Tracks().AppendChild(videoTrack)
+	item = encodeItem(built)
+	if item.StillFrame == nil || !*item.StillFrame || item.StillFrameOffset != nil {
+		t.Errorf("Expected stillframe TRUE without an offset, got %v and %v", item.StillFrame, item.StillFrameOffset)
+	}
+	if item.In != 30 || item.Out != 54 {
+		t.Errorf("Expected in=30 out=54, got in=%d out=%d", item.In, item.Out)
+	}
+}
+
+func TestOfflineFileRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence id="sequence-1">
+    <name>Offline</name>
+    <rate>
+      <timebase>25</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>Unlinked</name>
+            <rate>
+              <timebase>25</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>50</end>
+            <in>100</in>
+            <out>150</out>
+            <file id="file-1">
+              <name>A012_C003.mov</name>
+              <rate>
+                <timebase>25</timebase>
+                <ntsc>FALSE</ntsc>
+              </rate>
+              <duration>500</duration>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	checkReference := func(timeline *gotio.Timeline) {
+		t.Helper()
+		clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+		ref, ok := clip.MediaReference().(*gotio.MissingReference)
+		if !ok {
+			t.Fatalf("Expected a MissingReference, got %T", clip.MediaReference())
+		}
+		if ref.Name() != "A012_C003.mov" {
+			t.Errorf("Expected the reference named A012_C003.mov, got %q", ref.Name())
+		}
+		available := ref.AvailableRange()
+		if available == nil {
+			t.Fatal("Expected an available range")
+		}
+		if available.Duration().Value() != 500 || available.Duration().Rate() != 25 {
+			t.Errorf("Expected an available range of 500 frames at 25, got %v", available.Duration())
+		}
+	}
+	checkReference(timeline)
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	file := encoded.Sequence[0].Media.Video.Track[0].ClipItem[0].File
+	if file == nil {
+		t.Fatal("Expected an offline file")
+	}
+	if file.Name != "A012_C003.mov" || file.PathURL != "" || file.Duration != 500 || file.Rate.Timebase != 25 {
+		t.Errorf("Expected the offline file's name, rate and duration to be written back, got %+v", *file)
+	}
+
+	decoded, err := NewDecoder(bytes.NewReader(buf.Bytes())).Decode()
+	if err != nil {
+		t.Fatalf("Decode of encoded XML failed: %v", err)
+	}
+	checkReference(decoded)
+}
+
+func TestGeneratorParametersRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence id="sequence-1">
+    <name>Generators</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <generatoritem id="generatoritem-1">
+            <name>Color</name>
+            <duration>48</duration>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>48</end>
+            <in>0</in>
+            <out>48</out>
+            <effect>
+              <name>Color</name>
+              <effectid>Color</effectid>
+              <effectcategory>Matte</effectcategory>
+              <effecttype>generator</effecttype>
+              <mediatype>video</mediatype>
+              <parameter>
+                <parameterid>fillcolor</parameterid>
+                <name>Color</name>
+                <value>
+                  <alpha>255</alpha>
+                  <red>255</red>
+                  <green>0</green>
+                  <blue>0</blue>
+                </value>
+              </parameter>
+            </effect>
+          </generatoritem>
+          <generatoritem id="generatoritem-2">
+            <name>Text</name>
+            <duration>48</duration>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>48</start>
+            <end>96</end>
+            <in>0</in>
+            <out>48</out>
+            <effect>
+              <name>Text</name>
+              <effectid>Text</effectid>
+              <effectcategory>Text</effectcategory>
+              <effecttype>generator</effecttype>
+              <mediatype>video</mediatype>
+              <parameter>
+                <parameterid>str</parameterid>
+                <name>Text</name>
+                <value>Opening Titles</value>
+              </parameter>
+              <parameter>
+                <parameterid>fontsize</parameterid>
+                <name>Size</name>
+                <valuemin>0</valuemin>
+                <valuemax>1000</valuemax>
+                <value>36</value>
+              </parameter>
+            </effect>
+          </generatoritem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	children := timeline.VideoTracks()[0].Children()
+	parameters := func(i int) gotio.AnyDictionary {
+		ref, ok := children[i].(*gotio.Clip).MediaReference().(*gotio.GeneratorReference)
+		if !ok {
+			t.Fatalf("Item %d: expected a GeneratorReference, got %T", i, children[i].(*gotio.Clip).MediaReference())
+		}
+		return ref.Parameters()
+	}
+	color, ok := parameters(0)["fillcolor"].(gotio.AnyDictionary)
+	if !ok || color["red"] != 255.0 || color["green"] != 0.0 || color["blue"] != 0.0 || color["alpha"] != 255.0 {
+		t.Errorf("Expected a red fillcolor, got %v", parameters(0)["fillcolor"])
+	}
+	if text := parameters(1)["str"]; text != "Opening Titles" {
+		t.Errorf("Expected the title text, got %v", text)
+	}
+	if size := parameters(1)["fontsize"]; size != 36.0 {
+		t.Errorf("Expected a fontsize of 36, got %v", size)
+	}
+
+	encode := func() []GeneratorItem {
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(timeline); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		var encoded XMEML
+		if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+			t.Fatalf("Failed to parse encoded XML: %v", err)
+		}
+		return encoded.Sequence[0].Media.Video.Track[0].GeneratorItem
+	}
+
+	items := encode()
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 generatoritems, got %d", len(items))
+	}
+	p := findParameter(items[0].Effect, "fillcolor")
+	if p == nil || !maps.Equal(parseValueComponents(p.ValueXML), map[string]float64{"alpha": 255, "red": 255, "green": 0, "blue": 0}) {
+		t.Errorf("Expected the red fillcolor to be written back, got %+v", p)
+	}
+	if p := findParameter(items[1].Effect, "str"); p == nil || p.Value != "Opening Titles" {
+		t.Errorf("Expected the title text to be written back, got %+v", p)
+	}
+
+	// Edited parameters are written, and new ones added
+	color["red"], color["blue"] = 0.0, 255.0
+	parameters(1)["str"] = "Closing Titles"
+	parameters(1)["fontcolor"] = gotio.AnyDictionary{"red": 255.0, "green": 255.0, "blue": 255.0}
+	items = encode()
+	if p := findParameter(items[0].Effect, "fillcolor"); p == nil || !maps.Equal(parseValueComponents(p.ValueXML), map[string]float64{"alpha": 255, "red": 0, "green": 0, "blue": 255}) {
+		t.Errorf("Expected a blue fillcolor, got %+v", p)
+	}
+	if p := findParameter(items[1].Effect, "str"); p == nil || p.Value != "Closing Titles" {
+		t.Errorf("Expected the edited title text, got %+v", p)
+	}
+	if p := findParameter(items[1].Effect, "fontcolor"); p == nil || p.ValueXML != "<red>255</red><green>255</green><blue>255</blue>" {
+		t.Errorf("Expected a new fontcolor parameter, got %+v", p)
+	}
+}
+
+func TestAudioFiltersRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence id="sequence-1">
+    <name>Mix</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <audio>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>dialog.wav</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>48</end>
+            <in>0</in>
+            <out>48</out>
+            <file id="file-1">
+              <name>dialog.wav</name>
+              <pathurl>file:///media/dialog.wav</pathurl>
+              <duration>480</duration>
+            </file>
+            <filter>
+              <enabled>TRUE</enabled>
+              <effect>
+                <name>Audio Levels</name>
+                <effectid>audiolevels</effectid>
+                <effectcategory>audiolevels</effectcategory>
+                <effecttype>audiolevels</effecttype>
+                <mediatype>audio</mediatype>
+                <parameter>
+                  <parameterid>level</parameterid>
+                  <name>Level</name>
+                  <valuemin>0.00001</valuemin>
+                  <valuemax>3.98109</valuemax>
+                  <keyframe>
+                    <when>0</when>
+                    <value>0</value>
+                  </keyframe>
+                  <keyframe>
+                    <when>24</when>
+                    <value>1</value>
+                  </keyframe>
+                </parameter>
+              </effect>
+            </filter>
+            <filter>
+              <enabled>TRUE</enabled>
+              <effect>
+                <name>Audio Pan</name>
+                <effectid>audiopan</effectid>
+                <effectcategory>audiopan</effectcategory>
+                <effecttype>audiopan</effecttype>
+                <mediatype>audio</mediatype>
+                <parameter>
+                  <parameterid>pan</parameterid>
+                  <name>Pan</name>
+                  <valuemin>-1</valuemin>
+                  <valuemax>1</valuemax>
+                  <value>-0.5</value>
+                </parameter>
+              </effect>
+            </filter>
+          </clipitem>
+        </track>
+      </audio>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	clip := timeline.AudioTracks()[0].Children()[0].(*gotio.Clip)
+	metadata := clip.Metadata()
+	keyframes, ok := metadata["fcp7xml_audio_level_keyframes"].([]gotio.AnyDictionary)
+	if !ok || len(keyframes) != 2 || keyframes[0]["value"] != 0.0 || keyframes[1]["when"] != int64(24) || keyframes[1]["value"] != 1.0 {
+		t.Errorf("Expected a fade up in fcp7xml_audio_level_keyframes, got %v", metadata["fcp7xml_audio_level_keyframes"])
+	}
+	if pan := metadata["fcp7xml_audio_pan"]; pan != -0.5 {
+		t.Errorf("Expected fcp7xml_audio_pan -0.5, got %v", pan)
+	}
+
+	encodeFilters := func(timeline *gotio.Timeline) []Filter {
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(timeline); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		var encoded XMEML
+		if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+			t.Fatalf("Failed to parse encoded XML: %v", err)
+		}
+		return encoded.Sequence[0].Media.Audio.Track[0].ClipItem[0].Filter
+	}
+	var original XMEML
+	if err := xml.Unmarshal([]byte(xmlData), &original); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+
+	// Unedited filters are written back as they were read
+	filters := encodeFilters(timeline)
+	if !reflect.DeepEqual(filters, original.Sequence[0].Media.Audio.Track[0].ClipItem[0].Filter) {
+		t.Errorf("Expected the filters unchanged, got %+v", filters)
+	}
+
+	// A constant level replaces the keyframes
+	delete(metadata, "fcp7xml_audio_level_keyframes")
+	metadata["fcp7xml_audio_level"] = 0.5
+	metadata["fcp7xml_audio_pan"] = 1.0
+	filters = encodeFilters(timeline)
+	level := findParameter(findFilterEffect(filters, "audiolevels"), "level")
+	if level == nil || level.Value != "0.5" || len(level.Keyframe) != 0 {
+		t.Errorf("Expected a constant level of 0.5, got %+v", level)
+	}
+	pan := findParameter(findFilterEffect(filters, "audiopan"), "pan")
+	if pan == nil || pan.Value != "1" {
+		t.Errorf("Expected a pan of 1, got %+v", pan)
+	}
+
+	// Clips made in OTIO get the filters added
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(24, 24))
+	built := gotio.NewClip("music.wav", gotio.NewExternalReference("", "file:///media/music.wav", nil, nil), &sourceRange,
+		gotio.AnyDictionary{"fcp7xml_audio_level": 0.25}, nil, nil, "", nil)
+	audioTrack := gotio.NewTrack("Audio 1", nil, gotio.TrackKindAudio, nil, nil)
+	audioTrack.AppendChild(built)
+	builtTimeline := gotio.NewTimeline("Built", nil, nil)
+	builtTimeline.Tracks().AppendChild(audioTrack)
+	filters = encodeFilters(builtTimeline)
+	if len(filters) != 1 || filters[0].Effect.Name != "Audio Levels" || filters[0].Effect.MediaType != "audio" {
+		t.Fatalf("Expected an Audio Levels filter, got %+v", filters)
+	}
+	if level := findParameter(filters[0].Effect, "level"); level == nil || level.Value != "0.25" {
+		t.Errorf("Expected a level of 0.25, got %+v", level)
+	}
+}
+
+func TestReverseSpeedRoundTrip(t *testing.T) {
+	// A fully reversed clip with its in and out points in playback order,
+	// and a reversed 50% slow motion given as a negative speed
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence id="sequence-1">
+    <name>Reverse</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>Backwards</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>48</end>
+            <in>58</in>
+            <out>10</out>
+            <file id="file-clipitem-1">
+              <name>Backwards.mov</name>
+              <pathurl>file:///media/Backwards.mov</pathurl>
+              <duration>240</duration>
+            </file>
+            <filter>
+              <enabled>TRUE</enabled>
+              <effect>
+                <name>Time Remap</name>
+                <effectid>timeremap</effectid>
+                <effectcategory>motion</effectcategory>
+                <effecttype>motion</effecttype>
+                <mediatype>video</mediatype>
+                <parameter>
+                  <parameterid>variablespeed</parameterid>
+                  <name>variablespeed</name>
+                  <value>0</value>
+                </parameter>
+                <parameter>
+                  <parameterid>speed</parameterid>
+                  <name>speed</name>
+                  <value>100</value>
+                </parameter>
+                <parameter>
+                  <parameterid>reverse</parameterid>
+                  <name>reverse</name>
+                  <value>TRUE</value>
+                </parameter>
+              </effect>
+            </filter>
+          </clipitem>
+          <clipitem id="clipitem-2">
+            <name>Slow Rewind</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>48</start>
+            <end>96</end>
+            <in>10</in>
+            <out>34</out>
+            <file id="file-clipitem-2">
+              <name>Slow Rewind.mov</name>
+              <pathurl>file:///media/Slow Rewind.mov</pathurl>
+              <duration>240</duration>
+            </file>
+            <filter>
+              <enabled>TRUE</enabled>
+              <effect>
+                <name>Time Remap</name>
+                <effectid>timeremap</effectid>
+                <effectcategory>motion</effectcategory>
+                <effecttype>motion</effecttype>
+                <mediatype>video</mediatype>
+                <parameter>
+                  <parameterid>variablespeed</parameterid>
+                  <name>variablespeed</name>
+                  <value>0</value>
+                </parameter>
+                <parameter>
+                  <parameterid>speed</parameterid>
+                  <name>speed</name>
+                  <value>-50</value>
+                </parameter>
+                <parameter>
+                  <parameterid>reverse</parameterid>
+                  <name>reverse</name>
+                  <value>FALSE</value>
+                </parameter>
+              </effect>
+            </filter>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	children := timeline.VideoTracks()[0].Children()
+	expected := []struct {
+		start, duration float64
+		scalar          float64
+	}{
+		{10, 48, -1},
+		{10, 24, -0.5},
+	}
+	for i, want := range expected {
+		clip := children[i].(*gotio.Clip)
+		sourceRange := clip.SourceRange()
+		if sourceRange.StartTime().Value() != want.start || sourceRange.Duration().Value() != want.duration {
+			t.Errorf("%s: Expected a source range of %v+%v, got %v+%v", clip.Name(), want.start, want.duration,
+				sourceRange.StartTime().Value(), sourceRange.Duration().Value())
+		}
+		effects := clip.Effects()
+		if len(effects) != 1 {
+			t.Fatalf("%s: Expected 1 effect, got %d", clip.Name(), len(effects))
+		}
+		warp, ok := effects[0].(*gotio.LinearTimeWarp)
+		if !ok || warp.TimeScalar() != want.scalar {
+			t.Errorf("%s: Expected a LinearTimeWarp with time scalar %v, got %+v", clip.Name(), want.scalar, effects[0])
+		}
+	}
+
+	encode := func(timeline *gotio.Timeline) []ClipItem {
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(timeline); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		var encoded XMEML
+		if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+			t.Fatalf("Failed to parse encoded XML: %v", err)
+		}
+		return encoded.Sequence[0].Media.Video.Track[0].ClipItem
+	}
+	var original XMEML
+	if err := xml.Unmarshal([]byte(xmlData), &original); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+
+	// Both are written back as they were read
+	items := encode(timeline)
+	for i, item := range items {
+		want := original.Sequence[0].Media.Video.Track[0].ClipItem[i]
+		if item.In != want.In || item.Out != want.Out {
+			t.Errorf("%s: Expected in=%d out=%d, got in=%d out=%d", item.Name, want.In, want.Out, item.In, item.Out)
+		}
+		if !reflect.DeepEqual(item.Filter, want.Filter) {
+			t.Errorf("%s: Expected the time remap unchanged, got %+v", item.Name, item.Filter)
+		}
+	}
+
+	// A reversed clip made in OTIO gets a time remap, with its in and out
+	// points in media order
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(10, 24), opentime.NewRationalTime(24, 24))
+	reversed := gotio.NewClip("Rewind", gotio.NewExternalReference("", "file:///media/rewind.mov", nil, nil), &sourceRange, nil,
+		[]gotio.Effect{gotio.NewLinearTimeWarp("", "LinearTimeWarp", -0.5, nil)}, nil, "", nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	videoTrack.AppendChild(reversed)
+	built := gotio.NewTimeline("Built", nil, nil)
+	built.Tracks().AppendChild(videoTrack)
+	item := encode(built)[0]
+	if item.In != 10 || item.Out != 34 {
+		t.Errorf("Expected in=10 out=34, got in=%d out=%d", item.In, item.Out)
+	}
+	effect := findFilterEffect(item.Filter, timeRemapID)
+	if effect == nil {
+		t.Fatal("Expected a time remap filter")
+	}
+	if p := findParameter(effect, "speed"); p == nil || p.Value != "50" {
+		t.Errorf("Expected a speed of 50, got %+v", p)
+	}
+	if p := findParameter(effect, "reverse"); p == nil || p.Value != "TRUE" {
+		t.Errorf("Expected reverse TRUE, got %+v", p)
+	}
+}
+
+func TestTransitionEffectParametersRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Wipes</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <transitionitem>
+            <name>Edge Wipe</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>24</end>
+            <alignment>center</alignment>
+            <effect>
+              <name>Edge Wipe</name>
+              <effectid>Edge Wipe</effectid>
+              <effectcategory>Wipe</effectcategory>
+              <effecttype>transition</effecttype>
+              <mediatype>video</mediatype>
+              <parameter>
+                <parameterid>angle</parameterid>
+                <name>Angle</name>
+                <valuemin>-360</valuemin>
+                <valuemax>360</valuemax>
+                <value>45</value>
+              </parameter>
+              <parameter>
+                <parameterid>border</parameterid>
+                <name>Border</name>
+                <valuemin>0</valuemin>
+                <valuemax>100</valuemax>
+                <value>0</value>
+                <keyframe>
+                  <when>0</when>
+                  <value>0</value>
+                </keyframe>
+                <keyframe>
+                  <when>24</when>
+                  <value>12.5</value>
+                  <interpolation>
+                    <name>FCPCurve</name>
+                  </interpolation>
+                </keyframe>
+              </parameter>
+              <parameter>
+                <parameterid>feather</parameterid>
+                <name>Feather</name>
+                <valuemin>0</valuemin>
+                <valuemax>1000</valuemax>
+                <value>10</value>
+              </parameter>
+            </effect>
+          </transitionitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	var original XMEML
+	if err := xml.Unmarshal([]byte(xmlData), &original); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+	originalEffect := original.Sequence[0].Media.Video.Track[0].TransitionItem[0].Effect
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	transitions := encoded.Sequence[0].Media.Video.Track[0].TransitionItem
+	if len(transitions) != 1 || transitions[0].Effect == nil {
+		t.Fatal("Expected one transition with an effect")
+	}
+	effect := transitions[0].Effect
+
+	if len(effect.Parameter) != 3 {
+		t.Fatalf("Expected 3 parameters, got %d", len(effect.Parameter))
+	}
+	for i, param := range effect.Parameter {
+		if !reflect.DeepEqual(param, originalEffect.Parameter[i]) {
+			t.Errorf("Parameter %d changed:\n  got      %+v\n  expected %+v", i, param, originalEffect.Parameter[i])
+		}
+	}
+	if effect.EffectCategory != "Wipe" {
+		t.Errorf("Expected effect category 'Wipe', got '%s'", effect.EffectCategory)
+	}
+}
+
+func TestColorCorrectionRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Grade</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem>
+            <name>Sunset</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>48</end>
+            <in>0</in>
+            <out>48</out>
+            <file id="sunset">
+              <name>sunset.mov</name>
+              <pathurl>file:///media/sunset.mov</pathurl>
+            </file>
+            <filter>
+              <enabled>TRUE</enabled>
+              <effect>
+                <name>Color Corrector 3-way</name>
+                <effectid>Color Corrector 3-way</effectid>
+                <effectcategory>Color Correction</effectcategory>
+                <effecttype>filter</effecttype>
+                <mediatype>video</mediatype>
+                <parameter>
+                  <parameterid>blackbalance</parameterid>
+                  <name>Balance</name>
+                  <value>
+                    <horiz>0</horiz>
+                    <vert>0</vert>
+                  </value>
+                </parameter>
+                <parameter>
+                  <parameterid>midbalance</parameterid>
+                  <name>Balance</name>
+                  <value>
+                    <horiz>0.02</horiz>
+                    <vert>-0.01</vert>
+                  </value>
+                </parameter>
+                <parameter>
+                  <parameterid>whitebalance</parameterid>
+                  <name>Balance</name>
+                  <value>
+                    <horiz>0.12</horiz>
+                    <vert>-0.08</vert>
+                  </value>
+                </parameter>
+                <parameter>
+                  <parameterid>whitelevel</parameterid>
+                  <name>Whites</name>
+                  <valuemin>0</valuemin>
+                  <valuemax>200</valuemax>
+                  <value>104</value>
+                </parameter>
+                <parameter>
+                  <parameterid>saturation</parameterid>
+                  <name>Sat</name>
+                  <valuemin>0</valuemin>
+                  <valuemax>200</valuemax>
+                  <value>110</value>
+                </parameter>
+                <parameter>
+                  <parameterid>limitsaturation</parameterid>
+                  <name>Limit Effect</name>
+                  <value>FALSE</value>
+                </parameter>
+              </effect>
+            </filter>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	var original XMEML
+	if err := xml.Unmarshal([]byte(xmlData), &original); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+	originalEffect := original.Sequence[0].Media.Video.Track[0].ClipItem[0].Filter[0].Effect
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+
+	colorCorrection, ok := clip.Metadata()["fcp7xml_color_correction"].(gotio.AnyDictionary)
+	if !ok {
+		t.Fatal("Expected fcp7xml_color_correction metadata")
+	}
+	gain, _ := colorCorrection["gain"].(gotio.AnyDictionary)
+	balance, _ := gain["balance"].(gotio.AnyDictionary)
+	if balance["horiz"] != 0.12 || balance["vert"] != -0.08 {
+		t.Errorf("Expected gain balance 0.12/-0.08, got %v", balance)
+	}
+	if gain["level"] != 104.0 {
+		t.Errorf("Expected gain level 104, got %v", gain["level"])
+	}
+	if colorCorrection["saturation"] != 110.0 {
+		t.Errorf("Expected saturation 110, got %v", colorCorrection["saturation"])
+	}
+
+	encodeEffect := func() *Effect {
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(timeline); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		var encoded XMEML
+		if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+			t.Fatalf("Failed to parse encoded XML: %v", err)
+		}
+		filters := encoded.Sequence[0].Media.Video.Track[0].ClipItem[0].Filter
+		if len(filters) != 1 || filters[0].Effect == nil {
+			t.Fatal("Expected one filter with an effect")
+		}
+		return filters[0].Effect
+	}
+
+	// Unedited, the filter is re-emitted as it was read
+	effect := encodeEffect()
+	if len(effect.Parameter) != len(originalEffect.Parameter) {
+		t.Fatalf("Expected %d parameters, got %d", len(originalEffect.Parameter), len(effect.Parameter))
+	}
+	for i, param := range effect.Parameter {
+		if !reflect.DeepEqual(param, originalEffect.Parameter[i]) {
+			t.Errorf("Parameter %d changed:\n  got      %+v\n  expected %+v", i, param, originalEffect.Parameter[i])
+		}
+	}
+
+	// Edits to the structured metadata are written to the filter
+	balance["horiz"] = 0.2
+	effect = encodeEffect()
+	whiteBalance := findParameter(effect, "whitebalance")
+	if whiteBalance == nil {
+		t.Fatal("Expected whitebalance parameter")
+	}
+	if whiteBalance.ValueXML != "<horiz>0.2</horiz><vert>-0.08</vert>" {
+		t.Errorf("Expected edited gain balance, got '%s'", whiteBalance.ValueXML)
+	}
+	if midBalance := findParameter(effect, "midbalance"); !reflect.DeepEqual(*midBalance, originalEffect.Parameter[1]) {
+		t.Errorf("Expected midbalance to be unchanged, got %+v", *midBalance)
+	}
+}
+
+func TestKeyframedFilterRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Push In</name>
+    <rate>
+      <timebase>25</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem>
+            <name>Interview</name>
+            <rate>
+              <timebase>25</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>50</end>
+            <in>0</in>
+            <out>50</out>
+            <file id="interview">
+              <name>interview.mov</name>
+              <pathurl>file:///media/interview.mov</pathurl>
+            </file>
+            <filter>
+              <effect>
+                <name>Basic Motion</name>
+                <effectid>basic</effectid>
+                <effectcategory>motion</effectcategory>
+                <effecttype>motion</effecttype>
+                <mediatype>video</mediatype>
+                <parameter>
+                  <parameterid>scale</parameterid>
+                  <name>Scale</name>
+                  <valuemin>0</valuemin>
+                  <valuemax>1000</valuemax>
+                  <value>100</value>
+                  <keyframe>
+                    <when>0</when>
+                    <value>100</value>
+                  </keyframe>
+                  <keyframe>
+                    <when>50</when>
+                    <value>120</value>
+                  </keyframe>
+                </parameter>
+                <parameter>
+                  <parameterid>center</parameterid>
+                  <name>Center</name>
+                  <value>
+                    <horiz>0</horiz>
+                    <vert>0</vert>
+                  </value>
+                  <keyframe>
+                    <when>0</when>
+                    <value>
+                      <horiz>0</horiz>
+                      <vert>0</vert>
+                    </value>
+                  </keyframe>
+                  <keyframe>
+                    <when>50</when>
+                    <value>
+                      <horiz>0.05</horiz>
+                      <vert>-0.1</vert>
+                    </value>
+                  </keyframe>
+                </parameter>
+              </effect>
+            </filter>
+            <filter>
+              <effect>
+                <name>Opacity</name>
+                <effectid>opacity</effectid>
+                <effectcategory>motion</effectcategory>
+                <effecttype>motion</effecttype>
+                <mediatype>video</mediatype>
+                <parameter>
+                  <parameterid>opacity</parameterid>
+                  <name>opacity</name>
+                  <valuemin>0</valuemin>
+                  <valuemax>100</valuemax>
+                  <value>100</value>
+                  <keyframe>
+                    <when>0</when>
+                    <value>0</value>
+                  </keyframe>
+                  <keyframe>
+                    <when>12</when>
+                    <value>100</value>
+                  </keyframe>
+                </parameter>
+              </effect>
+            </filter>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	var original XMEML
+	if err := xml.Unmarshal([]byte(xmlData), &original); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+	originalFilters := original.Sequence[0].Media.Video.Track[0].ClipItem[0].Filter
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	filters := encoded.Sequence[0].Media.Video.Track[0].ClipItem[0].Filter
+	if len(filters) != len(originalFilters) {
+		t.Fatalf("Expected %d filters, got %d", len(originalFilters), len(filters))
+	}
+	for i := range filters {
+		if !reflect.DeepEqual(filters[i].Effect, originalFilters[i].Effect) {
+			t.Errorf("Filter %d changed:\n  got      %+v\n  expected %+v", i, filters[i].Effect, originalFilters[i].Effect)
+		}
+	}
+
+	center := findParameter(filters[0].Effect, "center")
+	if center == nil || len(center.Keyframe) != 2 {
+		t.Fatal("Expected center parameter with 2 keyframes")
+	}
+	if !strings.Contains(center.Keyframe[1].ValueXML, "<horiz>0.05</horiz>") {
+		t.Errorf("Expected point keyframe value to survive, got '%s'", center.Keyframe[1].ValueXML)
+	}
+}
+
+func TestLabelsRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Labels</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip-1">
+            <name>B012C004</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>24</end>
+            <in>0</in>
+            <out>24</out>
+            <file id="file-1">
+              <name>B012C004.mov</name>
+              <pathurl>file:///media/B012C004.mov</pathurl>
+            </file>
+            <labels>
+              <label>Best Take</label>
+              <label2>Forest</label2>
+            </labels>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	if label, _ := clip.Metadata()["fcp7xml_label"].(string); label != "Best Take" {
+		t.Errorf("Expected label 'Best Take', got '%s'", label)
+	}
+	if label2, _ := clip.Metadata()["fcp7xml_label2"].(string); label2 != "Forest" {
+		t.Errorf("Expected label2 'Forest', got '%s'", label2)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	labels := encoded.Sequence[0].Media.Video.Track[0].ClipItem[0].Labels
+	if labels == nil {
+		t.Fatal("Expected labels to be written")
+	}
+	if labels.Label != "Best Take" || labels.Label2 != "Forest" {
+		t.Errorf("Expected labels 'Best Take'/'Forest', got '%s'/'%s'", labels.Label, labels.Label2)
+	}
+}
+
+func TestLockedTrackRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Locked</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <enabled>TRUE</enabled>
+          <locked>TRUE</locked>
+          <clipitem id="clip-1">
+            <name>Picture Lock</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>24</end>
+            <in>0</in>
+            <out>24</out>
+            <file id="file-1">
+              <name>lock.mov</name>
+              <pathurl>file:///media/lock.mov</pathurl>
+            </file>
+          </clipitem>
+        </track>
+        <track>
+          <locked>FALSE</locked>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	videoTracks := timeline.VideoTracks()
+	if locked, ok := videoTracks[0].Metadata()["fcp7xml_locked"].(bool); !ok || !locked {
+		t.Errorf("Expected first track to be locked, got %v", videoTracks[0].Metadata()["fcp7xml_locked"])
+	}
+	if locked, ok := videoTracks[1].Metadata()["fcp7xml_locked"].(bool); !ok || locked {
+		t.Errorf("Expected second track to be unlocked, got %v", videoTracks[1].Metadata()["fcp7xml_locked"])
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	tracks := encoded.Sequence[0].Media.Video.Track
+	if len(tracks) != 2 {
+		t.Fatalf("Expected 2 video tracks, got %d", len(tracks))
+	}
+	if tracks[0].Locked == nil || !*tracks[0].Locked {
+		t.Error("Expected first track to be written as locked")
+	}
+	if tracks[1].Locked == nil || *tracks[1].Locked {
+		t.Error("Expected second track to be written as unlocked")
+	}
+}
+
+func TestClipPixelAspectRatioRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Pixel Aspect</name>
+    <rate>
+      <timebase>25</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip-1">
+            <name>Override</name>
+            <rate>
+              <timebase>25</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>25</end>
+            <in>0</in>
+            <out>25</out>
+            <pixelaspectratio>PAL-601</pixelaspectratio>
+            <file id="file-1">
+              <name>dv.mov</name>
+              <pathurl>file:///media/dv.mov</pathurl>
+              <media>
+                <video>
+                  <samplecharacteristics>
+                    <width>720</width>
+                    <height>576</height>
+                    <pixelaspectratio>square</pixelaspectratio>
+                  </samplecharacteristics>
+                </video>
+              </media>
+            </file>
+          </clipitem>
+          <clipitem id="clip-2">
+            <name>Inherited</name>
+            <rate>
+              <timebase>25</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>25</start>
+            <end>50</end>
+            <in>0</in>
+            <out>25</out>
+            <file id="file-2">
+              <name>hd.mov</name>
+              <pathurl>file:///media/hd.mov</pathurl>
+              <media>
+                <video>
+                  <samplecharacteristics>
+                    <width>1920</width>
+                    <height>1080</height>
+                    <pixelaspectratio>square</pixelaspectratio>
+                  </samplecharacteristics>
+                </video>
+              </media>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	children := timeline.VideoTracks()[0].Children()
+	expected := []struct {
+		clip, file string
+		ratio      float64
+	}{
+		{"PAL-601", "square", 59.0 / 54.0},
+		{"square", "square", 1},
+	}
+	for i, want := range expected {
+		metadata := children[i].(*gotio.Clip).Metadata()
+		if got, _ := metadata["fcp7xml_pixelaspectratio"].(string); got != want.clip {
+			t.Errorf("Clip %d: expected pixel aspect '%s', got '%s'", i, want.clip, got)
+		}
+		if got, _ := metadata["fcp7xml_pixel_aspect"].(float64); got != want.ratio {
+			t.Errorf("Clip %d: expected numeric pixel aspect %.4f, got %v", i, want.ratio, metadata["fcp7xml_pixel_aspect"])
+		}
+		if got, _ := metadata["fcp7xml_file_pixelaspectratio"].(string); got != want.file {
+			t.Errorf("Clip %d: expected file pixel aspect '%s', got '%s'", i, want.file, got)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	clipItems := encoded.Sequence[0].Media.Video.Track[0].ClipItem
+	if clipItems[0].PixelAspectRatio != "PAL-601" {
+		t.Errorf("Expected clipitem override 'PAL-601', got '%s'", clipItems[0].PixelAspectRatio)
+	}
+	if clipItems[1].PixelAspectRatio != "" {
+		t.Errorf("Expected no clipitem override, got '%s'", clipItems[1].PixelAspectRatio)
+	}
+	for i, item := range clipItems {
+		characteristics := fileVideoCharacteristics(item.File)
+		if characteristics == nil || characteristics.PixelAspectRatio != "square" {
+			t.Errorf("Clip %d: expected file pixel aspect 'square', got %+v", i, characteristics)
+		}
+	}
+}
+
+func TestPointMarkerRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Markers</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip-1">
+            <name>Long Take</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>480</end>
+            <in>0</in>
+            <out>480</out>
+            <file id="file-1">
+              <name>long_take.mov</name>
+              <pathurl>file:///media/long_take.mov</pathurl>
+              <duration>480</duration>
+            </file>
+            <marker>
+              <name>Point</name>
+              <in>240</in>
+              <out>-1</out>
+            </marker>
+            <marker>
+              <name>Range</name>
+              <in>300</in>
+              <out>348</out>
+            </marker>
+            <marker>
+              <name>Same In And Out</name>
+              <in>360</in>
+              <out>360</out>
+            </marker>
+            <marker>
+              <name>One Frame</name>
+              <in>400</in>
+              <out>401</out>
+            </marker>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	markers := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip).Markers()
+	if len(markers) != 4 {
+		t.Fatalf("Expected 4 markers, got %d", len(markers))
+	}
+	if mr := markers[0].MarkedRange(); mr.StartTime().Value() != 240 || mr.Duration().Value() != 0 {
+		t.Errorf("Expected point marker at 240 with zero duration, got %v+%v", mr.StartTime().Value(), mr.Duration().Value())
+	}
+	if mr := markers[2].MarkedRange(); mr.StartTime().Value() != 360 || mr.Duration().Value() != 0 {
+		t.Errorf("Expected point marker at 360 with zero duration, got %v+%v", mr.StartTime().Value(), mr.Duration().Value())
+	}
+	if mr := markers[3].MarkedRange(); mr.StartTime().Value() != 400 || mr.Duration().Value() != 1 {
+		t.Errorf("Expected ranged marker at 400 lasting 1 frame, got %v+%v", mr.StartTime().Value(), mr.Duration().Value())
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	encodedMarkers := encoded.Sequence[0].Media.Video.Track[0].ClipItem[0].Marker
+	if len(encodedMarkers) != 4 {
+		t.Fatalf("Expected 4 encoded markers, got %d", len(encodedMarkers))
+	}
+	if m := encodedMarkers[0]; m.In != 240 || m.Out != -1 {
+		t.Errorf("Expected point marker in=240 out=-1, got in=%d out=%d", m.In, m.Out)
+	}
+	if m := encodedMarkers[1]; m.In != 300 || m.Out != 348 {
+		t.Errorf("Expected ranged marker in=300 out=348, got in=%d out=%d", m.In, m.Out)
+	}
+	// FCP7 writes point markers with an out point of -1, not equal to in
+	if m := encodedMarkers[2]; m.In != 360 || m.Out != -1 {
+		t.Errorf("Expected point marker in=360 out=-1, got in=%d out=%d", m.In, m.Out)
+	}
+	if m := encodedMarkers[3]; m.In != 400 || m.Out != 401 {
+		t.Errorf("Expected ranged marker in=400 out=401, got in=%d out=%d", m.In, m.Out)
+	}
+}
+
+func TestSubclipInfoRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Subclips</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip-1">
+            <masterclipid>masterclip-1</masterclipid>
+            <name>Interview Answer 3</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>96</end>
+            <in>1224</in>
+            <out>1320</out>
+            <file id="file-1">
+              <name>interview.mov</name>
+              <pathurl>file:///media/interview.mov</pathurl>
+              <duration>4800</duration>
+            </file>
+            <subclipinfo>
+              <startoffset>1200</startoffset>
+              <endoffset>3120</endoffset>
+            </subclipinfo>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	subclip, ok := clip.Metadata()["fcp7xml_subclipinfo"].(gotio.AnyDictionary)
+	if !ok {
+		t.Fatal("Expected fcp7xml_subclipinfo metadata")
+	}
+	if subclip["startoffset"] != int64(1200) || subclip["endoffset"] != int64(3120) {
+		t.Errorf("Expected offsets 1200 and 3120, got %v and %v", subclip["startoffset"], subclip["endoffset"])
+	}
+
+	// The available range is the subclip's part of the media
+	ar := clip.MediaReference().AvailableRange()
+	if ar == nil {
+		t.Fatal("Expected an available range")
+	}
+	if ar.StartTime().Value() != 1200 || ar.Duration().Value() != 480 {
+		t.Errorf("Expected available range 1200+480, got %v+%v", ar.StartTime().Value(), ar.Duration().Value())
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	item := encoded.Sequence[0].Media.Video.Track[0].ClipItem[0]
+	if item.SubclipInfo == nil {
+		t.Fatal("Expected <subclipinfo> to be re-emitted")
+	}
+	if item.SubclipInfo.StartOffset != 1200 || item.SubclipInfo.EndOffset != 3120 {
+		t.Errorf("Expected offsets 1200 and 3120, got %d and %d", item.SubclipInfo.StartOffset, item.SubclipInfo.EndOffset)
+	}
+	if item.File.Duration != 4800 {
+		t.Errorf("Expected the file's full duration 4800, got %d", item.File.Duration)
+	}
+	if item.In != 1224 || item.Out != 1320 {
+		t.Errorf("Expected in/out 1224/1320, got %d/%d", item.In, item.Out)
+	}
+}
+
+func TestSubclipInfoFileRateRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Subclips</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip-1">
+            <name>Interview Answer 3</name>
+            <rate>
+              <timebase>24</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>96</end>
+            <in>100</in>
+            <out>196</out>
+            <file id="file-1">
+              <name>interview.mov</name>
+              <pathurl>file:///media/interview.mov</pathurl>
+              <rate>
+                <timebase>30</timebase>
+                <ntsc>TRUE</ntsc>
+              </rate>
+              <duration>1000</duration>
+            </file>
+            <subclipinfo>
+              <startoffset>100</startoffset>
+              <endoffset>200</endoffset>
+            </subclipinfo>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	// The available range is in the file's rate; one rescaled to the
+	// sequence's rate must still give the file's duration in its own frames
+	clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	ref := clip.MediaReference().(*gotio.ExternalReference)
+	ar := ref.AvailableRange()
+	if ar == nil {
+		t.Fatal("Expected an available range")
+	}
+	if ar.StartTime().Value() != 100 || ar.Duration().Value() != 700 {
+		t.Errorf("Expected available range 100+700, got %v+%v", ar.StartTime().Value(), ar.Duration().Value())
+	}
+	rescaled := opentime.NewTimeRange(ar.StartTime().RescaledTo(24), ar.Duration().RescaledTo(24))
+	ref.SetAvailableRange(&rescaled)
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	item := encoded.Sequence[0].Media.Video.Track[0].ClipItem[0]
+	if item.SubclipInfo == nil || item.SubclipInfo.StartOffset != 100 || item.SubclipInfo.EndOffset != 200 {
+		t.Errorf("Expected offsets 100 and 200, got %+v", item.SubclipInfo)
+	}
+	if item.File.Rate.Timebase != 30 || !item.File.Rate.NTSC {
+		t.Errorf("Expected the file's rate 29.97, got %s", formatRate(&item.File.Rate))
+	}
+	if item.File.Duration != 1000 {
+		t.Errorf("Expected the file's full duration 1000, got %d", item.File.Duration)
+	}
+}
+
+func TestLinkedStereoAudioRoundTrip(t *testing.T) {
+	timeline := gotio.NewTimeline("Linked", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	audioTrack := gotio.NewTrack("Audio 1", nil, gotio.TrackKindAudio, nil, nil)
+	sourceRange := opentime.NewTimeRange(
+		opentime.NewRationalTime(48, 24),
+		opentime.NewRationalTime(96, 24),
+	)
+	newClip := func(metadata gotio.AnyDictionary) *gotio.Clip {
+		return gotio.NewClip(
+			"Take 4",
+			gotio.NewExternalReference("take4.mov", "file:///media/take4.mov", nil, nil),
+			&sourceRange,
+			metadata,
+			nil,
+			nil,
+			"",
+			nil,
+		)
+	}
+	videoTrack.AppendChild(newClip(gotio.AnyDictionary{"fcp7xml_link_group": "take4"}))
+	audioTrack.AppendChild(newClip(gotio.AnyDictionary{
+		"fcp7xml_link_group":     "take4",
+		"fcp7xml_audio_channels": int64(2),
+	}))
+	timeline.Tracks().AppendChild(videoTrack)
+	timeline.Tracks().AppendChild(audioTrack)
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	media := encoded.Sequence[0].Media
+	if len(media.Video.Track) != 1 || len(media.Audio.Track) != 2 {
+		t.Fatalf("Expected 1 video and 2 audio tracks, got %d and %d", len(media.Video.Track), len(media.Audio.Track))
+	}
+
+	// Every clipitem links to all three, and every reference resolves
+	type position struct {
+		mediaType  string
+		trackIndex int
+	}
+	positions := make(map[string]position)
+	var items []*ClipItem
+	for i := range media.Video.Track {
+		for j := range media.Video.Track[i].ClipItem {
+			item := &media.Video.Track[i].ClipItem[j]
+			positions[item.ID] = position{"video", i + 1}
+			items = append(items, item)
+		}
+	}
+	for i := range media.Audio.Track {
+		for j := range media.Audio.Track[i].ClipItem {
+			item := &media.Audio.Track[i].ClipItem[j]
+			positions[item.ID] = position{"audio", i + 1}
+			items = append(items, item)
+		}
+	}
+	if len(items) != 3 || len(positions) != 3 {
+		t.Fatalf("Expected 3 clipitems with distinct ids, got %d with %d ids", len(items), len(positions))
+	}
+	for _, item := range items {
+		if len(item.Link) != 3 {
+			t.Errorf("Clipitem %s: expected 3 links, got %d", item.ID, len(item.Link))
+		}
+		for _, link := range item.Link {
+			pos, ok := positions[link.LinkClipRef]
+			if !ok {
+				t.Errorf("Clipitem %s: link to missing clipitem '%s'", item.ID, link.LinkClipRef)
+				continue
+			}
+			if pos.mediaType != link.MediaType || pos.trackIndex != link.TrackIndex {
+				t.Errorf("Clipitem %s: link to '%s' says %s track %d, but it is on %s track %d",
+					item.ID, link.LinkClipRef, link.MediaType, link.TrackIndex, pos.mediaType, pos.trackIndex)
+			}
+		}
+	}
+	for i, track := range media.Audio.Track {
+		item := track.ClipItem[0]
+		if item.SourceTrack == nil || item.SourceTrack.TrackIndex != i+1 {
+			t.Errorf("Audio track %d: expected source track %d, got %+v", i+1, i+1, item.SourceTrack)
+		}
+		if item.In != 48 || item.Out != 144 {
+			t.Errorf("Audio track %d: expected in/out 48/144, got %d/%d", i+1, item.In, item.Out)
+		}
+	}
+
+	// The pair merges back into one stereo clip on decode
+	decoded, err := NewDecoder(bytes.NewReader(buf.Bytes())).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	audioTracks := decoded.AudioTracks()
+	if len(audioTracks) != 1 || len(audioTracks[0].Children()) != 1 {
+		t.Fatalf("Expected 1 audio track with 1 clip, got %d tracks", len(audioTracks))
+	}
+	audio := audioTracks[0].Children()[0].(*gotio.Clip)
+	if channels, _ := audio.Metadata()["fcp7xml_audio_channels"].(int64); channels != 2 {
+		t.Errorf("Expected a stereo audio clip, got %v channels", audio.Metadata()["fcp7xml_audio_channels"])
+	}
+	video := decoded.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	videoGroup, _ := video.Metadata()["fcp7xml_link_group"].(string)
+	if videoGroup == "" || audio.Metadata()["fcp7xml_link_group"] != videoGroup {
+		t.Errorf("Expected video and audio in one link group, got %v and %v",
+			video.Metadata()["fcp7xml_link_group"], audio.Metadata()["fcp7xml_link_group"])
+	}
+}
+
+func TestPixelAspectRatioSpellingRoundTrip(t *testing.T) {
+	const spelling = "NTSC CCIR 601/DV (0.9091)"
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Spelling</name>
+    <rate>
+      <timebase>30</timebase>
+      <ntsc>TRUE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip-1">
+            <name>DV Shot</name>
+            <rate>
+              <timebase>30</timebase>
+              <ntsc>TRUE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>60</end>
+            <in>0</in>
+            <out>60</out>
+            <file id="file-1">
+              <name>dv_shot.mov</name>
+              <pathurl>file:///media/dv_shot.mov</pathurl>
+              <duration>300</duration>
+              <media>
+                <video>
+                  <samplecharacteristics>
+                    <width>720</width>
+                    <height>480</height>
+                    <pixelaspectratio>` + spelling + `</pixelaspectratio>
+                  </samplecharacteristics>
+                </video>
+              </media>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	metadata := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip).Metadata()
+	if got := metadata["fcp7xml_pixelaspectratio"]; got != spelling {
+		t.Errorf("Expected pixel aspect '%s', got %v", spelling, got)
+	}
+	if got, _ := metadata["fcp7xml_pixel_aspect"].(float64); got != 0.9091 {
+		t.Errorf("Expected numeric pixel aspect 0.9091, got %v", metadata["fcp7xml_pixel_aspect"])
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "<pixelaspectratio>"+spelling+"</pixelaspectratio>") {
+		t.Errorf("Expected '%s' to be written unchanged, got:\n%s", spelling, buf.String())
+	}
+
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	item := encoded.Sequence[0].Media.Video.Track[0].ClipItem[0]
+	if item.PixelAspectRatio != "" {
+		t.Errorf("Expected no clipitem override, got '%s'", item.PixelAspectRatio)
+	}
+}
+
+func TestAnamorphicSDClipRoundTrip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Widescreen SD</name>
+    <rate>
+      <timebase>30</timebase>
+      <ntsc>TRUE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clip-1">
+            <name>Interview 16x9</name>
+            <rate>
+              <timebase>30</timebase>
+              <ntsc>TRUE</ntsc>
+            </rate>
+            <start>0</start>
+            <end>90</end>
+            <in>0</in>
+            <out>90</out>
+            <anamorphic>TRUE</anamorphic>
+            <file id="file-1">
+              <name>interview_16x9.mov</name>
+              <pathurl>file:///media/interview_16x9.mov</pathurl>
+              <duration>900</duration>
+              <media>
+                <video>
+                  <samplecharacteristics>
+                    <width>720</width>
+                    <height>480</height>
+                    <anamorphic>TRUE</anamorphic>
+                    <pixelaspectratio>NTSC-601</pixelaspectratio>
+                  </samplecharacteristics>
+                </video>
+              </media>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`
+
+	timeline, err := NewDecoder(strings.NewReader(xmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	metadata := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip).Metadata()
+	if anamorphic, ok := metadata["fcp7xml_anamorphic"].(bool); !ok || !anamorphic {
+		t.Errorf("Expected fcp7xml_anamorphic true, got %v", metadata["fcp7xml_anamorphic"])
+	}
+	if mode := metadata["fcp7xml_file_anamorphic"]; mode != "TRUE" {
+		t.Errorf("Expected file anamorphic 'TRUE', got %v", mode)
+	}
+	if aspect, _ := metadata["fcp7xml_display_aspect"].(float64); aspect != 16.0/9.0 {
+		t.Errorf("Expected a 16:9 display aspect, got %v", metadata["fcp7xml_display_aspect"])
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var encoded XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &encoded); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	item := encoded.Sequence[0].Media.Video.Track[0].ClipItem[0]
+	if item.Anamorphic == nil || !*item.Anamorphic {
+		t.Errorf("Expected clipitem anamorphic TRUE, got %v", item.Anamorphic)
+	}
+	characteristics := item.File.Media.Video.SampleCharacteristics
+	if characteristics.AnamorphicMode != "TRUE" {
+		t.Errorf("Expected file anamorphic 'TRUE', got '%s'", characteristics.AnamorphicMode)
+	}
+}
@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// FileURLFromPath returns the file:// URL of a local path, as written to
+// <pathurl>. Windows paths are recognized on any platform: C:\media\clip.mov
+// becomes file:///C:/media/clip.mov and \\server\share\clip.mov becomes
+// file://server/share/clip.mov. Other relative paths are made absolute
+// first.
+func FileURLFromPath(path string) string {
+	if !isWindowsPath(path) && !isUNCPath(path) && !filepath.IsAbs(path) {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+	if isUNCPath(path) {
+		host, share, _ := strings.Cut(strings.ReplaceAll(path[2:], `\`, "/"), "/")
+		return (&url.URL{Scheme: "file", Host: host, Path: "/" + share}).String()
+	}
+	if isWindowsPath(path) {
+		path = "/" + strings.ReplaceAll(path, `\`, "/")
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// PathFromFileURL returns the local path of a file:// URL, the reverse of
+// FileURLFromPath. A localhost host, as FCP7 writes, is dropped. URLs of
+// Windows paths, with a drive letter or a host other than localhost, give
+// Windows paths on any platform.
+func PathFromFileURL(fileURL string) (string, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse file URL: %w", err)
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("not a file URL: %q", fileURL)
+	}
+	path := u.Path
+	if u.Host != "" && !strings.EqualFold(u.Host, "localhost") {
+		return `\\` + u.Host + strings.ReplaceAll(path, "/", `\`), nil
+	}
+	if len(path) > 1 && path[0] == '/' && isWindowsPath(path[1:]) {
+		return strings.ReplaceAll(path[1:], "/", `\`), nil
+	}
+	return path, nil
+}
+
+// isWindowsPath reports whether path starts with a drive letter, as in
+// C:\media or C:/media.
+func isWindowsPath(path string) bool {
+	if len(path) < 3 || path[1] != ':' || (path[2] != '\\' && path[2] != '/') {
+		return false
+	}
+	c := path[0]
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// isUNCPath reports whether path is a Windows network path, as in
+// \\server\share.
+func isUNCPath(path string) bool {
+	return len(path) > 2 && strings.HasPrefix(path, `\\`) && path[2] != '\\'
+}
+
+// resolvePathURL returns pathURL resolved against DecodeOptions.BaseDir if it
+// is relative, and unchanged otherwise.
+func (d *Decoder) resolvePathURL(pathURL string) string {
+	if d.opts.BaseDir == "" || pathURL == "" || isWindowsPath(pathURL) || isUNCPath(pathURL) {
+		return pathURL
+	}
+	ref, err := url.Parse(pathURL)
+	if err != nil || ref.IsAbs() || ref.Host != "" || strings.HasPrefix(ref.Path, "/") {
+		return pathURL
+	}
+	base, err := url.Parse(FileURLFromPath(d.opts.BaseDir))
+	if err != nil {
+		return pathURL
+	}
+	// Resolve against the directory itself, not its parent
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// repairPathURL returns the <pathurl> of file, repairing a file:// URL that
+// isn't escaped, as DaVinci Resolve writes on Windows: backslashes become
+// slashes and spaces and other characters are escaped, keeping any that are
+// escaped already. A repair is recorded as a WarningMalformedPathURL.
+func (d *Decoder) repairPathURL(file *File) string {
+	pathURL := file.PathURL
+	if len(pathURL) < len("file:") || !strings.EqualFold(pathURL[:len("file:")], "file:") {
+		return pathURL
+	}
+	if _, err := url.Parse(pathURL); err == nil && !strings.ContainsAny(pathURL, ` \`) {
+		return pathURL
+	}
+	rest := strings.ReplaceAll(pathURL[len("file:"):], `\`, "/")
+	var host string
+	if strings.HasPrefix(rest, "//") {
+		host, rest, _ = strings.Cut(rest[2:], "/")
+		rest = "/" + rest
+	}
+	path, err := url.PathUnescape(rest)
+	if err != nil {
+		// A % that doesn't start an escape is part of the name
+		path = rest
+	}
+	repaired := (&url.URL{Scheme: "file", Host: host, Path: path}).String()
+	d.warn(Warning{
+		Category: WarningMalformedPathURL,
+		Message:  fmt.Sprintf("file %q has a malformed pathurl %q; it was read as %q", file.Name, pathURL, repaired),
+	})
+	return repaired
+}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"runtime"
+	"testing"
+
+	"github.com/Avalanche-io/gotio"
+	"github.com/Avalanche-io/gotio/opentime"
+)
+
+func TestFileURLFromPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		// Windows paths are converted the same way on every platform
+		{`C:\media\clip.mov`, "file:///C:/media/clip.mov"},
+		{`d:\Footage\Day 1\A001.mov`, "file:///d:/Footage/Day%201/A001.mov"},
+		{`C:/media/clip.mov`, "file:///C:/media/clip.mov"},
+		{`\\server\share\clip.mov`, "file://server/share/clip.mov"},
+	}
+	if runtime.GOOS != "windows" {
+		tests = append(tests, []struct {
+			path     string
+			expected string
+		}{
+			{"/media/clip.mov", "file:///media/clip.mov"},
+			{"/Volumes/Media/Day 1/A001.mov", "file:///Volumes/Media/Day%201/A001.mov"},
+		}...)
+	}
+	for _, test := range tests {
+		if got := FileURLFromPath(test.path); got != test.expected {
+			t.Errorf("%s: Expected %s, got %s", test.path, test.expected, got)
+		}
+	}
+}
+
+func TestPathFromFileURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"file:///C:/media/clip.mov", `C:\media\clip.mov`},
+		{"file:///d:/Footage/Day%201/A001.mov", `d:\Footage\Day 1\A001.mov`},
+		{"file://localhost/C:/media/clip.mov", `C:\media\clip.mov`},
+		{"file://server/share/clip.mov", `\\server\share\clip.mov`},
+		{"file:///media/clip.mov", "/media/clip.mov"},
+		{"file://localhost/Volumes/Media/Day%201/A001.mov", "/Volumes/Media/Day 1/A001.mov"},
+	}
+	for _, test := range tests {
+		got, err := PathFromFileURL(test.url)
+		if err != nil {
+			t.Errorf("%s: %v", test.url, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("%s: Expected %s, got %s", test.url, test.expected, got)
+		}
+		// The path converts back to the URL, less any localhost host. On
+		// Windows, POSIX paths would be given a drive.
+		if runtime.GOOS == "windows" && !isWindowsPath(got) && !isUNCPath(got) {
+			continue
+		}
+		if back, err := PathFromFileURL(FileURLFromPath(got)); err != nil || back != got {
+			t.Errorf("%s: Expected %s to round-trip, got %s (%v)", test.url, got, back, err)
+		}
+	}
+
+	if _, err := PathFromFileURL("https://example.com/clip.mov"); err == nil {
+		t.Error("Expected an error for a URL that isn't a file URL")
+	}
+}
+
+func TestEncoder_WindowsPath(t *testing.T) {
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(24, 24))
+	clip := gotio.NewClip("Clip", gotio.NewExternalReference("clip.mov", `C:\media\clip.mov`, nil, nil), &sourceRange, nil, nil, nil, "", nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	videoTrack.AppendChild(clip)
+	timeline := gotio.NewTimeline("Windows", nil, nil)
+	timeline.Tracks().AppendChild(videoTrack)
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	file := xmeml.Sequence[0].Media.Video.Track[0].ClipItem[0].File
+	if file == nil || file.PathURL != "file:///C:/media/clip.mov" {
+		t.Errorf("Expected pathurl file:///C:/media/clip.mov, got %+v", file)
+	}
+}
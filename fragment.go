@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// EncodeSequenceFragment converts an OTIO Timeline to a standalone FCP7
+// <sequence> element. The fragment has no XML header, DOCTYPE or <xmeml>
+// wrapper, so it can be inserted under an existing <xmeml> element.
+func EncodeSequenceFragment(timeline *gotio.Timeline, opts EncodeOptions) (string, error) {
+	if timeline == nil {
+		return "", fmt.Errorf("timeline cannot be nil")
+	}
+
+	e := &Encoder{opts: opts}
+	xmeml, err := e.convertTimeline(timeline)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert timeline: %w", err)
+	}
+
+	data, err := xml.MarshalIndent(&xmeml.Sequence[0], "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode XML: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// EncodeSequence converts an OTIO Timeline to an FCP7 <sequence> element and
+// writes it to enc, for embedding in a larger document the caller is writing.
+// Nothing else is written: no XML header, DOCTYPE or <xmeml> wrapper. The
+// Encoder's own writer is not used, and enc's indentation settings apply.
+func (e *Encoder) EncodeSequence(enc *xml.Encoder, timeline *gotio.Timeline) error {
+	if timeline == nil {
+		return fmt.Errorf("timeline cannot be nil")
+	}
+
+	xmeml, err := e.convertTimeline(timeline)
+	if err != nil {
+		return fmt.Errorf("failed to convert timeline: %w", err)
+	}
+
+	if err := enc.Encode(&xmeml.Sequence[0]); err != nil {
+		return fmt.Errorf("failed to encode XML: %w", err)
+	}
+	return nil
+}
+
+// DecodeSequenceFragment parses a standalone FCP7 <sequence> element, as
+// produced by EncodeSequenceFragment, and returns an OTIO Timeline.
+func DecodeSequenceFragment(s string, opts DecodeOptions) (*gotio.Timeline, error) {
+	d := NewDecoderWithOptions(strings.NewReader(s), opts)
+
+	decoder := d.xmlDecoder()
+	root, err := readRootElement(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if root.Name.Local != "sequence" {
+		return nil, fmt.Errorf("unexpected root element <%s>, expected <sequence>", root.Name.Local)
+	}
+
+	sequences := make([]Sequence, 1)
+	if err := decoder.DecodeElement(&sequences[0], &root); err != nil {
+		return nil, fmt.Errorf("failed to decode XML: %w", err)
+	}
+
+	if err := checkNesting(&sequences[0], 0, d.maxNestingDepth()); err != nil {
+		return nil, err
+	}
+
+	d.prepare([]*Sequence{&sequences[0]}, 0)
+	return d.convertSequence(&sequences[0], "")
+}
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Avalanche-io/gotio"
+	"github.com/Avalanche-io/gotio/opentime"
+)
+
+func TestSequenceFragmentRoundTrip(t *testing.T) {
+	timeline := gotio.NewTimeline("Fragment", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+
+	sourceRange := opentime.NewTimeRange(
+		opentime.NewRationalTime(12, 24),
+		opentime.NewRationalTime(36, 24),
+	)
+	clip := gotio.NewClip(
+		"Fragment Clip",
+		gotio.NewExternalReference("clip.mov", "file:///media/clip.mov", nil, nil),
+		&sourceRange,
+		nil,
+		nil,
+		nil,
+		"",
+		nil,
+	)
+	videoTrack.AppendChild(clip)
+	timeline.Tracks().AppendChild(videoTrack)
+
+	fragment, err := EncodeSequenceFragment(timeline, EncodeOptions{})
+	if err != nil {
+		t.Fatalf("EncodeSequenceFragment() failed: %v", err)
+	}
+
+	if !strings.HasPrefix(fragment, "<sequence>") {
+		t.Errorf("Expected fragment to start with <sequence>, got: %.40s", fragment)
+	}
+	for _, unwanted := range []string{"<?xml", "<!DOCTYPE", "<xmeml"} {
+		if strings.Contains(fragment, unwanted) {
+			t.Errorf("Fragment should not contain %s", unwanted)
+		}
+	}
+
+	// The fragment decodes on its own
+	decoded, err := DecodeSequenceFragment(fragment, DecodeOptions{})
+	if err != nil {
+		t.Fatalf("DecodeSequenceFragment() failed: %v", err)
+	}
+	if decoded.Name() != "Fragment" {
+		t.Errorf("Expected name 'Fragment', got '%s'", decoded.Name())
+	}
+
+	// And it decodes with the normal Decoder once wrapped in an xmeml document
+	wrapped := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<!DOCTYPE xmeml>\n<xmeml version=\"5\">\n" +
+		fragment + "\n</xmeml>\n"
+	decoded, err = NewDecoder(strings.NewReader(wrapped)).Decode()
+	if err != nil {
+		t.Fatalf("Decode() of wrapped fragment failed: %v", err)
+	}
+
+	videoTracks := decoded.VideoTracks()
+	if len(videoTracks) != 1 || len(videoTracks[0].Children()) != 1 {
+		t.Fatal("Expected 1 video track with 1 clip")
+	}
+	decodedClip := videoTracks[0].Children()[0].(*gotio.Clip)
+	if decodedClip.Name() != "Fragment Clip" {
+		t.Errorf("Expected clip name 'Fragment Clip', got '%s'", decodedClip.Name())
+	}
+	if sr := decodedClip.SourceRange(); sr.StartTime().Value() != 12 || sr.Duration().Value() != 36 {
+		t.Errorf("Expected source range 12+36, got %v+%v", sr.StartTime().Value(), sr.Duration().Value())
+	}
+}
+
+func TestDecodeSequenceFragment_WrongRoot(t *testing.T) {
+	_, err := DecodeSequenceFragment(`<xmeml version="5"><sequence><name>x</name></sequence></xmeml>`, DecodeOptions{})
+	if err == nil {
+		t.Error("Expected error for a fragment that isn't a <sequence>")
+	}
+}
+
+func TestDecodeSequenceFragment_Limits(t *testing.T) {
+	fragment := `<sequence><name>Hostile</name><rate><timebase>24</timebase></rate><media><video><track>` +
+		strings.Repeat(`<clipitem><name>C</name><start>0</start><end>1</end><in>0</in><out>1</out></clipitem>`, 100) +
+		`</track></video></media></sequence>`
+
+	tests := []struct {
+		opts  DecodeOptions
+		limit string
+	}{
+		{DecodeOptions{MaxElements: 20}, "MaxElements"},
+		{DecodeOptions{MaxClipItems: 2}, "MaxClipItems"},
+		{DecodeOptions{MaxFileSizeBytes: 1024}, "MaxFileSizeBytes"},
+	}
+	for _, tt := range tests {
+		_, err := DecodeSequenceFragment(fragment, tt.opts)
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) {
+			t.Errorf("%s: Expected a *LimitError, got %v", tt.limit, err)
+		} else if limitErr.Limit != tt.limit {
+			t.Errorf("Expected limit %s, got %s", tt.limit, limitErr.Limit)
+		}
+	}
+
+	nested := strings.TrimSuffix(strings.TrimPrefix(nestedSequenceXML(3), `<?xml version="1.0" encoding="UTF-8"?><xmeml version="5">`), `</xmeml>`)
+	_, err := DecodeSequenceFragment(nested, DecodeOptions{MaxNestingDepth: 2})
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "MaxNestingDepth" {
+		t.Errorf("Expected a MaxNestingDepth *LimitError, got %v", err)
+	}
+}
+
+func TestEncoder_EncodeSequenceEmbedded(t *testing.T) {
+	timeline := gotio.NewTimeline("Reel 1", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	sourceRange := opentime.NewTimeRange(
+		opentime.NewRationalTime(0, 25),
+		opentime.NewRationalTime(50, 25),
+	)
+	videoTrack.AppendChild(gotio.NewClip(
+		"Opening",
+		gotio.NewExternalReference("opening.mov", "file:///media/opening.mov", nil, nil),
+		&sourceRange,
+		nil,
+		nil,
+		nil,
+		"",
+		nil,
+	))
+	timeline.Tracks().AppendChild(videoTrack)
+
+	// Write the sequence inside a document of the caller's own
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	root := xml.StartElement{Name: xml.Name{Local: "delivery"}}
+	if err := enc.EncodeToken(root); err != nil {
+		t.Fatalf("EncodeToken() failed: %v", err)
+	}
+	if err := enc.EncodeElement("Festival cut", xml.StartElement{Name: xml.Name{Local: "title"}}); err != nil {
+		t.Fatalf("EncodeElement() failed: %v", err)
+	}
+	if err := NewEncoder(nil).EncodeSequence(enc, timeline); err != nil {
+		t.Fatalf("EncodeSequence() failed: %v", err)
+	}
+	if err := enc.EncodeToken(root.End()); err != nil {
+		t.Fatalf("EncodeToken() failed: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush() failed: %v", err)
+	}
+
+	for _, unwanted := range []string{"<?xml", "<!DOCTYPE", "<xmeml"} {
+		if strings.Contains(buf.String(), unwanted) {
+			t.Errorf("Embedded output should not contain %s", unwanted)
+		}
+	}
+
+	var delivery struct {
+		XMLName  xml.Name `xml:"delivery"`
+		Title    string   `xml:"title"`
+		Sequence Sequence `xml:"sequence"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &delivery); err != nil {
+		t.Fatalf("Failed to parse embedding document: %v", err)
+	}
+	if delivery.Title != "Festival cut" {
+		t.Errorf("Expected title 'Festival cut', got '%s'", delivery.Title)
+	}
+	if delivery.Sequence.Name != "Reel 1" {
+		t.Errorf("Expected sequence name 'Reel 1', got '%s'", delivery.Sequence.Name)
+	}
+	clips := delivery.Sequence.Media.Video.Track[0].ClipItem
+	if len(clips) != 1 || clips[0].Name != "Opening" || clips[0].End != 50 {
+		t.Errorf("Expected embedded clip 'Opening' ending at 50, got %+v", clips)
+	}
+}
@@ -0,0 +1,260 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/metrics"
+	"testing"
+	"time"
+
+	"github.com/Avalanche-io/otio-fcp7xml"
+	"github.com/Avalanche-io/otio-fcp7xml/fcp7xmltest"
+)
+
+// benchmarkSpec is a feature-heavy timeline of 800 clips.
+var benchmarkSpec = fcp7xmltest.Spec{
+	Seed:          1,
+	VideoTracks:   4,
+	AudioTracks:   4,
+	ClipsPerTrack: 100,
+	Timebase:      24,
+	NTSC:          true,
+	Transitions:   true,
+	Markers:       true,
+	Retimes:       true,
+}
+
+func BenchmarkDecode(b *testing.B) {
+	data := fcp7xmltest.GenerateXMEML(benchmarkSpec)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := fcp7xml.NewDecoder(bytes.NewReader(data)).Decode(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// largeSpec is a plain timeline of 50,000 clips.
+var largeSpec = fcp7xmltest.Spec{
+	Seed:          1,
+	VideoTracks:   2,
+	AudioTracks:   2,
+	ClipsPerTrack: 12500,
+	Timebase:      24,
+}
+
+// BenchmarkDecodeLarge compares decoding a large sequence with Decode, which
+// streams it, and DecodeAll, which parses the whole document first. Both
+// allocate about as much in total; the peak-heap-MB metric shows the
+// difference in memory held at once, which is clearest with a low GOGC.
+func BenchmarkDecodeLarge(b *testing.B) {
+	data := fcp7xmltest.GenerateXMEML(largeSpec)
+	for _, streaming := range []bool{false, true} {
+		b.Run(fmt.Sprintf("Streaming=%v", streaming), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			var peak uint64
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+				stop := sampleHeap(&peak)
+				decoder := fcp7xml.NewDecoder(bytes.NewReader(data))
+				var err error
+				if streaming {
+					_, err = decoder.Decode()
+				} else {
+					_, err = decoder.DecodeAll()
+				}
+				stop()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(peak)/1e6, "peak-heap-MB")
+		})
+	}
+}
+
+// sampleHeap records the largest heap seen in peak until the returned
+// function is called.
+func sampleHeap(peak *uint64) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			metrics.Read(sample)
+			if v := sample[0].Value.Uint64(); v > *peak {
+				*peak = v
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	timeline := fcp7xmltest.GenerateTimeline(benchmarkSpec)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := fcp7xml.NewEncoder(io.Discard).Encode(timeline); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecodeContext_Cancel(t *testing.T) {
+	data := fcp7xmltest.GenerateXMEML(fcp7xmltest.Spec{
+		Seed:          1,
+		VideoTracks:   2,
+		AudioTracks:   2,
+		ClipsPerTrack: 5000,
+	})
+
+	for _, streaming := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		var cancelled time.Time
+		timer := time.AfterFunc(20*time.Millisecond, func() {
+			cancelled = time.Now()
+			cancel()
+		})
+		decoder := fcp7xml.NewDecoder(bytes.NewReader(data))
+		var err error
+		if streaming {
+			_, err = decoder.DecodeContext(ctx)
+		} else {
+			_, err = decoder.DecodeAllContext(ctx)
+		}
+		returned := time.Now()
+		timer.Stop()
+		cancel()
+
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Streaming=%v: Expected context.Canceled, got %v", streaming, err)
+		}
+		if wait := returned.Sub(cancelled); wait > time.Second {
+			t.Errorf("Streaming=%v: Expected DecodeContext to return promptly after cancellation, took %v", streaming, wait)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := fcp7xml.NewDecoder(bytes.NewReader(data)).DecodeAllContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected DecodeAllContext to fail with context.Canceled, got %v", err)
+	}
+}
+
+func TestDecodeProgress(t *testing.T) {
+	data := fcp7xmltest.GenerateXMEML(fcp7xmltest.Spec{
+		Seed:          1,
+		VideoTracks:   2,
+		AudioTracks:   1,
+		ClipsPerTrack: 250,
+		Transitions:   true,
+	})
+
+	for _, streaming := range []bool{false, true} {
+		type call struct {
+			stage       string
+			done, total int
+		}
+		var calls []call
+		opts := fcp7xml.DecodeOptions{
+			Progress: func(stage string, done, total int) {
+				calls = append(calls, call{stage, done, total})
+			},
+		}
+		decoder := fcp7xml.NewDecoderWithOptions(bytes.NewReader(data), opts)
+		var err error
+		if streaming {
+			_, err = decoder.Decode()
+		} else {
+			_, err = decoder.DecodeAll()
+		}
+		if err != nil {
+			t.Fatalf("Streaming=%v: Decode failed: %v", streaming, err)
+		}
+
+		// Items count up within each track, tracks within the sequence
+		items, tracks := 0, 0
+		itemCalls := 0
+		for _, c := range calls {
+			if c.total > 0 && c.done > c.total {
+				t.Errorf("Streaming=%v: %s done %d exceeds total %d", streaming, c.stage, c.done, c.total)
+			}
+			switch c.stage {
+			case fcp7xml.ProgressItems:
+				if c.done <= items {
+					t.Errorf("Streaming=%v: Expected item progress to increase past %d, got %d", streaming, items, c.done)
+				}
+				items = c.done
+				itemCalls++
+			case fcp7xml.ProgressTracks:
+				if c.done != tracks+1 {
+					t.Errorf("Streaming=%v: Expected track %d to be reported, got %d", streaming, tracks+1, c.done)
+				}
+				if items == 0 {
+					t.Errorf("Streaming=%v: Expected item progress before track %d was reported", streaming, c.done)
+				}
+				tracks, items = c.done, 0
+			}
+		}
+		if tracks != 3 {
+			t.Errorf("Streaming=%v: Expected 3 tracks to be reported, got %d", streaming, tracks)
+		}
+		if itemCalls < 6 {
+			t.Errorf("Streaming=%v: Expected item progress every %d items, got %d calls", streaming, 100, itemCalls)
+		}
+		if last := calls[len(calls)-1]; last != (call{fcp7xml.ProgressSequences, 1, 1}) {
+			t.Errorf("Streaming=%v: Expected the last call to report the sequence done, got %+v", streaming, last)
+		}
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	for seed := int64(0); seed < 4; seed++ {
+		f.Add(fcp7xmltest.GenerateXMEML(fcp7xmltest.Spec{
+			Seed:        seed,
+			AudioTracks: 1,
+			Timebase:    []int{24, 25, 30, 60}[seed],
+			NTSC:        seed%2 == 0,
+			Transitions: true,
+			Markers:     true,
+			Retimes:     true,
+		}))
+	}
+
+	f.Add([]byte(`<xmeml version="5"><sequence><rate><timebase>24</timebase></rate><media><video><track>` +
+		`<clipitem><sequence id="s1"/></clipitem><clipitem><sequence><media><video><track>` +
+		`<clipitem><sequence id="s1"/></clipitem></track></video></media></sequence></clipitem>` +
+		`</track></video></media></sequence></xmeml>`))
+
+	limited := fcp7xml.DecodeOptions{
+		ExpandNestedSequences: true,
+		MaxElements:           10000,
+		MaxNestingDepth:       8,
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Malformed input may fail to decode but must not panic
+		fcp7xml.NewDecoder(bytes.NewReader(data)).Decode()
+		fcp7xml.NewDecoderWithOptions(bytes.NewReader(data), limited).Decode()
+		fcp7xml.NewDecoderWithOptions(bytes.NewReader(data), limited).DecodeAll()
+	})
+}
@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"maps"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// generatorParameters returns the parameters of a generator's effect, such as
+// the color of a color matte or the text of a title, for its
+// GeneratorReference. They are keyed by parameterid, or by name if a
+// parameter has none. Numbers become float64, structured values such as
+// colors an AnyDictionary of their components, and other values strings.
+// Keyframed parameters are left out. It returns nil if there are none.
+func generatorParameters(effect *Effect) gotio.AnyDictionary {
+	if effect == nil {
+		return nil
+	}
+	parameters := make(gotio.AnyDictionary)
+	for _, p := range effect.Parameter {
+		key := generatorParameterKey(&p)
+		if key == "" || len(p.Keyframe) > 0 {
+			continue
+		}
+		if components := parseValueComponents(p.ValueXML); len(components) > 0 {
+			value := make(gotio.AnyDictionary, len(components))
+			for name, v := range components {
+				value[name] = v
+			}
+			parameters[key] = value
+		} else if v, err := strconv.ParseFloat(strings.TrimSpace(p.Value), 64); err == nil {
+			parameters[key] = v
+		} else if p.ValueXML == "" && p.Value != "" {
+			parameters[key] = p.Value
+		}
+	}
+	if len(parameters) == 0 {
+		return nil
+	}
+	return parameters
+}
+
+// generatorParameterKey returns the key of a generator parameter in
+// GeneratorReference parameters.
+func generatorParameterKey(p *Parameter) string {
+	if p.ParameterID != "" {
+		return p.ParameterID
+	}
+	return p.Name
+}
+
+// applyGeneratorParameters writes the parameters of a GeneratorReference
+// back to the generator's effect, adding those it doesn't have, in key
+// order. Parameters whose value is unchanged are left as they were, so an
+// unedited generator is re-emitted verbatim.
+func applyGeneratorParameters(effect *Effect, parameters gotio.AnyDictionary) {
+	keys := make([]string, 0, len(parameters))
+	for key := range parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var p *Parameter
+		for i := range effect.Parameter {
+			if generatorParameterKey(&effect.Parameter[i]) == key {
+				p = &effect.Parameter[i]
+				break
+			}
+		}
+		if p == nil {
+			effect.Parameter = append(effect.Parameter, Parameter{ParameterID: key, Name: key})
+			p = &effect.Parameter[len(effect.Parameter)-1]
+		}
+		value := parameters[key]
+		if dict, ok := metadataDict(value); ok {
+			value = dict
+		}
+		if number, ok := metadataFloat(value); ok {
+			value = number
+		}
+		switch value := value.(type) {
+		case float64:
+			setFloatParameter(p, value)
+		case string:
+			if p.Value != value || p.ValueXML != "" {
+				p.Value, p.ValueXML = value, ""
+			}
+		case gotio.AnyDictionary:
+			components := make(map[string]float64, len(value))
+			for name, v := range value {
+				if v, ok := metadataFloat(v); ok {
+					components[name] = v
+				}
+			}
+			if !maps.Equal(parseValueComponents(p.ValueXML), components) {
+				p.Value = ""
+				p.ValueXML = formatValueComponents(components)
+			}
+		}
+	}
+}
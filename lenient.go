@@ -0,0 +1,260 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// DecodeLenient parses FCP7 XML that may be malformed or truncated, such as
+// a crash-recovered project or a hand-edited file. It reads the document
+// token by token, stops at the first syntax error, and skips any clipitem,
+// transitionitem, generatoritem or other element that is incomplete or fails
+// to parse.
+//
+// The returned Timeline holds whatever could be recovered from the first
+// sequence and may be partial; each entry of the returned []error describes
+// something that was skipped. An error is returned only when no sequence
+// could be recovered at all, the document's xmeml version is unsupported, or
+// the document exceeds one of the limits in DecodeOptions.
+func (d *Decoder) DecodeLenient() (*gotio.Timeline, []error, error) {
+	decoder := d.xmlDecoder()
+	decoder.Strict = false
+
+	root, err := readRootElement(decoder)
+	if err != nil {
+		return nil, nil, err
+	}
+	version, err := xmemlVersion(root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var problems []error
+	rootNode, err := readNode(decoder, root, 0)
+	if errors.Is(err, ErrLimitExceeded) {
+		return nil, problems, err
+	}
+	if err != nil {
+		line, _ := decoder.InputPos()
+		problems = append(problems, fmt.Errorf("stopped reading at line %d, content after it is lost: %w", line, err))
+	}
+
+	var sequenceNodes []*xmlNode
+	if root.Name.Local == "sequence" {
+		sequenceNodes = append(sequenceNodes, rootNode)
+	} else {
+		for _, child := range rootNode.elements() {
+			if child.start.Name.Local == "sequence" {
+				sequenceNodes = append(sequenceNodes, child)
+			}
+		}
+	}
+
+	var sequences []*Sequence
+	for i, node := range sequenceNodes {
+		problems = append(problems, node.prune(fmt.Sprintf("sequence %d", i))...)
+
+		seq := &Sequence{}
+		if err := node.unmarshal(seq); err != nil {
+			problems = append(problems, fmt.Errorf("skipped sequence %d: %w", i, err))
+			continue
+		}
+		if err := checkNesting(seq, 0, d.maxNestingDepth()); err != nil {
+			return nil, problems, err
+		}
+		sequences = append(sequences, seq)
+	}
+
+	if len(sequences) == 0 {
+		return nil, problems, fmt.Errorf("no sequence could be recovered from FCP7 XML")
+	}
+
+	d.prepare(sequences, version)
+	timeline, err := d.convertSequence(sequences[0], "")
+	if err != nil {
+		return nil, problems, err
+	}
+	return timeline, problems, nil
+}
+
+// xmlNode is an element read by DecodeLenient, kept as tokens so that broken
+// subtrees can be dropped before unmarshaling.
+type xmlNode struct {
+	start xml.StartElement
+	// children holds xml.CharData and *xmlNode values in document order
+	children []interface{}
+	// complete is set once the element's end tag has been read
+	complete bool
+}
+
+// readNode reads the content of the element opened by start, which is depth
+// levels below the root. When the token stream breaks, it returns the error
+// along with everything read so far; elements left open are marked
+// incomplete.
+func readNode(decoder *xml.Decoder, start xml.StartElement, depth int) (*xmlNode, error) {
+	node := &xmlNode{start: start.Copy()}
+	if depth > maxElementDepth {
+		return node, &LimitError{Limit: "MaxElementDepth", Max: maxElementDepth}
+	}
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return node, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child, err := readNode(decoder, t, depth+1)
+			node.children = append(node.children, child)
+			if err != nil {
+				return node, err
+			}
+		case xml.EndElement:
+			node.complete = true
+			return node, nil
+		case xml.CharData:
+			node.children = append(node.children, t.Copy())
+		}
+	}
+}
+
+// elements returns the child elements of n.
+func (n *xmlNode) elements() []*xmlNode {
+	var elements []*xmlNode
+	for _, child := range n.children {
+		if element, ok := child.(*xmlNode); ok {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+// childText returns the character data of the first child element named name.
+func (n *xmlNode) childText(name string) string {
+	for _, child := range n.elements() {
+		if child.start.Name.Local != name {
+			continue
+		}
+		var text strings.Builder
+		for _, c := range child.children {
+			if data, ok := c.(xml.CharData); ok {
+				text.Write(data)
+			}
+		}
+		return strings.TrimSpace(text.String())
+	}
+	return ""
+}
+
+// lenientContainers are the elements between a sequence and its track items.
+// They are kept even when truncated, so that their complete children survive.
+var lenientContainers = map[string]bool{
+	"media": true,
+	"video": true,
+	"audio": true,
+	"track": true,
+}
+
+// lenientItems are the track items that are checked individually, so that
+// one broken clip doesn't take its whole track with it.
+var lenientItems = map[string]func() interface{}{
+	"clipitem":       func() interface{} { return &ClipItem{} },
+	"transitionitem": func() interface{} { return &TransitionItem{} },
+	"generatoritem":  func() interface{} { return &GeneratorItem{} },
+}
+
+// prune removes the children of n that are incomplete or fail to unmarshal,
+// returning an error describing each one. location names n in those errors.
+func (n *xmlNode) prune(location string) []error {
+	var problems []error
+	var kept []interface{}
+	trackIndex := 0
+
+	for _, child := range n.children {
+		element, ok := child.(*xmlNode)
+		if !ok {
+			kept = append(kept, child)
+			continue
+		}
+
+		name := element.start.Name.Local
+		switch {
+		case lenientContainers[name]:
+			childLocation := location
+			switch name {
+			case "video", "audio":
+				childLocation += " " + name
+			case "track":
+				childLocation = fmt.Sprintf("%s track %d", location, trackIndex)
+				trackIndex++
+			}
+			problems = append(problems, element.prune(childLocation)...)
+
+		case !element.complete:
+			problems = append(problems, fmt.Errorf("%s: skipped incomplete %s", location, element.describe()))
+			continue
+
+		case lenientItems[name] != nil:
+			if err := element.unmarshal(lenientItems[name]()); err != nil {
+				problems = append(problems, fmt.Errorf("%s: skipped %s: %w", location, element.describe(), err))
+				continue
+			}
+		}
+		kept = append(kept, element)
+	}
+
+	n.children = kept
+	return problems
+}
+
+// describe names an element for error messages, e.g. `<clipitem> "Main Clip"`.
+func (n *xmlNode) describe() string {
+	if name := n.childText("name"); name != "" {
+		return fmt.Sprintf("<%s> %q", n.start.Name.Local, name)
+	}
+	return fmt.Sprintf("<%s>", n.start.Name.Local)
+}
+
+// unmarshal re-encodes n and decodes it into v.
+func (n *xmlNode) unmarshal(v interface{}) error {
+	var buf bytes.Buffer
+	encoder := xml.NewEncoder(&buf)
+	if err := n.encode(encoder); err != nil {
+		return err
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+	return xml.Unmarshal(buf.Bytes(), v)
+}
+
+// encode writes n and its children as tokens.
+func (n *xmlNode) encode(encoder *xml.Encoder) error {
+	start := xml.StartElement{Name: xml.Name{Local: n.start.Name.Local}}
+	for _, attr := range n.start.Attr {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: attr.Name.Local}, Value: attr.Value})
+	}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, child := range n.children {
+		switch c := child.(type) {
+		case xml.CharData:
+			if err := encoder.EncodeToken(c); err != nil {
+				return err
+			}
+		case *xmlNode:
+			if err := c.encode(encoder); err != nil {
+				return err
+			}
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDecoder_DecodeLenientTruncated(t *testing.T) {
+	data, err := os.ReadFile("testdata/truncated.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	if _, err := NewDecoder(bytes.NewReader(data)).Decode(); err == nil {
+		t.Fatal("Expected Decode() to fail on truncated input")
+	}
+
+	timeline, problems, err := NewDecoder(bytes.NewReader(data)).DecodeLenient()
+	if err != nil {
+		t.Fatalf("DecodeLenient() failed: %v", err)
+	}
+
+	if timeline.Name() != "Sample Sequence" {
+		t.Errorf("Expected timeline name 'Sample Sequence', got '%s'", timeline.Name())
+	}
+
+	videoTracks := timeline.VideoTracks()
+	if len(videoTracks) != 1 {
+		t.Fatalf("Expected 1 video track, got %d", len(videoTracks))
+	}
+	children := videoTracks[0].Children()
+	if len(children) != 1 {
+		t.Fatalf("Expected 1 recovered clip, got %d", len(children))
+	}
+	if children[0].Name() != "Intro Clip" {
+		t.Errorf("Expected recovered clip 'Intro Clip', got '%s'", children[0].Name())
+	}
+
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %d: %v", len(problems), problems)
+	}
+	if !strings.Contains(problems[0].Error(), "stopped reading at line 56") {
+		t.Errorf("Expected first problem to report where reading stopped, got: %v", problems[0])
+	}
+	if !strings.Contains(problems[1].Error(), `video track 0: skipped incomplete <clipitem> "Main Clip"`) {
+		t.Errorf("Expected second problem to name the skipped clip, got: %v", problems[1])
+	}
+}
+
+func TestDecoder_DecodeLenientSkipsBrokenClip(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence>
+    <name>Hand Edited</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>false</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem>
+            <name>Good</name>
+            <rate>
+              <timebase>24</timebase>
+            </rate>
+            <start>0</start>
+            <end>10</end>
+            <in>0</in>
+            <out>10</out>
+          </clipitem>
+          <clipitem>
+            <name>Bad</name>
+            <start>ten</start>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>
+<<garbage`
+
+	timeline, problems, err := NewDecoder(strings.NewReader(xmlData)).DecodeLenient()
+	if err != nil {
+		t.Fatalf("DecodeLenient() failed: %v", err)
+	}
+
+	children := timeline.VideoTracks()[0].Children()
+	if len(children) != 1 || children[0].Name() != "Good" {
+		t.Errorf("Expected only clip 'Good' to be recovered, got %d children", len(children))
+	}
+
+	// Stray bytes after the root element are never read
+	if len(problems) != 1 {
+		t.Fatalf("Expected 1 problem, got %d: %v", len(problems), problems)
+	}
+	if !strings.Contains(problems[0].Error(), `sequence 0 video track 0: skipped <clipitem> "Bad"`) {
+		t.Errorf("Expected problem naming clip 'Bad', got: %v", problems[0])
+	}
+}
+
+func TestDecoder_DecodeLenientWellFormed(t *testing.T) {
+	data, err := os.ReadFile("testdata/sample.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	timeline, problems, err := NewDecoder(bytes.NewReader(data)).DecodeLenient()
+	if err != nil {
+		t.Fatalf("DecodeLenient() failed: %v", err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+	if len(timeline.VideoTracks()[0].Children()) != 2 {
+		t.Errorf("Expected 2 video clips, got %d", len(timeline.VideoTracks()[0].Children()))
+	}
+	if len(timeline.AudioTracks()) != 1 {
+		t.Errorf("Expected 1 audio track, got %d", len(timeline.AudioTracks()))
+	}
+}
+
+func TestDecoder_DecodeLenientNothingRecovered(t *testing.T) {
+	_, _, err := NewDecoder(strings.NewReader(`<xmeml version="5"><seq`)).DecodeLenient()
+	if err == nil {
+		t.Error("Expected an error when no sequence can be recovered")
+	}
+}
+
+func TestDecoder_DecodeLenientLimits(t *testing.T) {
+	data, err := os.ReadFile("testdata/features_test.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	deep := `<xmeml version="5"><sequence><name>Deep</name>` + strings.Repeat(`<a>`, maxElementDepth+1)
+
+	tests := []struct {
+		document string
+		opts     DecodeOptions
+		limit    string
+	}{
+		{string(data), DecodeOptions{MaxElements: 20}, "MaxElements"},
+		{string(data), DecodeOptions{MaxClipItems: 2}, "MaxClipItems"},
+		{string(data), DecodeOptions{MaxFileSizeBytes: 1024}, "MaxFileSizeBytes"},
+		{nestedSequenceXML(3), DecodeOptions{MaxNestingDepth: 2}, "MaxNestingDepth"},
+		{deep, DecodeOptions{}, "MaxElementDepth"},
+	}
+	for _, tt := range tests {
+		_, _, err := NewDecoderWithOptions(strings.NewReader(tt.document), tt.opts).DecodeLenient()
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) {
+			t.Errorf("%s: Expected a *LimitError, got %v", tt.limit, err)
+		} else if limitErr.Limit != tt.limit {
+			t.Errorf("Expected limit %s, got %s", tt.limit, limitErr.Limit)
+		}
+	}
+}
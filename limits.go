@@ -0,0 +1,211 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrLimitExceeded is returned, wrapped in a *LimitError, when a document
+// exceeds one of the limits in DecodeOptions.
+var ErrLimitExceeded = errors.New("decode limit exceeded")
+
+// LimitError reports which decode limit a document exceeded. It matches
+// ErrLimitExceeded with errors.Is.
+type LimitError struct {
+	// Limit is the name of the DecodeOptions field, such as "MaxClipItems",
+	// or "MaxElementDepth" for the fixed maxElementDepth.
+	Limit string
+	// Max is the effective value of the limit.
+	Max int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v: %s of %d exceeded", ErrLimitExceeded, e.Limit, e.Max)
+}
+
+// Is reports whether target is ErrLimitExceeded.
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// Default decode limits; see DecodeOptions.
+const (
+	DefaultMaxElements      = 20_000_000
+	DefaultMaxNestingDepth  = 64
+	DefaultMaxClipItems     = 1_000_000
+	DefaultMaxSequences     = 10_000
+	DefaultMaxFileSizeBytes = 1 << 30
+)
+
+// maxElementDepth is how deeply XML elements may nest. It isn't a
+// DecodeOptions field, as encoding/xml refuses to unmarshal anything deeper
+// anyway; DecodeLenient, which reads elements itself, enforces it.
+const maxElementDepth = 10000
+
+// limit returns the effective value of a limit option: the default for 0,
+// or 0 (no limit) for a negative value.
+func limit[T int | int64](value, defaultValue T) T {
+	switch {
+	case value == 0:
+		return defaultValue
+	case value < 0:
+		return 0
+	}
+	return value
+}
+
+// maxNestingDepth returns the decoder's effective MaxNestingDepth.
+func (d *Decoder) maxNestingDepth() int {
+	return limit(d.opts.MaxNestingDepth, DefaultMaxNestingDepth)
+}
+
+// readLimits are the limits enforced while reading a document; 0 means no
+// limit.
+type readLimits struct {
+	elements  int
+	clipItems int
+	sequences int
+	bytes     int64
+}
+
+// limitedReader counts the bytes and start tags read through it, and fails
+// with a *LimitError once there are more than its limits allow. Any '<'
+// followed by a letter, '_' or ':' counts as an element, so markup inside
+// comments and CDATA sections counts too. The input is read through an
+// io.LimitedReader, so no more than one byte past the size limit is ever
+// read.
+type limitedReader struct {
+	r      io.Reader
+	limits readLimits
+
+	bytes     int64
+	elements  int
+	clipItems int
+	sequences int
+	// inName is set while reading the name of a start tag into name, which
+	// holds at most maxTagName bytes.
+	inName bool
+	name   []byte
+}
+
+// maxTagName is the length of the longest tag name limitedReader counts
+// separately.
+const maxTagName = len("clipitem")
+
+// newLimitedReader returns r with the given limits, or r itself if there
+// are none.
+func newLimitedReader(r io.Reader, limits readLimits) io.Reader {
+	if limits == (readLimits{}) {
+		return r
+	}
+	if limits.bytes > 0 {
+		r = &io.LimitedReader{R: r, N: limits.bytes + 1}
+	}
+	return &limitedReader{r: r, limits: limits, name: make([]byte, 0, maxTagName)}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.bytes += int64(n)
+	for _, b := range p[:n] {
+		if l.inName {
+			if b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b == '_' || b == ':' || b >= 0x80 ||
+				len(l.name) > 0 && (b >= '0' && b <= '9' || b == '-' || b == '.') {
+				if len(l.name) == 0 {
+					l.elements++
+				}
+				if len(l.name) < cap(l.name) {
+					l.name = append(l.name, b)
+				} else {
+					// Too long to be a name that's counted separately.
+					l.name = append(l.name[:0], '-')
+				}
+				continue
+			}
+			l.countName()
+		}
+		l.inName = b == '<'
+		l.name = l.name[:0]
+	}
+	if n == 0 && l.inName {
+		l.countName()
+	}
+	if lerr := l.check(); lerr != nil {
+		return 0, lerr
+	}
+	return n, err
+}
+
+// countName counts the start tag whose name has just been read.
+func (l *limitedReader) countName() {
+	switch string(l.name) {
+	case "clipitem":
+		l.clipItems++
+	case "sequence":
+		l.sequences++
+	}
+	l.inName = false
+}
+
+// check returns a *LimitError for the first limit exceeded, if any.
+func (l *limitedReader) check() error {
+	switch {
+	case l.limits.bytes > 0 && l.bytes > l.limits.bytes:
+		return &LimitError{Limit: "MaxFileSizeBytes", Max: l.limits.bytes}
+	case l.limits.elements > 0 && l.elements > l.limits.elements:
+		return &LimitError{Limit: "MaxElements", Max: int64(l.limits.elements)}
+	case l.limits.clipItems > 0 && l.clipItems > l.limits.clipItems:
+		return &LimitError{Limit: "MaxClipItems", Max: int64(l.limits.clipItems)}
+	case l.limits.sequences > 0 && l.sequences > l.limits.sequences:
+		return &LimitError{Limit: "MaxSequences", Max: int64(l.limits.sequences)}
+	}
+	return nil
+}
+
+// checkNesting returns a *LimitError if sequences are nested inside the
+// clipitems of seq, which is depth levels deep, more than max levels deep. A
+// max of 0 means no limit.
+func checkNesting(seq *Sequence, depth, max int) error {
+	for _, t := range classifyTracks(seq) {
+		if err := checkTrackNesting(t.track, depth, max); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkTrackNesting is checkNesting for the clipitems of a track.
+func checkTrackNesting(track *Track, depth, max int) error {
+	if max == 0 {
+		return nil
+	}
+	for i := range track.ClipItem {
+		nested := track.ClipItem[i].Sequence
+		if nested == nil {
+			continue
+		}
+		if depth+1 > max {
+			return &LimitError{Limit: "MaxNestingDepth", Max: int64(max)}
+		}
+		if err := checkNesting(nested, depth+1, max); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// xmlDecoder returns an xml.Decoder for the decoder's input, limited by the
+// decoder's options.
+func (d *Decoder) xmlDecoder() *xml.Decoder {
+	return newXMLDecoder(newLimitedReader(d.reader(), readLimits{
+		elements:  limit(d.opts.MaxElements, DefaultMaxElements),
+		clipItems: limit(d.opts.MaxClipItems, DefaultMaxClipItems),
+		sequences: limit(d.opts.MaxSequences, DefaultMaxSequences),
+		bytes:     limit(d.opts.MaxFileSizeBytes, DefaultMaxFileSizeBytes),
+	}), d.opts)
+}
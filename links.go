@@ -0,0 +1,275 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// linkGroups returns the link group of every clipitem in items, the
+// clipitems of a sequence in track order, that is linked to another:
+// clipitems connected by <link> elements, directly or through each other,
+// form a group named after its first clipitem's id. Links to ids that aren't
+// in the sequence are ignored.
+func linkGroups(items []*ClipItem) map[string]string {
+	var ids []string
+	parent := make(map[string]string)
+	for _, item := range items {
+		if item.ID != "" {
+			if _, ok := parent[item.ID]; !ok {
+				ids = append(ids, item.ID)
+				parent[item.ID] = item.ID
+			}
+		}
+	}
+
+	var find func(id string) string
+	find = func(id string) string {
+		if parent[id] != id {
+			parent[id] = find(parent[id])
+		}
+		return parent[id]
+	}
+	for _, item := range items {
+		if item.ID == "" {
+			continue
+		}
+		for _, link := range item.Link {
+			if _, ok := parent[link.LinkClipRef]; !ok {
+				continue
+			}
+			// The root of a group is always its first member
+			a, b := find(item.ID), find(link.LinkClipRef)
+			for _, id := range ids {
+				if id == a || id == b {
+					parent[a], parent[b] = id, id
+					break
+				}
+			}
+		}
+	}
+
+	sizes := make(map[string]int)
+	for _, id := range ids {
+		sizes[find(id)]++
+	}
+	groups := make(map[string]string)
+	for _, id := range ids {
+		if root := find(id); sizes[root] > 1 {
+			groups[id] = root
+		}
+	}
+	return groups
+}
+
+// trackClipItems returns the clipitems on tracks, in order.
+func trackClipItems(tracks []sequenceTrack) []*ClipItem {
+	var items []*ClipItem
+	for _, t := range tracks {
+		for i := range t.track.ClipItem {
+			items = append(items, &t.track.ClipItem[i])
+		}
+	}
+	return items
+}
+
+// findStereoPairs finds the stereo pairs among the clipitems of a sequence's
+// audio tracks: two linked clipitems on different tracks that use the same
+// file over the same frames, one for source track 1 and one for source
+// track 2. It returns the clipitems for channel 1, which stand for the pair,
+// and those for channel 2, which are merged into them.
+func findStereoPairs(audioTracks []*Track, groups map[string]string) (stereo, merged map[*ClipItem]bool) {
+	stereo = make(map[*ClipItem]bool)
+	merged = make(map[*ClipItem]bool)
+
+	for i, track := range audioTracks {
+		for j := range track.ClipItem {
+			left := &track.ClipItem[j]
+			if !isSourceChannel(left, 1) || groups[left.ID] == "" {
+				continue
+			}
+		search:
+			for k, other := range audioTracks {
+				if k == i {
+					continue
+				}
+				for l := range other.ClipItem {
+					right := &other.ClipItem[l]
+					if !merged[right] && isStereoPair(left, right, groups) {
+						stereo[left] = true
+						merged[right] = true
+						break search
+					}
+				}
+			}
+		}
+	}
+	return stereo, merged
+}
+
+// isSourceChannel reports whether item uses channel (source track) n of its
+// file's audio.
+func isSourceChannel(item *ClipItem, n int) bool {
+	return item.SourceTrack != nil && item.SourceTrack.TrackIndex == n &&
+		strings.EqualFold(item.SourceTrack.MediaType, "audio")
+}
+
+// isStereoPair reports whether right is the second channel of left.
+func isStereoPair(left, right *ClipItem, groups map[string]string) bool {
+	if !isSourceChannel(right, 2) || groups[right.ID] != groups[left.ID] {
+		return false
+	}
+	if left.Start != right.Start || left.End != right.End || left.In != right.In || left.Out != right.Out {
+		return false
+	}
+	if left.File == nil || right.File == nil {
+		return left.File == right.File
+	}
+	return left.File.ID == right.File.ID
+}
+
+// mayHoldStereo reports whether track has a clipitem for source track 1 or
+// 2, which may be half of a stereo pair.
+func mayHoldStereo(track *Track) bool {
+	for i := range track.ClipItem {
+		item := &track.ClipItem[i]
+		if isSourceChannel(item, 1) || isSourceChannel(item, 2) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasOnlyMergedItems reports whether every item on track is a clipitem merged
+// into a stereo pair on another track.
+func hasOnlyMergedItems(track *Track, merged map[*ClipItem]bool) bool {
+	if len(track.ClipItem) == 0 || len(track.TransitionItem) > 0 || len(track.GeneratorItem) > 0 {
+		return false
+	}
+	for i := range track.ClipItem {
+		if !merged[&track.ClipItem[i]] {
+			return false
+		}
+	}
+	return true
+}
+
+// registerLinks records the link group of a clipitem, and whether it is
+// stereo, from the metadata written by the decoder. Clipitems in a group
+// are given an id if they have none, so that links can refer to them.
+func (e *Encoder) registerLinks(metadata gotio.AnyDictionary, clipItem *ClipItem) {
+	group, _ := metadata["fcp7xml_link_group"].(string)
+	channels, _ := metadataInt(metadata["fcp7xml_audio_channels"])
+	if group == "" && channels != 2 {
+		return
+	}
+	if clipItem.ID == "" {
+		clipItem.ID = e.newClipItemID()
+	}
+	if group == "" {
+		group = clipItem.ID
+	}
+	e.linkGroups[clipItem.ID] = group
+	if channels == 2 {
+		e.stereoItems[clipItem.ID] = true
+	}
+}
+
+// newClipItemID returns a clipitem id that isn't used in the sequence yet.
+func (e *Encoder) newClipItemID() string {
+	for {
+		e.generatedIDs++
+		id := fmt.Sprintf("clipitem-%d", e.generatedIDs)
+		if !e.clipItemIDs[id] {
+			e.clipItemIDs[id] = true
+			return id
+		}
+	}
+}
+
+// splitStereo writes each stereo clipitem on track as two mono clipitems, as
+// FCP7 does: the clipitem on track takes channel 1, and a copy on the
+// returned track, which follows it, takes channel 2. Both are in the same
+// link group. It returns nil if track has no stereo clipitems.
+func (e *Encoder) splitStereo(track *Track) *Track {
+	var right *Track
+	for i := range track.ClipItem {
+		left := &track.ClipItem[i]
+		if !e.stereoItems[left.ID] {
+			continue
+		}
+		if right == nil {
+			right = &Track{
+				Enabled:        track.Enabled,
+				Locked:         track.Locked,
+				ClipItem:       make([]ClipItem, 0),
+				TransitionItem: make([]TransitionItem, 0),
+				GeneratorItem:  make([]GeneratorItem, 0),
+			}
+		}
+
+		left.SourceTrack = &SourceTrack{MediaType: "audio", TrackIndex: 1}
+		channel2 := *left
+		channel2.ID = e.newClipItemID()
+		channel2.SourceTrack = &SourceTrack{MediaType: "audio", TrackIndex: 2}
+		channel2.Marker = nil
+		if left.File != nil && left.File.ID != "" {
+			channel2.File = &File{ID: left.File.ID}
+		}
+		e.linkGroups[channel2.ID] = e.linkGroups[left.ID]
+		right.ClipItem = append(right.ClipItem, channel2)
+	}
+	return right
+}
+
+// linkClipItems writes the <link> elements of every clipitem in seq that is
+// in a link group with other clipitems: each links to every member of its
+// group, itself included, video before audio.
+func (e *Encoder) linkClipItems(seq *Sequence) {
+	type member struct {
+		item       *ClipItem
+		mediaType  string
+		trackIndex int
+	}
+	var order []string
+	groups := make(map[string][]member)
+	add := func(tracks []Track, mediaType string) {
+		for i := range tracks {
+			for j := range tracks[i].ClipItem {
+				item := &tracks[i].ClipItem[j]
+				group, ok := e.linkGroups[item.ID]
+				if !ok || item.ID == "" {
+					continue
+				}
+				if _, seen := groups[group]; !seen {
+					order = append(order, group)
+				}
+				groups[group] = append(groups[group], member{item, mediaType, i + 1})
+			}
+		}
+	}
+	if seq.Media.Video != nil {
+		add(seq.Media.Video.Track, "video")
+	}
+	if seq.Media.Audio != nil {
+		add(seq.Media.Audio.Track, "audio")
+	}
+
+	for _, group := range order {
+		members := groups[group]
+		if len(members) < 2 {
+			continue
+		}
+		links := make([]Link, len(members))
+		for i, m := range members {
+			links[i] = Link{LinkClipRef: m.item.ID, MediaType: m.mediaType, TrackIndex: m.trackIndex}
+		}
+		for _, m := range members {
+			m.item.Link = links
+		}
+	}
+}
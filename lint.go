@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import "slices"
+
+// Lint inspects a parsed FCP7 document without converting it and returns the
+// problems the Decoder would report as warnings. File references are
+// resolved as the Decoder resolves them, on copies of the clipitems, so the
+// document is left as it is.
+func Lint(xmeml *XMEML) []Warning {
+	var warnings []Warning
+	// An unsupported version is an error for the Decoder, not a warning
+	version, _ := parseVersion(xmeml.Version)
+	sequences := collectSequences(xmeml)
+	d := &Decoder{files: make(map[string]*File)}
+	for _, s := range sequences {
+		forEachClipItem(s.sequence, d.indexFile)
+	}
+	for _, s := range sequences {
+		warnings = append(warnings, d.lintSequence(s.sequence, "", version)...)
+	}
+	return warnings
+}
+
+// lintSequence inspects every track of a sequence, including nested sequences.
+// parent is the path of the clipitem holding a nested sequence, and version
+// the document's xmeml version.
+func (d *Decoder) lintSequence(seq *Sequence, parent string, version int) []Warning {
+	path := seq.Name
+	if parent != "" {
+		path = parent + "/" + seq.Name
+	}
+
+	var warnings []Warning
+	for _, finding := range sequenceTiming(seq) {
+		w := finding.warning()
+		w.Path = path + "/" + finding.path()
+		warnings = append(warnings, w)
+	}
+
+	for _, t := range classifyTracks(seq) {
+		trackPath := path + "/" + trackName(t.kind, t.index)
+		if w := t.warning(); w != nil {
+			w.Path = trackPath
+			warnings = append(warnings, *w)
+		}
+		for i := range t.track.ClipItem {
+			item := &t.track.ClipItem[i]
+			itemPath := trackPath + "/" + item.Name
+			resolved := d.resolvedClipItem(item)
+			if mismatch := findRateMismatch(resolved, version); mismatch != nil {
+				w := mismatch.warning(resolved)
+				w.Path = itemPath
+				warnings = append(warnings, w)
+			}
+			if item.Sequence != nil {
+				warnings = append(warnings, d.lintSequence(item.Sequence, itemPath, version)...)
+			}
+		}
+	}
+	return warnings
+}
+
+// resolvedClipItem returns a copy of item with its file references resolved
+// by resolveFile, leaving item as it is.
+func (d *Decoder) resolvedClipItem(item *ClipItem) *ClipItem {
+	resolved := *item
+	if item.Multiclip != nil {
+		multiclip := *item.Multiclip
+		multiclip.MCSource = slices.Clone(multiclip.MCSource)
+		resolved.Multiclip = &multiclip
+	}
+	d.resolveFile(&resolved)
+	return &resolved
+}
@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"encoding/xml"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLint_RateMismatch(t *testing.T) {
+	data, err := os.ReadFile("testdata/rate_mismatch.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	var xmeml XMEML
+	if err := xml.Unmarshal(data, &xmeml); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+
+	warnings := Lint(&xmeml)
+	if len(warnings) != 2 {
+		t.Fatalf("Expected 2 warnings, got %d: %v", len(warnings), warnings)
+	}
+
+	for _, w := range warnings {
+		if w.Category != WarningRateMismatch {
+			t.Errorf("Expected category %q, got %q", WarningRateMismatch, w.Category)
+		}
+		if !strings.Contains(w.Message, "25") || !strings.Contains(w.Message, "24") {
+			t.Errorf("Expected warning to mention both rates, got: %s", w.Message)
+		}
+	}
+	if warnings[0].Path != "Rate Mismatch/Video 1/Repairable" {
+		t.Errorf("Expected path 'Rate Mismatch/Video 1/Repairable', got '%s'", warnings[0].Path)
+	}
+	if !strings.Contains(warnings[1].Message, "ambiguous") {
+		t.Errorf("Expected second mismatch to be ambiguous, got: %s", warnings[1].Message)
+	}
+}
+
+func TestLint_FileReference(t *testing.T) {
+	data, err := os.ReadFile("testdata/rate_mismatch.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	// A second use of the first file, written as a reference
+	reference := `<clipitem id="clip-3">
+            <name>Reference</name>
+            <rate>
+              <timebase>25</timebase>
+              <ntsc>FALSE</ntsc>
+            </rate>
+            <start>150</start>
+            <end>200</end>
+            <in>25</in>
+            <out>75</out>
+            <file id="file-1"/>
+          </clipitem>
+        </track>`
+	document := strings.Replace(string(data), "</track>", reference, 1)
+
+	var xmeml XMEML
+	if err := xml.Unmarshal([]byte(document), &xmeml); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+
+	warnings := Lint(&xmeml)
+	if len(warnings) != 3 {
+		t.Fatalf("Expected 3 warnings, got %d: %v", len(warnings), warnings)
+	}
+	if warnings[2].Path != "Rate Mismatch/Video 1/Reference" || warnings[2].Category != WarningRateMismatch {
+		t.Errorf("Expected a rate mismatch for the referenced file, got %v", warnings[2])
+	}
+	if !strings.Contains(warnings[2].Message, "swapped_24.mov") {
+		t.Errorf("Expected warning to name the referenced file, got: %s", warnings[2].Message)
+	}
+
+	// The reference is resolved on a copy
+	file := xmeml.Sequence[0].Media.Video.Track[0].ClipItem[2].File
+	if !file.isReference() {
+		t.Errorf("Expected the document's file reference to be left as it was, got %+v", file)
+	}
+}
+
+func TestLint_TimingInconsistencies(t *testing.T) {
+	data, err := os.ReadFile("testdata/timing_inconsistent.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	var xmeml XMEML
+	if err := xml.Unmarshal(data, &xmeml); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+
+	warnings := Lint(&xmeml)
+	if len(warnings) != 3 {
+		t.Fatalf("Expected 3 warnings, got %d: %v", len(warnings), warnings)
+	}
+	for _, w := range warnings {
+		if w.Category != WarningTimingInconsistency {
+			t.Errorf("Expected category %q, got %q", WarningTimingInconsistency, w.Category)
+		}
+	}
+}
+
+func TestLint_NoFindings(t *testing.T) {
+	data, err := os.ReadFile("testdata/sample.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	var xmeml XMEML
+	if err := xml.Unmarshal(data, &xmeml); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+
+	if warnings := Lint(&xmeml); len(warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", warnings)
+	}
+}
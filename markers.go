@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import "github.com/Avalanche-io/gotio"
+
+// defaultMarkerColor is the OTIO color of markers without a <color>.
+// Markers of this color are written without one.
+const defaultMarkerColor = gotio.MarkerColorGreen
+
+// markerPalette holds the RGB value of each OTIO marker color, in the 0-255
+// range FCP7 uses.
+var markerPalette = []struct {
+	color            gotio.MarkerColor
+	red, green, blue int
+}{
+	{gotio.MarkerColorRed, 255, 0, 0},
+	{gotio.MarkerColorOrange, 255, 128, 0},
+	{gotio.MarkerColorYellow, 255, 255, 0},
+	{gotio.MarkerColorGreen, 0, 255, 0},
+	{gotio.MarkerColorCyan, 0, 255, 255},
+	{gotio.MarkerColorBlue, 0, 0, 255},
+	{gotio.MarkerColorPurple, 128, 0, 255},
+	{gotio.MarkerColorMagenta, 255, 0, 255},
+	{gotio.MarkerColorPink, 255, 128, 192},
+	{gotio.MarkerColorBlack, 0, 0, 0},
+	{gotio.MarkerColorWhite, 255, 255, 255},
+}
+
+// markerColor returns the OTIO marker color nearest to c, or
+// defaultMarkerColor if c is nil.
+func markerColor(c *Color) gotio.MarkerColor {
+	if c == nil {
+		return defaultMarkerColor
+	}
+	nearest, best := defaultMarkerColor, -1
+	for _, p := range markerPalette {
+		dr, dg, db := c.Red-p.red, c.Green-p.green, c.Blue-p.blue
+		if distance := dr*dr + dg*dg + db*db; best < 0 || distance < best {
+			nearest, best = p.color, distance
+		}
+	}
+	return nearest
+}
+
+// markerRGB returns the FCP7 <color> for an OTIO marker color, or nil for
+// defaultMarkerColor and colors outside the palette.
+func markerRGB(color gotio.MarkerColor) *Color {
+	if color == defaultMarkerColor {
+		return nil
+	}
+	for _, p := range markerPalette {
+		if p.color == color {
+			return &Color{Red: p.red, Green: p.green, Blue: p.blue}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MediaRef is a media file defined in a document, as listed by
+// Decoder.MediaReferences.
+type MediaRef struct {
+	ID   string // id of the <file>, if it has one
+	Name string
+
+	// URL is the file's <pathurl>, repaired and resolved against
+	// DecodeOptions.BaseDir as Decode does, or empty for offline media.
+	URL string
+}
+
+// MediaReferences scans the document for the media files it defines and
+// returns them in document order. A file defined in full more than once
+// under the same id is listed once, and references to it by id are skipped.
+// Nothing is converted to OTIO, which makes this much cheaper than Decode
+// for tools that relink or check media. The limits of DecodeOptions apply
+// as they do to Decode, and repaired pathurls are reported by Warnings.
+func (d *Decoder) MediaReferences() ([]MediaRef, error) {
+	d.warnings = nil
+	d.path = nil
+	decoder := d.xmlDecoder()
+	if _, err := readRootElement(decoder); err != nil {
+		return nil, err
+	}
+
+	var refs []MediaRef
+	seen := make(map[string]bool)
+	for {
+		tok, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return refs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode XML: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "file" {
+			continue
+		}
+		var file File
+		if err := decodeElement(decoder, &file, start); err != nil {
+			return nil, err
+		}
+		if file.isReference() || (file.ID != "" && seen[file.ID]) {
+			continue
+		}
+		if file.ID != "" {
+			seen[file.ID] = true
+		}
+		refs = append(refs, MediaRef{
+			ID:   file.ID,
+			Name: file.Name,
+			URL:  d.resolvePathURL(d.repairPathURL(&file)),
+		})
+	}
+}
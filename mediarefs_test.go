@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+func TestDecoder_MediaReferences(t *testing.T) {
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence id="sequence-1">
+    <name>Media</name>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    <media>
+      <video>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>Shot A</name>
+            <start>0</start>
+            <end>24</end>
+            <in>0</in>
+            <out>24</out>
+            <file id="file-1">
+              <name>a.mov</name>
+              <pathurl>file:///media/a.mov</pathurl>
+              <duration>240</duration>
+            </file>
+          </clipitem>
+          <clipitem id="clipitem-2">
+            <name>Shot A again</name>
+            <start>24</start>
+            <end>48</end>
+            <in>24</in>
+            <out>48</out>
+            <file id="file-1"/>
+          </clipitem>
+          <clipitem id="clipitem-3">
+            <name>Offline</name>
+            <start>48</start>
+            <end>72</end>
+            <in>0</in>
+            <out>24</out>
+            <file id="file-2">
+              <name>lost.mov</name>
+              <duration>240</duration>
+            </file>
+          </clipitem>
+        </track>
+      </video>
+      <audio>
+        <track>
+          <clipitem id="clipitem-4">
+            <name>Music</name>
+            <start>0</start>
+            <end>72</end>
+            <in>0</in>
+            <out>72</out>
+            <file id="file-3">
+              <name>music.wav</name>
+              <pathurl>music/music.wav</pathurl>
+              <duration>720</duration>
+            </file>
+          </clipitem>
+        </track>
+      </audio>
+    </media>
+  </sequence>
+</xmeml>`
+
+	refs, err := NewDecoderWithOptions(strings.NewReader(xmlData), DecodeOptions{BaseDir: "/projects/show"}).MediaReferences()
+	if err != nil {
+		t.Fatalf("MediaReferences failed: %v", err)
+	}
+	expected := []MediaRef{
+		{ID: "file-1", Name: "a.mov", URL: "file:///media/a.mov"},
+		{ID: "file-2", Name: "lost.mov"},
+		{ID: "file-3", Name: "music.wav", URL: "file:///projects/show/music/music.wav"},
+	}
+	if !reflect.DeepEqual(refs, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, refs)
+	}
+
+	if _, err := NewDecoder(strings.NewReader(`<fcpxml version="1.9"/>`)).MediaReferences(); !errors.Is(err, ErrFCPXMLNotSupported) {
+		t.Errorf("Expected ErrFCPXMLNotSupported, got %v", err)
+	}
+}
+
+func TestDecoder_MediaReferencesMatchDecode(t *testing.T) {
+	data, err := os.ReadFile("testdata/premiere_example.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	refs, err := NewDecoder(bytes.NewReader(data)).MediaReferences()
+	if err != nil {
+		t.Fatalf("MediaReferences failed: %v", err)
+	}
+	listed := make(map[string]bool)
+	for _, ref := range refs {
+		listed[ref.URL] = true
+	}
+
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	var tracks []*gotio.Track
+	tracks = append(tracks, timeline.VideoTracks()...)
+	tracks = append(tracks, timeline.AudioTracks()...)
+	decoded := 0
+	for _, track := range tracks {
+		for _, child := range track.Children() {
+			clip, ok := child.(*gotio.Clip)
+			if !ok {
+				continue
+			}
+			if ref, ok := clip.MediaReference().(*gotio.ExternalReference); ok {
+				decoded++
+				if !listed[ref.TargetURL()] {
+					t.Errorf("Expected %s to be listed", ref.TargetURL())
+				}
+			}
+		}
+	}
+	if decoded == 0 {
+		t.Fatal("Expected clips with media")
+	}
+}
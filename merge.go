@@ -0,0 +1,293 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Avalanche-io/gotio"
+	"github.com/Avalanche-io/gotio/opentime"
+)
+
+// Merge joins timelines end to end into one, such as the per-reel sequences
+// of a film: each timeline starts where the one before it ends. Video and
+// audio tracks are matched by index, and a timeline with fewer tracks than
+// another leaves a gap on the tracks it lacks, as does a track shorter than
+// its timeline. The result is named after the first timeline and has its
+// metadata, less what describes that timeline's sequence alone, its
+// fcp7xml_duration and fcp7xml_work_area.
+//
+// The items of the given timelines are copied into the result, which leaves
+// them as they were, so the same timeline may be given more than once. The
+// copies share only media references of kinds other than external, missing
+// and generator references with the originals.
+func Merge(timelines ...*gotio.Timeline) (*gotio.Timeline, error) {
+	if len(timelines) == 0 {
+		return nil, fmt.Errorf("no timelines to merge")
+	}
+
+	var video, audio []*gotio.Track
+	var offset *opentime.RationalTime
+	for i, timeline := range timelines {
+		if timeline == nil {
+			return nil, fmt.Errorf("timeline %d is nil", i)
+		}
+		duration, err := timeline.Duration()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get duration of timeline %q: %w", timeline.Name(), err)
+		}
+
+		if video, err = mergeTracks(video, timeline.VideoTracks(), gotio.TrackKindVideo, offset, duration); err != nil {
+			return nil, fmt.Errorf("failed to merge timeline %q: %w", timeline.Name(), err)
+		}
+		if audio, err = mergeTracks(audio, timeline.AudioTracks(), gotio.TrackKindAudio, offset, duration); err != nil {
+			return nil, fmt.Errorf("failed to merge timeline %q: %w", timeline.Name(), err)
+		}
+
+		if offset == nil {
+			offset = &duration
+		} else {
+			next := offset.Add(duration)
+			offset = &next
+		}
+	}
+
+	first := timelines[0]
+	metadata := cloneMetadata(first.Metadata())
+	for _, key := range sequenceMetadata {
+		delete(metadata, key)
+	}
+	merged := gotio.NewTimeline(first.Name(), first.GlobalStartTime(), metadata)
+	for _, track := range append(video, audio...) {
+		if err := merged.Tracks().AppendChild(track); err != nil {
+			return nil, fmt.Errorf("failed to append track: %w", err)
+		}
+	}
+	return merged, nil
+}
+
+// sequenceMetadata are the timeline metadata keys that describe a decoded
+// sequence as a whole, and no longer apply once it is merged with others.
+var sequenceMetadata = []string{"fcp7xml_duration", "fcp7xml_work_area"}
+
+// mergeTracks appends copies of the items of tracks, which last duration, to the merged
+// tracks of their kind, and returns those. A track with no merged track to
+// go on yet starts a new one, after a gap as long as offset, the merged
+// timelines so far.
+func mergeTracks(merged, tracks []*gotio.Track, kind string, offset *opentime.RationalTime, duration opentime.RationalTime) ([]*gotio.Track, error) {
+	for i, track := range tracks {
+		if i == len(merged) {
+			next := gotio.NewTrack(track.Name(), nil, kind, cloneMetadata(track.Metadata()), nil)
+			next.SetEnabled(track.Enabled())
+			if offset != nil {
+				if err := appendGapTo(next, *offset); err != nil {
+					return nil, err
+				}
+			}
+			merged = append(merged, next)
+		}
+
+		children := track.Children()
+		for _, child := range children {
+			if err := merged[i].AppendChild(cloneComposable(child)); err != nil {
+				return nil, fmt.Errorf("failed to append %q: %w", child.Name(), err)
+			}
+		}
+
+		// Pad the track to the end of its timeline
+		rest := duration
+		if used, ok, err := durationOf(children); err != nil {
+			return nil, err
+		} else if ok {
+			rest = duration.Sub(used)
+		}
+		if err := appendGapTo(merged[i], rest); err != nil {
+			return nil, err
+		}
+	}
+
+	// Tracks this timeline lacks are left empty for its duration
+	for i := len(tracks); i < len(merged); i++ {
+		if err := appendGapTo(merged[i], duration); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+// durationOf returns the length of a track's children, which transitions
+// overlap rather than add to. It reports false if there are none.
+func durationOf(children []gotio.Composable) (opentime.RationalTime, bool, error) {
+	var total opentime.RationalTime
+	found := false
+	for _, child := range children {
+		if _, ok := child.(*gotio.Transition); ok {
+			continue
+		}
+		d, err := child.Duration()
+		if err != nil {
+			return opentime.RationalTime{}, false, fmt.Errorf("failed to get duration of %q: %w", child.Name(), err)
+		}
+		if found {
+			total = total.Add(d)
+		} else {
+			total, found = d, true
+		}
+	}
+	return total, found, nil
+}
+
+// appendGapTo appends a gap of the given length to track, unless it is empty.
+func appendGapTo(track *gotio.Track, duration opentime.RationalTime) error {
+	if duration.Value() <= 0 {
+		return nil
+	}
+	if err := track.AppendChild(gotio.NewGapWithDuration(duration)); err != nil {
+		return fmt.Errorf("failed to append gap: %w", err)
+	}
+	return nil
+}
+
+// cloneComposable returns a copy of a track's child, with copies of its
+// children, metadata, markers, effects and media references.
+func cloneComposable(child gotio.Composable) gotio.Composable {
+	switch c := child.(type) {
+	case *gotio.Clip:
+		refs := make(map[string]gotio.MediaReference)
+		for key, ref := range c.MediaReferences() {
+			refs[key] = cloneMediaReference(ref)
+		}
+		clip := gotio.NewClip(c.Name(), nil, cloneRange(c.SourceRange()), cloneMetadata(c.Metadata()),
+			cloneEffects(c.Effects()), cloneMarkers(c.Markers()), c.ActiveMediaReferenceKey(), c.Color())
+		if err := clip.SetMediaReferences(refs, c.ActiveMediaReferenceKey()); err != nil {
+			clip.SetMediaReference(cloneMediaReference(c.MediaReference()))
+		}
+		clip.SetEnabled(c.Enabled())
+		return clip
+	case *gotio.Gap:
+		gap := gotio.NewGap(c.Name(), cloneRange(c.SourceRange()), cloneMetadata(c.Metadata()),
+			cloneEffects(c.Effects()), cloneMarkers(c.Markers()), nil)
+		gap.SetEnabled(c.Enabled())
+		return gap
+	case *gotio.Transition:
+		return gotio.NewTransition(c.Name(), c.TransitionType(), c.InOffset(), c.OutOffset(), cloneMetadata(c.Metadata()))
+	case *gotio.Stack:
+		stack := gotio.NewStack(c.Name(), cloneRange(c.SourceRange()), cloneMetadata(c.Metadata()),
+			cloneEffects(c.Effects()), cloneMarkers(c.Markers()), nil)
+		stack.SetEnabled(c.Enabled())
+		for _, grandchild := range c.Children() {
+			_ = stack.AppendChild(cloneComposable(grandchild))
+		}
+		return stack
+	case *gotio.Track:
+		track := gotio.NewTrack(c.Name(), cloneRange(c.SourceRange()), c.Kind(), cloneMetadata(c.Metadata()), nil)
+		track.SetEnabled(c.Enabled())
+		for _, grandchild := range c.Children() {
+			_ = track.AppendChild(cloneComposable(grandchild))
+		}
+		return track
+	}
+	return child
+}
+
+// cloneMediaReference returns a copy of an external, missing or generator
+// reference, and ref itself for other kinds.
+func cloneMediaReference(ref gotio.MediaReference) gotio.MediaReference {
+	switch r := ref.(type) {
+	case *gotio.ExternalReference:
+		return gotio.NewExternalReference(r.Name(), r.TargetURL(), cloneRange(r.AvailableRange()), cloneMetadata(r.Metadata()))
+	case *gotio.MissingReference:
+		return gotio.NewMissingReference(r.Name(), cloneRange(r.AvailableRange()), cloneMetadata(r.Metadata()))
+	case *gotio.GeneratorReference:
+		return gotio.NewGeneratorReference(r.Name(), r.GeneratorKind(), cloneMetadata(r.Parameters()),
+			cloneRange(r.AvailableRange()), cloneMetadata(r.Metadata()))
+	}
+	return ref
+}
+
+// cloneEffects returns copies of effects of the kinds the decoder makes;
+// others are shared.
+func cloneEffects(effects []gotio.Effect) []gotio.Effect {
+	if effects == nil {
+		return nil
+	}
+	clones := make([]gotio.Effect, len(effects))
+	for i, effect := range effects {
+		switch e := effect.(type) {
+		case *gotio.LinearTimeWarp:
+			clones[i] = gotio.NewLinearTimeWarp(e.Name(), e.EffectName(), e.TimeScalar(), cloneMetadata(e.Metadata()))
+		case *gotio.FreezeFrame:
+			clones[i] = gotio.NewFreezeFrame(e.Name(), cloneMetadata(e.Metadata()))
+		case *gotio.EffectImpl:
+			clones[i] = gotio.NewEffect(e.Name(), e.EffectName(), cloneMetadata(e.Metadata()))
+		default:
+			clones[i] = effect
+		}
+	}
+	return clones
+}
+
+// cloneMarkers returns copies of markers.
+func cloneMarkers(markers []*gotio.Marker) []*gotio.Marker {
+	if markers == nil {
+		return nil
+	}
+	clones := make([]*gotio.Marker, len(markers))
+	for i, m := range markers {
+		clones[i] = gotio.NewMarker(m.Name(), m.MarkedRange(), m.Color(), m.Comment(), cloneMetadata(m.Metadata()))
+	}
+	return clones
+}
+
+// cloneRange returns a copy of r, or nil.
+func cloneRange(r *opentime.TimeRange) *opentime.TimeRange {
+	if r == nil {
+		return nil
+	}
+	clone := *r
+	return &clone
+}
+
+// cloneMetadata returns a deep copy of metadata, copying the dictionaries
+// and lists in it.
+func cloneMetadata(metadata gotio.AnyDictionary) gotio.AnyDictionary {
+	if metadata == nil {
+		return nil
+	}
+	clone := make(gotio.AnyDictionary, len(metadata))
+	for key, value := range metadata {
+		clone[key] = cloneValue(value)
+	}
+	return clone
+}
+
+// cloneValue returns a deep copy of a metadata value.
+func cloneValue(value any) any {
+	switch v := value.(type) {
+	case gotio.AnyDictionary:
+		return cloneMetadata(v)
+	case map[string]any:
+		return map[string]any(cloneMetadata(v))
+	case []gotio.AnyDictionary:
+		clone := make([]gotio.AnyDictionary, len(v))
+		for i, d := range v {
+			clone[i] = cloneMetadata(d)
+		}
+		return clone
+	case []any:
+		clone := make([]any, len(v))
+		for i, item := range v {
+			clone[i] = cloneValue(item)
+		}
+		return clone
+	case []string:
+		return slices.Clone(v)
+	case []int64:
+		return slices.Clone(v)
+	case []float64:
+		return slices.Clone(v)
+	}
+	return value
+}
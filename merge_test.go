@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"testing"
+
+	"github.com/Avalanche-io/gotio"
+	"github.com/Avalanche-io/gotio/opentime"
+)
+
+// reelTimeline returns a timeline with one clip of the given length on each
+// of videoTracks video tracks, and on one audio track if withAudio is set.
+func reelTimeline(name string, frames float64, videoTracks int, withAudio bool) *gotio.Timeline {
+	timeline := gotio.NewTimeline(name, nil, nil)
+	newTrack := func(kind string, index int) {
+		track := gotio.NewTrack(trackName(kind, index), nil, kind, nil, nil)
+		sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(frames, 24))
+		clip := gotio.NewClip(
+			name,
+			gotio.NewExternalReference(name+".mov", "file:///media/"+name+".mov", nil, nil),
+			&sourceRange,
+			nil, nil, nil, "", nil,
+		)
+		track.AppendChild(clip)
+		timeline.Tracks().AppendChild(track)
+	}
+	for i := 0; i < videoTracks; i++ {
+		newTrack(gotio.TrackKindVideo, i)
+	}
+	if withAudio {
+		newTrack(gotio.TrackKindAudio, 0)
+	}
+	return timeline
+}
+
+func TestMerge(t *testing.T) {
+	reel1 := reelTimeline("Reel 1", 48, 1, true)
+	reel2 := reelTimeline("Reel 2", 24, 2, false)
+	reel3 := reelTimeline("Reel 3", 36, 1, true)
+
+	merged, err := Merge(reel1, reel2, reel3)
+	if err != nil {
+		t.Fatalf("Merge() failed: %v", err)
+	}
+	if merged.Name() != "Reel 1" {
+		t.Errorf("Expected merged timeline named 'Reel 1', got '%s'", merged.Name())
+	}
+
+	duration, err := merged.Duration()
+	if err != nil {
+		t.Fatalf("Duration() failed: %v", err)
+	}
+	if duration.Value() != 108 {
+		t.Errorf("Expected merged duration 108, got %v", duration.Value())
+	}
+
+	tests := []struct {
+		track    *gotio.Track
+		expected []string
+	}{
+		{merged.VideoTracks()[0], []string{"Reel 1", "Reel 2", "Reel 3"}},
+		{merged.VideoTracks()[1], []string{"gap 48", "Reel 2", "gap 36"}},
+		{merged.AudioTracks()[0], []string{"Reel 1", "gap 24", "Reel 3"}},
+	}
+	for _, tt := range tests {
+		children := tt.track.Children()
+		if len(children) != len(tt.expected) {
+			t.Errorf("%s: Expected %d items, got %d", tt.track.Name(), len(tt.expected), len(children))
+			continue
+		}
+		for i, child := range children {
+			name := child.Name()
+			if gap, ok := child.(*gotio.Gap); ok {
+				dur, _ := gap.Duration()
+				name = "gap " + strconv.FormatFloat(dur.Value(), 'f', -1, 64)
+			}
+			if name != tt.expected[i] {
+				t.Errorf("%s: Expected item %d to be '%s', got '%s'", tt.track.Name(), i, tt.expected[i], name)
+			}
+		}
+	}
+
+	// The merged timeline encodes as one sequence
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(merged); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse encoded XML: %v", err)
+	}
+	clipItems := xmeml.Sequence[0].Media.Video.Track[0].ClipItem
+	if len(clipItems) != 3 {
+		t.Fatalf("Expected 3 clipitems on V1, got %d", len(clipItems))
+	}
+	for i, start := range []int64{0, 48, 72} {
+		if clipItems[i].Start != start {
+			t.Errorf("Expected clipitem %d to start at %d, got %d", i, start, clipItems[i].Start)
+		}
+	}
+}
+
+func TestMerge_Errors(t *testing.T) {
+	if _, err := Merge(); err == nil {
+		t.Error("Expected an error when merging no timelines")
+	}
+	if _, err := Merge(reelTimeline("Reel 1", 24, 1, false), nil); err == nil {
+		t.Error("Expected an error when merging a nil timeline")
+	}
+}
+
+func TestMerge_LeavesInputs(t *testing.T) {
+	reel1 := reelTimeline("Reel 1", 48, 1, true)
+	reel1.Metadata()["fcp7xml_duration"] = int64(48)
+	reel1.Metadata()["fcp7xml_work_area"] = gotio.AnyDictionary{"in": int64(0), "out": int64(48)}
+	reel2 := reelTimeline("Reel 2", 24, 1, true)
+
+	merged, err := Merge(reel1, reel2)
+	if err != nil {
+		t.Fatalf("Merge() failed: %v", err)
+	}
+
+	for _, reel := range []*gotio.Timeline{reel1, reel2} {
+		for _, track := range reel.Tracks().Children() {
+			children := track.(*gotio.Track).Children()
+			if len(children) != 1 || children[0].Name() != reel.Name() {
+				t.Errorf("%s: Expected %s to keep its clip, got %d items", reel.Name(), track.Name(), len(children))
+			}
+		}
+	}
+
+	// Changing the result doesn't change the inputs
+	clip := merged.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	clip.Metadata()["note"] = "merged"
+	clip.MediaReference().Metadata()["note"] = "merged"
+	original := reel1.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	if _, ok := original.Metadata()["note"]; ok {
+		t.Error("Expected the input clip's metadata to be left alone")
+	}
+	if _, ok := original.MediaReference().Metadata()["note"]; ok {
+		t.Error("Expected the input clip's media reference to be left alone")
+	}
+
+	// The first timeline's sequence duration and work area don't describe
+	// the merged one
+	for _, key := range []string{"fcp7xml_duration", "fcp7xml_work_area"} {
+		if _, ok := merged.Metadata()[key]; ok {
+			t.Errorf("Expected no %s on the merged timeline", key)
+		}
+		if _, ok := reel1.Metadata()[key]; !ok {
+			t.Errorf("Expected the first timeline to keep its %s", key)
+		}
+	}
+}
+
+func TestMerge_RepeatedTimeline(t *testing.T) {
+	reel := reelTimeline("Reel 1", 48, 1, true)
+
+	merged, err := Merge(reel, reel)
+	if err != nil {
+		t.Fatalf("Merge() failed: %v", err)
+	}
+	duration, err := merged.Duration()
+	if err != nil {
+		t.Fatalf("Duration() failed: %v", err)
+	}
+	if duration.Value() != 96 {
+		t.Errorf("Expected merged duration 96, got %v", duration.Value())
+	}
+	for _, track := range merged.Tracks().Children() {
+		children := track.(*gotio.Track).Children()
+		if len(children) != 2 || children[0] == children[1] {
+			t.Errorf("%s: Expected two separate copies of the clip, got %d items", track.Name(), len(children))
+			continue
+		}
+		for i, child := range children {
+			if child.Name() != "Reel 1" {
+				t.Errorf("%s: Expected item %d to be 'Reel 1', got '%s'", track.Name(), i, child.Name())
+			}
+		}
+	}
+}
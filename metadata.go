@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"math"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// The metadata accessors below return a metadata value as the type the
+// decoder stores, whether it was made by the decoder or read back from OTIO
+// JSON, where every number is a float64, every list a []any and every
+// dictionary a map[string]any.
+
+// metadataInt returns v as an int64. A float64 is accepted if it is a whole
+// number.
+func metadataInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case float64:
+		if n == math.Trunc(n) && !math.IsInf(n, 0) {
+			return int64(n), true
+		}
+	}
+	return 0, false
+}
+
+// metadataFloat returns v as a float64. An integer is accepted too, as OTIO
+// JSON may write a whole float64 without a fraction.
+func metadataFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// metadataDict returns v as a dictionary.
+func metadataDict(v any) (gotio.AnyDictionary, bool) {
+	switch dict := v.(type) {
+	case gotio.AnyDictionary:
+		return dict, true
+	case map[string]any:
+		return gotio.AnyDictionary(dict), true
+	}
+	return nil, false
+}
+
+// metadataDicts returns v as a list of dictionaries.
+func metadataDicts(v any) ([]gotio.AnyDictionary, bool) {
+	if dicts, ok := v.([]gotio.AnyDictionary); ok {
+		return dicts, true
+	}
+	return metadataList(v, metadataDict)
+}
+
+// metadataStrings returns v as a list of strings.
+func metadataStrings(v any) ([]string, bool) {
+	if strings, ok := v.([]string); ok {
+		return strings, true
+	}
+	return metadataList(v, func(v any) (string, bool) {
+		s, ok := v.(string)
+		return s, ok
+	})
+}
+
+// metadataInts returns v as a list of int64s.
+func metadataInts(v any) ([]int64, bool) {
+	if ints, ok := v.([]int64); ok {
+		return ints, true
+	}
+	return metadataList(v, metadataInt)
+}
+
+// metadataIntMap returns v as a map of ints, as the decoder stores colors.
+func metadataIntMap(v any) (map[string]int, bool) {
+	if m, ok := v.(map[string]int); ok {
+		return m, true
+	}
+	dict, ok := metadataDict(v)
+	if !ok {
+		return nil, false
+	}
+	m := make(map[string]int, len(dict))
+	for key, value := range dict {
+		n, ok := metadataInt(value)
+		if !ok {
+			return nil, false
+		}
+		m[key] = int(n)
+	}
+	return m, true
+}
+
+// metadataList returns v, a []any read from JSON, with every element
+// converted by element, or false if v isn't a []any or an element can't be
+// converted.
+func metadataList[T any](v any, element func(any) (T, bool)) ([]T, bool) {
+	values, ok := v.([]any)
+	if !ok {
+		return nil, false
+	}
+	list := make([]T, len(values))
+	for i, value := range values {
+		if list[i], ok = element(value); !ok {
+			return nil, false
+		}
+	}
+	return list, true
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// activeSource returns the active angle of m, or its first angle if none of
+// them is the active one. It returns nil if m has no angles.
+func (m *Multiclip) activeSource() *MCSource {
+	for i := range m.MCSource {
+		if m.MCSource[i].Angle == m.ActiveAngle {
+			return &m.MCSource[i]
+		}
+	}
+	if len(m.MCSource) == 0 {
+		return nil
+	}
+	return &m.MCSource[0]
+}
+
+// multiclipToMetadata stores a multiclip as fcp7xml_multiclip metadata: its
+// id, name and active angle, and for each angle its name, index and file, the
+// file as an XML fragment.
+func multiclipToMetadata(m *Multiclip) gotio.AnyDictionary {
+	angles := make([]gotio.AnyDictionary, len(m.MCSource))
+	for i, source := range m.MCSource {
+		angle := gotio.AnyDictionary{
+			"name":  source.Name,
+			"angle": int64(source.Angle),
+		}
+		if source.File != nil {
+			if fragment, err := fileFragment(source.File); err == nil {
+				angle["file"] = fragment
+			}
+		}
+		setUnknownMetadata(angle, source.Unknown)
+		angles[i] = angle
+	}
+	metadata := gotio.AnyDictionary{
+		"name":         m.Name,
+		"active_angle": int64(m.ActiveAngle),
+		"angles":       angles,
+	}
+	if m.ID != "" {
+		metadata["id"] = m.ID
+	}
+	setUnknownMetadata(metadata, m.Unknown)
+	return metadata
+}
+
+// fileFragment returns file as an XML fragment.
+func fileFragment(file *File) (string, error) {
+	var buf strings.Builder
+	encoder := xml.NewEncoder(&buf)
+	if err := encoder.EncodeElement(file, xml.StartElement{Name: xml.Name{Local: "file"}}); err != nil {
+		return "", err
+	}
+	if err := encoder.Flush(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// metadataToMulticlip restores the multiclip stored by the decoder. Angle
+// files that aren't well-formed XML are left out.
+func metadataToMulticlip(metadata gotio.AnyDictionary) *Multiclip {
+	m := &Multiclip{Unknown: metadataToUnknown(metadata)}
+	m.ID, _ = metadata["id"].(string)
+	m.Name, _ = metadata["name"].(string)
+	if active, ok := metadataInt(metadata["active_angle"]); ok {
+		m.ActiveAngle = int(active)
+	}
+	angles, _ := metadataDicts(metadata["angles"])
+	for _, angle := range angles {
+		source := MCSource{Unknown: metadataToUnknown(angle)}
+		source.Name, _ = angle["name"].(string)
+		if index, ok := metadataInt(angle["angle"]); ok {
+			source.Angle = int(index)
+		}
+		if fragment, ok := angle["file"].(string); ok {
+			file := &File{}
+			if err := xml.Unmarshal([]byte(fragment), file); err == nil {
+				source.File = file
+			}
+		}
+		m.MCSource = append(m.MCSource, source)
+	}
+	return m
+}
+
+// restoreMulticlip writes the multiclip stored in metadata on clipItem. The
+// clip's own file, written from its media reference, becomes that of the
+// active angle, and the files of the angles are shared as clipitem files
+// are.
+func (e *Encoder) restoreMulticlip(metadata gotio.AnyDictionary, clipItem *ClipItem) {
+	m := metadataToMulticlip(metadata)
+	if source := m.activeSource(); source != nil && clipItem.File != nil {
+		source.File = clipItem.File
+		clipItem.File = nil
+	}
+	for i := range m.MCSource {
+		if file := m.MCSource[i].File; file != nil {
+			m.MCSource[i].File = e.shareFile(file)
+		}
+	}
+	clipItem.Multiclip = m
+}
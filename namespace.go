@@ -0,0 +1,254 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// MetadataNamespace selects the metadata layout read and written for the
+// details of a document that OTIO has no field for.
+type MetadataNamespace int
+
+const (
+	// NamespaceFCP7XML stores them under flat fcp7xml_* keys only.
+	NamespaceFCP7XML MetadataNamespace = iota
+
+	// NamespacePythonAdapter also stores them as the OTIO Python adapter
+	// does: each sequence, track, clipitem, file, transition and marker as a
+	// nested dictionary under the "fcp_xml" key. The encoder writes the
+	// elements found there that it doesn't write otherwise, so timelines
+	// decoded by the Python adapter keep them too.
+	NamespacePythonAdapter
+)
+
+// pythonAdapterKey is the metadata key of the Python adapter's layout.
+const pythonAdapterKey = "fcp_xml"
+
+// pythonAdapterTiming are the elements the Python adapter leaves out of its
+// dictionaries at every level, as OTIO holds their values.
+var pythonAdapterTiming = map[string]bool{
+	"rate": true, "start": true, "end": true, "duration": true,
+}
+
+// pythonAdapterIgnore are the child elements the Python adapter leaves out of
+// the dictionary of each element, as OTIO holds their values.
+var pythonAdapterIgnore = map[string]map[string]bool{
+	"sequence":       {"media": true, "name": true, "marker": true},
+	"track":          {"clipitem": true, "transitionitem": true, "generatoritem": true},
+	"clipitem":       {"name": true, "in": true, "out": true, "file": true, "sequence": true, "marker": true},
+	"file":           {"name": true, "pathurl": true},
+	"marker":         {"name": true, "comment": true, "in": true, "out": true},
+	"transitionitem": {"name": true, "alignment": true},
+}
+
+// setAdapterMetadata stores v, written as the element tag, in the Python
+// adapter's layout if d is configured for it. metadata must not be nil.
+func (d *Decoder) setAdapterMetadata(metadata gotio.AnyDictionary, tag string, v any) {
+	if d.opts.Namespace != NamespacePythonAdapter {
+		return
+	}
+	if dict, err := elementToAdapterDict(tag, v); err == nil {
+		metadata[pythonAdapterKey] = dict
+	}
+}
+
+// elementToAdapterDict writes v as the element tag and returns it as the
+// Python adapter's dictionary: attributes under "@" keys, leaf elements as
+// their text, or nil if they have none, other elements as dictionaries, and
+// repeated elements as lists.
+func elementToAdapterDict(tag string, v any) (gotio.AnyDictionary, error) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", tag, err)
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	start, err := readRootElement(decoder)
+	if err != nil {
+		return nil, err
+	}
+	value, err := readAdapterValue(decoder, start, pythonAdapterIgnore[tag])
+	if err != nil {
+		return nil, err
+	}
+	dict, _ := value.(gotio.AnyDictionary)
+	if dict == nil {
+		dict = gotio.AnyDictionary{}
+	}
+	return dict, nil
+}
+
+// readAdapterValue reads the element start up to its end element, returning
+// its value in the Python adapter's layout and leaving out the children named
+// in ignore.
+func readAdapterValue(decoder *xml.Decoder, start xml.StartElement, ignore map[string]bool) (any, error) {
+	dict := gotio.AnyDictionary{}
+	for _, attr := range start.Attr {
+		dict["@"+attr.Name.Local] = attr.Value
+	}
+	var text strings.Builder
+	var children bool
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode XML: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			children = true
+			name := t.Name.Local
+			if ignore[name] || pythonAdapterTiming[name] {
+				if err := decoder.Skip(); err != nil {
+					return nil, fmt.Errorf("failed to decode XML: %w", err)
+				}
+				continue
+			}
+			value, err := readAdapterValue(decoder, t, nil)
+			if err != nil {
+				return nil, err
+			}
+			switch existing := dict[name].(type) {
+			case nil:
+				if _, ok := dict[name]; ok {
+					dict[name] = []any{nil, value}
+				} else {
+					dict[name] = value
+				}
+			case []any:
+				dict[name] = append(existing, value)
+			default:
+				dict[name] = []any{existing, value}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if children || len(start.Attr) > 0 {
+				return dict, nil
+			}
+			if s := strings.TrimSpace(text.String()); s != "" {
+				return s, nil
+			}
+			return nil, nil
+		}
+	}
+}
+
+// adapterToUnknown returns unknown with the elements of the Python adapter's
+// dictionary in metadata that aren't written for v already appended. It
+// returns unknown unchanged unless e is configured for the Python adapter's
+// layout.
+func (e *Encoder) adapterToUnknown(metadata gotio.AnyDictionary, v any, unknown []UnknownElement) []UnknownElement {
+	if e.opts.Namespace != NamespacePythonAdapter {
+		return unknown
+	}
+	dict, _ := metadataDict(metadata[pythonAdapterKey])
+	if len(dict) == 0 {
+		return unknown
+	}
+	skip := writtenElements(v)
+	for _, element := range unknown {
+		skip[element.XMLName.Local] = true
+	}
+	for name := range pythonAdapterTiming {
+		skip[name] = true
+	}
+	keys := make([]string, 0, len(dict))
+	for key := range dict {
+		if !strings.HasPrefix(key, "@") && !skip[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values, ok := dict[key].([]any)
+		if !ok {
+			values = []any{dict[key]}
+		}
+		for _, value := range values {
+			if element, err := adapterElement(key, value); err == nil {
+				unknown = append(unknown, element)
+			}
+		}
+	}
+	return unknown
+}
+
+// writtenElements returns the names of the child elements written for v.
+func writtenElements(v any) map[string]bool {
+	names := make(map[string]bool)
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return names
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for depth := 0; ; {
+		tok, err := decoder.Token()
+		if err != nil {
+			return names
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth == 1 {
+				names[t.Name.Local] = true
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// adapterElement returns the element name with value from the Python
+// adapter's layout.
+func adapterElement(name string, value any) (UnknownElement, error) {
+	element := UnknownElement{XMLName: xml.Name{Local: name}}
+	var inner bytes.Buffer
+	if dict, ok := metadataDict(value); ok {
+		value = dict
+	}
+	switch v := value.(type) {
+	case nil:
+	case gotio.AnyDictionary:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		encoder := xml.NewEncoder(&inner)
+		for _, key := range keys {
+			if attr, ok := strings.CutPrefix(key, "@"); ok {
+				element.Attrs = append(element.Attrs, xml.Attr{Name: xml.Name{Local: attr}, Value: fmt.Sprint(v[key])})
+				continue
+			}
+			values, ok := v[key].([]any)
+			if !ok {
+				values = []any{v[key]}
+			}
+			for _, value := range values {
+				child, err := adapterElement(key, value)
+				if err != nil {
+					return UnknownElement{}, err
+				}
+				if err := encoder.Encode(child); err != nil {
+					return UnknownElement{}, fmt.Errorf("failed to encode %s: %w", key, err)
+				}
+			}
+		}
+		if err := encoder.Flush(); err != nil {
+			return UnknownElement{}, err
+		}
+	default:
+		if err := xml.EscapeText(&inner, []byte(fmt.Sprint(v))); err != nil {
+			return UnknownElement{}, err
+		}
+	}
+	element.Inner = inner.String()
+	return element, nil
+}
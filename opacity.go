@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import "github.com/Avalanche-io/gotio"
+
+// opacityID is the effectid and parameterid of FCP7's opacity filter, whose
+// single parameter runs from 0 to 100.
+const opacityID = "opacity"
+
+// opacityToMetadata stores the opacity filter among filters as
+// fcp7xml_opacity, from 0 to 1, if it is constant, or as
+// fcp7xml_opacity_keyframes if it is keyframed. The filter itself is still
+// kept in full under fcp7xml_filters.
+func opacityToMetadata(filters []Filter, metadata gotio.AnyDictionary) {
+	effect := findFilterEffect(filters, opacityID)
+	if effect == nil {
+		return
+	}
+	p := findParameter(effect, opacityID)
+	if p == nil {
+		return
+	}
+	value, _ := animatedValue(p, 100)
+	switch value := value.(type) {
+	case float64:
+		metadata["fcp7xml_opacity"] = value
+	case []gotio.AnyDictionary:
+		metadata["fcp7xml_opacity_keyframes"] = value
+	}
+}
+
+// applyOpacity writes fcp7xml_opacity or fcp7xml_opacity_keyframes metadata
+// back to the opacity filter in filters, adding one if there is none. An
+// unchanged value or keyframe is left as it was, so an unedited filter is
+// re-emitted verbatim.
+func applyOpacity(filters []Filter, metadata gotio.AnyDictionary) []Filter {
+	value, ok := metadataFloat(metadata["fcp7xml_opacity"])
+	var opacity any = value
+	if !ok {
+		keyframes, ok := metadataDicts(metadata["fcp7xml_opacity_keyframes"])
+		if !ok {
+			return filters
+		}
+		opacity = keyframes
+	}
+
+	valueMin, valueMax := 0.0, 100.0
+	filters, effect := filterEffect(filters, &Effect{
+		Name:           "Opacity",
+		EffectID:       opacityID,
+		EffectCategory: "motion",
+		EffectType:     "motion",
+		MediaType:      "video",
+		Parameter: []Parameter{{
+			ParameterID: opacityID,
+			Name:        "Opacity",
+			ValueMin:    &valueMin,
+			ValueMax:    &valueMax,
+		}},
+	})
+	setAnimatedValue(parameterFor(effect, opacityID), opacity, 100)
+	return filters
+}
@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import "github.com/Avalanche-io/gotio"
+
+// outputsToMetadata stores the audio routing of a sequence as
+// fcp7xml_audio_outputs metadata: one dictionary per output group, with its
+// index, numchannels, downmix and the indexes of its channels.
+func outputsToMetadata(outputs *Outputs) []gotio.AnyDictionary {
+	groups := make([]gotio.AnyDictionary, len(outputs.Group))
+	for i, group := range outputs.Group {
+		channels := make([]int64, len(group.Channel))
+		for j, channel := range group.Channel {
+			channels[j] = int64(channel.Index)
+		}
+		groups[i] = gotio.AnyDictionary{
+			"index":       int64(group.Index),
+			"numchannels": int64(group.NumChannels),
+			"downmix":     int64(group.Downmix),
+			"channels":    channels,
+		}
+	}
+	return groups
+}
+
+// metadataToOutputs restores the audio routing stored by the decoder, or
+// returns nil if there is none.
+func metadataToOutputs(metadata gotio.AnyDictionary) *Outputs {
+	groups, ok := metadataDicts(metadata["fcp7xml_audio_outputs"])
+	if !ok {
+		return nil
+	}
+	outputs := &Outputs{Group: make([]OutputGroup, len(groups))}
+	for i, md := range groups {
+		index, _ := metadataInt(md["index"])
+		numChannels, _ := metadataInt(md["numchannels"])
+		downmix, _ := metadataInt(md["downmix"])
+		channels, _ := metadataInts(md["channels"])
+		group := OutputGroup{Index: int(index), NumChannels: int(numChannels), Downmix: int(downmix)}
+		for _, channel := range channels {
+			group.Channel = append(group.Channel, OutputChannel{Index: int(channel)})
+		}
+		outputs.Group[i] = group
+	}
+	return outputs
+}
+
+// defaultOutputs returns the routing FCP7 gives a new sequence: two mono
+// outputs on channels 1 and 2, making a stereo pair.
+func defaultOutputs() *Outputs {
+	return &Outputs{Group: []OutputGroup{
+		{Index: 1, NumChannels: 1, Channel: []OutputChannel{{Index: 1}}},
+		{Index: 2, NumChannels: 1, Channel: []OutputChannel{{Index: 2}}},
+	}}
+}
@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"math"
+
+	"github.com/Avalanche-io/gotio"
+	"github.com/Avalanche-io/gotio/opentime"
+)
+
+// pproTicksPerSecond is the resolution of Premiere Pro's <pproTicksIn> and
+// <pproTicksOut>.
+const pproTicksPerSecond = 254016000000
+
+// ticksToFrames returns a tick count as frames at frameRate.
+func ticksToFrames(ticks int64, frameRate float64) float64 {
+	return float64(ticks) * frameRate / pproTicksPerSecond
+}
+
+// pproTicksStart returns the source start of item from its <pproTicksIn>,
+// at frameRate, which may fall between frames. ok is false if item has no
+// tick values, or if they are a frame or more away from inPoint, as when the
+// in point was repaired.
+func pproTicksStart(item *ClipItem, inPoint int64, frameRate float64) (start opentime.RationalTime, ok bool) {
+	if item.PProTicksIn == nil || item.PProTicksOut == nil || inPoint != item.In || frameRate <= 0 {
+		return opentime.RationalTime{}, false
+	}
+	frames := ticksToFrames(*item.PProTicksIn, frameRate)
+	if math.Abs(frames-float64(inPoint)) >= 1 {
+		return opentime.RationalTime{}, false
+	}
+	return opentime.NewRationalTime(frames, frameRate), true
+}
+
+// pproTicksToMetadata stores the tick values of item as
+// fcp7xml_ppro_ticks_in and fcp7xml_ppro_ticks_out.
+func pproTicksToMetadata(item *ClipItem, metadata gotio.AnyDictionary) {
+	if item.PProTicksIn != nil {
+		metadata["fcp7xml_ppro_ticks_in"] = *item.PProTicksIn
+	}
+	if item.PProTicksOut != nil {
+		metadata["fcp7xml_ppro_ticks_out"] = *item.PProTicksOut
+	}
+}
+
+// restorePProTicks writes back the tick values stored by the decoder, as
+// long as they still agree with the clipitem's in and out points to within a
+// frame. Ticks of a clip that was trimmed since are left out.
+func restorePProTicks(metadata gotio.AnyDictionary, clipItem *ClipItem) {
+	ticksIn, okIn := metadataInt(metadata["fcp7xml_ppro_ticks_in"])
+	ticksOut, okOut := metadataInt(metadata["fcp7xml_ppro_ticks_out"])
+	if !okIn || !okOut {
+		return
+	}
+	frameRate := rateToFrameRate(&clipItem.Rate)
+	if math.Abs(ticksToFrames(ticksIn, frameRate)-float64(clipItem.In)) >= 1 ||
+		math.Abs(ticksToFrames(ticksOut, frameRate)-float64(clipItem.Out)) >= 1 {
+		return
+	}
+	clipItem.PProTicksIn, clipItem.PProTicksOut = &ticksIn, &ticksOut
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// binSequence is a sequence found in a document, with the names of the
+// project and bins containing it joined with "/", e.g. "My Project/Edits".
+// binPath is empty for sequences directly under <xmeml>.
+type binSequence struct {
+	sequence *Sequence
+	binPath  string
+}
+
+// collectSequences returns every sequence in xmeml: first those directly
+// under <xmeml>, then those in projects and bins, depth first in document
+// order.
+func collectSequences(xmeml *XMEML) []binSequence {
+	var sequences []binSequence
+	for i := range xmeml.Sequence {
+		sequences = append(sequences, binSequence{sequence: &xmeml.Sequence[i]})
+	}
+	for i := range xmeml.Project {
+		project := &xmeml.Project[i]
+		sequences = collectChildSequences(project.Children, project.Name, sequences)
+	}
+	for i := range xmeml.Bin {
+		bin := &xmeml.Bin[i]
+		sequences = collectChildSequences(bin.Children, bin.Name, sequences)
+	}
+	return sequences
+}
+
+// collectChildSequences appends the sequences in children and its bins to
+// sequences. path is the bin path of children.
+func collectChildSequences(children *Children, path string, sequences []binSequence) []binSequence {
+	if children == nil {
+		return sequences
+	}
+	for i := range children.Sequence {
+		sequences = append(sequences, binSequence{sequence: &children.Sequence[i], binPath: path})
+	}
+	for i := range children.Bin {
+		bin := &children.Bin[i]
+		sequences = collectChildSequences(bin.Children, path+"/"+bin.Name, sequences)
+	}
+	return sequences
+}
+
+// DecodeAll parses FCP7 XML and returns a Timeline for every sequence in it,
+// including sequences inside the <project> and <bin> hierarchy of a full
+// project export. Sequences in bins have their bin path recorded as
+// fcp7xml_bin_path metadata. Warnings() covers all of the sequences.
+func (d *Decoder) DecodeAll() ([]*gotio.Timeline, error) {
+	return d.DecodeAllContext(context.Background())
+}
+
+// DecodeAllContext is like DecodeAll, but gives up and returns ctx.Err() once
+// ctx is done, checking it as DecodeContext does.
+func (d *Decoder) DecodeAllContext(ctx context.Context) ([]*gotio.Timeline, error) {
+	d.ctx = ctx
+	sequences, err := d.readSequences()
+	if err != nil {
+		return nil, d.contextError(err)
+	}
+
+	timelines := make([]*gotio.Timeline, 0, len(sequences))
+	for i, s := range sequences {
+		timeline, err := d.convertSequence(s.sequence, s.binPath)
+		if err != nil {
+			return nil, d.contextError(fmt.Errorf("failed to convert sequence %q: %w", s.sequence.Name, err))
+		}
+		timelines = append(timelines, timeline)
+		d.progress(ProgressSequences, i+1, len(sequences))
+	}
+	return timelines, nil
+}
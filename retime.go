@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// timeRemapID is the effectid of FCP7's time remap, which changes a clip's
+// speed.
+const timeRemapID = "timeremap"
+
+// timeRemapEffect returns a clipitem's time remap effect, which FCP7 writes
+// as a filter and some tools as an effect, or nil.
+func timeRemapEffect(item *ClipItem) *Effect {
+	for i := range item.Effect {
+		if strings.EqualFold(item.Effect[i].EffectID, timeRemapID) {
+			return &item.Effect[i]
+		}
+	}
+	return findFilterEffect(item.Filter, timeRemapID)
+}
+
+// timeScalar returns the constant speed of a time remap as an OTIO time
+// scalar: 0.5 for 50% slow motion, and negative if the clip is reversed,
+// by its reverse flag or a negative speed. ok is false if the speed varies.
+func timeScalar(effect *Effect) (scalar float64, ok bool) {
+	if p := findParameter(effect, "variablespeed"); p != nil && isTrueText(p.Value) {
+		return 0, false
+	}
+	speed := 100.0
+	if p := findParameter(effect, "speed"); p != nil {
+		if len(p.Keyframe) > 0 {
+			return 0, false
+		}
+		if v, err := strconv.ParseFloat(strings.TrimSpace(p.Value), 64); err == nil {
+			speed = v
+		}
+	}
+	scalar = speed / 100
+	if p := findParameter(effect, "reverse"); p != nil && isTrueText(p.Value) {
+		scalar = -math.Abs(scalar)
+	}
+	return scalar, true
+}
+
+// isTrueText reports whether a parameter value is a true boolean, in any of
+// the spellings fcpBool accepts.
+func isTrueText(text string) bool {
+	text = strings.TrimSpace(text)
+	return strings.EqualFold(text, "true") || text == "1"
+}
+
+// retiming returns the time scalar of a clipitem with a constant-speed time
+// remap, and whether its in and out points are given in playback order,
+// which for a reversed clip puts out before in. ok is false if it has no
+// such time remap.
+func retiming(item *ClipItem, inPoint, outPoint int64) (scalar float64, swapped, ok bool) {
+	effect := timeRemapEffect(item)
+	if effect == nil {
+		return 0, false, false
+	}
+	if scalar, ok = timeScalar(effect); !ok {
+		return 0, false, false
+	}
+	return scalar, scalar < 0 && outPoint < inPoint, true
+}
+
+// restoreTimeRemap writes the LinearTimeWarp effect of a clip to its
+// clipitem's time remap, adding one if there is none. A time remap that
+// already gives the same speed is left as it was. A reversed clip has its in
+// and out points swapped back into playback order if fcp7xml_reversed_inout
+// says they were read that way.
+func restoreTimeRemap(clip *gotio.Clip, clipItem *ClipItem) {
+	var warp *gotio.LinearTimeWarp
+	for _, effect := range clip.Effects() {
+		if w, ok := effect.(*gotio.LinearTimeWarp); ok {
+			warp = w
+			break
+		}
+	}
+	if warp == nil {
+		return
+	}
+	scalar := warp.TimeScalar()
+
+	effect := timeRemapEffect(clipItem)
+	if effect == nil {
+		clipItem.Filter, effect = filterEffect(clipItem.Filter, &Effect{
+			Name:           "Time Remap",
+			EffectID:       timeRemapID,
+			EffectCategory: "motion",
+			EffectType:     "motion",
+			MediaType:      "video",
+		})
+	}
+	if current, ok := timeScalar(effect); !ok || current != scalar {
+		parameterFor(effect, "variablespeed").Value = "0"
+		speed := parameterFor(effect, "speed")
+		speed.Keyframe = nil
+		setFloatParameter(speed, math.Abs(scalar)*100)
+		reverse := parameterFor(effect, "reverse")
+		reverse.Value = "FALSE"
+		if scalar < 0 {
+			reverse.Value = "TRUE"
+		}
+	}
+
+	if swapped, _ := clip.Metadata()["fcp7xml_reversed_inout"].(bool); swapped && scalar < 0 {
+		clipItem.In, clipItem.Out = clipItem.Out, clipItem.In
+	}
+}
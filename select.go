@@ -0,0 +1,275 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// SequenceSelector selects one sequence of a document for DecodeSequence.
+// Make one with SequenceIndex or SequenceName.
+type SequenceSelector struct {
+	index  int
+	name   string
+	byName bool
+}
+
+// SequenceIndex selects the sequence at index i of the sequences DecodeAll
+// would return.
+func SequenceIndex(i int) SequenceSelector {
+	return SequenceSelector{index: i}
+}
+
+// SequenceName selects the first sequence named name, matched exactly, in
+// the order DecodeAll would return them.
+func SequenceName(name string) SequenceSelector {
+	return SequenceSelector{name: name, byName: true}
+}
+
+// find returns the index of the selected sequence among those named names,
+// or an error listing the names if there is none.
+func (s SequenceSelector) find(names []string) (int, error) {
+	if len(names) == 0 {
+		return 0, fmt.Errorf("no sequence found in FCP7 XML")
+	}
+	if !s.byName {
+		if s.index < 0 || s.index >= len(names) {
+			return 0, fmt.Errorf("sequence index %d out of range: the document has %d sequences", s.index, len(names))
+		}
+		return s.index, nil
+	}
+	for i, name := range names {
+		if name == s.name {
+			return i, nil
+		}
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = fmt.Sprintf("%q", name)
+	}
+	return 0, fmt.Errorf("no sequence named %q; available sequences: %s", s.name, strings.Join(quoted, ", "))
+}
+
+// mayMatch reports whether a sequence named name, which at least minIndex
+// sequences come before, may be the selected one.
+func (s SequenceSelector) mayMatch(minIndex int, name string) bool {
+	if s.byName {
+		return name == s.name
+	}
+	return minIndex <= s.index
+}
+
+// DecodeSequence parses FCP7 XML and returns a Timeline for the sequence
+// selected by selector. The other sequences are not converted, which makes
+// picking one sequence out of a large project export much cheaper than
+// DecodeAll.
+//
+// The document is read once, a sequence at a time. Each sequence is parsed
+// for its file definitions, which clipitems of the selected sequence may
+// refer to, and then dropped unless it may still be the selected one:
+// sequences in projects and bins are numbered after the top-level ones,
+// which may come later in the document, so a sequence selected by index is
+// only known once the whole document has been read. With
+// DecodeOptions.Sidecar or ExpandNestedSequences set, the whole document
+// is parsed and kept, as those need it.
+func (d *Decoder) DecodeSequence(selector SequenceSelector) (*gotio.Timeline, error) {
+	return d.DecodeSequenceContext(context.Background(), selector)
+}
+
+// DecodeSequenceContext is like DecodeSequence, but gives up and returns
+// ctx.Err() once ctx is done, checking it as DecodeContext does.
+func (d *Decoder) DecodeSequenceContext(ctx context.Context, selector SequenceSelector) (*gotio.Timeline, error) {
+	d.ctx = ctx
+	var timeline *gotio.Timeline
+	var err error
+	if d.opts.Sidecar != nil || d.opts.ExpandNestedSequences {
+		timeline, err = d.decodeSelectedSequence(selector)
+	} else {
+		timeline, err = d.decodeSequenceOnce(selector)
+	}
+	if err != nil {
+		return nil, d.contextError(err)
+	}
+	d.progress(ProgressSequences, 1, 1)
+	return timeline, nil
+}
+
+// decodeSelectedSequence is DecodeSequence for a document parsed in full.
+func (d *Decoder) decodeSelectedSequence(selector SequenceSelector) (*gotio.Timeline, error) {
+	sequences, err := d.readSequences()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(sequences))
+	for i, s := range sequences {
+		names[i] = s.sequence.Name
+	}
+	i, err := selector.find(names)
+	if err != nil {
+		return nil, err
+	}
+	return d.convertSequence(sequences[i].sequence, sequences[i].binPath)
+}
+
+// decodeSequenceOnce is DecodeSequence in a single pass over the document,
+// keeping only the sequences that may be the selected one.
+func (d *Decoder) decodeSequenceOnce(selector SequenceSelector) (*gotio.Timeline, error) {
+	decoder := d.xmlDecoder()
+	root, err := readRootElement(decoder)
+	if err != nil {
+		return nil, err
+	}
+	version, err := xmemlVersion(root)
+	if err != nil {
+		return nil, err
+	}
+	d.prepare(nil, version)
+
+	candidates := make(map[int]*Sequence)
+	entries, err := walkSequences(decoder, func(ordinal, minIndex int, start xml.StartElement) (string, error) {
+		seq := &Sequence{}
+		if err := decodeElement(decoder, seq, start); err != nil {
+			return "", err
+		}
+		forEachClipItem(seq, d.indexFile)
+		if selector.mayMatch(minIndex, seq.Name) {
+			candidates[ordinal] = seq
+		}
+		return seq.Name, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.name
+	}
+	i, err := selector.find(names)
+	if err != nil {
+		return nil, err
+	}
+	selected := entries[i]
+	seq := candidates[selected.ordinal]
+
+	if err := checkNesting(seq, 0, d.maxNestingDepth()); err != nil {
+		return nil, err
+	}
+	forEachClipItem(seq, d.resolveFile)
+	return d.convertSequence(seq, selected.binPath)
+}
+
+// sequenceEntry is a sequence listed by walkSequences.
+type sequenceEntry struct {
+	// ordinal is the position of the sequence in document order
+	ordinal int
+	name    string
+	binPath string
+}
+
+// walkSequences reads the content of an <xmeml> element, calling visit for
+// each sequence directly under it or in its projects and bins, in document
+// order. visit must read the sequence up to its end element, and returns the
+// sequence's name. minIndex is the number of sequences read so far that
+// come before the sequence; sequences read later may add to it. Everything
+// else is skipped. The sequences are returned in the order of
+// collectSequences.
+func walkSequences(decoder *xml.Decoder, visit func(ordinal, minIndex int, start xml.StartElement) (string, error)) ([]sequenceEntry, error) {
+	var ordinal int
+	// seen counts the sequences read so far at the top level, in projects
+	// and in bins, which come in that order
+	seen := make(map[string]int)
+	walkSequence := func(start xml.StartElement, group string, minIndex int) (sequenceEntry, error) {
+		entry := sequenceEntry{ordinal: ordinal}
+		ordinal++
+		seen[group]++
+		var err error
+		entry.name, err = visit(entry.ordinal, minIndex, start)
+		return entry, err
+	}
+	// before returns the number of sequences read so far in group or in a
+	// group that comes before it
+	before := func(group string) int {
+		n := seen[""]
+		if group != "" {
+			n += seen["project"]
+		}
+		if group == "bin" {
+			n += seen["bin"]
+		}
+		return n
+	}
+
+	// walkBin walks a project or bin in group, returning its name and its
+	// sequences with their paths below it, as collectChildSequences orders
+	// them. Sequences directly in it come before those of its bins, so
+	// those read so far don't count towards their minIndex.
+	var walkBin func(group string) (string, []sequenceEntry, error)
+	walkBin = func(group string) (string, []sequenceEntry, error) {
+		var name string
+		var sequences, nested []sequenceEntry
+		err := readChildren(decoder, func(start xml.StartElement) error {
+			switch start.Name.Local {
+			case "name":
+				return decodeElement(decoder, &name, start)
+			case "children":
+				return readChildren(decoder, func(start xml.StartElement) error {
+					switch start.Name.Local {
+					case "sequence":
+						entry, err := walkSequence(start, group, before(group)-len(nested))
+						sequences = append(sequences, entry)
+						return err
+					case "bin":
+						binName, entries, err := walkBin(group)
+						nested = append(nested, prefixBinPath(binName, entries)...)
+						return err
+					}
+					return skipElement(decoder)
+				})
+			}
+			return skipElement(decoder)
+		})
+		return name, append(sequences, nested...), err
+	}
+
+	var sequences, projects, bins []sequenceEntry
+	err := readChildren(decoder, func(start xml.StartElement) error {
+		switch start.Name.Local {
+		case "sequence":
+			entry, err := walkSequence(start, "", before(""))
+			sequences = append(sequences, entry)
+			return err
+		case "project", "bin":
+			name, entries, err := walkBin(start.Name.Local)
+			if start.Name.Local == "project" {
+				projects = append(projects, prefixBinPath(name, entries)...)
+			} else {
+				bins = append(bins, prefixBinPath(name, entries)...)
+			}
+			return err
+		}
+		return skipElement(decoder)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(append(sequences, projects...), bins...), nil
+}
+
+// prefixBinPath puts the sequences of the project or bin named name, with
+// paths below it, at their path including it.
+func prefixBinPath(name string, entries []sequenceEntry) []sequenceEntry {
+	for i := range entries {
+		if entries[i].binPath == "" {
+			entries[i].binPath = name
+		} else {
+			entries[i].binPath = name + "/" + entries[i].binPath
+		}
+	}
+	return entries
+}
@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// SidecarVersion is the version of the sidecar format written by the decoder.
+const SidecarVersion = 1
+
+// Sidecar holds a parsed FCP7 XML document next to the OTIO timeline decoded
+// from it, for the details OTIO has no place for. It is written as JSON by a
+// Decoder with DecodeOptions.Sidecar set, and merged back into the output by
+// an Encoder with EncodeOptions.Sidecar set.
+type Sidecar struct {
+	Version int    `json:"version"`
+	XMEML   *XMEML `json:"xmeml"`
+}
+
+// ReadSidecar reads a JSON sidecar written by the decoder.
+func ReadSidecar(r io.Reader) (*Sidecar, error) {
+	var sidecar Sidecar
+	if err := json.NewDecoder(r).Decode(&sidecar); err != nil {
+		return nil, fmt.Errorf("failed to read sidecar: %w", err)
+	}
+	if sidecar.Version < 1 || sidecar.Version > SidecarVersion {
+		return nil, fmt.Errorf("unsupported sidecar version %d", sidecar.Version)
+	}
+	if sidecar.XMEML == nil {
+		return nil, fmt.Errorf("sidecar has no xmeml document")
+	}
+	return &sidecar, nil
+}
+
+// writeSidecar writes xmeml to w as a JSON sidecar.
+func writeSidecar(w io.Writer, xmeml *XMEML) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(Sidecar{Version: SidecarVersion, XMEML: xmeml}); err != nil {
+		return fmt.Errorf("failed to write sidecar: %w", err)
+	}
+	return nil
+}
+
+// sequence returns the sidecar's sequence named name, or its only sequence
+// if none has that name.
+func (s *Sidecar) sequence(name string) *Sequence {
+	sequences := collectSequences(s.XMEML)
+	for _, seq := range sequences {
+		if seq.sequence.Name == name {
+			return seq.sequence
+		}
+	}
+	if len(sequences) == 1 {
+		return sequences[0].sequence
+	}
+	return nil
+}
+
+// mergeSidecar fills in what the encoder left out of seq from the sidecar's
+// sequence of the same name. Elements the encoder wrote take precedence.
+func mergeSidecar(seq *Sequence, sidecar *Sidecar) {
+	if src := sidecar.sequence(seq.Name); src != nil {
+		mergeValue(reflect.ValueOf(seq).Elem(), reflect.ValueOf(src).Elem())
+		// The encoder writes misplaced tracks under <video> or <audio>
+		seq.Media.Track = nil
+	}
+}
+
+var (
+	clipItemType = reflect.TypeOf(ClipItem{})
+	fileType     = reflect.TypeOf(File{})
+)
+
+// mergeValue copies into dst the parts of src that are absent from dst: nil
+// pointers, empty slices, zero structs, and zero values of fields tagged
+// omitempty. Clipitems are paired by id; other slices element by element when
+// they have the same length.
+func mergeValue(dst, src reflect.Value) {
+	switch dst.Kind() {
+	case reflect.Pointer:
+		switch {
+		case src.IsNil():
+		case dst.IsNil():
+			dst.Set(src)
+		case dst.Type().Elem() == fileType && dst.Interface().(*File).isReference():
+			// The file is defined in full on an earlier clipitem
+		default:
+			mergeValue(dst.Elem(), src.Elem())
+		}
+	case reflect.Slice:
+		switch {
+		case src.Len() == 0:
+		case dst.Len() == 0:
+			dst.Set(src)
+		case dst.Type().Elem() == clipItemType:
+			mergeClipItems(dst, src)
+		case dst.Len() == src.Len():
+			for i := 0; i < dst.Len(); i++ {
+				mergeValue(dst.Index(i), src.Index(i))
+			}
+		}
+	case reflect.Struct:
+		if dst.IsZero() {
+			dst.Set(src)
+			return
+		}
+		for i := 0; i < dst.NumField(); i++ {
+			field := dst.Type().Field(i)
+			if !field.IsExported() || field.Name == "XMLName" {
+				continue
+			}
+			if field.Type.Kind() == reflect.Pointer || field.Type.Kind() == reflect.Slice || field.Type.Kind() == reflect.Struct {
+				mergeValue(dst.Field(i), src.Field(i))
+			} else if dst.Field(i).IsZero() && strings.Contains(field.Tag.Get("xml"), "omitempty") {
+				dst.Field(i).Set(src.Field(i))
+			}
+		}
+	}
+}
+
+// mergeClipItems merges each clipitem in dst with the clipitem in src that
+// has the same id.
+func mergeClipItems(dst, src reflect.Value) {
+	byID := make(map[string]reflect.Value)
+	for i := 0; i < src.Len(); i++ {
+		if id := src.Index(i).Interface().(ClipItem).ID; id != "" {
+			byID[id] = src.Index(i)
+		}
+	}
+	for i := 0; i < dst.Len(); i++ {
+		if item, ok := byID[dst.Index(i).Interface().(ClipItem).ID]; ok {
+			mergeValue(dst.Index(i), item)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSidecarRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("testdata/sidecar.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	var sidecarJSON bytes.Buffer
+	timeline, err := NewDecoderWithOptions(bytes.NewReader(data), DecodeOptions{Sidecar: &sidecarJSON}).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if !strings.Contains(sidecarJSON.String(), `"version": 1`) {
+		t.Errorf("Expected a version 1 sidecar, got:\n%.200s", sidecarJSON.String())
+	}
+	sidecar, err := ReadSidecar(&sidecarJSON)
+	if err != nil {
+		t.Fatalf("ReadSidecar failed: %v", err)
+	}
+
+	encode := func(opts EncodeOptions) *Sequence {
+		var buf bytes.Buffer
+		if err := NewEncoderWithOptions(&buf, opts).Encode(timeline); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		var xmeml XMEML
+		if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+			t.Fatalf("Failed to parse encoded XML: %v", err)
+		}
+		return &xmeml.Sequence[0]
+	}
+
+	// Without the sidecar the unmodeled elements are lost; the sequence
+	// timecode comes from the timeline's global start time either way
+	plain := encode(EncodeOptions{})
+	if plain.Timecode.String != "10:00:00:00" {
+		t.Errorf("Expected sequence timecode 10:00:00:00 without the sidecar, got '%s'", plain.Timecode.String)
+	}
+	if sourceTrack := plain.Media.Video.Track[0].ClipItem[0].SourceTrack; sourceTrack != nil {
+		t.Errorf("Expected no sourcetrack without the sidecar, got %+v", sourceTrack)
+	}
+
+	seq := encode(EncodeOptions{Sidecar: sidecar})
+	if seq.ID != "sequence-1" {
+		t.Errorf("Expected sequence id 'sequence-1', got '%s'", seq.ID)
+	}
+	if seq.Timecode.String != "10:00:00:00" || seq.Timecode.Frame != 900000 || seq.Timecode.Rate.Timebase != 25 {
+		t.Errorf("Expected sequence timecode 10:00:00:00 at 25 fps, got %+v", seq.Timecode)
+	}
+
+	video := seq.Media.Video.Track[0].ClipItem[0]
+	if video.Comments == nil || len(video.Comments.Comment) != 1 || video.Comments.Comment[0].Text != "Check the boom in frame" {
+		t.Errorf("Expected the clip comment to be restored, got %+v", video.Comments)
+	}
+	if video.SourceTrack == nil || video.SourceTrack.MediaType != "video" {
+		t.Errorf("Expected a video sourcetrack, got %+v", video.SourceTrack)
+	}
+	if len(video.Link) != 2 || video.Link[1].LinkClipRef != "clipitem-2" || video.Link[1].TrackIndex != 1 {
+		t.Errorf("Expected the clip's links to be restored, got %+v", video.Link)
+	}
+	chars := video.File.Media.Video.SampleCharacteristics
+	if chars.FieldDominance != "none" || chars.Depth != 24 {
+		t.Errorf("Expected field dominance 'none' and depth 24, got '%s' and %d", chars.FieldDominance, chars.Depth)
+	}
+	audioChars := video.File.Media.Audio.SampleCharacteristics
+	if audioChars.SampleRate != 48000 || audioChars.Channels != 2 {
+		t.Errorf("Expected 48000 Hz stereo audio, got %d Hz and %d channels", audioChars.SampleRate, audioChars.Channels)
+	}
+
+	audio := seq.Media.Audio.Track[0].ClipItem[0]
+	if audio.SourceTrack == nil || audio.SourceTrack.TrackIndex != 1 {
+		t.Errorf("Expected an audio sourcetrack with track index 1, got %+v", audio.SourceTrack)
+	}
+	if !audio.File.isReference() {
+		t.Errorf("Expected the audio clip to reference the shared file, got %+v", *audio.File)
+	}
+
+	// Values the encoder writes take precedence over the sidecar
+	timeline.SetName("Renamed")
+	renamed := encode(EncodeOptions{Sidecar: sidecar})
+	if renamed.Name != "Renamed" {
+		t.Errorf("Expected name 'Renamed', got '%s'", renamed.Name)
+	}
+	if renamed.Timecode.String != "10:00:00:00" {
+		t.Errorf("Expected the only sequence in the sidecar to be used, got timecode '%s'", renamed.Timecode.String)
+	}
+}
+
+func TestReadSidecar_UnsupportedVersion(t *testing.T) {
+	_, err := ReadSidecar(strings.NewReader(`{"version": 2, "xmeml": {}}`))
+	if err == nil {
+		t.Error("Expected error for an unsupported sidecar version")
+	}
+}
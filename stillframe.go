@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"github.com/Avalanche-io/gotio"
+	"github.com/Avalanche-io/gotio/opentime"
+)
+
+// stillFrame reports whether a clipitem is a freeze frame, and if so returns
+// the frame it holds, counted in its rate from the start of the media: the
+// one <stillframeoffset> frames after its in point.
+func stillFrame(item *ClipItem, inPoint int64) (int64, bool) {
+	if item.StillFrame == nil || !*item.StillFrame {
+		return 0, false
+	}
+	var offset int64
+	if item.StillFrameOffset != nil && *item.StillFrameOffset > 0 {
+		offset = *item.StillFrameOffset
+	}
+	return inPoint + offset, true
+}
+
+// freezeFrame turns a clip decoded from a freeze frame clipitem into an OTIO
+// freeze frame: its source range starts at the held frame, keeping its
+// length, and it gets a FreezeFrame effect. The offset is kept as
+// fcp7xml_stillframe_offset metadata.
+func freezeFrame(item *ClipItem, held int64, frameRate float64, sourceRange *opentime.TimeRange, metadata gotio.AnyDictionary) gotio.Effect {
+	*sourceRange = opentime.NewTimeRange(opentime.NewRationalTime(float64(held), frameRate), sourceRange.Duration())
+	metadata["fcp7xml_stillframe"] = true
+	if item.StillFrameOffset != nil {
+		metadata["fcp7xml_stillframe_offset"] = *item.StillFrameOffset
+	}
+	return gotio.NewFreezeFrame("Freeze Frame", nil)
+}
+
+// restoreStillFrame writes a clip with a FreezeFrame effect, or
+// fcp7xml_stillframe metadata, as a freeze frame clipitem. Its in point is
+// moved back from the held frame by fcp7xml_stillframe_offset, as it was read.
+func restoreStillFrame(clip *gotio.Clip, clipItem *ClipItem) {
+	frozen, _ := clip.Metadata()["fcp7xml_stillframe"].(bool)
+	for _, effect := range clip.Effects() {
+		if _, ok := effect.(*gotio.FreezeFrame); ok {
+			frozen = true
+		}
+	}
+	if !frozen {
+		return
+	}
+	clipItem.StillFrame = newFCPBool(true)
+	offset, ok := metadataInt(clip.Metadata()["fcp7xml_stillframe_offset"])
+	if !ok {
+		return
+	}
+	if offset > 0 && offset <= clipItem.In {
+		clipItem.In -= offset
+		clipItem.Out -= offset
+	}
+	clipItem.StillFrameOffset = &offset
+}
@@ -0,0 +1,582 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// decodeStreaming is Decode. The first sequence directly under <xmeml> is
+// read one track at a time; projects and bins before it are parsed in full,
+// as they may hold the sequence to convert if there is none at the top
+// level. With DecodeOptions.Sidecar set the rest of the document is parsed
+// too, and every track is kept as read for the sidecar.
+func (d *Decoder) decodeStreaming() (*gotio.Timeline, error) {
+	decoder := d.xmlDecoder()
+	root, err := readRootElement(decoder)
+	if err != nil {
+		return nil, err
+	}
+	version, err := xmemlVersion(root)
+	if err != nil {
+		return nil, err
+	}
+	d.prepare(nil, version)
+
+	// rest holds the parsed content of the document other than the sequence
+	// being streamed
+	var rest XMEML
+	var stream *sequenceStream
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode XML: %w", err)
+		}
+		if _, ok := tok.(xml.EndElement); ok {
+			break
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		// Once the sequence has been read, the rest of the document is only
+		// needed for the sidecar, and for tracks that refer to files or
+		// nested sequences defined later
+		if stream != nil && !stream.unresolved && d.opts.Sidecar == nil {
+			if err := decoder.Skip(); err != nil {
+				return nil, fmt.Errorf("failed to decode XML: %w", err)
+			}
+			continue
+		}
+		switch start.Name.Local {
+		case "sequence":
+			if stream == nil {
+				line, _ := decoder.InputPos()
+				stream = newSequenceStream(d, start, line)
+				if err := stream.read(decoder); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			var seq Sequence
+			err = decoder.DecodeElement(&seq, &start)
+			rest.Sequence = append(rest.Sequence, seq)
+		case "project":
+			var project Project
+			err = decoder.DecodeElement(&project, &start)
+			rest.Project = append(rest.Project, project)
+		case "bin":
+			var bin Bin
+			err = decoder.DecodeElement(&bin, &start)
+			rest.Bin = append(rest.Bin, bin)
+		default:
+			err = decoder.Skip()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode XML: %w", err)
+		}
+	}
+
+	if d.opts.Sidecar != nil {
+		rest.Version = rootVersion(root)
+		if stream != nil {
+			rest.Sequence = append([]Sequence{stream.sidecarSequence()}, rest.Sequence...)
+		}
+		if err := writeSidecar(d.opts.Sidecar, &rest); err != nil {
+			return nil, err
+		}
+		if stream != nil {
+			rest.Sequence = rest.Sequence[1:]
+		}
+	}
+
+	sequences := collectSequences(&rest)
+	if stream == nil {
+		if len(sequences) == 0 {
+			return nil, fmt.Errorf("no sequence found in FCP7 XML")
+		}
+		all := make([]*Sequence, len(sequences))
+		for i, s := range sequences {
+			if err := checkNesting(s.sequence, 0, d.maxNestingDepth()); err != nil {
+				return nil, err
+			}
+			all[i] = s.sequence
+		}
+		d.prepare(all, version)
+		return d.convertSequence(sequences[0].sequence, sequences[0].binPath)
+	}
+
+	for _, s := range sequences {
+		forEachClipItem(s.sequence, d.indexFile)
+		if d.opts.ExpandNestedSequences {
+			d.indexSequences(s.sequence)
+		}
+	}
+	if d.opts.ExpandNestedSequences {
+		// Sequences nested in held back tracks may be defined here
+		for _, s := range sequences {
+			forEachClipItem(s.sequence, d.resolveFile)
+		}
+	}
+	return stream.finish()
+}
+
+// sequenceStream converts a sequence as it is read. Each track is converted
+// as soon as it has been read unless it may need something that comes later
+// in the document: a file or, with DecodeOptions.ExpandNestedSequences, a
+// nested sequence defined further on, or the other half of a stereo pair
+// (see findStereoPairs), in which case it is held back until the end.
+type sequenceStream struct {
+	d   *Decoder
+	seq Sequence
+	// line is the line the sequence starts on
+	line int
+
+	// header holds the elements of the sequence other than <media>,
+	// re-encoded so that they can be decoded into seq
+	header bytes.Buffer
+
+	// started is set once <media> has been reached. If the sequence has no
+	// rate by then, buffered is set and its tracks are kept in seq and
+	// converted once it has been read, as without streaming.
+	started  bool
+	buffered bool
+
+	// tracks holds every track read, in document order
+	tracks []*streamedTrack
+	// counts holds the number of tracks read of each kind
+	counts map[string]int
+	// links holds the id and links of every clipitem read, by track kind
+	links map[string][]*ClipItem
+	// holdAudio is set once an audio track that may hold half of a stereo
+	// pair has been read; it and every audio track after it are held back
+	holdAudio bool
+	// unresolved is set when a track held back refers to a file or nested
+	// sequence that hasn't been defined yet
+	unresolved bool
+	// kept holds every track as read by container, for the sidecar
+	kept map[string][]Track
+	// timing holds the timing findings in strict mode
+	timing []*TimingError
+}
+
+// streamedTrack is a track read by a sequenceStream: converted, or held back
+// until the sequence has been read.
+type streamedTrack struct {
+	kind    string
+	track   *gotio.Track
+	pending *sequenceTrack
+}
+
+// newSequenceStream returns a sequenceStream for the sequence element start.
+func newSequenceStream(d *Decoder, start xml.StartElement, line int) *sequenceStream {
+	s := &sequenceStream{
+		d:      d,
+		line:   line,
+		counts: make(map[string]int),
+		links:  make(map[string][]*ClipItem),
+		kept:   make(map[string][]Track),
+	}
+	encoder := xml.NewEncoder(&s.header)
+	encoder.EncodeToken(xml.StartElement{Name: xml.Name{Local: start.Name.Local}, Attr: start.Attr})
+	encoder.Flush()
+	d.linkedClips = make(map[string][]*gotio.Clip)
+	return s
+}
+
+// read reads the sequence up to its end element.
+func (s *sequenceStream) read(decoder *xml.Decoder) error {
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return fmt.Errorf("failed to decode XML: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "media" {
+				err = s.readMedia(decoder)
+			} else {
+				err = s.copyElement(decoder, t)
+			}
+			if err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return s.decodeHeader()
+		}
+	}
+}
+
+// copyElement copies the element start and its content to the header. The
+// content is copied as read, so that elements kept as UnknownElement are the
+// same as when the whole document is decoded.
+func (s *sequenceStream) copyElement(decoder *xml.Decoder, start xml.StartElement) error {
+	var element UnknownElement
+	if err := decoder.DecodeElement(&element, &start); err != nil {
+		return fmt.Errorf("failed to decode XML: %w", err)
+	}
+	element.XMLName = xml.Name{Local: start.Name.Local}
+	data, err := xml.Marshal(element)
+	if err != nil {
+		return fmt.Errorf("failed to copy sequence element <%s>: %w", start.Name.Local, err)
+	}
+	s.header.Write(data)
+	return nil
+}
+
+// decodeHeader decodes the header read so far into seq, keeping its media.
+func (s *sequenceStream) decodeHeader() error {
+	data := append(bytes.Clone(s.header.Bytes()), "</sequence>"...)
+	media := s.seq.Media
+	s.seq = Sequence{}
+	if err := xml.Unmarshal(data, &s.seq); err != nil {
+		return fmt.Errorf("failed to decode XML: %w", err)
+	}
+	s.seq.Media = media
+	s.seq.line = s.line
+	return nil
+}
+
+// readMedia reads the <media> element of the sequence, converting its tracks.
+func (s *sequenceStream) readMedia(decoder *xml.Decoder) error {
+	if !s.started {
+		if err := s.decodeHeader(); err != nil {
+			return err
+		}
+		s.started = true
+		s.buffered = s.seq.Rate.Timebase == 0
+		if !s.buffered {
+			s.d.enter(s.seq.Name)
+			s.d.scope = decodeScope{sequence: s.seq.Name, sequenceLine: s.line}
+			s.d.warnAssumedNTSC("sequence", &s.seq.Rate, &s.seq.Timecode.Rate)
+		}
+	}
+
+	media := &s.seq.Media
+	return readChildren(decoder, func(start xml.StartElement) error {
+		switch start.Name.Local {
+		case "video":
+			if media.Video == nil {
+				media.Video = &Video{}
+			}
+			return readChildren(decoder, func(start xml.StartElement) error {
+				switch start.Name.Local {
+				case "format":
+					media.Video.Format = &Format{}
+					return decodeElement(decoder, media.Video.Format, start)
+				case "track":
+					return s.readTrack(decoder, start, gotio.TrackKindVideo, &media.Video.Track)
+				}
+				return skipElement(decoder)
+			})
+		case "audio":
+			if media.Audio == nil {
+				media.Audio = &Audio{}
+			}
+			return readChildren(decoder, func(start xml.StartElement) error {
+				switch start.Name.Local {
+				case "numOutputChannels":
+					return decodeElement(decoder, &media.Audio.NumOutputChannels, start)
+				case "outputs":
+					media.Audio.Outputs = &Outputs{}
+					return decodeElement(decoder, media.Audio.Outputs, start)
+				case "track":
+					return s.readTrack(decoder, start, gotio.TrackKindAudio, &media.Audio.Track)
+				}
+				return skipElement(decoder)
+			})
+		case "track":
+			return s.readTrack(decoder, start, "", &media.Track)
+		}
+		return skipElement(decoder)
+	})
+}
+
+// readTrack reads a track held by the given container, and converts it or
+// holds it back. In buffered mode it is appended to list instead.
+func (s *sequenceStream) readTrack(decoder *xml.Decoder, start xml.StartElement, container string, list *[]Track) error {
+	var track Track
+	if err := decodeElement(decoder, &track, start); err != nil {
+		return err
+	}
+	if err := checkTrackNesting(&track, 0, s.d.maxNestingDepth()); err != nil {
+		return err
+	}
+	if s.buffered {
+		*list = append(*list, track)
+		return nil
+	}
+
+	d := s.d
+	if d.opts.Sidecar != nil {
+		// Files are resolved in place, so the sidecar gets a copy
+		kept, err := copyTrack(&track)
+		if err != nil {
+			return err
+		}
+		s.kept[container] = append(s.kept[container], kept)
+	}
+	forEachTrackClipItem(&track, d.indexFile)
+	forEachTrackClipItem(&track, d.resolveFile)
+	unresolvedSequence := false
+	if d.opts.ExpandNestedSequences {
+		for i := range track.ClipItem {
+			if nested := track.ClipItem[i].Sequence; nested != nil {
+				d.indexSequences(nested)
+			}
+		}
+		var err error
+		if unresolvedSequence, err = s.hasUnresolvedSequence(&track, make(map[*Sequence]bool)); err != nil {
+			return err
+		}
+	}
+
+	t := classifyTrack(&track, container)
+	t.index = s.counts[t.kind]
+	s.counts[t.kind]++
+	for _, item := range track.ClipItem {
+		if item.ID != "" {
+			s.links[t.kind] = append(s.links[t.kind], &ClipItem{ID: item.ID, Link: item.Link})
+		}
+	}
+
+	findings := checkTrackTiming(&track, &s.seq.Rate, t.kind, t.index)
+	if d.opts.Strict {
+		s.timing = append(s.timing, findings...)
+	} else {
+		d.reportTiming(&s.seq, findings)
+	}
+
+	streamed := &streamedTrack{kind: t.kind}
+	s.tracks = append(s.tracks, streamed)
+	switch {
+	case len(s.timing) > 0:
+		// The decode fails once the sequence has been read
+	case t.kind == gotio.TrackKindAudio && (s.holdAudio || mayHoldStereo(&track)):
+		s.holdAudio = true
+		streamed.pending = &t
+	case hasUnresolvedFile(&track) || unresolvedSequence:
+		s.unresolved = true
+		streamed.pending = &t
+	default:
+		d.sequenceAnamorphic = sequenceAnamorphicMode(&s.seq)
+		converted, err := d.convertSequenceTrack(t, t.index, &s.seq)
+		if err != nil {
+			return err
+		}
+		streamed.track = converted
+	}
+	d.progress(ProgressTracks, len(s.tracks), 0)
+	return nil
+}
+
+// finish converts the tracks held back and returns the sequence's timeline.
+func (s *sequenceStream) finish() (*gotio.Timeline, error) {
+	d := s.d
+	linkedClips := d.linkedClips
+	d.linkedClips = nil
+	if !s.started || s.buffered {
+		forEachClipItem(&s.seq, d.indexFile)
+		forEachClipItem(&s.seq, d.resolveFile)
+		if d.opts.ExpandNestedSequences {
+			d.indexSequences(&s.seq)
+		}
+		return d.convertSequence(&s.seq, "")
+	}
+	defer d.leave()
+
+	if len(s.timing) > 0 {
+		return nil, d.reportTiming(&s.seq, s.timing)
+	}
+
+	groups := linkGroups(append(s.links[gotio.TrackKindVideo], s.links[gotio.TrackKindAudio]...))
+	maps.Copy(d.linkGroups, groups)
+	for id, clips := range linkedClips {
+		if group, ok := groups[id]; ok {
+			for _, clip := range clips {
+				clip.Metadata()["fcp7xml_link_group"] = group
+			}
+		}
+	}
+
+	var audioTracks []*Track
+	for _, streamed := range s.tracks {
+		if streamed.pending == nil {
+			continue
+		}
+		forEachTrackClipItem(streamed.pending.track, d.resolveFile)
+		if streamed.kind == gotio.TrackKindAudio {
+			audioTracks = append(audioTracks, streamed.pending.track)
+		}
+	}
+	stereo, merged := findStereoPairs(audioTracks, groups)
+	maps.Copy(d.stereoItems, stereo)
+	maps.Copy(d.mergedItems, merged)
+
+	timeline := d.newSequenceTimeline(&s.seq, "")
+
+	// Tracks held back are converted in order, dropping those holding only
+	// the second channels of stereo pairs as appendSequenceTracks does. The
+	// tracks converted while reading come before any dropped track of their
+	// kind, so their numbers stand.
+	dropped := make(map[string]int)
+	for _, streamed := range s.tracks {
+		t := streamed.pending
+		if t == nil {
+			continue
+		}
+		if hasOnlyMergedItems(t.track, merged) {
+			dropped[t.kind]++
+			continue
+		}
+		track, err := d.convertSequenceTrack(*t, t.index-dropped[t.kind], &s.seq)
+		if err != nil {
+			return nil, err
+		}
+		streamed.track = track
+	}
+
+	for _, kind := range []string{gotio.TrackKindVideo, gotio.TrackKindAudio} {
+		for _, streamed := range s.tracks {
+			if streamed.kind != kind || streamed.track == nil {
+				continue
+			}
+			if err := timeline.Tracks().AppendChild(streamed.track); err != nil {
+				return nil, fmt.Errorf("failed to append %s track: %w", strings.ToLower(kind), err)
+			}
+		}
+	}
+	d.checkSequenceDuration(&s.seq, timeline)
+	d.conformToTargetRate(timeline)
+	return timeline, nil
+}
+
+// sidecarSequence returns the sequence as read, for the sidecar.
+func (s *sequenceStream) sidecarSequence() Sequence {
+	seq := s.seq
+	if !s.started || s.buffered {
+		return seq
+	}
+	seq.Media = Media{Track: s.kept[""]}
+	if s.seq.Media.Video != nil {
+		video := *s.seq.Media.Video
+		video.Track = s.kept[gotio.TrackKindVideo]
+		seq.Media.Video = &video
+	}
+	if s.seq.Media.Audio != nil {
+		audio := *s.seq.Media.Audio
+		audio.Track = s.kept[gotio.TrackKindAudio]
+		seq.Media.Audio = &audio
+	}
+	return seq
+}
+
+// hasUnresolvedSequence reports whether a clipitem on track refers to a
+// nested sequence that hasn't been defined yet, or to one whose tracks
+// refer to a file or sequence that hasn't. It fails for a reference to the
+// sequence being read, which can't be expanded within itself. seen holds
+// the definitions already checked.
+func (s *sequenceStream) hasUnresolvedSequence(track *Track, seen map[*Sequence]bool) (bool, error) {
+	var refs []*Sequence
+	forEachTrackClipItem(track, func(item *ClipItem) {
+		if nested := item.Sequence; nested != nil && nested.Media.Video == nil && nested.Media.Audio == nil {
+			refs = append(refs, nested)
+		}
+	})
+	for _, ref := range refs {
+		if ref.ID == "" {
+			continue
+		}
+		if ref.ID == s.seq.ID {
+			return false, fmt.Errorf("nested sequence %q contains itself", s.seq.Name)
+		}
+		def, ok := s.d.sequences[ref.ID]
+		if !ok {
+			return true, nil
+		}
+		if seen[def] {
+			continue
+		}
+		seen[def] = true
+		for _, t := range classifyTracks(def) {
+			if hasUnresolvedFile(t.track) {
+				return true, nil
+			}
+			if unresolved, err := s.hasUnresolvedSequence(t.track, seen); unresolved || err != nil {
+				return unresolved, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// copyTrack returns a copy of track that shares nothing with it.
+func copyTrack(track *Track) (Track, error) {
+	var copied Track
+	data, err := json.Marshal(track)
+	if err == nil {
+		err = json.Unmarshal(data, &copied)
+	}
+	if err != nil {
+		return Track{}, fmt.Errorf("failed to copy track: %w", err)
+	}
+	return copied, nil
+}
+
+// hasUnresolvedFile reports whether a clipitem on track refers to a file
+// that hasn't been defined yet.
+func hasUnresolvedFile(track *Track) bool {
+	unresolved := false
+	forEachTrackClipItem(track, func(item *ClipItem) {
+		for _, file := range itemFiles(item) {
+			if *file != nil && (*file).isReference() {
+				unresolved = true
+			}
+		}
+	})
+	return unresolved
+}
+
+// readChildren calls f with the start of every child element of the element
+// being read, up to its end element. f must consume the child.
+func readChildren(decoder *xml.Decoder, f func(xml.StartElement) error) error {
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return fmt.Errorf("failed to decode XML: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if err := f(t); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// decodeElement decodes the element start into v.
+func decodeElement(decoder *xml.Decoder, v any, start xml.StartElement) error {
+	if err := decoder.DecodeElement(v, &start); err != nil {
+		return fmt.Errorf("failed to decode XML: %w", err)
+	}
+	return nil
+}
+
+// skipElement skips the element being read.
+func skipElement(decoder *xml.Decoder) error {
+	if err := decoder.Skip(); err != nil {
+		return fmt.Errorf("failed to decode XML: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"github.com/Avalanche-io/gotio"
+	"github.com/Avalanche-io/gotio/opentime"
+)
+
+// conformToTargetRate converts every time in timeline to
+// DecodeOptions.TargetRate, if it is set, keeping what they come to in
+// seconds.
+func (d *Decoder) conformToTargetRate(timeline *gotio.Timeline) {
+	rate := d.opts.TargetRate
+	if rate <= 0 {
+		return
+	}
+	if start := timeline.GlobalStartTime(); start != nil {
+		conformed := start.RescaledTo(rate)
+		timeline.SetGlobalStartTime(&conformed)
+	}
+	conformItem(timeline.Tracks(), rate)
+}
+
+// conformItem converts the times of item, and of its children, media
+// references and markers, to rate.
+func conformItem(item gotio.Item, rate float64) {
+	item.SetSourceRange(conformRange(item.SourceRange(), rate))
+	for _, marker := range item.Markers() {
+		markedRange := marker.MarkedRange()
+		marker.SetMarkedRange(*conformRange(&markedRange, rate))
+	}
+	switch item := item.(type) {
+	case *gotio.Clip:
+		for _, ref := range item.MediaReferences() {
+			ref.SetAvailableRange(conformRange(ref.AvailableRange(), rate))
+		}
+	case gotio.Composition:
+		for _, child := range item.Children() {
+			switch child := child.(type) {
+			case *gotio.Transition:
+				child.SetInOffset(child.InOffset().RescaledTo(rate))
+				child.SetOutOffset(child.OutOffset().RescaledTo(rate))
+			case gotio.Item:
+				conformItem(child, rate)
+			}
+		}
+	}
+}
+
+// conformRange returns r converted to rate, or nil if r is nil.
+func conformRange(r *opentime.TimeRange, rate float64) *opentime.TimeRange {
+	if r == nil {
+		return nil
+	}
+	conformed := opentime.NewTimeRange(r.StartTime().RescaledTo(rate), r.Duration().RescaledTo(rate))
+	return &conformed
+}
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Avalanche-io/gotio"
+	"github.com/Avalanche-io/gotio/opentime"
+)
+
+// Timecode display formats.
+const (
+	displayFormatNDF = "NDF"
+	displayFormatDF  = "DF"
+)
+
+// sequenceStartTime returns the time of the first frame of seq from its
+// <timecode>, or nil if it has none. The <frame> count is used when set, and
+// the timecode string otherwise.
+func sequenceStartTime(seq *Sequence) *opentime.RationalTime {
+	tc := &seq.Timecode
+	rate := itemRate(&tc.Rate, &seq.Rate)
+	if rate.Timebase <= 0 {
+		return nil
+	}
+	frame := tc.Frame
+	if frame == 0 && tc.String != "" {
+		parsed, ok := parseTimecode(tc.String, rate, strings.EqualFold(tc.DisplayFormat, displayFormatDF))
+		if !ok {
+			return nil
+		}
+		frame = parsed
+	}
+	if frame == 0 && tc.String == "" {
+		return nil
+	}
+	start := opentime.NewRationalTime(float64(frame), rateToFrameRate(rate))
+	return &start
+}
+
+// sequenceTimecode returns the <timecode> of a sequence at the given rate
+// that starts at the timeline's global start time, or at frame 0 if it has
+// none. The display format is taken from the timeline's
+// fcp7xml_timecode_displayformat metadata, and is NDF by default.
+func sequenceTimecode(timeline *gotio.Timeline, rate Rate) Timecode {
+	var frame int64
+	if start := timeline.GlobalStartTime(); start != nil && start.Rate() > 0 {
+		frame = max(int64(math.Round(start.ValueRescaledTo(rateToFrameRate(&rate)))), 0)
+	}
+	displayFormat := displayFormatNDF
+	if format, ok := timeline.Metadata()["fcp7xml_timecode_displayformat"].(string); ok && format != "" {
+		displayFormat = format
+	}
+	return Timecode{
+		Rate:          rate,
+		String:        formatTimecode(frame, &rate, strings.EqualFold(displayFormat, displayFormatDF)),
+		Frame:         frame,
+		DisplayFormat: displayFormat,
+	}
+}
+
+// dropFrames returns the number of frame numbers skipped each minute, except
+// every tenth minute, by drop-frame timecode at rate, or 0 if rate has no
+// drop-frame timecode.
+func dropFrames(rate *Rate) int64 {
+	if !rate.NTSC || rate.Timebase%30 != 0 {
+		return 0
+	}
+	return int64(rate.Timebase / 15)
+}
+
+// formatTimecode formats a frame count as HH:MM:SS:FF at rate. Drop-frame
+// timecode is separated by a semicolon before the frames, HH:MM:SS;FF.
+func formatTimecode(frame int64, rate *Rate, dropFrame bool) string {
+	timebase := int64(rate.Timebase)
+	separator := ":"
+	if drop := dropFrames(rate); dropFrame && drop > 0 {
+		separator = ";"
+		framesPer10Minutes := timebase*600 - drop*9
+		framesPerMinute := timebase*60 - drop
+		tens, rest := frame/framesPer10Minutes, frame%framesPer10Minutes
+		frame += drop * 9 * tens
+		if rest > drop {
+			frame += drop * ((rest - drop) / framesPerMinute)
+		}
+	}
+	ff := frame % timebase
+	seconds := frame / timebase
+	return fmt.Sprintf("%02d:%02d:%02d%s%02d", seconds/3600, seconds/60%60, seconds%60, separator, ff)
+}
+
+// parseTimecode parses HH:MM:SS:FF (or HH:MM:SS;FF) timecode at rate into a
+// frame count. It reports false if s is not a timecode.
+func parseTimecode(s string, rate *Rate, dropFrame bool) (int64, bool) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ':' || r == ';' || r == '.' })
+	if len(fields) != 4 {
+		return 0, false
+	}
+	var parts [4]int64
+	for i, field := range fields {
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		parts[i] = n
+	}
+
+	timebase := int64(rate.Timebase)
+	minutes := parts[0]*60 + parts[1]
+	frame := (minutes*60+parts[2])*timebase + parts[3]
+	if drop := dropFrames(rate); (dropFrame || strings.Contains(s, ";")) && drop > 0 {
+		frame -= drop * (minutes - minutes/10)
+	}
+	return frame, true
+}
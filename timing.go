@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// TimingError describes an item whose start/end/in/out/duration values
+// disagree with each other or with another item on the same track.
+type TimingError struct {
+	TrackKind  string // gotio.TrackKindVideo or gotio.TrackKindAudio
+	TrackIndex int
+	Element    string // "clipitem", "transitionitem" or "generatoritem"
+	Name       string
+	Message    string
+}
+
+// Error implements the error interface.
+func (e *TimingError) Error() string {
+	return fmt.Sprintf("%s track %d: %s %q: %s",
+		strings.ToLower(e.TrackKind), e.TrackIndex, e.Element, e.Name, e.Message)
+}
+
+// warning converts the timing error to a decode warning.
+func (e *TimingError) warning() Warning {
+	return Warning{Category: WarningTimingInconsistency, Message: e.Error()}
+}
+
+// path locates the item within its sequence, e.g. "Video 1/Clip A".
+func (e *TimingError) path() string {
+	return trackName(e.TrackKind, e.TrackIndex) + "/" + e.Name
+}
+
+// sequenceTiming cross-checks the timing of every video and audio track of
+// seq, without descending into nested sequences.
+func sequenceTiming(seq *Sequence) []*TimingError {
+	var findings []*TimingError
+	for _, t := range classifyTracks(seq) {
+		findings = append(findings, checkTrackTiming(t.track, &seq.Rate, t.kind, t.index)...)
+	}
+	return findings
+}
+
+// timedSpan is the timeline range occupied by a track item.
+type timedSpan struct {
+	element, name string
+	start, end    int64
+}
+
+// checkTrackTiming cross-checks the start/end/in/out/duration values of every
+// item on an FCP7 track, and reports clipitems and generators that overlap
+// outside of a transition.
+//
+// A clipitem's <duration> is the length of its media, not of the edit, so it
+// is only required to be at least out - in. In/out are counted in the item's
+// rate and start/end in the sequence's rate. Start or end values of -1 (used
+// by FCP7 next to transitions) are not checked.
+func checkTrackTiming(track *Track, sequenceRate *Rate, kind string, index int) []*TimingError {
+	var errs []*TimingError
+	report := func(element, name, format string, args ...interface{}) {
+		errs = append(errs, &TimingError{
+			TrackKind:  kind,
+			TrackIndex: index,
+			Element:    element,
+			Name:       name,
+			Message:    fmt.Sprintf(format, args...),
+		})
+	}
+
+	var spans, transitions []timedSpan
+	checkItem := func(element, name string, rate *Rate, start, end, in, out, duration int64, retimed bool) {
+		if out < in {
+			report(element, name, "out point %d is before in point %d", out, in)
+			return
+		}
+		if duration > 0 && duration < out-in {
+			report(element, name, "duration %d is shorter than out - in (%d)", duration, out-in)
+		}
+		if start < 0 || end < 0 {
+			return
+		}
+		if end < start {
+			report(element, name, "end %d is before start %d", end, start)
+			return
+		}
+		if used := framesInRate(out-in, rate, sequenceRate); !retimed && end-start != used {
+			report(element, name, "end - start (%d) does not match out - in (%d)", end-start, used)
+		}
+		spans = append(spans, timedSpan{element: element, name: name, start: start, end: end})
+	}
+
+	for i := range track.ClipItem {
+		item := &track.ClipItem[i]
+		in, out := mediaInOut(item)
+		if _, swapped, _ := retiming(item, in, out); swapped {
+			in, out = out, in
+		}
+		checkItem("clipitem", item.Name, &item.Rate, item.Start, item.End, in, out, item.Duration, isRetimed(item))
+	}
+	for i := range track.GeneratorItem {
+		item := &track.GeneratorItem[i]
+		checkItem("generatoritem", item.Name, &item.Rate, item.Start, item.End, item.In, item.Out, item.Duration, false)
+	}
+	for i := range track.TransitionItem {
+		item := &track.TransitionItem[i]
+		if item.End <= item.Start {
+			report("transitionitem", item.Name, "end %d is not after start %d", item.End, item.Start)
+			continue
+		}
+		transitions = append(transitions, timedSpan{start: item.Start, end: item.End})
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	for i := 1; i < len(spans); i++ {
+		prev, cur := spans[i-1], spans[i]
+		if prev.end <= cur.start || coveredByTransition(transitions, cur.start, prev.end) {
+			continue
+		}
+		report(cur.element, cur.name, "overlaps %s %q by %d frames", prev.element, prev.name, prev.end-cur.start)
+	}
+
+	return errs
+}
+
+// framesInRate converts a frame count from one rate to another, leaving it
+// unchanged when either rate is unknown.
+func framesInRate(frames int64, from, to *Rate) int64 {
+	if from.Timebase == 0 || to.Timebase == 0 || sameRate(from, to) {
+		return frames
+	}
+	return int64(math.Round(float64(frames) * rateToFrameRate(to) / rateToFrameRate(from)))
+}
+
+// coveredByTransition reports whether a transition spans [start, end).
+func coveredByTransition(transitions []timedSpan, start, end int64) bool {
+	for _, t := range transitions {
+		if t.start <= start && end <= t.end {
+			return true
+		}
+	}
+	return false
+}
+
+// isRetimed reports whether a clipitem carries a time remap, in which case its
+// timeline length legitimately differs from its source length.
+func isRetimed(item *ClipItem) bool {
+	return timeRemapEffect(item) != nil
+}
+
+// mediaInOut returns the in and out points of a clipitem. FCP7 writes an in or
+// out point of -1 for a clipitem that uses its media from the start or to the
+// end; those stand for 0 and the media's duration, taken from the file or
+// else from the clipitem's <duration>. The file counts its duration at its
+// own rate, so where that differs from the clipitem's the clipitem's
+// <duration> is used if it has one, and the file's converted otherwise.
+func mediaInOut(item *ClipItem) (in, out int64) {
+	in, out = item.In, item.Out
+	if in == -1 {
+		in = 0
+	}
+	if out == -1 {
+		file := item.File
+		mixedRate := file != nil && file.Rate.Timebase > 0 && item.Rate.Timebase > 0 && !sameRate(&file.Rate, &item.Rate)
+		switch {
+		case file != nil && file.Duration > 0 && !(mixedRate && item.Duration > 0):
+			out = framesInRate(file.Duration, &file.Rate, &item.Rate)
+		case item.Duration > 0:
+			out = item.Duration
+		default:
+			out = in
+		}
+	}
+	return in, out
+}
@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// sequenceTrack is a track of a sequence with the kind it is decoded as.
+type sequenceTrack struct {
+	track *Track
+	// kind is the OTIO track kind, and index the track's position among
+	// the sequence's tracks of that kind
+	kind  string
+	index int
+	// container is the kind of the <video> or <audio> element holding the
+	// track, or "" for a track directly under <media>
+	container string
+	// fromSource is set when kind comes from the clipitems' <sourcetrack>
+	// rather than from the container
+	fromSource bool
+}
+
+// classifyTracks returns the tracks of seq, video tracks first, in document
+// order within each kind. A track is normally the kind of the <video> or
+// <audio> element containing it; when every clipitem on it names the other
+// media type in its <sourcetrack>, or when it sits directly under <media>,
+// the clipitems decide.
+func classifyTracks(seq *Sequence) []sequenceTrack {
+	var tracks []sequenceTrack
+	add := func(list []Track, container string) {
+		for i := range list {
+			tracks = append(tracks, classifyTrack(&list[i], container))
+		}
+	}
+	if seq.Media.Video != nil {
+		add(seq.Media.Video.Track, gotio.TrackKindVideo)
+	}
+	add(seq.Media.Track, "")
+	if seq.Media.Audio != nil {
+		add(seq.Media.Audio.Track, gotio.TrackKindAudio)
+	}
+
+	sort.SliceStable(tracks, func(i, j int) bool {
+		return tracks[i].kind == gotio.TrackKindVideo && tracks[j].kind != gotio.TrackKindVideo
+	})
+	counts := make(map[string]int)
+	for i := range tracks {
+		tracks[i].index = counts[tracks[i].kind]
+		counts[tracks[i].kind]++
+	}
+	return tracks
+}
+
+// classifyTrack returns track, held by the given container, with the kind it
+// is decoded as. The index is left for the caller to assign.
+func classifyTrack(track *Track, container string) sequenceTrack {
+	t := sequenceTrack{track: track, kind: container, container: container}
+	if kind := sourceTrackKind(track); kind != "" && kind != container {
+		t.kind = kind
+		t.fromSource = true
+	}
+	if t.kind == "" {
+		t.kind = gotio.TrackKindVideo
+	}
+	return t
+}
+
+// sourceTrackKind returns the track kind named by the <sourcetrack> of every
+// clipitem on track, or "" if they disagree or none names one.
+func sourceTrackKind(track *Track) string {
+	kind := ""
+	for _, item := range track.ClipItem {
+		if item.SourceTrack == nil {
+			continue
+		}
+		var itemKind string
+		switch strings.ToLower(item.SourceTrack.MediaType) {
+		case "video":
+			itemKind = gotio.TrackKindVideo
+		case "audio":
+			itemKind = gotio.TrackKindAudio
+		default:
+			continue
+		}
+		if kind != "" && kind != itemKind {
+			return ""
+		}
+		kind = itemKind
+	}
+	return kind
+}
+
+// warning describes how the track was classified, or returns nil if it is
+// simply the kind of its container.
+func (t *sequenceTrack) warning() *Warning {
+	kind := strings.ToLower(t.kind)
+	switch {
+	case t.container == "" && t.fromSource:
+		return &Warning{
+			Category: WarningTrackReclassified,
+			Message:  fmt.Sprintf("track outside <video> and <audio> was decoded as %s because its clipitems' source tracks are %s", kind, kind),
+		}
+	case t.container == "":
+		return &Warning{
+			Category: WarningTrackReclassified,
+			Message:  "track outside <video> and <audio> was decoded as video because its clipitems don't name a media type",
+		}
+	case t.fromSource:
+		return &Warning{
+			Category: WarningTrackReclassified,
+			Message: fmt.Sprintf("track in <%s> was decoded as %s because its clipitems' source tracks are %s",
+				strings.ToLower(t.container), kind, kind),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+// alignmentCut returns the frame of the cut a transition from start to end
+// is aligned on: its start or end for the start and end alignments,
+// including their -black variants, and the frame halfway between them
+// otherwise.
+func alignmentCut(alignment string, start, end int64) int64 {
+	switch alignment {
+	case "start", "start-black":
+		return start
+	case "end", "end-black":
+		return end
+	default:
+		return start + (end-start)/2
+	}
+}
+
+// transitionCut returns the sequence frame of the cut item is aligned on.
+func transitionCut(item *TransitionItem) int64 {
+	return alignmentCut(item.Alignment, item.Start, item.End)
+}
+
+// bounds returns pointers to the start, end, in and out item has on the
+// track, copied from a clipitem or generator, or nils for a transition.
+func (item *trackItem) bounds() (start, end, in, out *int64) {
+	if item.itemType == "transition" {
+		return nil, nil, nil, nil
+	}
+	return &item.start, &item.end, &item.in, &item.out
+}
+
+// joinedClipItem returns the clipitem to convert for item: the parsed one,
+// or a copy with the bounds joinTransitions gave it, so that the parsed
+// document is left as it was.
+func (d *Decoder) joinedClipItem(item *trackItem) *ClipItem {
+	c := item.clipItem
+	if c.Start == item.start && c.End == item.end && c.In == item.in && c.Out == item.out {
+		return c
+	}
+	joined := *c
+	joined.Start, joined.End, joined.In, joined.Out = item.start, item.end, item.in, item.out
+	if d.stereoItems[c] {
+		d.stereoItems[&joined] = true
+	}
+	return &joined
+}
+
+// joinedGenerator is joinedClipItem for a generator.
+func joinedGenerator(item *trackItem) *GeneratorItem {
+	g := item.generator
+	if g.Start == item.start && g.End == item.end && g.In == item.in && g.Out == item.out {
+		return g
+	}
+	joined := *g
+	joined.Start, joined.End, joined.In, joined.Out = item.start, item.end, item.in, item.out
+	return &joined
+}
+
+// sortKey returns the sequence frame items are ordered by on a track: the
+// start of a clipitem or generator and the cut of a transition, which then
+// falls between the items it joins.
+func (item *trackItem) sortKey() int64 {
+	if item.itemType == "transition" {
+		return transitionCut(item.transition)
+	}
+	return item.start
+}
+
+// joinTransitions places the items for clipitems and generators that FCP7
+// writes without a start or end (-1) next to a transition at the cut of that
+// transition. FCP7 counts the media under the whole transition in their in
+// and out points, while in OTIO the part past the cut is handle the
+// Transition reaches into, so the in or out is trimmed by as much. The
+// transition is found by where the item's media would start or end.
+func joinTransitions(items []trackItem) {
+	var transitions []*TransitionItem
+	for _, item := range items {
+		if item.itemType == "transition" {
+			transitions = append(transitions, item.transition)
+		}
+	}
+	if len(transitions) == 0 {
+		return
+	}
+
+	for i := range items {
+		start, end, in, out := items[i].bounds()
+		if start == nil || (*start >= 0 && *end >= 0) || *in < 0 || *out <= *in {
+			continue
+		}
+		length := *out - *in
+
+		var before, after *TransitionItem
+		switch {
+		case *end >= 0:
+			before = findTransition(transitions, func(t *TransitionItem) bool { return t.Start == *end-length })
+		case *start >= 0:
+			after = findTransition(transitions, func(t *TransitionItem) bool { return t.End == *start+length })
+		default:
+			// Between two transitions, which together span the media
+			for _, t := range transitions {
+				next := findTransition(transitions, func(n *TransitionItem) bool { return n.Start > t.Start && n.End-t.Start == length })
+				if next != nil {
+					before, after = t, next
+					break
+				}
+			}
+		}
+
+		if before != nil {
+			cut := transitionCut(before)
+			*in += cut - before.Start
+			*start = cut
+		}
+		if after != nil {
+			cut := transitionCut(after)
+			*out -= after.End - cut
+			*end = cut
+		}
+	}
+}
+
+// findTransition returns the first of transitions that match accepts, or nil.
+func findTransition(transitions []*TransitionItem, match func(*TransitionItem) bool) *TransitionItem {
+	for _, t := range transitions {
+		if match(t) {
+			return t
+		}
+	}
+	return nil
+}
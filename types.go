@@ -3,128 +3,347 @@
 
 package fcp7xml
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
 
 // XMEML represents the root element of a Final Cut Pro 7 XML document.
 type XMEML struct {
-	XMLName  xml.Name   `xml:"xmeml"`
+	XMLName  xml.Name   `xml:"xmeml" json:"-"`
 	Version  string     `xml:"version,attr"`
 	Sequence []Sequence `xml:"sequence"`
+	Project  []Project  `xml:"project,omitempty"` // Full project exports
+	Bin      []Bin      `xml:"bin,omitempty"`     // Bin exports
+}
+
+// Project represents an FCP7 project, as written by a full project export.
+type Project struct {
+	XMLName  xml.Name  `xml:"project" json:"-"`
+	Name     string    `xml:"name"`
+	Children *Children `xml:"children,omitempty"`
+}
+
+// Bin represents a bin (folder) in an FCP7 project.
+type Bin struct {
+	XMLName  xml.Name  `xml:"bin" json:"-"`
+	Name     string    `xml:"name"`
+	Children *Children `xml:"children,omitempty"`
+}
+
+// Children contains the items in a project or bin. Master clips (<clip>)
+// are not modeled and are skipped.
+type Children struct {
+	XMLName  xml.Name   `xml:"children" json:"-"`
+	Bin      []Bin      `xml:"bin,omitempty"`
+	Sequence []Sequence `xml:"sequence,omitempty"`
 }
 
 // Sequence represents a timeline sequence in FCP7.
 type Sequence struct {
-	XMLName  xml.Name `xml:"sequence"`
+	XMLName  xml.Name `xml:"sequence" json:"-"`
+	ID       string   `xml:"id,attr,omitempty"`
 	Name     string   `xml:"name"`
 	Duration int64    `xml:"duration,omitempty"`
 	Rate     Rate     `xml:"rate"`
+	// In and Out are the work area marks, in sequence frames; -1 means the
+	// mark isn't set
+	In       *int64   `xml:"in,omitempty"`
+	Out      *int64   `xml:"out,omitempty"`
 	Timecode Timecode `xml:"timecode,omitempty"`
 	Media    Media    `xml:"media"`
 	Marker   []Marker `xml:"marker,omitempty"`
+	Unknown  []UnknownElement `xml:",any"`
+	// Attrs holds attributes that aren't otherwise modeled, such as those
+	// Premiere Pro writes
+	Attrs    []xml.Attr `xml:",any,attr"`
+
+	line int // see DecodeError
 }
 
 // Rate represents frame rate information.
 type Rate struct {
-	XMLName  xml.Name `xml:"rate"`
+	XMLName  xml.Name `xml:"rate" json:"-"`
 	Timebase int      `xml:"timebase"`
-	NTSC     bool     `xml:"ntsc"`
+	NTSC     fcpBool  `xml:"ntsc"`
+
+	// ntscAssumed is set when <ntsc> was missing and taken as TRUE, so that
+	// the decoder can warn of it
+	ntscAssumed bool
+}
+
+// UnmarshalXML reads a rate. DaVinci Resolve leaves <ntsc> out of some rate
+// blocks; a missing one is taken as TRUE for the timebases that in practice
+// are always NTSC rates, 30 and 60, and as FALSE for any other.
+func (r *Rate) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var rate struct {
+		Timebase int      `xml:"timebase"`
+		NTSC     *fcpBool `xml:"ntsc"`
+	}
+	if err := d.DecodeElement(&rate, &start); err != nil {
+		return err
+	}
+	r.XMLName = start.Name
+	r.Timebase = rate.Timebase
+	r.NTSC = fcpBool(rate.Timebase == 30 || rate.Timebase == 60)
+	r.ntscAssumed = rate.NTSC == nil && bool(r.NTSC)
+	if rate.NTSC != nil {
+		r.NTSC = *rate.NTSC
+	}
+	return nil
+}
+
+// fcpBool is a boolean element. FCP7 writes TRUE or FALSE; true, false, 1
+// and 0 are accepted too.
+type fcpBool bool
+
+// MarshalXML writes b as TRUE or FALSE.
+func (b fcpBool) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	text := "FALSE"
+	if b {
+		text = "TRUE"
+	}
+	return e.EncodeElement(text, start)
+}
+
+// newFCPBool returns a pointer to an fcpBool set to b.
+func newFCPBool(b bool) *fcpBool {
+	v := fcpBool(b)
+	return &v
+}
+
+// UnmarshalXML reads a boolean element in any of the accepted spellings.
+func (b *fcpBool) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var text string
+	if err := d.DecodeElement(&text, &start); err != nil {
+		return err
+	}
+	switch text = strings.TrimSpace(text); {
+	case strings.EqualFold(text, "true") || text == "1":
+		*b = true
+	case strings.EqualFold(text, "false") || text == "0":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %q in <%s>", text, start.Name.Local)
+	}
+	return nil
 }
 
 // Timecode represents timecode information.
 type Timecode struct {
-	XMLName      xml.Name `xml:"timecode"`
+	XMLName      xml.Name `xml:"timecode" json:"-"`
 	Rate         Rate     `xml:"rate"`
 	String       string   `xml:"string,omitempty"`
 	Frame        int64    `xml:"frame,omitempty"`
 	DisplayFormat string   `xml:"displayformat,omitempty"`
+	Reel         *Reel    `xml:"reel,omitempty"`
+}
+
+// Reel identifies the source reel or tape of a piece of media.
+type Reel struct {
+	XMLName xml.Name `xml:"reel" json:"-"`
+	Name    string   `xml:"name"`
 }
 
 // Media contains video and audio tracks.
 type Media struct {
-	XMLName xml.Name `xml:"media"`
+	XMLName xml.Name `xml:"media" json:"-"`
 	Video   *Video   `xml:"video,omitempty"`
 	Audio   *Audio   `xml:"audio,omitempty"`
+	Track   []Track  `xml:"track,omitempty"` // Malformed exports only; see classifyTracks
 }
 
 // Video contains video tracks.
 type Video struct {
-	XMLName xml.Name `xml:"video"`
+	XMLName xml.Name `xml:"video" json:"-"`
+	Format  *Format  `xml:"format,omitempty"`
 	Track   []Track  `xml:"track"`
 }
 
+// Format describes the video format of a sequence.
+type Format struct {
+	XMLName               xml.Name               `xml:"format" json:"-"`
+	SampleCharacteristics *SampleCharacteristics `xml:"samplecharacteristics,omitempty"`
+}
+
 // Audio contains audio tracks.
 type Audio struct {
-	XMLName xml.Name `xml:"audio"`
-	Track   []Track  `xml:"track"`
+	XMLName           xml.Name `xml:"audio" json:"-"`
+	NumOutputChannels int      `xml:"numOutputChannels,omitempty"`
+	Outputs           *Outputs `xml:"outputs,omitempty"`
+	Track             []Track  `xml:"track"`
+}
+
+// Outputs describes how a sequence's audio is routed to its output
+// channels, as groups such as a stereo pair or a mono output.
+type Outputs struct {
+	XMLName xml.Name      `xml:"outputs" json:"-"`
+	Group   []OutputGroup `xml:"group"`
+}
+
+// OutputGroup is one output of a sequence, carrying NumChannels of its
+// output channels.
+type OutputGroup struct {
+	XMLName     xml.Name        `xml:"group" json:"-"`
+	Index       int             `xml:"index"`
+	NumChannels int             `xml:"numchannels"`
+	Downmix     int             `xml:"downmix"`
+	Channel     []OutputChannel `xml:"channel"`
+}
+
+// OutputChannel is an output channel of a sequence, by its 1-based index.
+type OutputChannel struct {
+	XMLName xml.Name `xml:"channel" json:"-"`
+	Index   int      `xml:"index"`
 }
 
 // Track represents a single video or audio track.
 type Track struct {
-	XMLName        xml.Name         `xml:"track"`
-	Enabled        *bool            `xml:"enabled,omitempty"`
-	Locked         *bool            `xml:"locked,omitempty"`
+	XMLName        xml.Name         `xml:"track" json:"-"`
+	// Name is the track's name. FCP7 tracks have none; Premiere writes it
+	// as the MZ.TrackName attribute, which FCP7 ignores.
+	Name           string           `xml:"MZ.TrackName,attr,omitempty"`
+	Enabled        *fcpBool         `xml:"enabled,omitempty"`
+	Locked         *fcpBool         `xml:"locked,omitempty"`
+	// OutputChannelIndex is the audio output channel an audio track is
+	// routed to, one of those of the sequence's <outputs>
+	OutputChannelIndex *int         `xml:"outputchannelindex,omitempty"`
 	ClipItem       []ClipItem       `xml:"clipitem"`
 	TransitionItem []TransitionItem `xml:"transitionitem"`
 	GeneratorItem  []GeneratorItem  `xml:"generatoritem"`
+	Unknown        []UnknownElement `xml:",any"`
+	Attrs          []xml.Attr       `xml:",any,attr"` // As for Sequence
+
+	line int // see DecodeError
 }
 
 // ClipItem represents a clip in a track.
 type ClipItem struct {
-	XMLName      xml.Name   `xml:"clipitem"`
+	XMLName      xml.Name   `xml:"clipitem" json:"-"`
 	ID           string     `xml:"id,attr,omitempty"`
+	MasterClipID string     `xml:"masterclipid,omitempty"`
 	Name         string     `xml:"name"`
-	Enabled      *bool      `xml:"enabled,omitempty"`
+	Enabled      *fcpBool   `xml:"enabled,omitempty"`
 	Duration     int64      `xml:"duration"`
 	Rate         Rate       `xml:"rate"`
 	Start        int64      `xml:"start"`
 	End          int64      `xml:"end"`
 	In           int64      `xml:"in"`
 	Out          int64      `xml:"out"`
+	// PProTicksIn and PProTicksOut are Premiere Pro's in and out points, in
+	// 254016000000ths of a second.
+	PProTicksIn  *int64     `xml:"pproTicksIn,omitempty"`
+	PProTicksOut *int64     `xml:"pproTicksOut,omitempty"`
+	// StillFrame marks a freeze frame, which shows the frame StillFrameOffset
+	// frames after In for its whole length.
+	StillFrame       *fcpBool `xml:"stillframe,omitempty"`
+	StillFrameOffset *int64   `xml:"stillframeoffset,omitempty"`
+	Anamorphic   *fcpBool   `xml:"anamorphic,omitempty"`
+	AlphaType    string     `xml:"alphatype,omitempty"` // none, straight, premultiplied, black or white
+	PixelAspectRatio string `xml:"pixelaspectratio,omitempty"` // Overrides the file's
 	File         *File      `xml:"file,omitempty"`
+	SubclipInfo  *SubclipInfo `xml:"subclipinfo,omitempty"`
+	Stereo3D     *Stereo3D  `xml:"stereo3d,omitempty"`
 	Sequence     *Sequence  `xml:"sequence,omitempty"` // For nested sequences
+	Multiclip    *Multiclip `xml:"multiclip,omitempty"` // For multicam clips
 	SourceTrack  *SourceTrack `xml:"sourcetrack,omitempty"`
+	LoggingInfo  *LoggingInfo `xml:"logginginfo,omitempty"`
 	Labels       *Labels    `xml:"labels,omitempty"`
 	Comments     *Comments  `xml:"comments,omitempty"`
 	Link         []Link     `xml:"link,omitempty"`
 	Filter       []Filter   `xml:"filter,omitempty"`
 	Effect       []Effect   `xml:"effect,omitempty"`
 	Marker       []Marker   `xml:"marker,omitempty"`
+	Unknown      []UnknownElement `xml:",any"`
+	Attrs        []xml.Attr `xml:",any,attr"` // As for Sequence
+
+	line int // see DecodeError
+}
+
+// Multiclip represents a multicam clip: angles of the same scene, one of
+// which is active.
+type Multiclip struct {
+	XMLName     xml.Name         `xml:"multiclip" json:"-"`
+	ID          string           `xml:"id,attr,omitempty"`
+	Name        string           `xml:"name,omitempty"`
+	ActiveAngle int              `xml:"activeangle,omitempty"`
+	MCSource    []MCSource       `xml:"mcsource"`
+	Unknown     []UnknownElement `xml:",any"`
+}
+
+// MCSource represents an angle of a multiclip.
+type MCSource struct {
+	XMLName xml.Name         `xml:"mcsource" json:"-"`
+	Name    string           `xml:"name,omitempty"`
+	Angle   int              `xml:"angle"`
+	File    *File            `xml:"file,omitempty"`
+	Unknown []UnknownElement `xml:",any"`
 }
 
 // File represents a media file reference.
 type File struct {
-	XMLName     xml.Name    `xml:"file"`
+	XMLName     xml.Name    `xml:"file" json:"-"`
 	ID          string      `xml:"id,attr"`
 	Name        string      `xml:"name"`
 	PathURL     string      `xml:"pathurl,omitempty"`
 	Rate        Rate        `xml:"rate,omitempty"`
 	Duration    int64       `xml:"duration,omitempty"`
 	Timecode    *Timecode   `xml:"timecode,omitempty"`
+	Reel        *Reel       `xml:"reel,omitempty"` // Some exporters place the reel outside timecode
 	Media       *FileMedia  `xml:"media,omitempty"`
+	LoggingInfo *LoggingInfo `xml:"logginginfo,omitempty"`
+	Unknown     []UnknownElement `xml:",any"`
+}
+
+// isReference reports whether f only refers to a file defined earlier in the
+// document by its id, as in <file id="file-1"/>.
+func (f *File) isReference() bool {
+	return f.ID != "" && f.Name == "" && f.PathURL == "" && f.Rate == (Rate{}) && f.Duration == 0 &&
+		f.Timecode == nil && f.Reel == nil && f.Media == nil && f.LoggingInfo == nil && len(f.Unknown) == 0
+}
+
+// fileFields has the fields of File without its methods.
+type fileFields File
+
+// MarshalXML encodes a file, writing a reference to an earlier definition as
+// an empty element.
+func (f File) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if f.isReference() {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "id"}, Value: f.ID})
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		return e.EncodeToken(start.End())
+	}
+	return e.EncodeElement(fileFields(f), start)
 }
 
 // FileMedia contains video and audio track information for a file.
 type FileMedia struct {
-	XMLName xml.Name   `xml:"media"`
+	XMLName xml.Name   `xml:"media" json:"-"`
 	Video   *FileVideo `xml:"video,omitempty"`
 	Audio   *FileAudio `xml:"audio,omitempty"`
 }
 
 // FileVideo contains video track information.
 type FileVideo struct {
-	XMLName        xml.Name        `xml:"video"`
+	XMLName        xml.Name        `xml:"video" json:"-"`
 	SampleCharacteristics *SampleCharacteristics `xml:"samplecharacteristics,omitempty"`
 }
 
 // FileAudio contains audio track information.
 type FileAudio struct {
-	XMLName        xml.Name        `xml:"audio"`
+	XMLName        xml.Name        `xml:"audio" json:"-"`
 	SampleCharacteristics *SampleCharacteristics `xml:"samplecharacteristics,omitempty"`
+	// ChannelCount is the number of audio channels in the file. FCP7 writes
+	// it after <samplecharacteristics> rather than inside it.
+	ChannelCount   int             `xml:"channelcount,omitempty"`
 }
 
 // SampleCharacteristics defines media characteristics.
 type SampleCharacteristics struct {
-	XMLName       xml.Name `xml:"samplecharacteristics"`
+	XMLName       xml.Name `xml:"samplecharacteristics" json:"-"`
 	Rate          *Rate    `xml:"rate,omitempty"`
 	Width         int      `xml:"width,omitempty"`
 	Height        int      `xml:"height,omitempty"`
@@ -136,34 +355,87 @@ type SampleCharacteristics struct {
 	Channels      int      `xml:"channelcount,omitempty"`
 }
 
+// SubclipInfo limits a subclip to part of its master clip's media: the
+// offsets are the frames left out at the start and end of the media.
+type SubclipInfo struct {
+	XMLName     xml.Name `xml:"subclipinfo" json:"-"`
+	StartOffset int64    `xml:"startoffset"`
+	EndOffset   int64    `xml:"endoffset"`
+}
+
 // SourceTrack identifies which track in the source file.
 type SourceTrack struct {
-	XMLName   xml.Name `xml:"sourcetrack"`
+	XMLName   xml.Name `xml:"sourcetrack" json:"-"`
 	MediaType string   `xml:"mediatype"`
 	TrackIndex int     `xml:"trackindex,omitempty"`
 }
 
-// Labels contains color labels for clips.
+// Stereo3D holds the stereoscopic settings written by 3D plugins on a
+// clipitem of a stereo project. Its content isn't standardized, so it is kept
+// as raw XML; Eye reads the eye designation from it.
+type Stereo3D struct {
+	XMLName xml.Name `xml:"stereo3d" json:"-"`
+	Inner   string   `xml:",innerxml"`
+}
+
+// Eye returns the eye the clipitem is for, "left" or "right", read from an
+// <eye> element that holds left, right, L or R. It returns "" if there is
+// none.
+func (s *Stereo3D) Eye() string {
+	var settings struct {
+		Eye string `xml:"eye"`
+	}
+	if err := xml.Unmarshal([]byte("<stereo3d>"+s.Inner+"</stereo3d>"), &settings); err != nil {
+		return ""
+	}
+	switch strings.ToLower(strings.TrimSpace(settings.Eye)) {
+	case "left", "l":
+		return "left"
+	case "right", "r":
+		return "right"
+	}
+	return ""
+}
+
+// Labels contains labels for clips. Label is the master clip's label and
+// Label2 its color label; scripts may use them for different purposes.
 type Labels struct {
-	XMLName xml.Name `xml:"labels"`
+	XMLName xml.Name `xml:"labels" json:"-"`
+	Label   string   `xml:"label,omitempty"`
 	Label2  string   `xml:"label2,omitempty"`
 }
 
+// LoggingInfo contains the logging fields of a clip or file, as used in
+// dailies. Fields that are absent are nil, so that empty fields are kept.
+type LoggingInfo struct {
+	XMLName     xml.Name         `xml:"logginginfo" json:"-"`
+	Description *string          `xml:"description"`
+	Scene       *string          `xml:"scene"`
+	ShotTake    *string          `xml:"shottake"`
+	LogNote     *string          `xml:"lognote"`
+	Good        *fcpBool         `xml:"good"`
+	Unknown     []UnknownElement `xml:",any"`
+}
+
 // Comments contains clip comments.
 type Comments struct {
-	XMLName xml.Name `xml:"comments"`
-	Comment []Comment `xml:"comment"`
+	XMLName        xml.Name  `xml:"comments" json:"-"`
+	MasterComment1 string    `xml:"mastercomment1,omitempty"`
+	MasterComment2 string    `xml:"mastercomment2,omitempty"`
+	MasterComment3 string    `xml:"mastercomment3,omitempty"`
+	MasterComment4 string    `xml:"mastercomment4,omitempty"`
+	Comment        []Comment `xml:"comment"`
 }
 
 // Comment represents a single comment.
 type Comment struct {
-	XMLName xml.Name `xml:"comment"`
+	XMLName xml.Name `xml:"comment" json:"-"`
 	Text    string   `xml:",chardata"`
 }
 
 // Link represents a link between clips.
 type Link struct {
-	XMLName    xml.Name `xml:"link"`
+	XMLName    xml.Name `xml:"link" json:"-"`
 	LinkClipRef string  `xml:"linkclipref"`
 	MediaType   string  `xml:"mediatype,omitempty"`
 	TrackIndex  int     `xml:"trackindex,omitempty"`
@@ -171,8 +443,8 @@ type Link struct {
 
 // Filter represents an effect or filter applied to a clip.
 type Filter struct {
-	XMLName xml.Name `xml:"filter"`
-	Enabled *bool    `xml:"enabled,omitempty"`
+	XMLName xml.Name `xml:"filter" json:"-"`
+	Enabled *fcpBool `xml:"enabled,omitempty"`
 	Start   int64    `xml:"start,omitempty"`
 	End     int64    `xml:"end,omitempty"`
 	Effect  *Effect  `xml:"effect,omitempty"`
@@ -180,22 +452,26 @@ type Filter struct {
 
 // Effect represents an effect or processing operation.
 type Effect struct {
-	XMLName        xml.Name     `xml:"effect"`
+	XMLName        xml.Name     `xml:"effect" json:"-"`
 	Name           string       `xml:"name"`
 	EffectID       string       `xml:"effectid"`
 	EffectType     string       `xml:"effecttype"`
 	MediaType      string       `xml:"mediatype"`
 	EffectCategory string       `xml:"effectcategory,omitempty"`
 	Duration       int64        `xml:"duration,omitempty"`
+	// WipeCode selects the pattern of a wipe transition, and WipeAccuracy
+	// the precision of its edge.
+	WipeCode       *int64       `xml:"wipecode,omitempty"`
+	WipeAccuracy   *int64       `xml:"wipeaccuracy,omitempty"`
 	StartRatio     *float64     `xml:"startratio,omitempty"`
 	EndRatio       *float64     `xml:"endratio,omitempty"`
-	Reverse        *bool        `xml:"reverse,omitempty"`
+	Reverse        *fcpBool     `xml:"reverse,omitempty"`
 	Parameter      []Parameter  `xml:"parameter,omitempty"`
 }
 
 // Parameter represents an effect parameter.
 type Parameter struct {
-	XMLName      xml.Name `xml:"parameter"`
+	XMLName      xml.Name `xml:"parameter" json:"-"`
 	ParameterID  string   `xml:"parameterid,omitempty"`
 	Name         string   `xml:"name,omitempty"`
 	Value        string   `xml:"value,omitempty"`
@@ -203,22 +479,144 @@ type Parameter struct {
 	ValueMin     *float64 `xml:"valuemin,omitempty"`
 	ValueMax     *float64 `xml:"valuemax,omitempty"`
 	ValueList    string   `xml:"valuelist,omitempty"`
+	Keyframe     []Keyframe `xml:"keyframe,omitempty"`
+
+	// ValueXML holds the content of a structured <value>, such as
+	// <horiz>/<vert> for a point or <red>/<green>/<blue> for a color. Value
+	// is empty when ValueXML is set.
+	ValueXML string `xml:"-"`
+}
+
+// parameterValue is the raw form of a parameter's <value> element.
+type parameterValue struct {
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+// parameterXML mirrors Parameter with <value> in its raw form.
+type parameterXML struct {
+	XMLName     xml.Name        `xml:"parameter"`
+	ParameterID string          `xml:"parameterid,omitempty"`
+	Name        string          `xml:"name,omitempty"`
+	Value       *parameterValue `xml:"value,omitempty"`
+	ValueID     string          `xml:"valueid,omitempty"`
+	ValueMin    *float64        `xml:"valuemin,omitempty"`
+	ValueMax    *float64        `xml:"valuemax,omitempty"`
+	ValueList   string          `xml:"valuelist,omitempty"`
+	Keyframe    []Keyframe      `xml:"keyframe,omitempty"`
+}
+
+// UnmarshalXML decodes a parameter, keeping structured values in ValueXML.
+func (p *Parameter) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var raw parameterXML
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+	*p = Parameter{
+		XMLName:     raw.XMLName,
+		ParameterID: raw.ParameterID,
+		Name:        raw.Name,
+		ValueID:     raw.ValueID,
+		ValueMin:    raw.ValueMin,
+		ValueMax:    raw.ValueMax,
+		ValueList:   raw.ValueList,
+		Keyframe:    raw.Keyframe,
+	}
+	if raw.Value != nil {
+		if strings.Contains(raw.Value.Inner, "<") {
+			p.ValueXML = strings.TrimSpace(raw.Value.Inner)
+		} else {
+			p.Value = raw.Value.Text
+		}
+	}
+	return nil
+}
+
+// MarshalXML encodes a parameter, writing ValueXML as the <value> content
+// when it is set.
+func (p Parameter) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	raw := parameterXML{
+		ParameterID: p.ParameterID,
+		Name:        p.Name,
+		ValueID:     p.ValueID,
+		ValueMin:    p.ValueMin,
+		ValueMax:    p.ValueMax,
+		ValueList:   p.ValueList,
+		Keyframe:    p.Keyframe,
+	}
+	if p.ValueXML != "" {
+		raw.Value = &parameterValue{Inner: p.ValueXML}
+	} else if p.Value != "" {
+		raw.Value = &parameterValue{Text: p.Value}
+	}
+	return e.EncodeElement(raw, start)
+}
+
+// Keyframe is a parameter value at a frame, relative to the start of the
+// item the effect is applied to.
+type Keyframe struct {
+	XMLName       xml.Name `xml:"keyframe" json:"-"`
+	When          int64    `xml:"when"`
+	Value         string   `xml:"value"`
+	Interpolation string   `xml:"interpolation>name,omitempty"`
+
+	// ValueXML holds a structured value, as for Parameter.ValueXML.
+	ValueXML string `xml:"-"`
+}
+
+// keyframeXML mirrors Keyframe with <value> in its raw form.
+type keyframeXML struct {
+	XMLName       xml.Name        `xml:"keyframe"`
+	When          int64           `xml:"when"`
+	Value         *parameterValue `xml:"value"`
+	Interpolation string          `xml:"interpolation>name,omitempty"`
+}
+
+// UnmarshalXML decodes a keyframe, keeping structured values in ValueXML.
+func (k *Keyframe) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var raw keyframeXML
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+	*k = Keyframe{XMLName: raw.XMLName, When: raw.When, Interpolation: raw.Interpolation}
+	if raw.Value != nil {
+		if strings.Contains(raw.Value.Inner, "<") {
+			k.ValueXML = strings.TrimSpace(raw.Value.Inner)
+		} else {
+			k.Value = raw.Value.Text
+		}
+	}
+	return nil
+}
+
+// MarshalXML encodes a keyframe, writing ValueXML as the <value> content when
+// it is set.
+func (k Keyframe) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	raw := keyframeXML{When: k.When, Interpolation: k.Interpolation}
+	if k.ValueXML != "" {
+		raw.Value = &parameterValue{Inner: k.ValueXML}
+	} else {
+		raw.Value = &parameterValue{Text: k.Value}
+	}
+	return e.EncodeElement(raw, start)
 }
 
 // TransitionItem represents a transition in a track.
 type TransitionItem struct {
-	XMLName   xml.Name `xml:"transitionitem"`
+	XMLName   xml.Name `xml:"transitionitem" json:"-"`
 	Name      string   `xml:"name"`
 	Rate      Rate     `xml:"rate"`
 	Start     int64    `xml:"start"`
 	End       int64    `xml:"end"`
 	Alignment string   `xml:"alignment"`
 	Effect    *Effect  `xml:"effect,omitempty"`
+
+	line int // see DecodeError
 }
 
 // GeneratorItem represents a generator clip (slug, color bars, etc).
 type GeneratorItem struct {
-	XMLName     xml.Name `xml:"generatoritem"`
+	XMLName     xml.Name `xml:"generatoritem" json:"-"`
 	Name        string   `xml:"name"`
 	Duration    int64    `xml:"duration"`
 	Rate        Rate     `xml:"rate"`
@@ -226,17 +624,19 @@ type GeneratorItem struct {
 	End         int64    `xml:"end"`
 	In          int64    `xml:"in,omitempty"`
 	Out         int64    `xml:"out,omitempty"`
-	Enabled     *bool    `xml:"enabled,omitempty"`
-	Anamorphic  *bool    `xml:"anamorphic,omitempty"`
+	Enabled     *fcpBool `xml:"enabled,omitempty"`
+	Anamorphic  *fcpBool `xml:"anamorphic,omitempty"`
 	AlphaType   string   `xml:"alphatype,omitempty"`
 	Effect      *Effect  `xml:"effect,omitempty"`
 	Filter      []Filter `xml:"filter,omitempty"`
 	Marker      []Marker `xml:"marker,omitempty"`
+
+	line int // see DecodeError
 }
 
 // Marker represents a marker in a clip or sequence.
 type Marker struct {
-	XMLName xml.Name `xml:"marker"`
+	XMLName xml.Name `xml:"marker" json:"-"`
 	Name    string   `xml:"name"`
 	Comment string   `xml:"comment,omitempty"`
 	In      int64    `xml:"in"`
@@ -246,7 +646,7 @@ type Marker struct {
 
 // Color represents an RGB color value.
 type Color struct {
-	XMLName xml.Name `xml:"color"`
+	XMLName xml.Name `xml:"color" json:"-"`
 	Red     int      `xml:"red"`
 	Green   int      `xml:"green"`
 	Blue    int      `xml:"blue"`
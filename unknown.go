@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"encoding/xml"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// UnknownElement holds a child element that isn't otherwise modeled, such as
+// <uuid>, as read, so that it can be written back unchanged.
+type UnknownElement struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Inner   string     `xml:",innerxml"`
+}
+
+// unknownToMetadata returns elements as XML fragments, in document order, or
+// nil if there are none.
+func unknownToMetadata(elements []UnknownElement) []string {
+	if len(elements) == 0 {
+		return nil
+	}
+	fragments := make([]string, 0, len(elements))
+	for _, element := range elements {
+		data, err := xml.Marshal(element)
+		if err != nil {
+			continue
+		}
+		fragments = append(fragments, string(data))
+	}
+	return fragments
+}
+
+// setUnknownMetadata stores elements as fcp7xml_unknown metadata, if there
+// are any. metadata must not be nil.
+func setUnknownMetadata(metadata gotio.AnyDictionary, elements []UnknownElement) {
+	if fragments := unknownToMetadata(elements); len(fragments) > 0 {
+		metadata["fcp7xml_unknown"] = fragments
+	}
+}
+
+// metadataToUnknown parses the fcp7xml_unknown fragments stored by the
+// decoder. Fragments that aren't well-formed XML are skipped.
+func metadataToUnknown(metadata gotio.AnyDictionary) []UnknownElement {
+	fragments, _ := metadataStrings(metadata["fcp7xml_unknown"])
+	var elements []UnknownElement
+	for _, fragment := range fragments {
+		var element UnknownElement
+		if err := xml.Unmarshal([]byte(fragment), &element); err != nil {
+			continue
+		}
+		elements = append(elements, element)
+	}
+	return elements
+}
@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"math"
+
+	"github.com/Avalanche-io/gotio"
+	"github.com/Avalanche-io/gotio/opentime"
+)
+
+// notSet is the value FCP7 writes for an in or out mark that isn't set.
+const notSet = -1
+
+// workAreaToMetadata stores the <in> and <out> marks of a sequence as
+// fcp7xml_work_area metadata: the frames of the marks that are set, and the
+// sequence rate they are counted in. It returns nil if the sequence has
+// neither element.
+func workAreaToMetadata(seq *Sequence) gotio.AnyDictionary {
+	if seq.In == nil && seq.Out == nil {
+		return nil
+	}
+	md := gotio.AnyDictionary{}
+	if seq.In != nil && *seq.In != notSet {
+		md["in"] = *seq.In
+	}
+	if seq.Out != nil && *seq.Out != notSet {
+		md["out"] = *seq.Out
+	}
+	if seq.Rate.Timebase > 0 {
+		md["timebase"] = int64(seq.Rate.Timebase)
+		md["ntsc"] = bool(seq.Rate.NTSC)
+	}
+	return md
+}
+
+// setWorkArea restores the <in> and <out> marks stored by the decoder on
+// sequence, writing -1 for a mark that isn't set. Marks are converted to the
+// rate of the sequence if it differs from the one they were counted in.
+func setWorkArea(sequence *Sequence, metadata gotio.AnyDictionary) {
+	md, ok := metadataDict(metadata["fcp7xml_work_area"])
+	if !ok {
+		return
+	}
+	markRate, ownRate := metadataToRate(md)
+	mark := func(key string) *int64 {
+		frame := int64(notSet)
+		if value, ok := metadataInt(md[key]); ok {
+			frame = value
+			if ownRate && rateToFrameRate(&markRate) != rateToFrameRate(&sequence.Rate) {
+				seconds := float64(value) / rateToFrameRate(&markRate)
+				frame = int64(math.Round(seconds * rateToFrameRate(&sequence.Rate)))
+			}
+		}
+		return &frame
+	}
+	sequence.In, sequence.Out = mark("in"), mark("out")
+}
+
+// WorkArea returns the range between the in and out marks of the sequence
+// timeline was decoded from, the part of it FCP7 renders or exports. It
+// reports false if either mark isn't set.
+func WorkArea(timeline *gotio.Timeline) (opentime.TimeRange, bool) {
+	md, ok := metadataDict(timeline.Metadata()["fcp7xml_work_area"])
+	if !ok {
+		return opentime.TimeRange{}, false
+	}
+	rate, ok := metadataToRate(md)
+	in, hasIn := metadataInt(md["in"])
+	out, hasOut := metadataInt(md["out"])
+	if !ok || !hasIn || !hasOut || out < in {
+		return opentime.TimeRange{}, false
+	}
+	frameRate := rateToFrameRate(&rate)
+	return opentime.NewTimeRange(
+		opentime.NewRationalTime(float64(in), frameRate),
+		opentime.NewRationalTime(float64(out-in), frameRate),
+	), true
+}
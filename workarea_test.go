@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcp7xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// workAreaXML returns a one-clip sequence with the given <in> and <out>
+// elements.
+func workAreaXML(marks string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xmeml>
+<xmeml version="5">
+  <sequence id="sequence-1">
+    <name>Work Area</name>
+    <duration>480</duration>
+    <rate>
+      <timebase>24</timebase>
+      <ntsc>FALSE</ntsc>
+    </rate>
+    %s
+    <media>
+      <video>
+        <track>
+          <clipitem id="clipitem-1">
+            <name>Shot A</name>
+            <start>0</start>
+            <end>480</end>
+            <in>0</in>
+            <out>480</out>
+          </clipitem>
+        </track>
+      </video>
+    </media>
+  </sequence>
+</xmeml>`, marks)
+}
+
+// encodeWorkArea encodes timeline and returns the <in> and <out> of its
+// sequence.
+func encodeWorkArea(t *testing.T, timeline *gotio.Timeline, opts EncodeOptions) (in, out *int64) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := NewEncoderWithOptions(&buf, opts).Encode(timeline); err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+	var xmeml XMEML
+	if err := xml.Unmarshal(buf.Bytes(), &xmeml); err != nil {
+		t.Fatalf("Failed to parse XML: %v", err)
+	}
+	return xmeml.Sequence[0].In, xmeml.Sequence[0].Out
+}
+
+func TestWorkAreaRoundTrip(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(workAreaXML("<in>48</in>\n    <out>240</out>"))).Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+
+	workArea, ok := WorkArea(timeline)
+	if !ok {
+		t.Fatal("Expected a work area")
+	}
+	if workArea.StartTime().Value() != 48 || workArea.Duration().Value() != 192 || workArea.StartTime().Rate() != 24 {
+		t.Errorf("Expected work area of 192 frames from frame 48 at 24 fps, got %v", workArea)
+	}
+
+	in, out := encodeWorkArea(t, timeline, EncodeOptions{})
+	if in == nil || out == nil || *in != 48 || *out != 240 {
+		t.Errorf("Expected in 48 and out 240, got %v and %v", in, out)
+	}
+
+	// Marks follow the sequence to another rate
+	in, out = encodeWorkArea(t, timeline, EncodeOptions{ForcedRate: &Rate{Timebase: 48}})
+	if in == nil || out == nil || *in != 96 || *out != 480 {
+		t.Errorf("Expected in 96 and out 480 at 48 fps, got %v and %v", in, out)
+	}
+}
+
+func TestWorkAreaNotSet(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(workAreaXML("<in>-1</in>\n    <out>240</out>"))).Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+
+	workArea := timeline.Metadata()["fcp7xml_work_area"].(gotio.AnyDictionary)
+	if _, ok := workArea["in"]; ok {
+		t.Errorf("Expected no in mark, got %v", workArea["in"])
+	}
+	if _, ok := WorkArea(timeline); ok {
+		t.Error("Expected no work area without an in mark")
+	}
+
+	in, out := encodeWorkArea(t, timeline, EncodeOptions{})
+	if in == nil || out == nil || *in != -1 || *out != 240 {
+		t.Errorf("Expected in -1 and out 240, got %v and %v", in, out)
+	}
+}
+
+func TestWorkAreaAbsent(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(workAreaXML(""))).Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if _, ok := timeline.Metadata()["fcp7xml_work_area"]; ok {
+		t.Error("Expected no fcp7xml_work_area metadata")
+	}
+
+	in, out := encodeWorkArea(t, timeline, EncodeOptions{})
+	if in != nil || out != nil {
+		t.Errorf("Expected no in or out, got %v and %v", in, out)
+	}
+}